@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	tlsutils "github.com/0xReLogic/Charon/internal/tls"
+)
+
+const certsUsage = `Usage: charon certs <command> [flags]
+
+Commands:
+  init    generate the CA, server and client certificates (existing files are kept)
+  info    print subjects, SANs and expiry of the certificates
+  rotate  regenerate the server and client certificates (--ca also regenerates the CA)
+`
+
+// runCerts implements the "charon certs" subcommands and returns the exit code
+func runCerts(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, certsUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("certs "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dir := fs.String("dir", "./certs", "Certificate directory")
+	rotateCA := false
+	if args[0] == "rotate" {
+		fs.BoolVar(&rotateCA, "ca", false, "Also regenerate the CA (invalidates all issued certificates)")
+	}
+
+	switch args[0] {
+	case "init", "info", "rotate":
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+	default:
+		fmt.Fprintf(stderr, "unknown certs command %q\n\n%s", args[0], certsUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "init":
+		_, err = tlsutils.NewCertManager(*dir)
+		if err == nil {
+			fmt.Fprintf(stdout, "Certificates ready in %s\n", *dir)
+		}
+	case "rotate":
+		_, err = tlsutils.RotateCerts(*dir, rotateCA)
+		if err == nil {
+			fmt.Fprintf(stdout, "Certificates rotated in %s (ca=%t)\n", *dir, rotateCA)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "certs %s: %v\n", args[0], err)
+		return 1
+	}
+	return printCertInfo(*dir, stdout, stderr)
+}
+
+func printCertInfo(dir string, stdout, stderr io.Writer) int {
+	infos, err := tlsutils.InspectCerts(dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "certs info: %v\n", err)
+		return 1
+	}
+	now := time.Now()
+	for _, c := range infos {
+		fmt.Fprintf(stdout, "%s (%s)\n", c.Name, c.Path)
+		fmt.Fprintf(stdout, "  subject:  %s\n", c.Subject)
+		fmt.Fprintf(stdout, "  issuer:   %s\n", c.Issuer)
+		fmt.Fprintf(stdout, "  serial:   %s\n", c.Serial)
+		if sans := append(append([]string(nil), c.DNSNames...), c.IPs...); len(sans) > 0 {
+			fmt.Fprintf(stdout, "  sans:     %s\n", strings.Join(sans, ", "))
+		}
+		status := fmt.Sprintf("expires in %s", c.NotAfter.Sub(now).Round(time.Hour))
+		if now.After(c.NotAfter) {
+			status = "EXPIRED"
+		}
+		fmt.Fprintf(stdout, "  valid:    %s .. %s (%s)\n", c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339), status)
+	}
+	return 0
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -9,264 +10,39 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
-	"strings"
-	"sync"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus/promauto"
-
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/concurrency"
 	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/ipfilter"
 	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/metrics"
 	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/proxyproto"
 	"github.com/0xReLogic/Charon/internal/ratelimit"
 	"github.com/0xReLogic/Charon/internal/registry"
+	"github.com/0xReLogic/Charon/internal/routing"
 	tlsutils "github.com/0xReLogic/Charon/internal/tls"
 	"github.com/0xReLogic/Charon/internal/tracing"
-	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
-var upstreamHealth = promauto.NewGaugeVec(prometheus.GaugeOpts{
-	Name: "charon_upstream_health",
-	Help: "Upstream health status",
-}, []string{"service", "upstream"})
-
-var breakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
-	Name: "charon_circuit_breaker_transitions_total",
-	Help: "Circuit breaker state transitions",
-}, []string{"upstream", "to_state"})
-
-// simple round-robin balancer with passive health (cooldown on failure)
-type rrBalancer struct {
-	mu        sync.Mutex
-	rrIdx     map[string]int       // per-service round-robin index
-	downUntil map[string]time.Time // addr -> expiry
-	healthy   map[string]bool      // addr -> health
-	services  map[string][]string  // service -> last seen addrs
-	coolDown  time.Duration
-	interval  time.Duration
-	started   bool
-
-	// circuit breaker per upstream
-	cb               map[string]*cbState
-	failureThreshold int
-	openDuration     time.Duration
-}
-
-type cbState struct {
-	state        int // 0=closed,1=open,2=half-open
-	failures     int
-	openUntil    time.Time
-	trialAllowed bool
-}
-
-func newRRBalancer(coolDown, interval time.Duration, failureThreshold int, openDuration time.Duration) *rrBalancer {
-	return &rrBalancer{rrIdx: map[string]int{}, downUntil: map[string]time.Time{}, healthy: map[string]bool{}, services: map[string][]string{}, coolDown: coolDown, interval: interval, cb: map[string]*cbState{}, failureThreshold: failureThreshold, openDuration: openDuration}
-}
-
-func (b *rrBalancer) markFailure(addr string) {
-	b.mu.Lock()
-	b.downUntil[addr] = time.Now().Add(b.coolDown)
-	b.healthy[addr] = false
-	// update health gauges for all services that include this addr
-	for svc, addrs := range b.services {
-		for _, a := range addrs {
-			if a == addr {
-				upstreamHealth.WithLabelValues(svc, addr).Set(0)
-			}
-		}
-	}
-	logging.GetLogger().Info("health_passive_down",
-		zap.String("upstream", addr),
-		zap.Duration("cooldown", b.coolDown),
-	)
-
-	// circuit breaker failure accounting
-	now := time.Now()
-	s := b.cb[addr]
-	if s == nil {
-		s = &cbState{}
-		b.cb[addr] = s
-	}
-	s.failures++
-	switch s.state {
-	case 0: // closed
-		if s.failures >= b.failureThreshold {
-			s.state = 1 // open
-			s.openUntil = now.Add(b.openDuration)
-			s.trialAllowed = false
-			logging.LogCircuitBreaker(addr, "OPEN", fmt.Sprintf("failures=%d", s.failures))
-			breakerTransitions.WithLabelValues(addr, "open").Inc()
-		}
-	case 2: // half-open
-		// failure in half-open -> go OPEN again
-		s.state = 1
-		s.openUntil = now.Add(b.openDuration)
-		s.trialAllowed = false
-		logging.LogCircuitBreaker(addr, "RE-OPEN", "half-open failure")
-		breakerTransitions.WithLabelValues(addr, "open").Inc()
-	}
-	b.mu.Unlock()
-}
-
-func (b *rrBalancer) markSuccess(addr string) {
-	b.mu.Lock()
-	s := b.cb[addr]
-	if s == nil {
-		s = &cbState{}
-		b.cb[addr] = s
-	}
-	s.failures = 0
-	if s.state == 2 { // half-open -> close on success
-		s.state = 0
-		s.trialAllowed = false
-		logging.LogCircuitBreaker(addr, "CLOSE", "half-open success")
-		breakerTransitions.WithLabelValues(addr, "closed").Inc()
-	}
-	// if open and window elapsed, keep as open until selection path transitions it to half-open
-	b.mu.Unlock()
-}
-
-func (b *rrBalancer) setServiceAddrs(service string, addrs []string) {
-	b.mu.Lock()
-	b.services[service] = append([]string(nil), addrs...)
-	if !b.started {
-		b.started = true
-		interval := b.interval
-		if interval <= 0 {
-			interval = 5 * time.Second
-		}
-		go b.healthLoop(interval)
-	}
-	b.mu.Unlock()
-}
-
-func (b *rrBalancer) healthLoop(interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-	for range ticker.C {
-		// snapshot services map
-		b.mu.Lock()
-		snapshot := make(map[string][]string, len(b.services))
-		for svc, addrs := range b.services {
-			snapshot[svc] = append([]string(nil), addrs...)
-		}
-		b.mu.Unlock()
-
-		for svc, addrs := range snapshot {
-			for _, addr := range addrs {
-				// simple TCP health check
-				conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
-				ok := err == nil
-				if ok {
-					_ = conn.Close()
-				}
-				b.mu.Lock()
-				prev, had := b.healthy[addr]
-				b.healthy[addr] = ok
-				// If back healthy, clear passive cooldown early
-				if ok {
-					delete(b.downUntil, addr)
-				}
-				b.mu.Unlock()
-
-				// update gauge and log on change or first sight
-				val := 0.0
-				state := "DOWN"
-				if ok {
-					val = 1.0
-					state = "UP"
-				}
-				upstreamHealth.WithLabelValues(svc, addr).Set(val)
-				if !had || prev != ok {
-					logging.LogHealthChange(svc, addr, state)
-				}
-			}
-		}
-	}
-}
+// acmeChallengeAddr serves ACME HTTP-01 challenges, which Let's Encrypt only sends to port 80
+const acmeChallengeAddr = ":80"
 
-func (b *rrBalancer) next(service string, addrs []string) string {
-	n := len(addrs)
-	if n == 0 {
-		return ""
-	}
-	now := time.Now()
-	b.mu.Lock()
-	start := b.rrIdx[service]
-	// First pass: prefer healthy and not in cooldown
-	for i := 0; i < n; i++ {
-		idx := (start + i) % n
-		addr := addrs[idx]
-		if until, ok := b.downUntil[addr]; ok && now.Before(until) {
-			continue
-		}
-		// circuit breaker: handle open/half-open
-		if s, ok := b.cb[addr]; ok {
-			if s.state == 1 { // open
-				if now.After(s.openUntil) {
-					// transition to half-open, allow one trial
-					s.state = 2
-					s.trialAllowed = true
-					logging.LogCircuitBreaker(addr, "HALF-OPEN", "open window elapsed")
-					breakerTransitions.WithLabelValues(addr, "half_open").Inc()
-				} else {
-					continue
-				}
-			}
-			if s.state == 2 && !s.trialAllowed {
-				continue
-			}
-		}
-		if ok, has := b.healthy[addr]; has && !ok {
-			continue
-		}
-		b.rrIdx[service] = (idx + 1) % n
-		if s, ok := b.cb[addr]; ok && s.state == 2 {
-			// consume the single trial
-			s.trialAllowed = false
-		}
-		b.mu.Unlock()
-		return addr
-	}
-	// Second pass: allow unknown health but skip cooldown
-	for i := 0; i < n; i++ {
-		idx := (start + i) % n
-		addr := addrs[idx]
-		if until, ok := b.downUntil[addr]; ok && now.Before(until) {
-			continue
-		}
-		if s, ok := b.cb[addr]; ok {
-			if s.state == 1 {
-				if now.After(s.openUntil) {
-					s.state = 2
-					s.trialAllowed = true
-					logging.LogCircuitBreaker(addr, "HALF-OPEN", "second pass open window elapsed")
-					breakerTransitions.WithLabelValues(addr, "half_open").Inc()
-				} else {
-					continue
-				}
-			}
-			if s.state == 2 && !s.trialAllowed {
-				continue
-			}
-		}
-		b.rrIdx[service] = (idx + 1) % n
-		if s, ok := b.cb[addr]; ok && s.state == 2 {
-			s.trialAllowed = false
-		}
-		b.mu.Unlock()
-		return addr
+func main() {
+	// Certificate management subcommands (charon certs init|info|rotate)
+	if len(os.Args) > 1 && os.Args[1] == "certs" {
+		os.Exit(runCerts(os.Args[2:], os.Stdout, os.Stderr))
 	}
-	// All are on cooldown; pick next anyway
-	pick := addrs[start%n]
-	b.rrIdx[service] = (start + 1) % n
-	b.mu.Unlock()
-	return pick
-}
 
-func main() {
 	// Parse command line flags
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
 	flag.Parse()
@@ -294,23 +70,109 @@ func main() {
 
 	// Initialize tracing if enabled
 	if cfg.Tracing.Enabled {
-		shutdown, err := tracing.InitTracing(cfg.Tracing.ServiceName, cfg.Tracing.JaegerEndpoint)
+		opts := tracing.ExporterOptions{QueueSize: cfg.Tracing.QueueSize, SampleRate: cfg.Tracing.SampleRate}
+		if cfg.Tracing.ExportTimeout != "" {
+			if d, err := time.ParseDuration(cfg.Tracing.ExportTimeout); err == nil {
+				opts.ExportTimeout = d
+			}
+		}
+		shutdown, err := tracing.InitTracingWithOptions(cfg.Tracing.ServiceName, cfg.Tracing.JaegerEndpoint, opts)
 		if err != nil {
 			logging.LogError("Failed to initialize tracing", map[string]interface{}{
 				"error": err.Error(),
 			})
 		} else {
 			defer shutdown()
-			logging.LogInfo("Tracing initialized", map[string]interface{}{
+			fields := map[string]interface{}{
 				"service":  cfg.Tracing.ServiceName,
 				"endpoint": cfg.Tracing.JaegerEndpoint,
+			}
+			if r := cfg.Tracing.SampleRate; r != nil {
+				fields["sample_rate"] = *r
+			}
+			logging.LogInfo("Tracing initialized", fields)
+		}
+	}
+
+	// Mirror key metrics to StatsD/DogStatsD if configured
+	if cfg.Metrics.StatsD.Address != "" {
+		prefix := cfg.Metrics.StatsD.Prefix
+		if prefix == "" {
+			prefix = "charon"
+		}
+		statsd, err := metrics.NewStatsD(cfg.Metrics.StatsD.Address, prefix, cfg.Metrics.StatsD.Tags)
+		if err != nil {
+			logging.LogError("Failed to initialize StatsD sink", map[string]interface{}{
+				"error":   err.Error(),
+				"address": cfg.Metrics.StatsD.Address,
 			})
+		} else {
+			metrics.SetSink(statsd)
+			defer statsd.Close()
+			logging.LogInfo("StatsD metrics sink initialized", map[string]interface{}{
+				"address": cfg.Metrics.StatsD.Address,
+				"prefix":  prefix,
+			})
+		}
+	}
+	// Finer latency buckets for fast services; the values are checked by config.LoadConfig
+	if len(cfg.Metrics.LatencyBuckets) > 0 {
+		if err := proxy.SetLatencyBuckets(cfg.Metrics.LatencyBuckets); err != nil {
+			log.Fatalf("Invalid metrics.latency_buckets: %v", err)
 		}
 	}
 
-	// Initialize TLS certificate manager if enabled
+	// Initialize TLS certificate manager if enabled; ACME replaces the self-signed CA
+	switch cfg.TLS.Mode {
+	case "", "managed", "external":
+	default:
+		log.Fatalf("Unknown tls.mode %q (use managed or external)", cfg.TLS.Mode)
+	}
+	tlsOptions, err := tlsutils.ParseOptions(cfg.TLS.MinVersion, cfg.TLS.MaxVersion, cfg.TLS.CipherSuites)
+	if err != nil {
+		log.Fatalf("Invalid tls configuration: %v", err)
+	}
 	var certManager *tlsutils.CertManager
-	if cfg.TLS.Enabled {
+	var acmeManager *tlsutils.ACMEManager
+	if cfg.TLS.ACME.Enabled && !cfg.TLS.Enabled {
+		logging.LogWarn("tls.acme.enabled has no effect unless tls.enabled is set", nil)
+	}
+	if cfg.TLS.Enabled && cfg.TLS.ACME.Enabled {
+		cacheDir := cfg.TLS.ACME.CacheDir
+		if cacheDir == "" {
+			cacheDir = filepath.Join(cfg.TLS.CertDir, "acme")
+		}
+		var err error
+		acmeManager, err = tlsutils.NewACMEManager(cfg.TLS.ACME.Domains, cfg.TLS.ACME.Email, cacheDir, cfg.TLS.ACME.Staging)
+		if err != nil {
+			logging.LogError("Failed to initialize ACME manager", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		acmeManager.SetOptions(tlsOptions)
+		logging.LogInfo("ACME certificate manager initialized", map[string]interface{}{
+			"domains":   cfg.TLS.ACME.Domains,
+			"cache_dir": cacheDir,
+			"staging":   cfg.TLS.ACME.Staging,
+		})
+	} else if cfg.TLS.Enabled && cfg.TLS.Mode == "external" {
+		var err error
+		certManager, err = tlsutils.NewExternalCertManager(cfg.TLS.ServerCert, cfg.TLS.ServerKey, cfg.TLS.ClientCA)
+		if err != nil {
+			logging.LogError("Failed to load external certificates", map[string]interface{}{
+				"error":       err.Error(),
+				"server_cert": cfg.TLS.ServerCert,
+				"client_ca":   cfg.TLS.ClientCA,
+			})
+			return
+		}
+		certManager.SetOptions(tlsOptions)
+		logging.LogInfo("External TLS certificates loaded", map[string]interface{}{
+			"server_cert": cfg.TLS.ServerCert,
+			"mtls":        cfg.TLS.ClientCA != "",
+		})
+	} else if cfg.TLS.Enabled {
 		var err error
 		certManager, err = tlsutils.NewCertManager(cfg.TLS.CertDir)
 		if err != nil {
@@ -320,68 +182,215 @@ func main() {
 			})
 			return
 		}
+		certManager.SetOptions(tlsOptions)
 		logging.LogInfo("TLS certificate manager initialized", map[string]interface{}{
 			"cert_dir": cfg.TLS.CertDir,
 		})
 	}
 
-	// Parse circuit breaker config with defaults
-	cbThreshold := 3
-	cbDuration := 20 * time.Second
-	if cfg.CircuitBreaker.FailureThreshold > 0 {
-		cbThreshold = cfg.CircuitBreaker.FailureThreshold
+	// init balancer with circuit breaker and health check settings. Upstreams
+	// that leave every service also lose their connection pools.
+	var httpProxy *proxy.HTTPProxy
+	balOpts := balancerOptions(cfg)
+	balOpts.OnForget = func(addr string) {
+		if httpProxy != nil {
+			httpProxy.ForgetUpstream(addr)
+		}
 	}
-	if cfg.CircuitBreaker.OpenDuration != "" {
-		if d, err := time.ParseDuration(cfg.CircuitBreaker.OpenDuration); err == nil {
-			cbDuration = d
+	bal := balancer.New(balOpts)
+
+	// Session affinity: pick upstreams by hashing a request attribute.
+	// p2c picks the less busy of two random upstreams instead, latency_ewma the fastest.
+	var hashOn func(r *http.Request) string
+	p2c, latencyEWMA := false, false
+	switch cfg.LoadBalancing.Strategy {
+	case "", "round_robin":
+	case "consistent_hash":
+		hashOn, err = balancer.ParseHashOn(cfg.LoadBalancing.HashOn)
+		if err != nil {
+			log.Fatalf("Invalid load_balancing.hash_on: %v", err)
 		}
+	case "p2c":
+		p2c = true
+	case "latency_ewma":
+		latencyEWMA = true
+	default:
+		log.Fatalf("Unknown load_balancing.strategy %q (use round_robin, consistent_hash, p2c or latency_ewma)", cfg.LoadBalancing.Strategy)
 	}
 
-	// init balancer (30s cooldown, 5s health interval)
-	bal := newRRBalancer(30*time.Second, 5*time.Second, cbThreshold, cbDuration)
+	// Flag ambiguous routing settings before traffic starts flowing
+	for _, w := range cfg.RoutingWarnings() {
+		if cfg.StrictConfig {
+			log.Fatalf("Ambiguous routing configuration (strict_config): %s", w)
+		}
+		logging.LogWarn("Ambiguous routing configuration", map[string]interface{}{
+			"warning": w,
+		})
+	}
+	logging.LogInfo("Routing configuration", map[string]interface{}{
+		"mode":            cfg.RoutingMode(),
+		"routes":          len(cfg.Routes),
+		"default_service": cfg.TargetServiceName,
+		"static_addr":     cfg.TargetServiceAddr,
+		"host_as_service": cfg.HostAsService.Enabled,
+	})
+
+	// Sticky sessions: a cookie keeps a client on the upstream that served it
+	var sticky *proxy.StickyPolicy
+	if sc := cfg.LoadBalancing.Sticky; sc.Enabled {
+		sticky = &proxy.StickyPolicy{Cookie: sc.CookieName, Secret: []byte(sc.Secret)}
+		if sc.MaxAge != "" {
+			sticky.MaxAge, _ = time.ParseDuration(sc.MaxAge)
+		}
+	}
 
-	// Create HTTP reverse proxy with per-request resolver (Phase 3 + advanced routing)
-	resolver := func(r *http.Request) (*url.URL, error) {
-		// Try advanced routing rules first (host/path)
-		var serviceName string
-		if len(cfg.Routes) > 0 {
-			host := r.Host
-			if i := strings.Index(host, ":"); i >= 0 { // strip port
-				host = host[:i]
+	// Service discovery: registry file, DNS SRV records or admin API registrations
+	var dynamicRegistry *registry.DynamicRegistry
+	if cfg.Registry.Type == "api" {
+		dynamicRegistry = registry.NewDynamicRegistry()
+		dynamicRegistry.StartExpiry(time.Second)
+		defer dynamicRegistry.Close()
+	}
+	lookupEndpoints, err := newEndpointLookup(cfg, dynamicRegistry)
+	if err != nil {
+		log.Fatalf("Invalid registry configuration: %v", err)
+	}
+	if cfg.Registry.Type == "dns" {
+		logging.LogInfo("DNS SRV service discovery enabled", map[string]interface{}{
+			"namespace":  cfg.Registry.Namespace,
+			"domain":     cfg.Registry.Domain,
+			"dns_server": cfg.Registry.DNSServer,
+		})
+	}
+
+	// Route matcher shared by the proxy handler and the resolver
+	router, err := newRouter(cfg, lookupEndpoints)
+	if err != nil {
+		log.Fatalf("Invalid routing configuration: %v", err)
+	}
+	// The live config is swapped on SIGHUP; the resolver reads it per request
+	var live atomic.Value
+	live.Store(&liveConfig{cfg: cfg, router: router})
+	// gRPC clients without TLS need cleartext HTTP/2 on the listener
+	grpcEnabled := false
+	for name, svc := range cfg.Services {
+		switch svc.Protocol {
+		case "", "http":
+		case proxy.ProtocolGRPC:
+			grpcEnabled = true
+		default:
+			log.Fatalf("Service %q: unknown protocol %q (use http or grpc)", name, svc.Protocol)
+		}
+	}
+	for _, rule := range cfg.Routes {
+		grpcEnabled = grpcEnabled || rule.Protocol == proxy.ProtocolGRPC
+	}
+
+	// Optionally expand hostname registry entries into per-IP targets
+	var dnsExpander *registry.DNSExpander
+	if cfg.Registry.ExpandDNS {
+		interval := 30 * time.Second
+		if cfg.Registry.DNSRefreshInterval != "" {
+			if d, err := time.ParseDuration(cfg.Registry.DNSRefreshInterval); err == nil {
+				interval = d
 			}
-			path := r.URL.Path
-			for _, rule := range cfg.Routes {
-				if rule.Host != "" && !strings.EqualFold(rule.Host, host) {
-					continue
-				}
-				if rule.PathPrefix != "" && !strings.HasPrefix(path, rule.PathPrefix) {
-					continue
+		}
+		dnsExpander = registry.NewDNSExpander(interval)
+		dnsExpander.Start()
+		defer dnsExpander.Close()
+	}
+
+	// serviceAddrs resolves the current addresses of a registry service and
+	// reports whether the registry assigns them weights
+	serviceAddrs := func(serviceName string) ([]string, bool, error) {
+		endpoints, err := lookupEndpoints(serviceName)
+		if err != nil {
+			return nil, false, err
+		}
+		var addrs []string
+		weights := map[string]int{}
+		weighted := false
+		for _, ep := range endpoints {
+			expanded := []string{ep.Addr}
+			if dnsExpander != nil {
+				expanded = dnsExpander.Expand(expanded)
+			}
+			for _, a := range expanded {
+				addrs = append(addrs, a)
+				weights[a] = ep.Weight // IPs expanded from a hostname entry inherit its weight
+			}
+			weighted = weighted || ep.Weighted
+		}
+		if !weighted {
+			weights = nil
+		}
+		// update balancer's service address list for active health checks;
+		// a no-op without locking unless the registry changed
+		bal.SyncService(serviceName, addrs, weights)
+		return addrs, weighted, nil
+	}
+
+	// pinned returns the upstream of addrs named by r's sticky cookie, if it is still usable
+	pinned := func(r *http.Request, serviceName string, addrs []string) string {
+		if sticky == nil {
+			return ""
+		}
+		token := sticky.Token(r, serviceName)
+		if token == "" {
+			return ""
+		}
+		for _, a := range addrs {
+			if u, err := proxy.UpstreamURL(a, cfg.TLS.UpstreamTLS); err == nil && sticky.UpstreamToken(serviceName, u.Host) == token {
+				if bal.Stick(serviceName, a) {
+					return a
 				}
-				serviceName = rule.ServiceName
-				break
+				return ""
 			}
 		}
+		return ""
+	}
 
-		// Fall back to global service name if no route matched
-		if serviceName == "" && cfg.TargetServiceName != "" {
-			serviceName = cfg.TargetServiceName
+	// pick chooses one of addrs for r with the configured balancing strategy.
+	// Hedges use it too, so they are spread the same way as first attempts.
+	pick := func(serviceName string, addrs []string, r *http.Request) string {
+		switch {
+		case hashOn != nil:
+			return bal.NextHash(serviceName, addrs, hashOn(r))
+		case p2c:
+			return bal.NextP2C(serviceName, addrs)
+		case latencyEWMA:
+			return bal.NextLatency(serviceName, addrs)
+		default:
+			return bal.Next(serviceName, addrs)
 		}
+	}
+
+	// Create HTTP reverse proxy with per-request resolver (Phase 3 + advanced routing)
+	resolver := func(r *http.Request) (*url.URL, error) {
+		// Prefer the routing decision made by the proxy handler (host/path rules)
+		m := routing.FromContext(r.Context())
+		if m == nil {
+			m = live.Load().(*liveConfig).router.Match(r)
+		}
+		serviceName := m.Service
 
 		var addr string
 		if serviceName != "" {
-			if cfg.RegistryFile == "" {
-				return nil, fmt.Errorf("registry_file is required when service-based routing is used")
-			}
-			addrs, err := registry.ResolveServiceAddresses(cfg.RegistryFile, serviceName)
+			addrs, weighted, err := serviceAddrs(serviceName)
 			if err != nil {
 				return nil, err
 			}
-			// update balancer's service address list for active health checks
-			bal.setServiceAddrs(serviceName, addrs)
-			if len(addrs) == 1 {
+			if m.Rule != nil && m.Rule.Fallback != nil && bal.BreakersOpen(addrs) {
+				return nil, proxy.ErrCircuitOpen // the handler serves the route's fallback
+			}
+			addr = pinned(r, serviceName, addrs)
+			switch {
+			case addr != "":
+				// the client stays on its sticky upstream
+			case len(addrs) == 1 && !weighted:
 				addr = addrs[0]
-			} else {
-				addr = bal.next(serviceName, addrs)
+			default:
+				addr = pick(serviceName, addrs, r)
 			}
 		} else {
 			// Fallback to static address if configured
@@ -393,24 +402,94 @@ func main() {
 		}
 
 		// Ensure URL has scheme - use HTTPS if upstream TLS is enabled
-		if !strings.HasPrefix(addr, "http://") && !strings.HasPrefix(addr, "https://") {
-			if cfg.TLS.UpstreamTLS {
-				addr = "https://" + addr
-			} else {
-				addr = "http://" + addr
-			}
+		return proxy.UpstreamURL(addr, cfg.TLS.UpstreamTLS)
+	}
+
+	retry := &proxy.RetryPolicy{
+		MaxRetries:    cfg.Retry.MaxRetries,
+		Statuses:      cfg.Retry.Statuses,
+		BudgetPercent: cfg.Retry.BudgetPercent,
+	}
+	// checked by config.LoadConfig; unset ones parse to 0 (default)
+	retry.Backoff, _ = time.ParseDuration(cfg.Retry.Backoff)
+	retry.BackoffMax, _ = time.ParseDuration(cfg.Retry.BackoffMax)
+
+	// Hedged requests go to a different upstream of the same service, picked like the first attempt.
+	// retry.hedge_after is shorthand for a single hedge after that delay.
+	hedgeCfg := cfg.Hedging
+	if cfg.Retry.HedgeAfter != "" {
+		hedgeCfg = config.HedgingConfig{Enabled: true, Delay: cfg.Retry.HedgeAfter, MaxHedges: 1}
+	}
+	var hedging *proxy.HedgePolicy
+	if hedgeCfg.Enabled {
+		delay := 100 * time.Millisecond
+		if hedgeCfg.Delay != "" {
+			delay, _ = time.ParseDuration(hedgeCfg.Delay) // checked by config.LoadConfig
+		}
+		hedging = &proxy.HedgePolicy{
+			Delay:         delay,
+			MaxHedges:     hedgeCfg.MaxHedges,
+			BudgetPercent: hedgeCfg.BudgetPercent,
+			Pick: func(r *http.Request, exclude []string) (*url.URL, error) {
+				m := routing.FromContext(r.Context())
+				if m == nil || m.Service == "" {
+					return nil, nil // a static target has nowhere else to go
+				}
+				addrs, _, err := serviceAddrs(m.Service)
+				if err != nil {
+					return nil, err
+				}
+				var remaining []string
+				for _, a := range addrs {
+					u, err := proxy.UpstreamURL(a, cfg.TLS.UpstreamTLS)
+					if err == nil && !slices.Contains(exclude, u.Host) {
+						remaining = append(remaining, a)
+					}
+				}
+				if len(remaining) == 0 {
+					return nil, nil
+				}
+				return proxy.UpstreamURL(pick(m.Service, remaining, r), cfg.TLS.UpstreamTLS)
+			},
 		}
-		return url.Parse(addr)
+		logging.LogInfo("Request hedging enabled", map[string]interface{}{
+			"delay":      delay.String(),
+			"max_hedges": hedgeCfg.MaxHedges,
+		})
 	}
 
-	// Setup rate limiting if configured
-	var rateLimiter *ratelimit.RateLimiter
-	if cfg.RateLimit.RequestsPerSecond > 0 {
-		rateLimiter = ratelimit.NewRateLimiter(cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.BurstSize)
+	// Setup rate limiting if configured: the legacy per-route limit plus any extra rules.
+	// The policy always exists so a reload can add limits later.
+	dimensions, err := ratelimit.Dimensions(cfg.RateLimit)
+	if err != nil {
+		log.Fatalf("Invalid rate limiting configuration: %v", err)
+	}
+	rateLimits := ratelimit.NewPolicy(dimensions...)
+	if len(dimensions) > 0 {
 		logging.LogInfo("Rate limiting initialized", map[string]interface{}{
-			"rps":    cfg.RateLimit.RequestsPerSecond,
-			"burst":  cfg.RateLimit.BurstSize,
-			"routes": len(cfg.RateLimit.Routes),
+			"rps":        cfg.RateLimit.RequestsPerSecond,
+			"burst":      cfg.RateLimit.BurstSize,
+			"routes":     len(cfg.RateLimit.Routes),
+			"dimensions": len(dimensions),
+		})
+	}
+
+	// API key authentication (optional)
+	var apiKeys *auth.APIKeyAuth
+	if cfg.Auth.APIKey.Enabled {
+		keyCfg := cfg.Auth.APIKey
+		keys := make([]auth.Key, len(keyCfg.Keys))
+		for i, k := range keyCfg.Keys {
+			keys[i] = auth.Key{Name: k.Name, Key: k.Key, Hash: k.Hash, Tier: k.Tier}
+		}
+		apiKeys, err = auth.NewAPIKeyAuth(keyCfg.Header, keyCfg.QueryParam, keyCfg.Routes, keys, keyCfg.KeysFile)
+		if err != nil {
+			log.Fatalf("Invalid api key configuration: %v", err)
+		}
+		logging.LogInfo("API key authentication enabled", map[string]interface{}{
+			"keys":   len(keyCfg.Keys),
+			"file":   keyCfg.KeysFile,
+			"routes": len(keyCfg.Routes),
 		})
 	}
 
@@ -420,16 +499,19 @@ func main() {
 		listenAddr = ":" + cfg.TLS.ServerPort
 	}
 
-	httpProxy := &proxy.HTTPProxy{
+	httpProxy = &proxy.HTTPProxy{
 		ListenAddr: listenAddr,
 		Resolver:   resolver,
-		OnUpstreamError: func(host string) {
+		Router:     router,
+		Services:   cfg.Services,
+		H2C:        grpcEnabled,
+		OnUpstreamError: func(service, host string) {
 			// Log upstream error for monitoring
 			logging.LogInfo("Upstream error", map[string]interface{}{
 				"host": host,
 			})
 			if host != "" {
-				bal.markFailure(host)
+				bal.MarkServiceFailure(service, host)
 			}
 		},
 		OnUpstreamSuccess: func(host string) {
@@ -438,15 +520,199 @@ func main() {
 				"host": host,
 			})
 			if host != "" {
-				bal.markSuccess(host)
+				bal.MarkSuccess(host)
 			}
 		},
-		RateLimiter:    rateLimiter,
-		UseUpstreamTLS: cfg.TLS.UpstreamTLS,
+		OnUpstreamNeutral: func(host string) {
+			if host != "" {
+				bal.MarkNeutral(host)
+			}
+		},
+		RateLimits:          rateLimits,
+		APIKeys:             apiKeys,
+		FailureClassifier:   newFailureClassifier(cfg),
+		RouteLabels:         cfg.Metrics.RouteLabels,
+		Hedging:             hedging,
+		Sticky:              sticky,
+		Retry:               retry,
+		Compression:         &cfg.Compression,
+		MaxRequestBodyBytes: cfg.MaxRequestBodyBytes,
+		CacheMaxEntryBytes:  cfg.Cache.MaxEntryBytes,
+		CacheMaxSizeBytes:   cfg.Cache.MaxSizeBytes,
+		UseUpstreamTLS:      cfg.TLS.UpstreamTLS,
+		PreserveHost:        cfg.PreserveHost,
+		TraceHeaders:        tracing.NewHeaderRecorder(cfg.Tracing.HeaderAttributes, cfg.TraceRedactHeaders()),
+	}
+
+	if p2c {
+		// p2c compares the requests each upstream is serving
+		httpProxy.OnUpstreamStart = bal.Acquire
+		httpProxy.OnUpstreamDone = bal.Release
+	}
+	if latencyEWMA {
+		httpProxy.OnUpstreamComplete = bal.RecordLatency
+		httpProxy.OnUpstreamFailure = bal.RecordFailureLatency
+	}
+
+	httpProxy.MaxConcurrentRequests = cfg.MaxConcurrentRequests
+	// Upstream connection pool; durations are checked by config.LoadConfig and unset ones parse to 0 (default)
+	httpProxy.Transport = proxy.TransportSettings{
+		MaxIdleConns:        cfg.Transport.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.Transport.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.Transport.MaxConnsPerHost,
+		BufferSize:          cfg.Transport.BufferSize,
+	}
+	httpProxy.Transport.DialTimeout, _ = time.ParseDuration(cfg.Transport.DialTimeout)
+	httpProxy.Transport.TLSHandshakeTimeout, _ = time.ParseDuration(cfg.Transport.TLSHandshakeTimeout)
+	httpProxy.Transport.ResponseHeaderTimeout, _ = time.ParseDuration(cfg.Transport.ResponseHeaderTimeout)
+	httpProxy.Transport.IdleConnTimeout, _ = time.ParseDuration(cfg.Transport.IdleConnTimeout)
+	// Client timeouts, checked by config.LoadConfig like the transport durations
+	httpProxy.Timeouts.ReadHeaderTimeout, _ = time.ParseDuration(cfg.Server.ReadHeaderTimeout)
+	httpProxy.Timeouts.ReadTimeout, _ = time.ParseDuration(cfg.Server.ReadTimeout)
+	httpProxy.Timeouts.WriteTimeout, _ = time.ParseDuration(cfg.Server.WriteTimeout)
+	httpProxy.Timeouts.IdleTimeout, _ = time.ParseDuration(cfg.Server.IdleTimeout)
+	// Upstream fingerprinting headers; X-Powered-By is dropped unless remove_headers is set
+	removeHeaders := cfg.Response.RemoveHeaders
+	if removeHeaders == nil {
+		removeHeaders = []string{"X-Powered-By"}
+	}
+	httpProxy.ResponseHeaders = &config.HeaderRulesConfig{Remove: removeHeaders, Set: cfg.Response.SetHeaders}
+	if cc := cfg.Concurrency; cc.Adaptive {
+		initial, minLimit, maxLimit := 20, 5, 1000
+		if cc.InitialLimit > 0 {
+			initial = cc.InitialLimit
+		}
+		if cc.MinLimit > 0 {
+			minLimit = cc.MinLimit
+		}
+		if cc.MaxLimit > 0 {
+			maxLimit = cc.MaxLimit
+		}
+		httpProxy.AdaptiveConcurrency = concurrency.NewAdaptiveLimiter(initial, minLimit, maxLimit)
+		logging.LogInfo("Adaptive concurrency limiting enabled", map[string]interface{}{
+			"initial_limit": initial,
+			"min_limit":     minLimit,
+			"max_limit":     maxLimit,
+		})
+	}
+	httpProxy.RequestIDHeader = cfg.RequestIDHeader
+	if httpProxy.RequestIDHeader == "" {
+		httpProxy.RequestIDHeader = proxy.DefaultRequestIDHeader
+	}
+
+	httpProxy.DefaultTimeout, _ = time.ParseDuration(cfg.DefaultTimeout) // checked by config.LoadConfig
+
+	// Recover client addresses from PROXY protocol headers on both listeners
+	var proxyProtocol *proxyproto.Options
+	if ppCfg := cfg.ProxyProtocol; ppCfg.Enabled {
+		proxyProtocol = &proxyproto.Options{}
+		switch ppCfg.Mode {
+		case "", "optional":
+		case "require":
+			proxyProtocol.Require = true
+		default:
+			log.Fatalf("Invalid proxy_protocol.mode %q (want optional or require)", ppCfg.Mode)
+		}
+		if ppCfg.HeaderTimeout != "" {
+			d, err := time.ParseDuration(ppCfg.HeaderTimeout)
+			if err != nil || d <= 0 {
+				log.Fatalf("Invalid proxy_protocol.header_timeout %q", ppCfg.HeaderTimeout)
+			}
+			proxyProtocol.HeaderTimeout = d
+		}
+		httpProxy.ProxyProtocol = proxyProtocol
+		logging.LogInfo("PROXY protocol enabled", map[string]interface{}{
+			"require": proxyProtocol.Require,
+		})
+	}
+
+	// Forwarded headers from these proxies describe the original request
+	httpProxy.TrustedProxies, err = proxy.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid trusted_proxies: %v", err)
+	}
+
+	// Client address allow/deny lists for the whole listener
+	httpProxy.AccessControl, err = ipfilter.New(cfg.AccessControl.Allow, cfg.AccessControl.Deny)
+	if err != nil {
+		log.Fatalf("Invalid access_control: %v", err)
+	}
+
+	// Access log in its own rotated file; operational logs stay on stdout
+	if alCfg := cfg.Logging.AccessLog; alCfg.Path != "" {
+		accessLog, err := logging.NewAccessLogger(logging.AccessLogOptions{
+			Path:       alCfg.Path,
+			Format:     alCfg.Format,
+			MaxSizeMB:  alCfg.MaxSizeMB,
+			MaxBackups: alCfg.MaxBackups,
+			MaxAgeDays: alCfg.MaxAgeDays,
+		})
+		if err != nil {
+			log.Fatalf("Failed to open access log: %v", err)
+		}
+		defer func() { _ = accessLog.Close() }()
+		httpProxy.AccessLog = accessLog
+		logging.LogInfo("Access log enabled", map[string]interface{}{
+			"path":   alCfg.Path,
+			"format": alCfg.Format,
+		})
+	}
+
+	// /readyz fails until every routed service has a healthy upstream
+	httpProxy.Readiness = readiness(&live, httpProxy, bal, serviceAddrs)
+
+	// Admin API for runtime operations (disabled by default). With admin.listen_addr it
+	// moves to its own listener together with /metrics, /healthz, /readyz and /config.
+	var adminListener *admin.Listener
+	if cfg.Admin.Enabled {
+		audit, err := admin.NewAuditLogger(cfg.Admin.AuditLog)
+		if err != nil {
+			log.Fatalf("Failed to open admin audit log: %v", err)
+		}
+		defer func() { _ = audit.Sync() }()
+		adminServer := &admin.Server{Drainer: httpProxy, Audit: audit, RateLimiter: rateLimits, Breakers: bal, Upstreams: bal, APIKeys: apiKeys, APIKeyTier: cfg.Admin.APIKeyTier}
+		if dynamicRegistry != nil {
+			adminServer.Registry = dynamicRegistry
+		}
+		adminAddr := listenAddr
+		if cfg.Admin.ListenAddr != "" {
+			adminAddr = cfg.Admin.ListenAddr
+			adminListener = &admin.Listener{
+				Addr:   adminAddr,
+				Admin:  adminServer,
+				Ready:  httpProxy.Readiness,
+				Config: func() interface{} { return live.Load().(*liveConfig).cfg.Redacted() },
+			}
+			httpProxy.DisableMetricsEndpoint = true
+		} else {
+			httpProxy.Admin = adminServer
+		}
+		logging.LogInfo("Admin API enabled", map[string]interface{}{
+			"listen_addr": adminAddr,
+			"audit_log":   cfg.Admin.AuditLog,
+		})
+	} else if cfg.Admin.ListenAddr != "" {
+		logging.LogWarn("admin.listen_addr has no effect unless admin.enabled is set", nil)
 	}
 
 	// Configure TLS if enabled
-	if cfg.TLS.Enabled && certManager != nil {
+	if acmeManager != nil {
+		httpProxy.TLSConfig = acmeManager.GetServerTLSConfig()
+		go func() {
+			// HTTP-01 challenges must be answered on port 80; other requests redirect to HTTPS
+			err := http.ListenAndServe(acmeChallengeAddr, acmeManager.HTTPHandler(nil))
+			logging.LogError("ACME challenge listener stopped; certificates cannot be issued or renewed", map[string]interface{}{
+				"address": acmeChallengeAddr,
+				"error":   err.Error(),
+				"hint":    "port 80 must be free and binding it usually needs root or CAP_NET_BIND_SERVICE",
+			})
+		}()
+		logging.LogInfo("ACME TLS configuration applied to proxy", map[string]interface{}{
+			"domains":        acmeManager.Domains(),
+			"challenge_addr": acmeChallengeAddr,
+			"listen_addr":    listenAddr,
+		})
+	} else if cfg.TLS.Enabled && certManager != nil {
 		httpProxy.TLSConfig = certManager.GetServerTLSConfig()
 		httpProxy.ClientTLS = certManager.GetClientTLSConfig()
 
@@ -457,23 +723,174 @@ func main() {
 		})
 	}
 
+	// force_https serves listen_port in plaintext, redirecting everything to the TLS listener
+	if cfg.ForceHTTPS {
+		switch {
+		case !cfg.TLS.Enabled:
+			logging.LogWarn("force_https has no effect unless tls.enabled is set", nil)
+		case cfg.TLS.ServerPort == "" || cfg.TLS.ServerPort == cfg.ListenPort:
+			logging.LogWarn("force_https needs a tls.server_port different from listen_port, which then serves the redirects", nil)
+		case acmeManager != nil && ":"+cfg.ListenPort == acmeChallengeAddr:
+			// The ACME challenge listener already redirects port 80 to HTTPS
+		default:
+			redirectAddr := ":" + cfg.ListenPort
+			go func() {
+				err := http.ListenAndServe(redirectAddr, proxy.HTTPSRedirect(cfg.TLS.ServerPort))
+				logging.LogError("HTTPS redirect listener stopped", map[string]interface{}{
+					"address": redirectAddr,
+					"error":   err.Error(),
+				})
+			}()
+			logging.LogInfo("Redirecting plaintext requests to HTTPS", map[string]interface{}{
+				"address":     redirectAddr,
+				"listen_addr": listenAddr,
+			})
+		}
+	}
+
+	// Forward the verified client certificate identity; inbound copies are always stripped
+	if idCfg := cfg.TLS.ClientIdentity; idCfg.Enabled {
+		httpProxy.ClientIdentity = &proxy.ClientIdentityHeaders{CN: idCfg.CNHeader, SAN: idCfg.SANHeader}
+		if !cfg.TLS.Enabled {
+			logging.LogWarn("tls.client_identity is enabled without tls.enabled; identity headers will only be stripped", nil)
+		}
+	}
+
+	// TCP proxy (started with the HTTP proxy)
+	var tcpProxy *proxy.TCPProxy
+	if cfg.TCP.ListenPort != "" {
+		tcpProxy = proxy.NewTCPProxy(":"+cfg.TCP.ListenPort, cfg.TCP.TargetAddr)
+		tcpProxy.ProtocolTargets = cfg.TCP.Sniff
+		tcpProxy.ProxyProtocol = proxyProtocol
+		tcpProxy.MaxConnections = cfg.TCP.MaxConnections
+		if service := cfg.TCP.Service; service != "" {
+			// Balance connections across the service's upstreams like HTTP requests.
+			// Without headers or cookies, consistent_hash hashes the client IP.
+			tcpProxy.Resolver = func(client net.Addr) (string, error) {
+				addrs, _, err := serviceAddrs(service)
+				if err != nil {
+					return "", err
+				}
+				var addr string
+				switch {
+				case hashOn != nil:
+					host, _, _ := net.SplitHostPort(client.String())
+					addr = bal.NextHash(service, addrs, host)
+				case p2c:
+					addr = bal.NextP2C(service, addrs)
+				case latencyEWMA:
+					addr = bal.NextLatency(service, addrs)
+				default:
+					addr = bal.Next(service, addrs)
+				}
+				if addr != "" {
+					return addr, nil
+				}
+				return "", fmt.Errorf("service %s has no available upstream", service)
+			}
+			tcpProxy.OnDialError = func(addr string) { bal.MarkServiceFailure(service, addr) }
+			tcpProxy.OnDialSuccess = bal.MarkSuccess
+			if p2c {
+				// p2c compares the connections each upstream is serving
+				tcpProxy.OnUpstreamStart = bal.Acquire
+				tcpProxy.OnUpstreamDone = bal.Release
+			}
+			if latencyEWMA {
+				tcpProxy.OnDialLatency = bal.RecordLatency
+			}
+			tcpProxy.DialAttempts = cfg.TCP.DialAttempts
+		}
+		if cfg.TCP.SniffTimeout != "" {
+			if d, err := time.ParseDuration(cfg.TCP.SniffTimeout); err == nil {
+				tcpProxy.SniffTimeout = d
+			}
+		}
+		if cfg.TCP.IdleTimeout != "" {
+			d, err := time.ParseDuration(cfg.TCP.IdleTimeout)
+			if err != nil || d <= 0 {
+				log.Fatalf("Invalid tcp.idle_timeout %q", cfg.TCP.IdleTimeout)
+			}
+			tcpProxy.IdleTimeout = d
+		}
+		if cfg.TCP.MaxConnectionDuration != "" {
+			d, err := time.ParseDuration(cfg.TCP.MaxConnectionDuration)
+			if err != nil || d <= 0 {
+				log.Fatalf("Invalid tcp.max_connection_duration %q", cfg.TCP.MaxConnectionDuration)
+			}
+			tcpProxy.MaxConnectionDuration = d
+		}
+	}
+
 	// Handle graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start proxy in a goroutine
+	// Reload the runtime-safe part of the config on SIGHUP
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	reload := &reloader{path: *configPath, live: &live, proxy: httpProxy, balancer: bal, rateLimits: rateLimits, lookup: lookupEndpoints, tcp: tcpProxy}
+	go func() {
+		for range hupCh {
+			if err := reload.reload(); err != nil {
+				logging.LogError("Configuration reload failed; keeping the current configuration", map[string]interface{}{
+					"error": err.Error(),
+					"path":  *configPath,
+				})
+			}
+		}
+	}()
+
+	// Start proxy in a goroutine and wait for the listener to be bound
 	go func() {
 		if err := httpProxy.Start(); err != nil {
 			logging.GetLogger().Fatal("failed_to_start_proxy", zap.Error(err))
 		}
 	}()
+	<-httpProxy.Started()
+
+	if adminListener != nil {
+		go func() {
+			if err := adminListener.Start(); err != nil {
+				logging.GetLogger().Fatal("failed_to_start_admin_listener", zap.Error(err))
+			}
+		}()
+	}
+
+	// Start TCP proxy if configured
+	if tcpProxy != nil {
+		go func() {
+			if err := tcpProxy.Start(); err != nil {
+				logging.GetLogger().Fatal("failed_to_start_tcp_proxy", zap.Error(err))
+			}
+		}()
+	}
 
 	logging.GetLogger().Info("charon_proxy_started",
 		zap.String("listen_port", cfg.ListenPort),
 		zap.String("target_service", cfg.TargetServiceName),
 	)
 
-	// Wait for termination signal
+	// Wait for termination signal, then let in-flight requests finish
 	<-sigCh
-	logging.GetLogger().Info("shutting_down")
+	shutdownTimeout := 30 * time.Second
+	if cfg.ShutdownTimeout != "" {
+		shutdownTimeout, _ = time.ParseDuration(cfg.ShutdownTimeout) // checked by config.LoadConfig
+	}
+	logging.GetLogger().Info("shutting_down", zap.Duration("timeout", shutdownTimeout))
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpProxy.Stop(ctx); err != nil {
+		logging.GetLogger().Error("shutdown_incomplete", zap.Error(err))
+	}
+	if adminListener != nil {
+		if err := adminListener.Shutdown(ctx); err != nil {
+			logging.GetLogger().Error("admin_shutdown_incomplete", zap.Error(err))
+		}
+	}
+	signal.Stop(hupCh)
+	bal.Close()
+	for _, d := range rateLimits.Dimensions() {
+		d.Limiter.Close()
+	}
+	logging.GetLogger().Info("shutdown_complete")
 }
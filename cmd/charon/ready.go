@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// readiness reports an instance as ready when it is not draining and every
+// service referenced by the live routes or tcp.service has at least one
+// upstream that passed its health checks. It reads the balancer's health
+// snapshot, so it is cheap enough for frequent probes.
+func readiness(live *atomic.Value, p *proxy.HTTPProxy, bal *balancer.Balancer, serviceAddrs func(string) ([]string, bool, error)) func() error {
+	return func() error {
+		if p.Draining() {
+			return errors.New("draining")
+		}
+		cfg := live.Load().(*liveConfig).cfg
+		services := []string{cfg.TargetServiceName, cfg.TCP.Service}
+		for _, rule := range cfg.Routes {
+			services = append(services, rule.Services()...)
+		}
+		snapshot := bal.ReadySnapshot()
+		for _, service := range services {
+			if service == "" {
+				continue
+			}
+			health, known := snapshot[service]
+			if !known {
+				// Not resolved by any request yet: hand its addresses to the
+				// balancer so health checks start probing them
+				if _, _, err := serviceAddrs(service); err != nil {
+					return fmt.Errorf("service %s: %w", service, err)
+				}
+				return fmt.Errorf("service %s has not been health checked yet", service)
+			}
+			if health.Healthy == 0 {
+				return fmt.Errorf("service %s has no healthy upstream (0/%d)", service, health.Total)
+			}
+		}
+		return nil
+	}
+}
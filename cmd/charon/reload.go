@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+	"github.com/0xReLogic/Charon/internal/registry"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+// liveConfig is the configuration in effect together with the router built from
+// it. It is replaced as a whole on reload.
+type liveConfig struct {
+	cfg    *config.Config
+	router *routing.Router
+}
+
+// endpointLookup resolves the endpoints of a service from the configured registry
+type endpointLookup func(service string) ([]registry.Endpoint, error)
+
+// newEndpointLookup returns the lookup for registry.type: the registry file
+// (default), DNS SRV records or instances registered through the admin API,
+// which are held in dynamic
+func newEndpointLookup(cfg *config.Config, dynamic *registry.DynamicRegistry) (endpointLookup, error) {
+	var resolver registry.Resolver
+	switch cfg.Registry.Type {
+	case "", "file":
+		resolver = registry.FileResolver(cfg.RegistryFile)
+	case "dns":
+		srv, err := registry.NewSRVResolver(cfg.Registry.Namespace, cfg.Registry.Domain, cfg.Registry.DNSServer)
+		if err != nil {
+			return nil, err
+		}
+		resolver = srv
+	case "api":
+		if !cfg.Admin.Enabled {
+			return nil, fmt.Errorf("registry.type api needs admin.enabled to accept registrations")
+		}
+		resolver = dynamic
+	default:
+		return nil, fmt.Errorf("unknown registry.type %q (use file, dns or api)", cfg.Registry.Type)
+	}
+	return resolver.ResolveServiceEndpoints, nil
+}
+
+// newRouter builds the route matcher for cfg
+func newRouter(cfg *config.Config, lookup endpointLookup) (*routing.Router, error) {
+	router, err := routing.New(cfg.Routes, cfg.TargetServiceName)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HostAsService.Enabled {
+		router.EnableHostAsService(cfg.HostAsService.StripSuffix, func(service string) bool {
+			_, err := lookup(service)
+			return err == nil
+		})
+	}
+	return router, nil
+}
+
+// balancerOptions derives the balancer settings from cfg (30s cooldown, 5s health interval)
+func balancerOptions(cfg *config.Config) balancer.Options {
+	cbThreshold := 3
+	cbDuration := 20 * time.Second
+	if cfg.CircuitBreaker.FailureThreshold > 0 {
+		cbThreshold = cfg.CircuitBreaker.FailureThreshold
+	}
+	// checked by config.LoadConfig
+	if cfg.CircuitBreaker.OpenDuration != "" {
+		cbDuration, _ = time.ParseDuration(cfg.CircuitBreaker.OpenDuration)
+	}
+	var serviceBreakers map[string]balancer.BreakerSettings
+	for service, o := range cfg.CircuitBreaker.Services {
+		settings := balancer.BreakerSettings{FailureThreshold: o.FailureThreshold}
+		if o.OpenDuration != "" {
+			settings.OpenDuration, _ = time.ParseDuration(o.OpenDuration)
+		}
+		if serviceBreakers == nil {
+			serviceBreakers = map[string]balancer.BreakerSettings{}
+		}
+		serviceBreakers[service] = settings
+	}
+	var window, maxOpen time.Duration
+	if cfg.CircuitBreaker.Window != "" {
+		window, _ = time.ParseDuration(cfg.CircuitBreaker.Window)
+	}
+	if cfg.CircuitBreaker.MaxOpenDuration != "" {
+		maxOpen, _ = time.ParseDuration(cfg.CircuitBreaker.MaxOpenDuration)
+	}
+	od := cfg.OutlierDetection
+	var outlierWindow, ejectionTime time.Duration
+	if od.Window != "" {
+		outlierWindow, _ = time.ParseDuration(od.Window)
+	}
+	if od.EjectionTime != "" {
+		ejectionTime, _ = time.ParseDuration(od.EjectionTime)
+	}
+	var halfLife time.Duration
+	if cfg.LoadBalancing.LatencyHalfLife != "" {
+		halfLife, _ = time.ParseDuration(cfg.LoadBalancing.LatencyHalfLife)
+	}
+	return balancer.Options{
+		CoolDown:                   30 * time.Second,
+		HealthInterval:             5 * time.Second,
+		FailureThreshold:           cbThreshold,
+		OpenDuration:               cbDuration,
+		ServiceBreakers:            serviceBreakers,
+		BreakerMode:                cfg.CircuitBreaker.Mode,
+		BreakerErrorThreshold:      cfg.CircuitBreaker.ErrorThreshold,
+		BreakerWindow:              window,
+		BreakerMinRequests:         cfg.CircuitBreaker.MinRequests,
+		BreakerHalfOpenMaxRequests: cfg.CircuitBreaker.HalfOpenMaxRequests,
+		BreakerSuccessThreshold:    cfg.CircuitBreaker.SuccessThreshold,
+		BreakerMaxOpenDuration:     maxOpen,
+		HealthLatencyWeighting:     cfg.LoadBalancing.HealthLatencyWeighting,
+		MinLatencyFactor:           cfg.LoadBalancing.MinLatencyFactor,
+		ErrorRateWeighting:         cfg.LoadBalancing.ErrorRateWeighting,
+		ErrorRateDecay:             cfg.LoadBalancing.ErrorRateDecay,
+		HealthMaxConcurrent:        cfg.HealthCheck.MaxConcurrent,
+		HealthyThreshold:           cfg.HealthCheck.HealthyThreshold,
+		UnhealthyThreshold:         cfg.HealthCheck.UnhealthyThreshold,
+		VirtualNodes:               cfg.LoadBalancing.VirtualNodes,
+		LatencyDecay:               cfg.LoadBalancing.LatencyDecay,
+		LatencyHalfLife:            halfLife,
+		OutlierDetection:           od.Enabled,
+		OutlierWindow:              outlierWindow,
+		OutlierMinRequests:         od.MinRequests,
+		OutlierErrorMargin:         od.ErrorMargin,
+		OutlierEjectionTime:        ejectionTime,
+		OutlierMaxEjectionPercent:  od.MaxEjectionPercent,
+	}
+}
+
+// newFailureClassifier builds the classifier of failure_classification and
+// circuit_breaker.trip_statuses
+func newFailureClassifier(cfg *config.Config) *proxy.FailureClassifier {
+	return proxy.NewFailureClassifier(cfg.FailureClassification).WithTripStatuses(cfg.CircuitBreaker.TripStatuses)
+}
+
+// reloader applies the runtime-safe subset of a changed config file on SIGHUP
+type reloader struct {
+	path       string
+	live       *atomic.Value // *liveConfig, read by the resolver per request
+	proxy      *proxy.HTTPProxy
+	balancer   *balancer.Balancer
+	rateLimits *ratelimit.Policy
+	lookup     endpointLookup
+	tcp        *proxy.TCPProxy // nil without tcp.listen_port
+}
+
+// reload re-reads the config file, validates it and applies routes, rate limits,
+// circuit breaker (trip statuses included), outlier detection, health check settings,
+// services' max_rps and the HTTP and TCP concurrency limits.
+// Nothing is applied if validation fails; other changed sections are reported as requiring a restart.
+func (rl *reloader) reload() error {
+	next, err := config.LoadConfig(rl.path)
+	if err != nil {
+		return err
+	}
+	cur := rl.live.Load().(*liveConfig).cfg
+	for _, w := range next.RoutingWarnings() {
+		if cur.StrictConfig {
+			return fmt.Errorf("ambiguous routing configuration (strict_config): %s", w)
+		}
+		logging.LogWarn("Ambiguous routing configuration", map[string]interface{}{
+			"warning": w,
+		})
+	}
+	applied := cur.WithReloadable(next)
+	router, err := newRouter(applied, rl.lookup)
+	if err != nil {
+		return fmt.Errorf("invalid routing configuration: %w", err)
+	}
+	// Unchanged rate limits keep their limiters, and with them the clients' buckets
+	var dimensions []*ratelimit.Dimension
+	rateLimitChanged := !reflect.DeepEqual(cur.RateLimit, applied.RateLimit)
+	if rateLimitChanged {
+		if dimensions, err = ratelimit.Dimensions(applied.RateLimit); err != nil {
+			return err
+		}
+	}
+
+	rl.live.Store(&liveConfig{cfg: applied, router: router})
+	rl.proxy.SetRouter(router)
+	if rateLimitChanged {
+		for _, d := range rl.rateLimits.SetDimensions(dimensions...) {
+			d.Limiter.Close()
+		}
+	}
+	rl.balancer.Reconfigure(balancerOptions(applied))
+	rl.proxy.SetFailureClassifier(newFailureClassifier(applied))
+	rl.proxy.SetMaxConcurrentRequests(applied.MaxConcurrentRequests)
+	rl.proxy.SetServiceLimits(applied.Services)
+	if rl.tcp != nil {
+		rl.tcp.SetMaxConnections(applied.TCP.MaxConnections)
+	}
+
+	for _, key := range cur.RestartRequired(next) {
+		logging.LogWarn("Config change requires restart", map[string]interface{}{
+			"key": key,
+		})
+	}
+	logging.LogInfo("Configuration reloaded", map[string]interface{}{
+		"routes":     len(applied.Routes),
+		"dimensions": len(rl.rateLimits.Dimensions()),
+	})
+	return nil
+}
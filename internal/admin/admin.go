@@ -0,0 +1,178 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+// Drainer is implemented by components that can be taken out of rotation
+// without shutting down (readiness fails while draining).
+type Drainer interface {
+	SetDraining(draining bool)
+	Draining() bool
+}
+
+// RateLimitSwitch is implemented by rate limiters that can be bypassed at runtime
+type RateLimitSwitch interface {
+	SetEnabled(enabled bool)
+	Enabled() bool
+}
+
+// Server exposes operational endpoints for controlling Charon at runtime.
+type Server struct {
+	// Rate limiter controlled by /admin/ratelimit (optional)
+	RateLimiter RateLimitSwitch
+	// Readiness flag controlled by /admin/drain and /admin/undrain (optional)
+	Drainer Drainer
+	// Audit trail for mutating endpoints (optional)
+	Audit *AuditLogger
+	// Dynamic service registry managed by /admin/registry (optional)
+	Registry ServiceRegistry
+	// Circuit breakers overridden by /admin/breaker (optional)
+	Breakers BreakerController
+	// Health table served by /admin/upstreams (optional)
+	Upstreams UpstreamReporter
+	// Require an API key for every admin endpoint (optional)
+	APIKeys *auth.APIKeyAuth
+	// Tier the API key must belong to (default: "admin")
+	APIKeyTier string
+}
+
+// Register adds the admin endpoints to mux
+func (s *Server) Register(mux *http.ServeMux) {
+	// Reads are only audited when they are denied
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.HandleFunc(pattern, s.authenticated("read", h))
+	}
+	audit := func(pattern, action string, h http.HandlerFunc, fields ...string) {
+		mux.HandleFunc(pattern, s.authenticated(action, s.audited(action, h, fields...)))
+	}
+	handle("GET /admin/ratelimit", s.getRateLimit)
+	audit("POST /admin/ratelimit", "ratelimit.set", s.setRateLimit, "enabled")
+	audit("POST /admin/drain", "drain", s.drain(true))
+	audit("POST /admin/undrain", "undrain", s.drain(false))
+	handle("GET /admin/loglevel", s.getLogLevel)
+	audit("PUT /admin/loglevel", "loglevel.set", s.setLogLevel, "level")
+	handle("GET /admin/registry/{service}", s.listInstances)
+	audit("POST /admin/registry/{service}", "registry.register", s.registerInstance, "address", "weight", "ttl")
+	audit("DELETE /admin/registry/{service}/{address}", "registry.deregister", s.deregisterInstance)
+	audit("POST /admin/breaker/{addr}/reset", "breaker.reset", s.resetBreaker)
+	audit("POST /admin/breaker/{addr}/trip", "breaker.trip", s.tripBreaker, "duration")
+	handle("GET /admin/upstreams", s.listUpstreams)
+}
+
+// authenticated requires a valid API key of the admin tier when API keys are
+// configured and records the key name as the audit principal. Rejected calls
+// are audited as denied under action.
+func (s *Server) authenticated(action string, next http.HandlerFunc) http.HandlerFunc {
+	if s.APIKeys == nil {
+		return next
+	}
+	tier := s.APIKeyTier
+	if tier == "" {
+		tier = "admin"
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _, ok := s.APIKeys.Authenticate(r)
+		if !ok {
+			s.Audit.Record(r, action, "", http.StatusUnauthorized)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		r = r.WithContext(WithPrincipal(r.Context(), id.Name))
+		if id.Tier != tier {
+			auth.Fail(auth.ReasonTier)
+			s.Audit.Record(r, action, "", http.StatusForbidden)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type drainState struct {
+	Draining bool `json:"draining"`
+}
+
+// drain returns a handler that sets the draining flag to draining
+func (s *Server) drain(draining bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Drainer == nil {
+			http.Error(w, "drain not supported", http.StatusNotFound)
+			return
+		}
+		s.Drainer.SetDraining(draining)
+		logging.LogInfo("Maintenance drain toggled via admin API", map[string]interface{}{
+			"draining": draining,
+			"remote":   r.RemoteAddr,
+		})
+		writeJSON(w, http.StatusOK, drainState{Draining: s.Drainer.Draining()})
+	}
+}
+
+type rateLimitState struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (s *Server) getRateLimit(w http.ResponseWriter, r *http.Request) {
+	if s.RateLimiter == nil {
+		http.Error(w, "rate limiting not configured", http.StatusNotFound)
+		return
+	}
+	enabled := s.RateLimiter.Enabled()
+	writeJSON(w, http.StatusOK, rateLimitState{Enabled: &enabled})
+}
+
+func (s *Server) setRateLimit(w http.ResponseWriter, r *http.Request) {
+	if s.RateLimiter == nil {
+		http.Error(w, "rate limiting not configured", http.StatusNotFound)
+		return
+	}
+	var req rateLimitState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, `expected JSON body {"enabled": true|false}`, http.StatusBadRequest)
+		return
+	}
+	s.RateLimiter.SetEnabled(*req.Enabled)
+	// Logged once here rather than for every request let through
+	fields := map[string]interface{}{
+		"enabled": *req.Enabled,
+		"remote":  r.RemoteAddr,
+	}
+	if *req.Enabled {
+		logging.LogInfo("Rate limiting enforced via admin API", fields)
+	} else {
+		logging.LogWarn("Rate limiting bypassed via admin API", fields)
+	}
+	writeJSON(w, http.StatusOK, req)
+}
+
+type logLevelState struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logLevelState{Level: logging.Level()})
+}
+
+func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevelState
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Level == "" {
+		http.Error(w, `expected JSON body {"level": "debug|info|warn|error"}`, http.StatusBadRequest)
+		return
+	}
+	if err := logging.SetLevel(req.Level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, logLevelState{Level: logging.Level()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+// BreakerController is implemented by balancers whose circuit breakers can be
+// overridden at runtime
+type BreakerController interface {
+	ResetBreaker(addr string) bool
+	TripBreaker(addr string, d time.Duration) bool
+}
+
+type breakerTrip struct {
+	Duration string `json:"duration"` // e.g. "10m"; default: the configured open_duration
+}
+
+type breakerState struct {
+	Upstream string `json:"upstream"`
+	State    string `json:"state"`
+	Duration string `json:"duration,omitempty"`
+}
+
+func (s *Server) resetBreaker(w http.ResponseWriter, r *http.Request) {
+	if s.Breakers == nil {
+		http.Error(w, "circuit breakers not available", http.StatusNotFound)
+		return
+	}
+	addr := r.PathValue("addr")
+	if !s.Breakers.ResetBreaker(addr) {
+		http.Error(w, fmt.Sprintf("%s is not an upstream of any service", addr), http.StatusNotFound)
+		return
+	}
+	logging.LogWarn("Circuit breaker reset via admin API", map[string]interface{}{
+		"upstream": addr,
+		"remote":   r.RemoteAddr,
+	})
+	writeJSON(w, http.StatusOK, breakerState{Upstream: addr, State: "closed"})
+}
+
+func (s *Server) tripBreaker(w http.ResponseWriter, r *http.Request) {
+	if s.Breakers == nil {
+		http.Error(w, "circuit breakers not available", http.StatusNotFound)
+		return
+	}
+	var req breakerTrip
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `expected JSON body {"duration": "10m"} or no body`, http.StatusBadRequest)
+		return
+	}
+	var d time.Duration
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+		d = parsed
+	}
+	addr := r.PathValue("addr")
+	if !s.Breakers.TripBreaker(addr, d) {
+		http.Error(w, fmt.Sprintf("%s is not an upstream of any service", addr), http.StatusNotFound)
+		return
+	}
+	logging.LogWarn("Circuit breaker tripped via admin API", map[string]interface{}{
+		"upstream": addr,
+		"duration": req.Duration,
+		"remote":   r.RemoteAddr,
+	})
+	writeJSON(w, http.StatusOK, breakerState{Upstream: addr, State: "open", Duration: req.Duration})
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Listener serves the operational endpoints on their own address, apart from
+// proxied traffic: /metrics, /healthz, /readyz, /config and the /admin API.
+type Listener struct {
+	Addr string
+	// Admin endpoints served under /admin (optional)
+	Admin *Server
+	// Ready reports why the instance is not ready, or nil when it is (optional)
+	Ready func() error
+	// Config returns the effective configuration with secrets redacted (optional)
+	Config func() interface{}
+
+	mu     sync.Mutex
+	server *http.Server
+}
+
+// Handler returns the mux with every operational endpoint
+func (l *Listener) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if l.Ready != nil {
+			if err := l.Ready(); err != nil {
+				http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready\n"))
+	})
+	mux.HandleFunc("GET /config", func(w http.ResponseWriter, r *http.Request) {
+		if l.Config == nil {
+			http.Error(w, "config not available", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, l.Config())
+	})
+	if l.Admin != nil {
+		l.Admin.Register(mux)
+	}
+	return mux
+}
+
+// Start serves the endpoints on Addr until Shutdown is called
+func (l *Listener) Start() error {
+	ln, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: l.Handler()}
+	l.mu.Lock()
+	l.server = server
+	l.mu.Unlock()
+	logging.LogInfo("Admin listener started", map[string]interface{}{
+		"address": ln.Addr().String(),
+	})
+	if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx expires
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	server := l.server
+	l.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
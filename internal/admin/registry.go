@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/registry"
+)
+
+// ServiceRegistry is implemented by registries that accept instances at runtime
+type ServiceRegistry interface {
+	Register(service, addr string, weight int, ttl time.Duration) (registry.Instance, error)
+	Deregister(service, addr string) bool
+	Instances(service string) []registry.Instance
+}
+
+type registration struct {
+	Address string `json:"address"`
+	Weight  *int   `json:"weight"` // default 1; 0 keeps the instance registered without traffic
+	TTL     string `json:"ttl"`    // e.g. "30s"; re-POST before it elapses to stay registered
+}
+
+type instanceList struct {
+	Service   string              `json:"service"`
+	Instances []registry.Instance `json:"instances"`
+}
+
+func (s *Server) listInstances(w http.ResponseWriter, r *http.Request) {
+	if s.Registry == nil {
+		http.Error(w, "dynamic registry not configured (registry.type: api)", http.StatusNotFound)
+		return
+	}
+	service := r.PathValue("service")
+	writeJSON(w, http.StatusOK, instanceList{Service: service, Instances: s.Registry.Instances(service)})
+}
+
+func (s *Server) registerInstance(w http.ResponseWriter, r *http.Request) {
+	if s.Registry == nil {
+		http.Error(w, "dynamic registry not configured (registry.type: api)", http.StatusNotFound)
+		return
+	}
+	var req registration
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Address == "" {
+		http.Error(w, `expected JSON body {"address": "host:port", "weight": 1, "ttl": "30s"}`, http.StatusBadRequest)
+		return
+	}
+	weight := 1
+	if req.Weight != nil {
+		weight = *req.Weight
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 {
+			http.Error(w, fmt.Sprintf("invalid ttl %q", req.TTL), http.StatusBadRequest)
+			return
+		}
+		ttl = d
+	}
+	service := r.PathValue("service")
+	inst, err := s.Registry.Register(service, req.Address, weight, ttl)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logging.LogInfo("Service instance registered via admin API", map[string]interface{}{
+		"service":    service,
+		"address":    inst.Addr,
+		"weight":     inst.Weight,
+		"expires_at": inst.Expires,
+		"remote":     r.RemoteAddr,
+	})
+	writeJSON(w, http.StatusOK, inst)
+}
+
+func (s *Server) deregisterInstance(w http.ResponseWriter, r *http.Request) {
+	if s.Registry == nil {
+		http.Error(w, "dynamic registry not configured (registry.type: api)", http.StatusNotFound)
+		return
+	}
+	service, addr := r.PathValue("service"), r.PathValue("address")
+	if !s.Registry.Deregister(service, addr) {
+		http.Error(w, fmt.Sprintf("%s is not registered for service %s", addr, service), http.StatusNotFound)
+		return
+	}
+	logging.LogInfo("Service instance deregistered via admin API", map[string]interface{}{
+		"service": service,
+		"address": addr,
+		"remote":  r.RemoteAddr,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+// UpstreamReporter is implemented by balancers that can report the state of their upstreams
+type UpstreamReporter interface {
+	UpstreamSnapshot() map[string]map[string]balancer.UpstreamStatus
+}
+
+type upstreamStatus struct {
+	Healthy       bool       `json:"healthy"`
+	LastCheck     *time.Time `json:"last_check"`      // null before the first health check
+	LastLatencyMs *float64   `json:"last_latency_ms"` // null before the first health check
+	CooldownUntil *time.Time `json:"cooldown_until"`  // null outside a passive cooldown
+	BreakerState  string     `json:"breaker_state"`   // closed, open or half_open
+}
+
+// listUpstreams returns the health table of every service: service -> upstream -> status
+func (s *Server) listUpstreams(w http.ResponseWriter, r *http.Request) {
+	if s.Upstreams == nil {
+		http.Error(w, "upstream health not available", http.StatusNotFound)
+		return
+	}
+	snapshot := s.Upstreams.UpstreamSnapshot()
+	out := make(map[string]map[string]upstreamStatus, len(snapshot))
+	for svc, upstreams := range snapshot {
+		table := make(map[string]upstreamStatus, len(upstreams))
+		for addr, st := range upstreams {
+			u := upstreamStatus{Healthy: st.Healthy, BreakerState: st.BreakerState}
+			if !st.LastCheck.IsZero() {
+				lastCheck := st.LastCheck
+				latency := float64(st.LastLatency.Microseconds()) / 1000
+				u.LastCheck, u.LastLatencyMs = &lastCheck, &latency
+			}
+			if !st.CooldownUntil.IsZero() {
+				until := st.CooldownUntil
+				u.CooldownUntil = &until
+			}
+			table[addr] = u
+		}
+		out[svc] = table
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/0xReLogic/Charon/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultHeader carries the API key unless another header is configured
+const DefaultHeader = "X-API-Key"
+
+// Failure reasons reported in charon_auth_failures_total
+const (
+	ReasonMissing = "missing"
+	ReasonInvalid = "invalid"
+	ReasonTier    = "tier"
+)
+
+var authFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "charon_auth_failures_total",
+	Help: "Requests rejected by API key authentication, by reason",
+}, []string{"reason"})
+
+// Identity is the caller behind a valid API key
+type Identity struct {
+	Name string // key name, used as rate-limit key and audit principal
+	Tier string // rate-limit tier of the key ("" = none)
+}
+
+type identityKey struct{}
+
+// WithIdentity attaches an authenticated caller to ctx
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the authenticated caller, if any
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Key is one accepted API key. Either Key (plain text) or Hash (hex SHA-256 of
+// the key) is set.
+type Key struct {
+	Name string
+	Key  string
+	Hash string
+	Tier string
+}
+
+type storedKey struct {
+	hash []byte
+	id   Identity
+}
+
+// APIKeyAuth validates API keys sent in a header or query parameter. Keys are
+// kept as SHA-256 hashes and compared in constant time.
+type APIKeyAuth struct {
+	header string
+	query  string
+	routes []string
+	keys   []storedKey
+}
+
+// NewAPIKeyAuth creates an authenticator from inline keys and an optional
+// keys file. header defaults to X-API-Key; query, when set, is accepted if the
+// header is absent. routes limits authentication to path prefixes (empty = all).
+func NewAPIKeyAuth(header, query string, routes []string, keys []Key, keysFile string) (*APIKeyAuth, error) {
+	if header == "" {
+		header = DefaultHeader
+	}
+	a := &APIKeyAuth{header: http.CanonicalHeaderKey(header), query: query, routes: routes}
+	if keysFile != "" {
+		fromFile, err := loadKeysFile(keysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fromFile...)
+	}
+	names := map[string]bool{}
+	for i, k := range keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("api key %d: name is required", i)
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("api key %q: duplicate name", k.Name)
+		}
+		names[k.Name] = true
+		var hash []byte
+		switch {
+		case k.Key != "" && k.Hash != "":
+			return nil, fmt.Errorf("api key %q: set either key or hash, not both", k.Name)
+		case k.Key != "":
+			sum := sha256.Sum256([]byte(k.Key))
+			hash = sum[:]
+		default:
+			var err error
+			hash, err = hex.DecodeString(strings.TrimPrefix(k.Hash, "sha256:"))
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("api key %q: hash must be a hex SHA-256 digest", k.Name)
+			}
+		}
+		a.keys = append(a.keys, storedKey{hash: hash, id: Identity{Name: k.Name, Tier: k.Tier}})
+	}
+	if len(a.keys) == 0 {
+		return nil, fmt.Errorf("api key authentication is enabled but no keys are configured")
+	}
+	return a, nil
+}
+
+// Applies reports whether requests to path must carry a key
+func (a *APIKeyAuth) Applies(path string) bool {
+	if len(a.routes) == 0 {
+		return true
+	}
+	for _, prefix := range a.routes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate returns the identity of the key presented with r. On failure it
+// returns the reason (missing or invalid), which is also counted.
+func (a *APIKeyAuth) Authenticate(r *http.Request) (Identity, string, bool) {
+	presented := r.Header.Get(a.header)
+	if presented == "" && a.query != "" {
+		presented = r.URL.Query().Get(a.query)
+	}
+	if presented == "" {
+		Fail(ReasonMissing)
+		return Identity{}, ReasonMissing, false
+	}
+	sum := sha256.Sum256([]byte(presented))
+	var found Identity
+	match := 0
+	// Check every key so the time taken does not reveal which one matched
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(sum[:], k.hash) == 1 {
+			found = k.id
+			match = 1
+		}
+	}
+	if match == 0 {
+		Fail(ReasonInvalid)
+		return Identity{}, ReasonInvalid, false
+	}
+	return found, "", true
+}
+
+// Presented reports whether r carries a key, valid or not. It is safe on a nil
+// APIKeyAuth.
+func (a *APIKeyAuth) Presented(r *http.Request) bool {
+	if a == nil {
+		return false
+	}
+	if r.Header.Get(a.header) != "" {
+		return true
+	}
+	return a.query != "" && r.URL.Query().Get(a.query) != ""
+}
+
+// Strip removes the key from r so it is not forwarded upstream
+func (a *APIKeyAuth) Strip(r *http.Request) {
+	r.Header.Del(a.header)
+	if a.query != "" && r.URL.RawQuery != "" {
+		r.URL.RawQuery = replaceQueryParam(r.URL.RawQuery, a.query, "", true)
+	}
+}
+
+// RedactQuery hides the value of the key query parameter in a raw query, for
+// logs. It is safe on a nil APIKeyAuth.
+func (a *APIKeyAuth) RedactQuery(rawQuery string) string {
+	if a == nil || a.query == "" || rawQuery == "" {
+		return rawQuery
+	}
+	return replaceQueryParam(rawQuery, a.query, "REDACTED", false)
+}
+
+// RedactURI is RedactQuery for a request URI (path and query)
+func (a *APIKeyAuth) RedactURI(uri string) string {
+	path, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	return path + "?" + a.RedactQuery(query)
+}
+
+// replaceQueryParam sets the value of every name parameter in rawQuery, or drops
+// them, keeping the other parameters as they were sent
+func replaceQueryParam(rawQuery, name, value string, drop bool) string {
+	parts := strings.Split(rawQuery, "&")
+	out := parts[:0]
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if k, err := url.QueryUnescape(key); err == nil && k == name {
+			if drop {
+				continue
+			}
+			part = key + "=" + value
+		}
+		out = append(out, part)
+	}
+	return strings.Join(out, "&")
+}
+
+// Fail counts a rejected request
+func Fail(reason string) {
+	authFailuresTotal.WithLabelValues(reason).Inc()
+	metrics.Count("auth.failures", 1, map[string]string{"reason": reason})
+}
+
+// loadKeysFile reads "<sha256-hex> <name> [tier]" lines; blank lines and
+// lines starting with # are skipped
+func loadKeysFile(path string) ([]Key, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open api keys file: %w", err)
+	}
+	defer f.Close()
+	var keys []Key
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected \"<sha256> <name> [tier]\"", path, line)
+		}
+		k := Key{Hash: fields[0], Name: fields[1]}
+		if len(fields) == 3 {
+			k.Tier = fields[2]
+		}
+		keys = append(keys, k)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read api keys file: %w", err)
+	}
+	return keys, nil
+}
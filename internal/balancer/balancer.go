@@ -0,0 +1,1100 @@
+package balancer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/metrics"
+)
+
+var upstreamHealth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "charon_upstream_health",
+	Help: "Upstream health status",
+}, []string{"service", "upstream"})
+
+var upstreamHealthLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "charon_upstream_health_latency_seconds",
+	Help: "Smoothed round-trip latency of active health checks",
+}, []string{"service", "upstream"})
+
+var upstreamErrorRate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "charon_upstream_error_rate",
+	Help: "Exponentially weighted moving average of the upstream request error rate",
+}, []string{"upstream"})
+
+var breakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "charon_circuit_breaker_transitions_total",
+	Help: "Circuit breaker state transitions",
+}, []string{"upstream", "to_state", "service"})
+
+var breakerOpenDuration = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "charon_circuit_breaker_open_duration_seconds",
+	Help: "Open duration chosen the last time the circuit breaker opened, including backoff",
+}, []string{"upstream", "service"})
+
+var breakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "charon_circuit_breaker_state",
+	Help: "Current circuit breaker state (0=closed, 1=open, 2=half-open)",
+}, []string{"upstream", "service"})
+
+// recordTransition counts a breaker state change in Prometheus and the optional
+// StatsD sink, labelled with the service addr was last resolved for. Caller holds b.mu.
+func (b *Balancer) recordTransition(addr, state string) {
+	svc := b.addrService[addr]
+	if s := b.cb[addr]; s != nil {
+		breakerState.WithLabelValues(addr, svc).Set(float64(s.state))
+	}
+	breakerTransitions.WithLabelValues(addr, state, svc).Inc()
+	tags := map[string]string{"upstream": addr, "to_state": state}
+	if svc != "" {
+		tags["service"] = svc
+	}
+	metrics.Count("circuit_breaker.transitions", 1, tags)
+}
+
+// Options configures a Balancer
+type Options struct {
+	CoolDown         time.Duration // passive cooldown after a failure
+	HealthInterval   time.Duration // active health check interval (default 5s)
+	FailureThreshold int           // consecutive failures to open the breaker
+	OpenDuration     time.Duration // how long the breaker stays open
+	// ServiceBreakers overrides FailureThreshold and OpenDuration for the
+	// upstreams of a service, keyed by service name (case-insensitive); zero
+	// fields keep the defaults.
+	ServiceBreakers map[string]BreakerSettings
+	// BreakerMode selects how the breaker trips: BreakerConsecutive (default) or
+	// BreakerErrorRate, which opens once at least BreakerErrorThreshold percent of
+	// the requests in the last BreakerWindow failed and BreakerMinRequests were seen.
+	BreakerMode           string
+	BreakerErrorThreshold float64       // percentage of failed requests (default 50)
+	BreakerWindow         time.Duration // rolling window (default 1m)
+	BreakerMinRequests    int           // requests in the window before it can trip (default 20)
+	// A half-open breaker admits at most BreakerHalfOpenMaxRequests concurrent
+	// trial requests (default 1) and closes after BreakerSuccessThreshold
+	// consecutive successful ones (default 1).
+	BreakerHalfOpenMaxRequests int
+	BreakerSuccessThreshold    int
+	// BreakerMaxOpenDuration enables backoff: each reopen without a successful
+	// close doubles the open duration up to this value (0 = always OpenDuration).
+	BreakerMaxOpenDuration time.Duration
+
+	// HealthLatencyWeighting shifts traffic away from upstreams whose health
+	// checks respond slowly, scaling weight by fastest/observed latency.
+	HealthLatencyWeighting bool
+	// MinLatencyFactor bounds how far latency weighting can reduce an upstream's
+	// share (default 0.1, i.e. never below 10% of the fastest upstream's weight).
+	MinLatencyFactor float64
+
+	// ErrorRateWeighting shifts traffic away from upstreams with a high recent
+	// error rate under every strategy: round-robin weights and latency scores
+	// are scaled by (1 - EWMA error rate), and p2c and consistent hashing pass an
+	// upstream over with probability equal to it. Composes with latency weighting.
+	ErrorRateWeighting bool
+	// ErrorRateDecay is the EWMA smoothing factor applied per request outcome
+	// (default 0.1; higher reacts faster, lower is smoother).
+	ErrorRateDecay float64
+
+	// VirtualNodes is the number of consistent hash ring points per upstream (default 160)
+	VirtualNodes int
+
+	// P2CSeed seeds the sampling of NextP2C, for reproducible picks (0 = random)
+	P2CSeed uint64
+
+	// LatencyDecay is the EWMA smoothing factor applied per request latency
+	// (RecordLatency) for NextLatency (default 0.3; higher reacts faster).
+	LatencyDecay float64
+	// LatencyHalfLife halves the EWMA of an upstream for every period without
+	// requests, so NextLatency retries one it avoided for being slow (default 10s).
+	LatencyHalfLife time.Duration
+
+	// HealthyThreshold and UnhealthyThreshold are the consecutive probe results
+	// needed before an upstream flips UP or DOWN (default 2 each)
+	HealthyThreshold   int
+	UnhealthyThreshold int
+
+	// HealthMaxConcurrent bounds how many health checks run in parallel per tick (default 50)
+	HealthMaxConcurrent int
+	// HealthCheck probes one upstream address, nil meaning healthy; its duration
+	// is the latency used by HealthLatencyWeighting (default: a TCP connect
+	// within 2s)
+	HealthCheck func(addr string) error
+	// OnForget is called with an address that is no longer an upstream of any
+	// service, after its state is dropped (e.g. to close its connections)
+	OnForget func(addr string)
+
+	// OutlierDetection ejects an upstream whose error rate over OutlierWindow is
+	// OutlierErrorMargin percentage points above the rest of its service's pool,
+	// for OutlierEjectionTime. At most OutlierMaxEjectionPercent of a pool is
+	// ejected at a time.
+	OutlierDetection          bool
+	OutlierWindow             time.Duration // default 30s
+	OutlierMinRequests        int           // requests in the window before an upstream is judged (default 10)
+	OutlierErrorMargin        float64       // default 30
+	OutlierEjectionTime       time.Duration // default 30s
+	OutlierMaxEjectionPercent int           // default 50
+}
+
+// BreakerSettings are the circuit breaker parameters of one service
+type BreakerSettings struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// Balancer is a round-robin balancer with passive health (cooldown on failure),
+// active TCP health checks and a per-upstream circuit breaker.
+type Balancer struct {
+	mu          sync.Mutex
+	rrStates    roundRobin           // round-robin positions and upstream gates, read by Next without mu
+	downUntil   map[string]time.Time // addr -> expiry
+	healthy     map[string]bool      // addr -> health
+	services    map[string][]string  // service -> last seen addrs
+	addrService map[string]string    // addr -> service it was last resolved for (metric label)
+	coolDown    time.Duration
+	interval    time.Duration
+	started     bool
+	stop        chan struct{} // closed by Close to end the health loop
+	closed      bool
+
+	maxConcurrent int // parallel health checks per tick
+	check         func(addr string) error
+	onForget      func(addr string)
+
+	// active health check hysteresis
+	healthyThreshold   int
+	unhealthyThreshold int
+	probeStreaks       map[string]*probeStreak // addr -> current run of identical results
+	lastProbes         map[string]probeResult  // addr -> most recent health check
+
+	// circuit breaker per upstream
+	cb               map[string]*cbState
+	failureThreshold int
+	openDuration     time.Duration
+	serviceBreakers  map[string]BreakerSettings
+	breakerMode      string
+	errorThreshold   float64       // error_rate mode: percentage that trips
+	breakerWindow    time.Duration // error_rate mode: rolling window
+	minRequests      int           // error_rate mode: requests needed to trip
+	halfOpenMax      int           // concurrent half-open trials
+	successThreshold int           // half-open successes needed to close
+	maxOpenDuration  time.Duration // open duration backoff cap (0 = no backoff)
+
+	// health-check latency weighting
+	latencyWeighting bool
+	minLatencyFactor float64
+	healthLatency    map[string]time.Duration    // addr -> smoothed probe RTT
+	currentWeight    map[string]map[string]int64 // service -> addr -> smooth WRR current weight
+
+	// response-based error rate weighting
+	errorWeighting bool
+	errorDecay     float64
+	errorRate      map[string]float64 // addr -> EWMA of failures (0..1)
+
+	// outlier detection per service pool
+	outliers       map[string]*outlierState
+	outlierEnabled bool
+	outlierWindow  time.Duration
+	outlierMinReqs int
+	outlierMargin  float64
+	ejectionTime   time.Duration
+	maxEjection    int // percent of a pool
+
+	// request latency EWMA per upstream (RecordLatency)
+	latency         map[string]*latencyEWMA
+	latencyDecay    float64
+	latencyHalfLife time.Duration
+
+	// requests in flight per upstream (Acquire/Release) and the p2c sampling source
+	inflight map[string]int
+	rng      *rand.Rand
+
+	// registry weights per service (nil = unweighted round-robin)
+	weights map[string]map[string]int
+
+	// consistent hash rings per service (NextHash)
+	rings        map[string]*hashRing
+	virtualNodes int
+}
+
+// probeStreak counts consecutive identical health check results for an upstream
+type probeStreak struct {
+	ok    bool
+	count int
+}
+
+// probeResult is when an upstream was last health checked and how long the check took
+type probeResult struct {
+	at  time.Time
+	rtt time.Duration
+}
+
+type cbState struct {
+	state     int // 0=closed,1=open,2=half-open
+	failures  int
+	openUntil time.Time
+	probes    int           // half-open trials picked but not yet reported
+	successes int           // successful half-open trials so far
+	opens     int           // opens since the last close (open duration backoff)
+	window    rollingWindow // recent outcomes (error_rate mode)
+}
+
+// withDefaults fills in unset options
+func (opts Options) withDefaults() Options {
+	if len(opts.ServiceBreakers) > 0 {
+		// Config keys arrive lowercased; addrService keeps the registry's case
+		lowered := make(map[string]BreakerSettings, len(opts.ServiceBreakers))
+		for name, settings := range opts.ServiceBreakers {
+			lowered[strings.ToLower(name)] = settings
+		}
+		opts.ServiceBreakers = lowered
+	}
+	if opts.MinLatencyFactor <= 0 || opts.MinLatencyFactor > 1 {
+		opts.MinLatencyFactor = 0.1
+	}
+	if opts.ErrorRateDecay <= 0 || opts.ErrorRateDecay > 1 {
+		opts.ErrorRateDecay = 0.1
+	}
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = defaultVirtualNodes
+	}
+	if opts.HealthyThreshold <= 0 {
+		opts.HealthyThreshold = 2
+	}
+	if opts.UnhealthyThreshold <= 0 {
+		opts.UnhealthyThreshold = 2
+	}
+	if opts.HealthMaxConcurrent <= 0 {
+		opts.HealthMaxConcurrent = 50
+	}
+	if opts.HealthCheck == nil {
+		opts.HealthCheck = tcpCheck
+	}
+	if opts.BreakerMode == "" {
+		opts.BreakerMode = BreakerConsecutive
+	}
+	if opts.BreakerErrorThreshold <= 0 || opts.BreakerErrorThreshold > 100 {
+		opts.BreakerErrorThreshold = 50
+	}
+	if opts.BreakerWindow <= 0 {
+		opts.BreakerWindow = time.Minute
+	}
+	if opts.BreakerMinRequests <= 0 {
+		opts.BreakerMinRequests = 20
+	}
+	if opts.BreakerHalfOpenMaxRequests <= 0 {
+		opts.BreakerHalfOpenMaxRequests = 1
+	}
+	if opts.BreakerSuccessThreshold <= 0 {
+		opts.BreakerSuccessThreshold = 1
+	}
+	if opts.LatencyDecay <= 0 || opts.LatencyDecay > 1 {
+		opts.LatencyDecay = 0.3
+	}
+	if opts.LatencyHalfLife <= 0 {
+		opts.LatencyHalfLife = 10 * time.Second
+	}
+	if opts.P2CSeed == 0 {
+		opts.P2CSeed = rand.Uint64()
+	}
+	if opts.OutlierWindow <= 0 {
+		opts.OutlierWindow = 30 * time.Second
+	}
+	if opts.OutlierMinRequests <= 0 {
+		opts.OutlierMinRequests = 10
+	}
+	if opts.OutlierErrorMargin <= 0 {
+		opts.OutlierErrorMargin = 30
+	}
+	if opts.OutlierEjectionTime <= 0 {
+		opts.OutlierEjectionTime = 30 * time.Second
+	}
+	if opts.OutlierMaxEjectionPercent <= 0 || opts.OutlierMaxEjectionPercent > 100 {
+		opts.OutlierMaxEjectionPercent = 50
+	}
+	return opts
+}
+
+// New creates a balancer. The active health loop starts with the first service registration.
+func New(opts Options) *Balancer {
+	opts = opts.withDefaults()
+	return &Balancer{
+		stop:               make(chan struct{}),
+		downUntil:          map[string]time.Time{},
+		healthy:            map[string]bool{},
+		services:           map[string][]string{},
+		addrService:        map[string]string{},
+		coolDown:           opts.CoolDown,
+		interval:           opts.HealthInterval,
+		maxConcurrent:      opts.HealthMaxConcurrent,
+		check:              opts.HealthCheck,
+		onForget:           opts.OnForget,
+		healthyThreshold:   opts.HealthyThreshold,
+		unhealthyThreshold: opts.UnhealthyThreshold,
+		probeStreaks:       map[string]*probeStreak{},
+		lastProbes:         map[string]probeResult{},
+		cb:                 map[string]*cbState{},
+		failureThreshold:   opts.FailureThreshold,
+		openDuration:       opts.OpenDuration,
+		serviceBreakers:    opts.ServiceBreakers,
+		breakerMode:        opts.BreakerMode,
+		errorThreshold:     opts.BreakerErrorThreshold,
+		breakerWindow:      opts.BreakerWindow,
+		minRequests:        opts.BreakerMinRequests,
+		halfOpenMax:        opts.BreakerHalfOpenMaxRequests,
+		successThreshold:   opts.BreakerSuccessThreshold,
+		maxOpenDuration:    opts.BreakerMaxOpenDuration,
+		latencyWeighting:   opts.HealthLatencyWeighting,
+		minLatencyFactor:   opts.MinLatencyFactor,
+		healthLatency:      map[string]time.Duration{},
+		currentWeight:      map[string]map[string]int64{},
+		errorWeighting:     opts.ErrorRateWeighting,
+		errorDecay:         opts.ErrorRateDecay,
+		errorRate:          map[string]float64{},
+		outliers:           map[string]*outlierState{},
+		outlierEnabled:     opts.OutlierDetection,
+		outlierWindow:      opts.OutlierWindow,
+		outlierMinReqs:     opts.OutlierMinRequests,
+		outlierMargin:      opts.OutlierErrorMargin,
+		ejectionTime:       opts.OutlierEjectionTime,
+		maxEjection:        opts.OutlierMaxEjectionPercent,
+		latency:            map[string]*latencyEWMA{},
+		latencyDecay:       opts.LatencyDecay,
+		latencyHalfLife:    opts.LatencyHalfLife,
+		inflight:           map[string]int{},
+		rng:                rand.New(rand.NewPCG(opts.P2CSeed, opts.P2CSeed)),
+		weights:            map[string]map[string]int{},
+		rings:              map[string]*hashRing{},
+		virtualNodes:       opts.VirtualNodes,
+	}
+}
+
+// Reconfigure applies new circuit breaker and active health check settings
+// (FailureThreshold, OpenDuration, ServiceBreakers, the Breaker* options,
+// HealthyThreshold, UnhealthyThreshold, HealthMaxConcurrent and the Outlier*
+// options) to a running balancer. Breaker, probe and ejection state is kept;
+// the other options only take effect in New.
+func (b *Balancer) Reconfigure(opts Options) {
+	opts = opts.withDefaults()
+	b.mu.Lock()
+	b.failureThreshold = opts.FailureThreshold
+	b.openDuration = opts.OpenDuration
+	b.serviceBreakers = opts.ServiceBreakers
+	b.breakerMode = opts.BreakerMode
+	b.errorThreshold = opts.BreakerErrorThreshold
+	b.breakerWindow = opts.BreakerWindow
+	b.minRequests = opts.BreakerMinRequests
+	b.halfOpenMax = opts.BreakerHalfOpenMaxRequests
+	b.successThreshold = opts.BreakerSuccessThreshold
+	b.maxOpenDuration = opts.BreakerMaxOpenDuration
+	b.healthyThreshold = opts.HealthyThreshold
+	b.unhealthyThreshold = opts.UnhealthyThreshold
+	b.maxConcurrent = opts.HealthMaxConcurrent
+	b.outlierEnabled = opts.OutlierDetection
+	b.outlierWindow = opts.OutlierWindow
+	b.outlierMinReqs = opts.OutlierMinRequests
+	b.outlierMargin = opts.OutlierErrorMargin
+	b.ejectionTime = opts.OutlierEjectionTime
+	b.maxEjection = opts.OutlierMaxEjectionPercent
+	b.mu.Unlock()
+}
+
+// MarkFailure records a failed request to addr (cooldown + breaker accounting)
+// with the breaker settings of the service addr was last resolved for. Prefer
+// MarkServiceFailure when the request's service is known.
+func (b *Balancer) MarkFailure(addr string) {
+	b.MarkServiceFailure("", addr)
+}
+
+// MarkServiceFailure records a failed request to addr routed for service. The
+// breaker of addr is shared by every service listing it, but trips with the
+// settings of service ("" = the service addr was last resolved for).
+func (b *Balancer) MarkServiceFailure(service, addr string) {
+	b.mu.Lock()
+	b.downUntil[addr] = time.Now().Add(b.coolDown)
+	b.healthy[addr] = false
+	// update health gauges for all services that include this addr
+	for svc, addrs := range b.services {
+		for _, a := range addrs {
+			if a == addr {
+				upstreamHealth.WithLabelValues(svc, addr).Set(0)
+			}
+		}
+	}
+	logging.GetLogger().Info("health_passive_down",
+		zap.String("upstream", addr),
+		zap.Duration("cooldown", b.coolDown),
+	)
+
+	b.recordOutcome(addr, true)
+
+	// circuit breaker failure accounting, with the settings of the request's service
+	now := time.Now()
+	b.recordOutlier(addr, true, now)
+	threshold, openDuration := b.breakerSettings(service, addr)
+	s := b.breaker(addr)
+	s.failures++
+	s.window.record(now, b.breakerWindow, true)
+	switch s.state {
+	case 0: // closed
+		if trip, reason := b.shouldTrip(s, threshold, now); trip {
+			b.open(addr, s, openDuration, now, "OPEN", reason)
+		}
+	case 2: // half-open
+		// failure in half-open -> go OPEN again
+		b.open(addr, s, openDuration, now, "RE-OPEN", "half-open failure")
+	}
+	b.refreshGate(addr, now)
+	b.mu.Unlock()
+}
+
+// open trips the breaker of addr. The open duration doubles with every open
+// since the last close, up to maxOpenDuration. Caller holds b.mu.
+func (b *Balancer) open(addr string, s *cbState, base time.Duration, now time.Time, state, reason string) {
+	d := base
+	if b.maxOpenDuration > base {
+		for i := 0; i < s.opens && d < b.maxOpenDuration; i++ {
+			d *= 2
+		}
+		d = min(d, b.maxOpenDuration)
+	}
+	s.opens++
+	s.state = 1
+	s.openUntil = now.Add(d)
+	s.probes, s.successes = 0, 0
+	logging.LogCircuitBreaker(addr, state, fmt.Sprintf("%s open_duration=%s", reason, d))
+	b.recordTransition(addr, "open")
+	svc := b.addrService[addr]
+	breakerOpenDuration.WithLabelValues(addr, svc).Set(d.Seconds())
+	tags := map[string]string{"upstream": addr}
+	if svc != "" {
+		tags["service"] = svc
+	}
+	metrics.Timing("circuit_breaker.open_duration", d, tags)
+}
+
+// ResetBreaker forces the breaker of addr closed and clears its failure history,
+// backoff and passive cooldown. It reports false if addr is not an upstream of any service.
+func (b *Balancer) ResetBreaker(addr string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.listed(addr) {
+		return false
+	}
+	s := b.breaker(addr)
+	*s = cbState{}
+	delete(b.downUntil, addr)
+	b.refreshGate(addr, time.Now())
+	logging.LogCircuitBreaker(addr, "MANUAL-CLOSE", "admin reset")
+	b.recordTransition(addr, "closed")
+	return true
+}
+
+// TripBreaker forces the breaker of addr open for d (0 = its configured open
+// duration), after which it goes half-open as usual. It reports false if addr
+// is not an upstream of any service.
+func (b *Balancer) TripBreaker(addr string, d time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.listed(addr) {
+		return false
+	}
+	if d <= 0 {
+		_, d = b.breakerSettings("", addr)
+	}
+	s := b.breaker(addr)
+	s.state = 1
+	s.openUntil = time.Now().Add(d)
+	s.probes, s.successes = 0, 0
+	b.refreshGate(addr, time.Now())
+	logging.LogCircuitBreaker(addr, "MANUAL-OPEN", fmt.Sprintf("admin trip open_duration=%s", d))
+	b.recordTransition(addr, "open")
+	breakerOpenDuration.WithLabelValues(addr, b.addrService[addr]).Set(d.Seconds())
+	return true
+}
+
+// BreakersOpen reports whether the breakers of all addrs currently reject
+// traffic: open, or half-open with every trial slot taken. Open breakers whose
+// duration has elapsed count as available since the next pick moves them to half-open.
+func (b *Balancer) BreakersOpen(addrs []string) bool {
+	if len(addrs) == 0 {
+		return false
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, addr := range addrs {
+		s := b.cb[addr]
+		switch {
+		case s == nil || s.state == 0:
+			return false
+		case s.state == 1 && now.After(s.openUntil):
+			return false
+		case s.state == 2 && s.probes < b.halfOpenMax:
+			return false
+		}
+	}
+	return true
+}
+
+// breaker returns the breaker of addr, creating a closed one. Caller holds b.mu.
+func (b *Balancer) breaker(addr string) *cbState {
+	s := b.cb[addr]
+	if s == nil {
+		s = &cbState{}
+		b.cb[addr] = s
+		breakerState.WithLabelValues(addr, b.addrService[addr]).Set(0)
+	}
+	return s
+}
+
+// shouldTrip reports whether a closed breaker should open after a failure,
+// with the reason to log. Caller holds b.mu.
+func (b *Balancer) shouldTrip(s *cbState, threshold int, now time.Time) (bool, string) {
+	if b.breakerMode != BreakerErrorRate {
+		return s.failures >= threshold, fmt.Sprintf("failures=%d", s.failures)
+	}
+	total, failed := s.window.counts(now)
+	if total < b.minRequests {
+		return false, ""
+	}
+	rate := 100 * float64(failed) / float64(total)
+	return rate >= b.errorThreshold, fmt.Sprintf("error_rate=%.1f%% requests=%d", rate, total)
+}
+
+// breakerSettings returns the failure threshold and open duration for addr
+// when routed for service, or for the service it was last resolved for if
+// service is "". Caller holds b.mu.
+func (b *Balancer) breakerSettings(service, addr string) (int, time.Duration) {
+	threshold, openDuration := b.failureThreshold, b.openDuration
+	if service == "" {
+		service = b.addrService[addr]
+	}
+	if o, ok := b.serviceBreakers[strings.ToLower(service)]; ok {
+		if o.FailureThreshold > 0 {
+			threshold = o.FailureThreshold
+		}
+		if o.OpenDuration > 0 {
+			openDuration = o.OpenDuration
+		}
+	}
+	return threshold, openDuration
+}
+
+// MarkSuccess records a successful request to addr
+func (b *Balancer) MarkSuccess(addr string) {
+	b.mu.Lock()
+	s := b.breaker(addr)
+	s.failures = 0
+	now := time.Now()
+	s.window.record(now, b.breakerWindow, false)
+	b.recordOutcome(addr, false)
+	b.recordOutlier(addr, false, now)
+	if s.state == 2 { // half-open -> close after enough successes
+		s.releaseProbe()
+		s.successes++
+		if s.successes >= b.successThreshold {
+			s.state = 0
+			s.probes, s.successes, s.opens = 0, 0, 0
+			s.window.reset() // the failures that opened it must not trip it again
+			logging.LogCircuitBreaker(addr, "CLOSE", fmt.Sprintf("half-open successes=%d", b.successThreshold))
+			b.recordTransition(addr, "closed")
+		}
+	}
+	// if open and window elapsed, keep as open until selection path transitions it to half-open
+	b.refreshGate(addr, now)
+	b.mu.Unlock()
+}
+
+// MarkNeutral records a request to addr whose outcome says nothing about its
+// health (see failure classification). It only frees a half-open trial slot.
+func (b *Balancer) MarkNeutral(addr string) {
+	b.mu.Lock()
+	if s := b.cb[addr]; s != nil && s.state == 2 {
+		s.releaseProbe()
+	}
+	b.mu.Unlock()
+}
+
+// releaseProbe ends one outstanding half-open trial
+func (s *cbState) releaseProbe() {
+	if s.probes > 0 {
+		s.probes--
+	}
+}
+
+// SetServiceAddrs records the current addresses of a service for active health checks
+func (b *Balancer) SetServiceAddrs(service string, addrs []string) {
+	b.mu.Lock()
+	forgotten := b.setServiceAddrs(service, addrs)
+	b.rr(service).synced.Store(nil)
+	b.mu.Unlock()
+	b.notifyForgotten(forgotten)
+}
+
+// SyncService records the addresses and registry weights a service resolved
+// to, like SetServiceAddrs and SetServiceWeights. It only takes b.mu when they
+// differ from the last SyncService of the service, so it can run per request.
+func (b *Balancer) SyncService(service string, addrs []string, weights map[string]int) {
+	rs := b.rr(service)
+	if s := rs.synced.Load(); s != nil && s.matches(addrs, weights) {
+		return
+	}
+	b.mu.Lock()
+	forgotten := b.setServiceAddrs(service, addrs)
+	b.setServiceWeights(service, weights)
+	rs.synced.Store(&serviceSet{addrs: slices.Clone(addrs), weights: weights})
+	b.mu.Unlock()
+	b.notifyForgotten(forgotten)
+}
+
+// setServiceAddrs replaces the addresses of service and returns those that are
+// no longer an upstream of any service. Caller holds b.mu.
+func (b *Balancer) setServiceAddrs(service string, addrs []string) []string {
+	prev := b.services[service]
+	b.services[service] = append([]string(nil), addrs...)
+	for _, a := range addrs {
+		if old, ok := b.addrService[a]; ok && old != service {
+			// Move the state series to the new service label
+			breakerState.DeleteLabelValues(a, old)
+			if s := b.cb[a]; s != nil {
+				breakerState.WithLabelValues(a, service).Set(float64(s.state))
+			}
+		}
+		b.addrService[a] = service
+	}
+	var forgotten []string
+	for _, a := range prev {
+		if slices.Contains(addrs, a) {
+			continue
+		}
+		upstreamHealth.DeleteLabelValues(service, a)
+		upstreamHealthLatency.DeleteLabelValues(service, a)
+		delete(b.currentWeight[service], a)
+		if !b.listed(a) {
+			b.forget(a)
+			forgotten = append(forgotten, a)
+		}
+	}
+	if !b.started && !b.closed {
+		b.started = true
+		interval := b.interval
+		if interval <= 0 {
+			interval = 5 * time.Second
+		}
+		go b.healthLoop(interval)
+	}
+	return forgotten
+}
+
+// notifyForgotten passes addresses dropped by setServiceAddrs to OnForget
+func (b *Balancer) notifyForgotten(forgotten []string) {
+	if b.onForget == nil {
+		return
+	}
+	for _, a := range forgotten {
+		b.onForget(a)
+	}
+}
+
+// forget drops the health, breaker and error rate state of an address that is
+// no longer an upstream of any service, along with its metric series. Caller holds b.mu.
+func (b *Balancer) forget(addr string) {
+	delete(b.healthy, addr)
+	delete(b.downUntil, addr)
+	delete(b.cb, addr)
+	delete(b.probeStreaks, addr)
+	delete(b.lastProbes, addr)
+	delete(b.healthLatency, addr)
+	delete(b.errorRate, addr)
+	delete(b.outliers, addr)
+	delete(b.inflight, addr)
+	delete(b.latency, addr)
+	delete(b.addrService, addr)
+	b.rrStates.gates.Delete(addr)
+	breakerState.DeletePartialMatch(prometheus.Labels{"upstream": addr})
+	breakerOpenDuration.DeletePartialMatch(prometheus.Labels{"upstream": addr})
+	upstreamErrorRate.DeleteLabelValues(addr)
+	upstreamLatencyEWMA.DeleteLabelValues(addr)
+	outlierEjections.DeletePartialMatch(prometheus.Labels{"upstream": addr})
+}
+
+// listed reports whether addr is an upstream of any service. Caller holds b.mu.
+func (b *Balancer) listed(addr string) bool {
+	for _, addrs := range b.services {
+		for _, a := range addrs {
+			if a == addr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Close stops the active health checks. The balancer keeps selecting upstreams.
+func (b *Balancer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+}
+
+// SetServiceWeights sets the registry weights of a service's addresses. A weight
+// of 0 drains the address; addresses without an entry weigh 1. nil restores
+// plain round-robin.
+func (b *Balancer) SetServiceWeights(service string, weights map[string]int) {
+	b.mu.Lock()
+	b.setServiceWeights(service, weights)
+	b.rr(service).synced.Store(nil)
+	b.mu.Unlock()
+}
+
+// setServiceWeights is SetServiceWeights. Caller holds b.mu.
+func (b *Balancer) setServiceWeights(service string, weights map[string]int) {
+	if weights == nil {
+		delete(b.weights, service)
+	} else {
+		b.weights[service] = weights
+	}
+	b.rr(service).weighted.Store(weights != nil)
+}
+
+// HealthLatency returns the smoothed health-check round-trip latency for addr
+// (0 if no successful probe has been recorded yet).
+func (b *Balancer) HealthLatency(addr string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.healthLatency[addr]
+}
+
+// ServiceHealth counts the upstreams of a service that passed active health checks
+type ServiceHealth struct {
+	Healthy int
+	Total   int
+}
+
+// ReadySnapshot returns the health of every service known to the balancer.
+// Only upstreams whose health checks have confirmed them UP count as healthy.
+func (b *Balancer) ReadySnapshot() map[string]ServiceHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	snapshot := make(map[string]ServiceHealth, len(b.services))
+	for svc, addrs := range b.services {
+		h := ServiceHealth{Total: len(addrs)}
+		for _, addr := range addrs {
+			if b.healthy[addr] {
+				h.Healthy++
+			}
+		}
+		snapshot[svc] = h
+	}
+	return snapshot
+}
+
+// UpstreamStatus is the health and breaker state of one upstream
+type UpstreamStatus struct {
+	Healthy       bool          // not marked down by health checks or failed requests
+	LastCheck     time.Time     // start of the last health check (zero before the first)
+	LastLatency   time.Duration // round trip of the last health check, failed ones included
+	CooldownUntil time.Time     // end of the passive cooldown (zero outside one)
+	BreakerState  string        // closed, open or half_open
+}
+
+// UpstreamSnapshot returns the state of every upstream by service, taken at one point in time
+func (b *Balancer) UpstreamSnapshot() map[string]map[string]UpstreamStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	snapshot := make(map[string]map[string]UpstreamStatus, len(b.services))
+	for svc, addrs := range b.services {
+		upstreams := make(map[string]UpstreamStatus, len(addrs))
+		for _, addr := range addrs {
+			ok, has := b.healthy[addr]
+			st := UpstreamStatus{Healthy: !has || ok, BreakerState: "closed"}
+			if p, probed := b.lastProbes[addr]; probed {
+				st.LastCheck, st.LastLatency = p.at, p.rtt
+			}
+			if until, cooling := b.downUntil[addr]; cooling && now.Before(until) {
+				st.CooldownUntil = until
+			}
+			if s := b.cb[addr]; s != nil {
+				switch s.state {
+				case 1:
+					st.BreakerState = "open"
+				case 2:
+					st.BreakerState = "half_open"
+				}
+			}
+			upstreams[addr] = st
+		}
+		snapshot[svc] = upstreams
+	}
+	return snapshot
+}
+
+func (b *Balancer) healthLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+		// snapshot services map
+		b.mu.Lock()
+		snapshot := make(map[string][]string, len(b.services))
+		for svc, addrs := range b.services {
+			snapshot[svc] = append([]string(nil), addrs...)
+		}
+		maxConcurrent := b.maxConcurrent
+		b.mu.Unlock()
+
+		// probe concurrently, bounded so large fleets don't flood the network
+		sem := make(chan struct{}, maxConcurrent)
+		var wg sync.WaitGroup
+		for svc, addrs := range snapshot {
+			for _, addr := range addrs {
+				sem <- struct{}{}
+				wg.Add(1)
+				go func(svc, addr string) {
+					defer func() { <-sem; wg.Done() }()
+					b.probe(svc, addr)
+				}(svc, addr)
+			}
+		}
+		wg.Wait()
+	}
+}
+
+// probe runs a single active health check for addr on behalf of svc
+func (b *Balancer) probe(svc, addr string) {
+	probeStart := time.Now()
+	ok := b.check(addr) == nil
+	rtt := time.Since(probeStart)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// The address may have been removed while the probe was in flight
+	if !slices.Contains(b.services[svc], addr) {
+		return
+	}
+	// Count consecutive identical results; a differing result restarts the streak
+	st := b.probeStreaks[addr]
+	if st == nil {
+		st = &probeStreak{}
+		b.probeStreaks[addr] = st
+	}
+	if st.count == 0 || st.ok != ok {
+		st.ok, st.count = ok, 1
+	} else {
+		st.count++
+	}
+	b.lastProbes[addr] = probeResult{at: probeStart, rtt: rtt}
+	threshold := b.unhealthyThreshold
+	if ok {
+		threshold = b.healthyThreshold
+		b.recordHealthLatency(addr, rtt)
+	}
+	// The first result sets the initial state; later flips need a full streak
+	prev, had := b.healthy[addr]
+	changed := !had || (prev != ok && st.count >= threshold)
+	if changed {
+		b.healthy[addr] = ok
+		if ok {
+			// back healthy: clear passive cooldown early
+			delete(b.downUntil, addr)
+		}
+		b.refreshGate(addr, time.Now())
+	}
+	if ok {
+		upstreamHealthLatency.WithLabelValues(svc, addr).Set(b.healthLatency[addr].Seconds())
+	}
+	if !changed {
+		return
+	}
+	// update gauge and log only on a confirmed transition (or first sight)
+	val := 0.0
+	state := "DOWN"
+	if ok {
+		val = 1.0
+		state = "UP"
+	}
+	upstreamHealth.WithLabelValues(svc, addr).Set(val)
+	logging.LogHealthChange(svc, addr, state)
+}
+
+// tcpCheck is the default health check: a TCP connect to addr
+func tcpCheck(addr string) error {
+	conn, err := net.DialTimeout("tcp", dialAddr(addr), 2*time.Second)
+	if err != nil {
+		return err
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// dialAddr returns the host:port to probe for a registry address, which may be
+// a full URL (e.g. "https://[::1]:8443") rather than a bare host:port.
+func dialAddr(addr string) string {
+	if !strings.Contains(addr, "://") {
+		return addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return addr
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// recordHealthLatency folds a probe RTT into the per-address EWMA. Caller holds b.mu.
+func (b *Balancer) recordHealthLatency(addr string, rtt time.Duration) {
+	const alpha = 0.3
+	prev, ok := b.healthLatency[addr]
+	if !ok || prev <= 0 {
+		b.healthLatency[addr] = rtt
+		return
+	}
+	b.healthLatency[addr] = time.Duration(alpha*float64(rtt) + (1-alpha)*float64(prev))
+}
+
+// recordOutcome folds a request result into the per-address error rate EWMA. Caller holds b.mu.
+func (b *Balancer) recordOutcome(addr string, failed bool) {
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	rate := b.errorDecay*sample + (1-b.errorDecay)*b.errorRate[addr]
+	b.errorRate[addr] = rate
+	upstreamErrorRate.WithLabelValues(addr).Set(rate)
+}
+
+// ErrorRate returns the smoothed request error rate for addr (0..1)
+func (b *Balancer) ErrorRate(addr string) float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.errorRate[addr]
+}
+
+// available reports whether addr is outside its cooldown and its breaker admits
+// traffic, moving an expired open breaker to half-open. Caller holds b.mu.
+func (b *Balancer) available(addr string, now time.Time, reason string) bool {
+	defer b.refreshGate(addr, now)
+	if until, ok := b.downUntil[addr]; ok && now.Before(until) {
+		return false
+	}
+	if b.ejected(addr, now) {
+		return false
+	}
+	// circuit breaker: handle open/half-open
+	if s, ok := b.cb[addr]; ok {
+		if s.state == 1 { // open
+			if now.After(s.openUntil) {
+				// transition to half-open, allow a limited number of trials
+				s.state = 2
+				s.probes, s.successes = 0, 0
+				logging.LogCircuitBreaker(addr, "HALF-OPEN", reason)
+				b.recordTransition(addr, "half_open")
+			} else {
+				return false
+			}
+		}
+		if s.state == 2 && s.probes >= b.halfOpenMax {
+			return false
+		}
+	}
+	return true
+}
+
+// take records addr as the selection for service. Caller holds b.mu.
+func (b *Balancer) take(service string, idx, n int, addr string) string {
+	b.rr(service).next.Store(uint64((idx + 1) % n))
+	b.startTrial(addr)
+	return addr
+}
+
+// startTrial counts a pick of addr against its half-open trial limit. Caller holds b.mu.
+func (b *Balancer) startTrial(addr string) {
+	if s, ok := b.cb[addr]; ok && s.state == 2 {
+		s.probes++
+	}
+}
+
+// Next picks the upstream for service from addrs. With registry weights set
+// (SetServiceWeights) it uses smooth weighted round-robin and never picks an
+// address of weight 0; it returns "" if every address is drained. Plain
+// round-robin picks of upstreams in good standing don't take the balancer lock.
+func (b *Balancer) Next(service string, addrs []string) string {
+	if len(addrs) == 0 {
+		return ""
+	}
+	if addr, ok := b.nextLockFree(service, addrs); ok {
+		return addr
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.next(service, addrs, time.Now())
+}
+
+// next is Next for a non-empty addrs. Caller holds b.mu.
+func (b *Balancer) next(service string, addrs []string, now time.Time) string {
+	n := len(addrs)
+	start := b.rrStart(service, n)
+	weights := b.weights[service]
+
+	// First pass: prefer healthy and not in cooldown
+	var candidates []int
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		addr := addrs[idx]
+		if drained(weights, addr) || !b.available(addr, now, "open window elapsed") {
+			continue
+		}
+		if ok, has := b.healthy[addr]; has && !ok {
+			continue
+		}
+		if weights == nil && !b.latencyWeighting && !b.errorWeighting {
+			return b.take(service, idx, n, addr)
+		}
+		candidates = append(candidates, idx)
+	}
+	if len(candidates) > 0 {
+		idx := b.pickWeighted(service, addrs, candidates)
+		return b.take(service, idx, n, addrs[idx])
+	}
+	// Second pass: allow unknown health but skip cooldown
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		addr := addrs[idx]
+		if drained(weights, addr) || !b.available(addr, now, "second pass open window elapsed") {
+			continue
+		}
+		return b.take(service, idx, n, addr)
+	}
+	// All are on cooldown; pick next anyway
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		if !drained(weights, addrs[idx]) {
+			b.rr(service).next.Store(uint64((idx + 1) % n))
+			return addrs[idx]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,188 @@
+package balancer
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ringRebuilds = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "charon_balancer_ring_rebuilds_total",
+	Help: "Consistent hash ring rebuilds caused by upstream set changes",
+}, []string{"service"})
+
+// defaultVirtualNodes is the number of ring points per upstream
+const defaultVirtualNodes = 160
+
+// ParseHashOn returns the function extracting the consistent-hash key from a
+// request: "header:<Name>", "cookie:<Name>" or "remote_ip".
+func ParseHashOn(spec string) (func(r *http.Request) string, error) {
+	switch {
+	case spec == "remote_ip":
+		return func(r *http.Request) string {
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				return host
+			}
+			return r.RemoteAddr
+		}, nil
+	case strings.HasPrefix(spec, "header:"):
+		name := http.CanonicalHeaderKey(strings.TrimSpace(strings.TrimPrefix(spec, "header:")))
+		if name == "" {
+			return nil, fmt.Errorf("hash_on %q: missing header name", spec)
+		}
+		return func(r *http.Request) string { return r.Header.Get(name) }, nil
+	case strings.HasPrefix(spec, "cookie:"):
+		name := strings.TrimSpace(strings.TrimPrefix(spec, "cookie:"))
+		if name == "" {
+			return nil, fmt.Errorf("hash_on %q: missing cookie name", spec)
+		}
+		return func(r *http.Request) string {
+			if c, err := r.Cookie(name); err == nil {
+				return c.Value
+			}
+			return ""
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash_on %q (use header:<Name>, cookie:<Name> or remote_ip)", spec)
+	}
+}
+
+// hashRing maps hash points to upstreams. It is rebuilt only when the
+// upstream set changes; unavailable upstreams are skipped at lookup time so
+// only their keys move.
+type hashRing struct {
+	members []string // sorted upstream set the ring was built from
+	points  []uint64 // sorted
+	owners  []string // owners[i] owns points[i]
+}
+
+func newHashRing(addrs []string, vnodes int) *hashRing {
+	r := &hashRing{members: slices.Sorted(slices.Values(addrs))}
+	r.members = slices.Compact(r.members)
+	type point struct {
+		h     uint64
+		owner string
+	}
+	pts := make([]point, 0, len(r.members)*vnodes)
+	for _, addr := range r.members {
+		for i := 0; i < vnodes; i++ {
+			pts = append(pts, point{hashKey(addr + "#" + strconv.Itoa(i)), addr})
+		}
+	}
+	sort.Slice(pts, func(i, j int) bool { return pts[i].h < pts[j].h })
+	r.points = make([]uint64, len(pts))
+	r.owners = make([]string, len(pts))
+	for i, p := range pts {
+		r.points[i], r.owners[i] = p.h, p.owner
+	}
+	return r
+}
+
+// matches reports whether the ring was built from the same upstream set
+func (r *hashRing) matches(addrs []string) bool {
+	sorted := slices.Compact(slices.Sorted(slices.Values(addrs)))
+	return slices.Equal(r.members, sorted)
+}
+
+// walk calls visit for each distinct owner clockwise from key until it returns true
+func (r *hashRing) walk(key string, visit func(addr string) bool) {
+	if len(r.points) == 0 {
+		return
+	}
+	h := hashKey(key)
+	start := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	seen := make(map[string]bool, len(r.members))
+	for i := 0; i < len(r.points) && len(seen) < len(r.members); i++ {
+		owner := r.owners[(start+i)%len(r.points)]
+		if seen[owner] {
+			continue
+		}
+		seen[owner] = true
+		if visit(owner) {
+			return
+		}
+	}
+}
+
+// hashKey hashes s with FNV-1a followed by a 64-bit finalizer for better spread
+func hashKey(s string) uint64 {
+	f := fnv.New64a()
+	_, _ = f.Write([]byte(s))
+	h := f.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// NextHash picks the upstream for key on service's hash ring, so the same key
+// keeps landing on the same upstream. Upstreams that are unhealthy, cooling
+// down, breaker-open or drained are skipped, moving only their keys to the
+// next upstream on the ring. With error rate weighting, an upstream is also
+// passed over with probability equal to its EWMA error rate, moving that share
+// of its keys on. An empty key falls back to Next.
+func (b *Balancer) NextHash(service string, addrs []string, key string) string {
+	if key == "" || len(addrs) == 0 {
+		return b.Next(service, addrs)
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ring := b.rings[service]
+	if ring == nil || !ring.matches(addrs) {
+		ring = newHashRing(addrs, b.virtualNodes)
+		b.rings[service] = ring
+		ringRebuilds.WithLabelValues(service).Inc()
+	}
+	weights := b.weights[service]
+
+	// First pass: healthy upstreams not passed over for their error rate; second
+	// pass: unknown health but not cooling down
+	var pick string
+	ring.walk(key, func(addr string) bool {
+		if drained(weights, addr) || !b.available(addr, now, "open window elapsed") {
+			return false
+		}
+		if ok, has := b.healthy[addr]; has && !ok {
+			return false
+		}
+		if b.errorSkipped(addr) {
+			return false
+		}
+		pick = addr
+		return true
+	})
+	if pick == "" {
+		ring.walk(key, func(addr string) bool {
+			if drained(weights, addr) || !b.available(addr, now, "second pass open window elapsed") {
+				return false
+			}
+			pick = addr
+			return true
+		})
+	}
+	if pick == "" {
+		// All are on cooldown; keep the key's home upstream anyway
+		ring.walk(key, func(addr string) bool {
+			if drained(weights, addr) {
+				return false
+			}
+			pick = addr
+			return true
+		})
+		return pick
+	}
+	b.startTrial(pick)
+	return pick
+}
@@ -0,0 +1,150 @@
+package balancer
+
+import (
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var upstreamLatencyEWMA = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "charon_upstream_latency_ewma_seconds",
+	Help: "Exponentially weighted moving average of the upstream request latency",
+}, []string{"upstream"})
+
+// failurePenalty scales the latency recorded for a failed request, so an
+// upstream that fails fast does not look like the fastest one
+const failurePenalty = 4
+
+// latencyEWMA is the smoothed request latency of an upstream
+type latencyEWMA struct {
+	seconds float64
+	updated time.Time
+}
+
+// RecordLatency folds the latency of a request served by addr into its EWMA
+func (b *Balancer) RecordLatency(addr string, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.recordLatency(addr, latency.Seconds())
+}
+
+// RecordFailureLatency folds a failed request to addr into its EWMA as
+// failurePenalty times the slower of its latency and addr's average (the
+// average of every measured upstream while addr has none)
+func (b *Balancer) RecordFailureLatency(addr string, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	base := latency.Seconds()
+	if e := b.latency[addr]; e != nil {
+		base = max(base, e.seconds)
+	} else {
+		var sum float64
+		for _, e := range b.latency {
+			sum += e.seconds
+		}
+		if len(b.latency) > 0 {
+			base = max(base, sum/float64(len(b.latency)))
+		}
+	}
+	b.recordLatency(addr, failurePenalty*base)
+}
+
+// recordLatency folds sample, in seconds, into the EWMA of addr. Caller holds b.mu.
+func (b *Balancer) recordLatency(addr string, sample float64) {
+	e, ok := b.latency[addr]
+	if !ok {
+		e = &latencyEWMA{seconds: sample}
+		b.latency[addr] = e
+	} else {
+		e.seconds = b.latencyDecay*sample + (1-b.latencyDecay)*e.seconds
+	}
+	e.updated = time.Now()
+	upstreamLatencyEWMA.WithLabelValues(addr).Set(e.seconds)
+}
+
+// LatencyEWMA returns the smoothed request latency of addr (0 = no requests seen)
+func (b *Balancer) LatencyEWMA(addr string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e := b.latency[addr]; e != nil {
+		return time.Duration(e.seconds * float64(time.Second))
+	}
+	return 0
+}
+
+// latencyScore is the EWMA of addr halved for every latencyHalfLife without a
+// request, so an upstream passed over for being slow is tried again once the
+// others' averages are the higher ones. It reports false while addr has not
+// been measured. Caller holds b.mu.
+func (b *Balancer) latencyScore(addr string, now time.Time) (float64, bool) {
+	e := b.latency[addr]
+	if e == nil {
+		return 0, false
+	}
+	idle := now.Sub(e.updated)
+	return e.seconds * math.Exp2(-idle.Seconds()/b.latencyHalfLife.Seconds()), true
+}
+
+// NextLatency picks the upstream of service with the lowest request latency
+// EWMA (RecordLatency) among the healthy ones that are not cooling down,
+// breaker-open or drained; ties go round-robin. Upstreams not measured yet
+// score the average of the measured ones, so a new upstream is tried without
+// drawing every request until its first ones complete. With error rate
+// weighting, scores are divided by 1 - the EWMA error rate. Without an
+// eligible upstream it falls back to Next.
+func (b *Balancer) NextLatency(service string, addrs []string) string {
+	n := len(addrs)
+	if n == 0 {
+		return ""
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := b.rrStart(service, n)
+	weights := b.weights[service]
+
+	type candidate struct {
+		idx      int
+		score    float64
+		measured bool
+	}
+	candidates := make([]candidate, 0, n)
+	var sum float64
+	measured := 0
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		addr := addrs[idx]
+		if drained(weights, addr) || !b.available(addr, now, "open window elapsed") {
+			continue
+		}
+		if ok, has := b.healthy[addr]; has && !ok {
+			continue
+		}
+		score, ok := b.latencyScore(addr, now)
+		if ok {
+			sum += score
+			measured++
+		}
+		candidates = append(candidates, candidate{idx, score, ok})
+	}
+	average := 0.0
+	if measured > 0 {
+		average = sum / float64(measured)
+	}
+	best, bestScore := -1, 0.0
+	for _, c := range candidates {
+		if !c.measured {
+			c.score = average
+		}
+		c.score /= b.errorFactor(addrs[c.idx])
+		if best < 0 || c.score < bestScore {
+			best, bestScore = c.idx, c.score
+		}
+	}
+	if best < 0 {
+		return b.next(service, addrs, now)
+	}
+	return b.take(service, best, n, addrs[best])
+}
@@ -0,0 +1,100 @@
+package balancer
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/metrics"
+)
+
+var outlierEjections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "charon_outlier_ejections_total",
+	Help: "Upstreams ejected by outlier detection",
+}, []string{"service", "upstream"})
+
+// outlierState tracks the recent outcomes of an upstream for outlier detection
+type outlierState struct {
+	window       rollingWindow
+	ejectedUntil time.Time
+}
+
+// ejected reports whether addr is currently ejected by outlier detection. Caller holds b.mu.
+func (b *Balancer) ejected(addr string, now time.Time) bool {
+	o := b.outliers[addr]
+	return o != nil && now.Before(o.ejectedUntil)
+}
+
+// recordOutlier adds a request outcome of addr and, after a failure, ejects it
+// when its error rate stands out from the rest of its service's pool. Caller holds b.mu.
+func (b *Balancer) recordOutlier(addr string, failed bool, now time.Time) {
+	if !b.outlierEnabled {
+		return
+	}
+	o := b.outliers[addr]
+	if o == nil {
+		o = &outlierState{}
+		b.outliers[addr] = o
+	}
+	o.window.record(now, b.outlierWindow, failed)
+	if failed && !now.Before(o.ejectedUntil) {
+		b.detectOutlier(addr, o, now)
+	}
+}
+
+// detectOutlier compares the error rate of addr with the other upstreams of
+// its service that saw enough requests, and ejects it if it is worse by the
+// configured margin and the pool's ejection limit allows. Caller holds b.mu.
+func (b *Balancer) detectOutlier(addr string, o *outlierState, now time.Time) {
+	total, failed := o.window.counts(now)
+	if total < b.outlierMinReqs {
+		return
+	}
+	svc := b.addrService[addr]
+	pool := b.services[svc]
+	var peerTotal, peerFailed, ejected int
+	for _, a := range pool {
+		if a == addr {
+			continue
+		}
+		if b.ejected(a, now) {
+			ejected++
+			continue
+		}
+		if p := b.outliers[a]; p != nil {
+			if t, f := p.window.counts(now); t >= b.outlierMinReqs {
+				peerTotal += t
+				peerFailed += f
+			}
+		}
+	}
+	if peerTotal == 0 {
+		return // nothing to compare against
+	}
+	rate := float64(failed) / float64(total)
+	poolRate := float64(peerFailed) / float64(peerTotal)
+	if (rate-poolRate)*100 < b.outlierMargin {
+		return
+	}
+	if (ejected+1)*100 > len(pool)*b.maxEjection {
+		return
+	}
+	o.ejectedUntil = now.Add(b.ejectionTime)
+	o.window.reset() // judged afresh once it is back
+	logging.GetLogger().Warn("outlier_ejected",
+		zap.String("service", svc),
+		zap.String("upstream", addr),
+		zap.Float64("error_rate", rate),
+		zap.Float64("pool_error_rate", poolRate),
+		zap.Duration("ejection_time", b.ejectionTime),
+	)
+	outlierEjections.WithLabelValues(svc, addr).Inc()
+	tags := map[string]string{"upstream": addr}
+	if svc != "" {
+		tags["service"] = svc
+	}
+	metrics.Count("outlier.ejections", 1, tags)
+}
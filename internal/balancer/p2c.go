@@ -0,0 +1,80 @@
+package balancer
+
+import "time"
+
+// p2cDraws bounds how many random draws NextP2C makes looking for two
+// eligible upstreams before settling for fewer.
+const p2cDraws = 4
+
+// Acquire counts a request to addr as in flight until the matching Release
+func (b *Balancer) Acquire(addr string) {
+	b.mu.Lock()
+	b.inflight[addr]++
+	b.mu.Unlock()
+}
+
+// Release ends a request counted by Acquire
+func (b *Balancer) Release(addr string) {
+	b.mu.Lock()
+	if b.inflight[addr] > 1 {
+		b.inflight[addr]--
+	} else {
+		delete(b.inflight, addr)
+	}
+	b.mu.Unlock()
+}
+
+// NextP2C picks the upstream for service by the power of two choices: it
+// samples two upstreams at random and takes the one with fewer requests in
+// flight, preferring the lower health check latency on a tie. Sampling skips
+// upstreams that are unhealthy, cooling down, breaker-open or drained, and
+// costs the same however large the pool is. With error rate weighting, a
+// sample is also passed over with probability equal to its EWMA error rate.
+// When no sample is eligible it falls back to Next.
+func (b *Balancer) NextP2C(service string, addrs []string) string {
+	n := len(addrs)
+	if n == 0 {
+		return ""
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	weights := b.weights[service]
+
+	var picks []string
+	for i := 0; i < p2cDraws && len(picks) < 2; i++ {
+		addr := addrs[b.rng.IntN(n)]
+		if len(picks) == 1 && picks[0] == addr {
+			continue
+		}
+		if drained(weights, addr) || !b.available(addr, now, "open window elapsed") {
+			continue
+		}
+		if ok, has := b.healthy[addr]; has && !ok {
+			continue
+		}
+		if b.errorSkipped(addr) {
+			continue
+		}
+		picks = append(picks, addr)
+	}
+	if len(picks) == 0 {
+		return b.next(service, addrs, now)
+	}
+	pick := picks[0]
+	if len(picks) == 2 && b.lessLoaded(picks[1], pick) {
+		pick = picks[1]
+	}
+	b.startTrial(pick)
+	return pick
+}
+
+// lessLoaded reports whether a has fewer requests in flight than c, or as many
+// and a lower health check latency. Caller holds b.mu.
+func (b *Balancer) lessLoaded(a, c string) bool {
+	if b.inflight[a] != b.inflight[c] {
+		return b.inflight[a] < b.inflight[c]
+	}
+	la, lc := b.healthLatency[a], b.healthLatency[c]
+	return la > 0 && (lc == 0 || la < lc)
+}
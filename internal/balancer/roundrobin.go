@@ -0,0 +1,137 @@
+package balancer
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Gate values published per upstream for the lock-free path of Next. gateOpen
+// lets the address be picked as is; any other value in the past (gateCheck, or
+// an expiry that has passed) means its state must be looked at under b.mu, and
+// a value in the future skips it until then.
+const (
+	gateOpen  int64 = 0
+	gateCheck int64 = -1
+	gateNever int64 = math.MaxInt64
+)
+
+// rrState is the round-robin position of a service
+type rrState struct {
+	next     atomic.Uint64              // index after the last pick, modulo the address count
+	weighted atomic.Bool                // registry weights set: picks need b.mu
+	synced   atomic.Pointer[serviceSet] // last SyncService, nil after SetServiceAddrs/SetServiceWeights
+}
+
+// serviceSet is the addresses and registry weights a service last resolved to
+type serviceSet struct {
+	addrs   []string
+	weights map[string]int
+}
+
+// matches reports whether addrs and weights equal the recorded set
+func (s *serviceSet) matches(addrs []string, weights map[string]int) bool {
+	return slices.Equal(s.addrs, addrs) && (s.weights == nil) == (weights == nil) && maps.Equal(s.weights, weights)
+}
+
+// roundRobin holds the state Next reads without b.mu. Writers hold b.mu.
+type roundRobin struct {
+	services sync.Map // service -> *rrState
+	gates    sync.Map // addr -> *atomic.Int64
+}
+
+// rr returns the round-robin state of service
+func (b *Balancer) rr(service string) *rrState {
+	if s, ok := b.rrStates.services.Load(service); ok {
+		return s.(*rrState)
+	}
+	s, _ := b.rrStates.services.LoadOrStore(service, &rrState{})
+	return s.(*rrState)
+}
+
+// rrStart returns where the round-robin scan of service's n addresses begins
+func (b *Balancer) rrStart(service string, n int) int {
+	return int(b.rr(service).next.Load() % uint64(n))
+}
+
+// refreshGate publishes the gate of addr from its cooldown, ejection, health
+// and breaker state. Caller holds b.mu.
+func (b *Balancer) refreshGate(addr string, now time.Time) {
+	g := gateOpen
+	if until, ok := b.downUntil[addr]; ok && now.Before(until) {
+		g = until.UnixNano()
+	}
+	if o := b.outliers[addr]; o != nil && now.Before(o.ejectedUntil) {
+		g = max(g, o.ejectedUntil.UnixNano())
+	}
+	unhealthy := false
+	if ok, has := b.healthy[addr]; has && !ok {
+		unhealthy = true
+	}
+	s := b.cb[addr]
+	switch {
+	case s != nil && s.state == 1:
+		if now.After(s.openUntil) {
+			g = gateCheck // due to go half-open
+		} else {
+			// Also when unhealthy: it goes half-open once the window and
+			// any cooldown have passed
+			g = max(g, s.openUntil.UnixNano())
+		}
+	case unhealthy:
+		g = gateNever // until a health check or reset changes it
+	case s != nil && s.state == 2:
+		g = gateCheck // trials are counted under b.mu
+	}
+	gate, ok := b.rrStates.gates.Load(addr)
+	if !ok {
+		if g == gateOpen {
+			return
+		}
+		gate, _ = b.rrStates.gates.LoadOrStore(addr, new(atomic.Int64))
+	}
+	gate.(*atomic.Int64).Store(g)
+}
+
+// nextLockFree is the plain round-robin fast path of Next: it picks the next
+// address whose gate is open without taking b.mu. It reports false when the
+// choice needs the full selection, e.g. with weights or when an address on the
+// way is due for a state change.
+func (b *Balancer) nextLockFree(service string, addrs []string) (string, bool) {
+	if b.latencyWeighting || b.errorWeighting {
+		return "", false
+	}
+	rs := b.rr(service)
+	if rs.weighted.Load() {
+		return "", false
+	}
+	n := uint64(len(addrs))
+	now := time.Now().UnixNano()
+	for {
+		start := rs.next.Load()
+		picked := -1
+		for i := uint64(0); i < n; i++ {
+			idx := (start + i) % n
+			g := gateOpen
+			if gate, ok := b.rrStates.gates.Load(addrs[idx]); ok {
+				g = gate.(*atomic.Int64).Load()
+			}
+			if g == gateOpen {
+				picked = int(idx)
+				break
+			}
+			if g <= now {
+				return "", false
+			}
+		}
+		if picked < 0 {
+			return "", false // nothing healthy: fall back to the passes of next
+		}
+		if rs.next.CompareAndSwap(start, uint64(picked+1)%n) {
+			return addrs[picked], true
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package balancer
+
+import "time"
+
+// Stick reports whether a client pinned to addr can stay there: addr must be
+// healthy (or not probed yet), outside its cooldown, admitted by its breaker
+// and not drained. A true result counts as a pick of addr, like Next.
+func (b *Balancer) Stick(service, addr string) bool {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if drained(b.weights[service], addr) || !b.available(addr, now, "open window elapsed") {
+		return false
+	}
+	if ok, has := b.healthy[addr]; has && !ok {
+		return false
+	}
+	b.startTrial(addr)
+	return true
+}
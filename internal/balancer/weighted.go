@@ -0,0 +1,93 @@
+package balancer
+
+// baseWeight is the weight of an upstream before latency scaling
+const baseWeight = 100
+
+// minErrorFactor bounds the error rate scaling of NextLatency scores, so an
+// upstream failing every request scores 100x its latency rather than infinity
+const minErrorFactor = 0.01
+
+// effectiveWeight scales baseWeight by fastest/observed health-check latency
+// (bounded below by minLatencyFactor) and by 1 - the EWMA error rate, for
+// whichever weightings are enabled. Upstreams without samples keep full weight.
+// Caller holds b.mu.
+func (b *Balancer) effectiveWeight(addr string, fastest float64) int64 {
+	factor := 1.0
+	if lat := float64(b.healthLatency[addr]); b.latencyWeighting && lat > 0 && fastest > 0 {
+		factor = fastest / lat
+		if factor < b.minLatencyFactor {
+			factor = b.minLatencyFactor
+		}
+		if factor > 1 {
+			factor = 1
+		}
+	}
+	if b.errorWeighting {
+		factor *= 1 - b.errorRate[addr]
+	}
+	w := int64(baseWeight * factor)
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// errorFactor is 1 - the EWMA error rate of addr with error rate weighting on,
+// bounded below by minErrorFactor, and 1 otherwise. Caller holds b.mu.
+func (b *Balancer) errorFactor(addr string) float64 {
+	if !b.errorWeighting {
+		return 1
+	}
+	return max(1-b.errorRate[addr], minErrorFactor)
+}
+
+// errorSkipped reports whether a sampling strategy should pass over addr for
+// its error rate: with error rate weighting on, it does so with probability
+// equal to the EWMA error rate. Caller holds b.mu.
+func (b *Balancer) errorSkipped(addr string) bool {
+	return b.errorWeighting && b.rng.Float64() < b.errorRate[addr]
+}
+
+// drained reports whether addr has registry weight 0
+func drained(weights map[string]int, addr string) bool {
+	w, ok := weights[addr]
+	return ok && w <= 0
+}
+
+// staticWeight returns the registry weight of addr in service (1 if unweighted)
+func (b *Balancer) staticWeight(service, addr string) int64 {
+	if w, ok := b.weights[service][addr]; ok {
+		return int64(w)
+	}
+	return 1
+}
+
+// pickWeighted selects among candidate indexes of addrs using smooth weighted
+// round-robin (nginx-style current weights), combining registry weights with
+// latency and error rate scaling. Caller holds b.mu.
+func (b *Balancer) pickWeighted(service string, addrs []string, candidates []int) int {
+	var fastest float64
+	for _, idx := range candidates {
+		if lat := float64(b.healthLatency[addrs[idx]]); lat > 0 && (fastest == 0 || lat < fastest) {
+			fastest = lat
+		}
+	}
+	cw := b.currentWeight[service]
+	if cw == nil {
+		cw = map[string]int64{}
+		b.currentWeight[service] = cw
+	}
+	var total int64
+	best := -1
+	for _, idx := range candidates {
+		addr := addrs[idx]
+		w := b.effectiveWeight(addr, fastest) * b.staticWeight(service, addr)
+		cw[addr] += w
+		total += w
+		if best < 0 || cw[addr] > cw[addrs[best]] {
+			best = idx
+		}
+	}
+	cw[addrs[best]] -= total
+	return best
+}
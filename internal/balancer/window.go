@@ -0,0 +1,68 @@
+package balancer
+
+import "time"
+
+// Circuit breaker modes
+const (
+	BreakerConsecutive = "consecutive" // trip after FailureThreshold failures in a row
+	BreakerErrorRate   = "error_rate"  // trip when the failure ratio over BreakerWindow is too high
+)
+
+// windowBuckets is the number of buckets a rolling window is split into, so
+// outcomes expire in steps of a tenth of the window.
+const windowBuckets = 10
+
+// bucket counts the outcomes of one slice of a rolling window
+type bucket struct {
+	epoch  int64 // slice index since the Unix epoch
+	total  int
+	failed int
+}
+
+// rollingWindow counts request outcomes over the last width of time
+type rollingWindow struct {
+	width   time.Duration
+	buckets [windowBuckets]bucket
+}
+
+// slice returns the index of the bucket-sized slice of time containing now
+func (w *rollingWindow) slice(now time.Time) int64 {
+	size := int64(w.width) / windowBuckets
+	if size <= 0 {
+		size = 1
+	}
+	return now.UnixNano() / size
+}
+
+// record adds one outcome at now. A change of width discards what was counted.
+func (w *rollingWindow) record(now time.Time, width time.Duration, failed bool) {
+	if w.width != width {
+		*w = rollingWindow{width: width}
+	}
+	epoch := w.slice(now)
+	b := &w.buckets[epoch%windowBuckets]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	b.total++
+	if failed {
+		b.failed++
+	}
+}
+
+// counts returns the requests and failures recorded within the window ending at now
+func (w *rollingWindow) counts(now time.Time) (total, failed int) {
+	epoch := w.slice(now)
+	for _, b := range w.buckets {
+		if b.total > 0 && epoch-b.epoch < windowBuckets {
+			total += b.total
+			failed += b.failed
+		}
+	}
+	return total, failed
+}
+
+// reset forgets all outcomes
+func (w *rollingWindow) reset() {
+	*w = rollingWindow{width: w.width}
+}
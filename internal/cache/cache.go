@@ -0,0 +1,252 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// State describes the freshness of a cache lookup
+type State int
+
+const (
+	Miss  State = iota // no usable entry
+	Hit                // entry is fresh
+	Stale              // entry expired but still inside its stale-while-revalidate window
+)
+
+// String returns the value used for the X-Cache header and metric labels
+func (s State) String() string {
+	switch s {
+	case Hit:
+		return "HIT"
+	case Stale:
+		return "STALE"
+	default:
+		return "MISS"
+	}
+}
+
+// Entry is a stored upstream response
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Stored time.Time
+	TTL    time.Duration // how long the entry is fresh
+	SWR    time.Duration // how long after expiry the entry may still be served stale
+}
+
+// Size approximates the memory held by the entry (body plus headers)
+func (e *Entry) Size() int64 {
+	n := int64(len(e.Body))
+	for k, vs := range e.Header {
+		for _, v := range vs {
+			n += int64(len(k) + len(v))
+		}
+	}
+	return n
+}
+
+// Age returns how long ago the entry was stored
+func (e *Entry) Age(now time.Time) time.Duration {
+	return now.Sub(e.Stored)
+}
+
+func (e *Entry) state(now time.Time) State {
+	age := e.Age(now)
+	switch {
+	case age < e.TTL:
+		return Hit
+	case age < e.TTL+e.SWR:
+		return Stale
+	default:
+		return Miss
+	}
+}
+
+// Cache is an in-memory response cache with stale-while-revalidate support.
+// When bounded, entries are evicted least-recently-used first.
+type Cache struct {
+	mu           sync.Mutex
+	entries      map[string]*list.Element // values are *item
+	lru          *list.List               // front = most recently used
+	revalidating map[string]bool
+	filling      map[string]chan struct{} // closed when the fill of the key ends
+	varies       map[string]*varySpec     // base key -> headers its entries vary on
+
+	maxEntryBytes int64 // entries larger than this are not stored (0 = unlimited)
+	maxSizeBytes  int64 // total size bound (0 = unlimited)
+	size          int64
+
+	hits, lookups uint64
+	evictions     uint64
+}
+
+type item struct {
+	key   string
+	base  string // key of the request without its Vary header values
+	entry *Entry
+	size  int64
+}
+
+// Stats is a snapshot of cache usage
+type Stats struct {
+	Entries   int
+	Bytes     int64
+	Hits      uint64 // fresh or stale hits
+	Lookups   uint64
+	Evictions uint64
+}
+
+// New creates an empty, unbounded cache
+func New() *Cache {
+	return NewWithLimits(0, 0)
+}
+
+// NewWithLimits creates a cache that skips entries larger than maxEntryBytes and
+// evicts least-recently-used entries to stay within maxSizeBytes (0 = unlimited).
+func NewWithLimits(maxEntryBytes, maxSizeBytes int64) *Cache {
+	return &Cache{
+		entries:       make(map[string]*list.Element),
+		lru:           list.New(),
+		revalidating:  make(map[string]bool),
+		filling:       make(map[string]chan struct{}),
+		varies:        make(map[string]*varySpec),
+		maxEntryBytes: maxEntryBytes,
+		maxSizeBytes:  maxSizeBytes,
+	}
+}
+
+// MaxEntryBytes returns the per-entry size limit (0 = unlimited)
+func (c *Cache) MaxEntryBytes() int64 {
+	return c.maxEntryBytes
+}
+
+// Get looks up key and reports the entry freshness. Entries past their
+// stale window are removed and reported as Miss.
+func (c *Cache) Get(key string) (*Entry, State) {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lookups++
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, Miss
+	}
+	it := el.Value.(*item)
+	st := it.entry.state(now)
+	if st == Miss {
+		c.remove(el)
+		return nil, Miss
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	return it.entry, st
+}
+
+// Set stores an entry under key. It returns false when the entry exceeds the
+// per-entry limit, and the number of entries evicted to make room.
+func (c *Cache) Set(key string, e *Entry) (stored bool, evicted int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.set(key, key, e)
+}
+
+// set stores e under key for base. Caller holds c.mu.
+func (c *Cache) set(key, base string, e *Entry) (stored bool, evicted int) {
+	size := e.Size()
+	spec := c.varies[base] // kept even if the entries making room were its last
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	if (c.maxEntryBytes > 0 && size > c.maxEntryBytes) || (c.maxSizeBytes > 0 && size > c.maxSizeBytes) {
+		return false, 0
+	}
+	for c.maxSizeBytes > 0 && c.size+size > c.maxSizeBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		c.remove(oldest)
+		c.evictions++
+		evicted++
+	}
+	c.entries[key] = c.lru.PushFront(&item{key: key, base: base, entry: e, size: size})
+	c.size += size
+	if spec != nil {
+		c.varies[base] = spec
+		spec.entries++
+	}
+	return true, evicted
+}
+
+// Stats returns a snapshot of cache usage
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Entries:   len(c.entries),
+		Bytes:     c.size,
+		Hits:      c.hits,
+		Lookups:   c.lookups,
+		Evictions: c.evictions,
+	}
+}
+
+// remove drops an element. Caller holds c.mu.
+func (c *Cache) remove(el *list.Element) {
+	it := el.Value.(*item)
+	c.lru.Remove(el)
+	delete(c.entries, it.key)
+	c.size -= it.size
+	if v := c.varies[it.base]; v != nil {
+		if v.entries--; v.entries <= 0 {
+			delete(c.varies, it.base)
+		}
+	}
+}
+
+// BeginRevalidate marks key as being refreshed. It returns false when a
+// refresh for key is already in flight so only one runs at a time.
+func (c *Cache) BeginRevalidate(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.revalidating[key] {
+		return false
+	}
+	c.revalidating[key] = true
+	return true
+}
+
+// EndRevalidate clears the in-flight refresh marker for key
+func (c *Cache) EndRevalidate(key string) {
+	c.mu.Lock()
+	delete(c.revalidating, key)
+	c.mu.Unlock()
+}
+
+// BeginFill claims the upstream fetch for a missed key. The first caller gets
+// leader true and must call EndFill; later callers get a channel that is closed
+// when that fetch ends, so concurrent misses don't all go upstream.
+func (c *Cache) BeginFill(key string) (done <-chan struct{}, leader bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.filling[key]; ok {
+		return ch, false
+	}
+	c.filling[key] = make(chan struct{})
+	return nil, true
+}
+
+// EndFill ends the fetch claimed by BeginFill and wakes the callers waiting on it
+func (c *Cache) EndFill(key string) {
+	c.mu.Lock()
+	ch := c.filling[key]
+	delete(c.filling, key)
+	c.mu.Unlock()
+	if ch != nil {
+		close(ch)
+	}
+}
@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// varySpec is the set of request headers the entries of a base key vary on
+type varySpec struct {
+	names   []string // canonical, sorted
+	entries int      // stored entries of the base key
+}
+
+// VaryNames returns the request headers named by the Vary header of a
+// response, canonical and sorted. It reports false for "Vary: *", which
+// matches no later request.
+func VaryNames(h http.Header) ([]string, bool) {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, false
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), true
+}
+
+// variantKey extends base with the values of the named request headers
+func variantKey(base string, names []string, h http.Header) string {
+	if len(names) == 0 {
+		return base
+	}
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range names {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(h.Values(name), ","))
+	}
+	return b.String()
+}
+
+// Key returns the key of the entry for a request to base with header h: base
+// extended with the request's values of the headers its stored responses
+// vary on, or base itself when they don't.
+func (c *Cache) Key(base string, h http.Header) string {
+	c.mu.Lock()
+	v := c.varies[base]
+	c.mu.Unlock()
+	if v == nil {
+		return base
+	}
+	return variantKey(base, v.names, h)
+}
+
+// SetVaried stores e, the response to a request to base with header h, under
+// the key its Vary header selects. When the response varies on other headers
+// than the stored entries of base, those entries are dropped. It returns the
+// results of Set.
+func (c *Cache) SetVaried(base string, h http.Header, e *Entry) (stored bool, evicted int) {
+	names, ok := VaryNames(e.Header)
+	if !ok {
+		return false, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v := c.varies[base]; (v == nil && len(names) > 0) || (v != nil && !slices.Equal(v.names, names)) {
+		c.removeBase(base)
+	}
+	if len(names) > 0 && c.varies[base] == nil {
+		c.varies[base] = &varySpec{names: names}
+	}
+	return c.set(variantKey(base, names, h), base, e)
+}
+
+// removeBase drops every entry stored for base. Caller holds c.mu.
+func (c *Cache) removeBase(base string) {
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*item).base == base {
+			c.remove(el)
+		}
+		el = next
+	}
+	delete(c.varies, base)
+}
@@ -0,0 +1,98 @@
+// Package concurrency limits requests in flight to what the upstreams can absorb.
+package concurrency
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// longWindow is the number of samples averaged into the baseline latency
+	longWindow = 600
+	// tolerance is how far latency may rise over the baseline before the limit shrinks
+	tolerance = 1.5
+	// smoothing is the weight of each new limit estimate
+	smoothing = 0.2
+)
+
+// AdaptiveLimiter caps requests in flight at a limit that follows latency, after
+// Netflix's gradient algorithm. Each sample is compared with a long-term average:
+// while they match the limit grows by about its square root, and as latency rises
+// above the average the limit shrinks in proportion, shedding load before the
+// upstreams' queues do.
+type AdaptiveLimiter struct {
+	mu       sync.Mutex
+	limit    float64
+	min, max float64
+	longRTT  float64 // average latency in seconds, the baseline without queueing
+	samples  int
+	inflight int
+}
+
+// NewAdaptiveLimiter creates a limiter starting at initial requests in flight and
+// kept between minLimit and maxLimit
+func NewAdaptiveLimiter(initial, minLimit, maxLimit int) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{limit: float64(initial), min: float64(minLimit), max: float64(maxLimit)}
+	l.limit = math.Max(l.min, math.Min(l.max, l.limit))
+	return l
+}
+
+// Acquire takes a slot, or reports false when the limit is reached
+func (l *AdaptiveLimiter) Acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight >= int(l.limit) {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+// Release frees a slot taken by Acquire and adjusts the limit by rtt, the
+// request's latency. A zero rtt, e.g. for a request answered without an
+// upstream, says nothing about upstream load and leaves the limit alone.
+func (l *AdaptiveLimiter) Release(rtt time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	inflight := l.inflight
+	l.inflight--
+	if rtt <= 0 {
+		return
+	}
+
+	short := rtt.Seconds()
+	l.samples++
+	if l.longRTT == 0 {
+		l.longRTT = short
+	} else {
+		l.longRTT += (short - l.longRTT) / float64(min(l.samples, longWindow))
+	}
+	// Recover quickly once a slowdown is over instead of waiting out the window
+	if l.longRTT/short > 2 {
+		l.longRTT *= 0.95
+	}
+	// A limit the traffic doesn't use says nothing about capacity
+	if float64(inflight) < l.limit/2 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, tolerance*l.longRTT/short))
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-smoothing) + next*smoothing
+	l.limit = math.Max(l.min, math.Min(l.max, l.limit))
+}
+
+// Limit returns the current limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// Inflight returns the number of slots taken
+func (l *AdaptiveLimiter) Inflight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight
+}
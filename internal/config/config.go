@@ -1,23 +1,41 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 )
 
 // Config menyimpan konfigurasi aplikasi
 type Config struct {
 	ListenPort string `mapstructure:"listen_port"`
+	// How long to wait for in-flight requests on shutdown (default: "30s")
+	ShutdownTimeout string `mapstructure:"shutdown_timeout"`
 	// Phase 3: gunakan nama service dan registry
 	TargetServiceName string `mapstructure:"target_service_name"`
 	RegistryFile      string `mapstructure:"registry_file"`
 	// Backward compatibility (Phase 1/2)
 	TargetServiceAddr string `mapstructure:"target_service_addr"`
+	// Per-service settings keyed by registry service name (optional)
+	Services map[string]ServiceConfig `mapstructure:"services"`
 	// Advanced routing rules (optional). Evaluated in order; first match wins.
 	Routes []RouteRule `mapstructure:"routes"`
+	// Route to the service named by the Host header when no rule matches (optional)
+	HostAsService HostAsServiceConfig `mapstructure:"host_as_service"`
+	// Load balancing configuration
+	LoadBalancing LoadBalancingConfig `mapstructure:"load_balancing"`
+	// Active health check configuration
+	HealthCheck HealthCheckConfig `mapstructure:"health_check"`
 	// Circuit breaker configuration
 	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	// Eject upstreams that fail much more often than the rest of their service
+	OutlierDetection OutlierDetectionConfig `mapstructure:"outlier_detection"`
 	// Rate limiting configuration
 	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
 	// Logging configuration
@@ -26,26 +44,412 @@ type Config struct {
 	Tracing TracingConfig `mapstructure:"tracing"`
 	// TLS configuration
 	TLS TLSConfig `mapstructure:"tls"`
+	// Admin API configuration
+	Admin AdminConfig `mapstructure:"admin"`
+	// Client authentication
+	Auth AuthConfig `mapstructure:"auth"`
+	// TCP proxy configuration
+	TCP TCPConfig `mapstructure:"tcp"`
+	// PROXY protocol headers from an L4 load balancer in front of Charon
+	ProxyProtocol ProxyProtocolConfig `mapstructure:"proxy_protocol"`
+	// CIDRs or IPs of proxies whose X-Forwarded-Proto/-Host are passed on (default: none)
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+	// Send the client's Host header upstream instead of the upstream address (default: false)
+	PreserveHost bool `mapstructure:"preserve_host"`
+	// Redirect plaintext requests to HTTPS with a 301 when TLS is enabled (default: false)
+	ForceHTTPS bool `mapstructure:"force_https"`
+	// Client address ranges allowed on and denied from the listener (default: all allowed)
+	AccessControl AccessControlConfig `mapstructure:"access_control"`
+	// Registry lookup options
+	Registry RegistryConfig `mapstructure:"registry"`
+	// Metrics export options
+	Metrics MetricsConfig `mapstructure:"metrics"`
+	// Response cache bounds
+	Cache CacheConfig `mapstructure:"cache"`
+	// Header carrying the per-request correlation ID (default: "X-Request-ID")
+	RequestIDHeader string `mapstructure:"request_id_header"`
+	// Upstream timeout for routes without their own, e.g. "15s" (default: none)
+	DefaultTimeout string `mapstructure:"default_timeout"`
+	// Reject request bodies larger than this with 413 (default: 0, unlimited)
+	MaxRequestBodyBytes int64 `mapstructure:"max_request_body_bytes"`
+	// HTTP requests handled at once; more get 503 with Retry-After (default: 0, unlimited; reloadable)
+	MaxConcurrentRequests int `mapstructure:"max_concurrent_requests"`
+	// Latency-driven limit on HTTP requests in flight, on top of max_concurrent_requests
+	Concurrency ConcurrencyConfig `mapstructure:"concurrency"`
+	// Upstream connection pool and timeouts
+	Transport TransportConfig `mapstructure:"transport"`
+	// Client timeouts of the HTTP listener
+	Server ServerConfig `mapstructure:"server"`
+	// Header rewrites for every upstream response, before the route's response_headers
+	Response ResponseConfig `mapstructure:"response"`
+	// Gzip compression of responses sent to clients
+	Compression CompressionConfig `mapstructure:"compression"`
+	// Which upstream errors/statuses count as failures for cooldown and the breaker
+	FailureClassification FailureClassificationConfig `mapstructure:"failure_classification"`
+	// Upstream retries for idempotent requests
+	Retry RetryConfig `mapstructure:"retry"`
+	// Hedged requests for slow upstreams
+	Hedging HedgingConfig `mapstructure:"hedging"`
+	// Refuse to start on ambiguous routing settings instead of logging a warning
+	StrictConfig bool `mapstructure:"strict_config"`
+}
+
+// AccessControlConfig mendefinisikan allowlist/denylist alamat klien.
+// Deny wins over allow; an empty allow list allows every address not denied.
+type AccessControlConfig struct {
+	Allow []string `mapstructure:"allow"` // CIDRs or IPs
+	Deny  []string `mapstructure:"deny"`  // CIDRs or IPs
+}
+
+// RetryConfig mendefinisikan kebijakan retry request idempoten ke upstream
+type RetryConfig struct {
+	MaxRetries    int     `mapstructure:"max_retries"`    // attempts after the first (default: 2, negative disables)
+	Backoff       string  `mapstructure:"backoff"`        // base of the exponential backoff (default: "150ms")
+	BackoffMax    string  `mapstructure:"backoff_max"`    // cap for the backoff and upstream Retry-After (default: "5s")
+	Statuses      []int   `mapstructure:"statuses"`       // response statuses that are retried (default: none, e.g. [503])
+	BudgetPercent float64 `mapstructure:"budget_percent"` // retries allowed as a share of requests (default: 10, negative = unlimited)
+	// Hedge a bodiless GET/HEAD to another upstream after this delay, once (shorthand for hedging)
+	HedgeAfter string `mapstructure:"hedge_after"`
+}
+
+// ConcurrencyConfig mendefinisikan limit adaptif untuk request yang sedang berjalan
+type ConcurrencyConfig struct {
+	Adaptive     bool `mapstructure:"adaptive"`      // adjust the in-flight limit to upstream latency (default: false)
+	InitialLimit int  `mapstructure:"initial_limit"` // limit before any latency is observed (default: 20)
+	MinLimit     int  `mapstructure:"min_limit"`     // floor for the limit (default: 5)
+	MaxLimit     int  `mapstructure:"max_limit"`     // ceiling for the limit (default: 1000)
+}
+
+// TransportConfig mendefinisikan connection pool dan timeout ke upstream
+type TransportConfig struct {
+	MaxIdleConns          int    `mapstructure:"max_idle_conns"`          // idle connections kept per upstream pool (default: 100)
+	MaxIdleConnsPerHost   int    `mapstructure:"max_idle_conns_per_host"` // idle connections kept per upstream (default: 10)
+	MaxConnsPerHost       int    `mapstructure:"max_conns_per_host"`      // connections per upstream, dialing included (default: 0, unlimited)
+	DialTimeout           string `mapstructure:"dial_timeout"`            // default: "5s"
+	TLSHandshakeTimeout   string `mapstructure:"tls_handshake_timeout"`   // default: "5s"
+	ResponseHeaderTimeout string `mapstructure:"response_header_timeout"` // for requests without a route or default timeout (default: "10s")
+	IdleConnTimeout       string `mapstructure:"idle_conn_timeout"`       // default: "90s"
+	BufferSize            int    `mapstructure:"buffer_size"`             // bytes per pooled body copy buffer (default: 32768)
+}
+
+// ServerConfig mendefinisikan timeout koneksi klien pada listener HTTP
+type ServerConfig struct {
+	ReadHeaderTimeout string `mapstructure:"read_header_timeout"` // request line and headers (default: "10s")
+	ReadTimeout       string `mapstructure:"read_timeout"`        // whole request, body included (default: none)
+	WriteTimeout      string `mapstructure:"write_timeout"`       // whole response, streams included; upgraded connections exempt (default: none)
+	IdleTimeout       string `mapstructure:"idle_timeout"`        // keep-alive wait for the next request (default: "120s")
+}
+
+// ResponseConfig mendefinisikan manipulasi header untuk semua response dari upstream
+type ResponseConfig struct {
+	RemoveHeaders []string          `mapstructure:"remove_headers"` // headers dropped, e.g. Server (default: [X-Powered-By]; [] keeps all)
+	SetHeaders    map[string]string `mapstructure:"set_headers"`    // headers replaced, e.g. Server: "Charon" (templates as in response_headers)
+}
+
+// CompressionConfig mendefinisikan kompresi gzip response ke klien
+type CompressionConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`       // gzip eligible responses when the client accepts it (default: false)
+	MinLength    int      `mapstructure:"min_length"`    // only compress bodies of at least this many bytes (default: 1024)
+	ContentTypes []string `mapstructure:"content_types"` // media types to compress, "text/*" style wildcards allowed (default: common text types)
+}
+
+// RegistryConfig mendefinisikan opsi resolusi alamat dari registry
+type RegistryConfig struct {
+	Type               string `mapstructure:"type"`                 // file (registry_file, default), dns (SRV records) or api (admin registration)
+	Namespace          string `mapstructure:"namespace"`            // dns: namespace in _<service>._tcp.<namespace>.<domain> (default: "default")
+	Domain             string `mapstructure:"domain"`               // dns: domain suffix of SRV names (default: "svc.cluster.local")
+	DNSServer          string `mapstructure:"dns_server"`           // dns: nameserver host[:port] (default: first nameserver in /etc/resolv.conf)
+	ExpandDNS          bool   `mapstructure:"expand_dns"`           // balance across every A/AAAA record of hostname entries (default: false)
+	DNSRefreshInterval string `mapstructure:"dns_refresh_interval"` // how often hostnames are re-resolved (default: "30s")
+}
+
+// MetricsConfig mendefinisikan konfigurasi ekspor metrics tambahan
+type MetricsConfig struct {
+	StatsD StatsDConfig `mapstructure:"statsd"`
+	// Label request and rate-limit metrics with the matched route's name (default: false)
+	RouteLabels bool `mapstructure:"route_labels"`
+	// Upper bounds in seconds of the request latency histogram buckets, increasing (default: Prometheus' DefBuckets)
+	LatencyBuckets []float64 `mapstructure:"latency_buckets"`
+}
+
+// StatsDConfig mendefinisikan konfigurasi sink StatsD/DogStatsD
+type StatsDConfig struct {
+	Address string `mapstructure:"address"` // agent host:port over UDP (empty = disabled)
+	Prefix  string `mapstructure:"prefix"`  // metric name prefix (default: "charon")
+	Tags    bool   `mapstructure:"tags"`    // send DogStatsD tags (default: false)
+}
+
+// CacheConfig mendefinisikan batas memori response cache
+type CacheConfig struct {
+	MaxEntryBytes int64 `mapstructure:"max_entry_bytes"` // responses larger than this are not cached (default: 1 MiB)
+	MaxSizeBytes  int64 `mapstructure:"max_size_bytes"`  // total cache size, LRU eviction beyond it (default: 64 MiB)
+}
+
+// FailureClassificationConfig mendefinisikan error/status mana yang dihitung sebagai kegagalan upstream
+type FailureClassificationConfig struct {
+	FailureStatuses []int    `mapstructure:"failure_statuses"` // extra failure statuses besides circuit_breaker.trip_statuses (e.g. [408])
+	NeutralStatuses []int    `mapstructure:"neutral_statuses"` // statuses ignored for health (default: [429])
+	NeutralErrors   []string `mapstructure:"neutral_errors"`   // error classes ignored: refused, timeout, reset, canceled, dns, other (default: [canceled])
+}
+
+// HedgingConfig mendefinisikan hedged request ke upstream lain saat upstream utama lambat
+type HedgingConfig struct {
+	Enabled       bool    `mapstructure:"enabled"`        // hedge bodiless GET/HEAD requests (default: false)
+	Delay         string  `mapstructure:"delay"`          // wait for the primary before each hedge (default: "100ms")
+	MaxHedges     int     `mapstructure:"max_hedges"`     // extra attempts per request (default: 1)
+	BudgetPercent float64 `mapstructure:"budget_percent"` // cap hedges to this share of eligible requests (default: 10)
+}
+
+// ServiceConfig mendefinisikan pengaturan per service
+type ServiceConfig struct {
+	DisableKeepAlive bool `mapstructure:"disable_keepalive"` // open a fresh upstream connection per request
+	MaxRPS           int  `mapstructure:"max_rps"`           // cap on aggregate requests/sec sent to this service (0 = unlimited)
+	// Upstream protocol: "grpc" proxies over HTTP/2 (h2c, or h2 with upstream TLS); default HTTP/1.1
+	Protocol string `mapstructure:"protocol"`
 }
 
 // RouteRule mendefinisikan aturan routing berbasis host/path
 type RouteRule struct {
+	Name        string `mapstructure:"name"`        // optional route name, used as the route_name metric label
 	Host        string `mapstructure:"host"`        // optional exact host match (tanpa port)
 	PathPrefix  string `mapstructure:"path_prefix"` // optional path prefix match
+	PathExact   string `mapstructure:"path_exact"`  // optional exact path match (wins over regex and prefix rules)
+	PathRegex   string `mapstructure:"path_regex"`  // optional regex on the whole path (wins over prefix rules)
 	ServiceName string `mapstructure:"service"`     // target service name di registry
+	// Path sent upstream instead of the client's, e.g. "/v2/orders/{{id}}" (optional).
+	// May use {{path}} and path_regex captures such as {{1}} or {{id}}; the query string is kept.
+	Rewrite string `mapstructure:"rewrite"`
+	// Optional query parameter predicates. Values are exact matches, or a regex when prefixed with "~".
+	QueryMatch map[string]string `mapstructure:"query_match"`
+	// Optional HTTP methods the route applies to (case-insensitive; empty = any method)
+	Methods []string `mapstructure:"methods"`
+	// Optional header and cookie predicates, matched like query_match (e.g. X-Api-Version: "2")
+	Headers map[string]string `mapstructure:"headers"`
+	Cookies map[string]string `mapstructure:"cookies"`
+	// Response caching for this route (optional)
+	Cache *RouteCacheConfig `mapstructure:"cache"`
+	// Open a fresh upstream connection for every request on this route
+	DisableKeepAlive bool `mapstructure:"disable_keepalive"`
+	// Upstream protocol for this route, overriding the service's ("grpc" or "http")
+	Protocol string `mapstructure:"protocol"`
+	// Gzip request bodies before forwarding (optional, upstream must accept gzip bodies)
+	CompressUpstreamRequest *RouteCompressConfig `mapstructure:"compress_upstream_request"`
+	// Require a verified mTLS client certificate with these attributes (optional, 403 otherwise)
+	ClientCert *ClientCertConfig `mapstructure:"client_cert"`
+	// Upstream timeout for this route, e.g. "30s" (optional, overrides default_timeout)
+	Timeout string `mapstructure:"timeout"`
+	// Reject request bodies larger than this with 413, overriding the global limit (optional)
+	MaxRequestBodyBytes int64 `mapstructure:"max_request_body_bytes"`
+	// Header rewrites for requests sent upstream and responses sent to the client (optional)
+	RequestHeaders  *HeaderRulesConfig `mapstructure:"request_headers"`
+	ResponseHeaders *HeaderRulesConfig `mapstructure:"response_headers"`
+	// What to serve when every upstream of the service is circuit-open (optional)
+	Fallback *RouteFallbackConfig `mapstructure:"fallback"`
+	// Answer with this static response instead of proxying, e.g. a maintenance page (optional)
+	Respond *RouteRespondConfig `mapstructure:"respond"`
+	// Answer with a redirect instead of proxying (optional)
+	Redirect *RouteRedirectConfig `mapstructure:"redirect"`
+	// Share the route's traffic between services by weight, e.g. for a canary (optional, overrides service)
+	Split *RouteSplitConfig `mapstructure:"split"`
+	// Send the client's Host header upstream, overriding the global preserve_host (optional)
+	PreserveHost *bool `mapstructure:"preserve_host"`
+	// Client address ranges allowed on this route and denied from it, on top of access_control (optional)
+	AllowCIDRs []string `mapstructure:"allow_cidrs"`
+	DenyCIDRs  []string `mapstructure:"deny_cidrs"`
+}
+
+// RouteFallbackConfig mendefinisikan fallback ketika semua upstream sebuah route circuit-open.
+// The service is tried first; the static response is served if it is unset or circuit-open too.
+type RouteFallbackConfig struct {
+	Service     string `mapstructure:"service"`      // service to send the request to instead
+	Status      int    `mapstructure:"status"`       // static response status (default 503)
+	Body        string `mapstructure:"body"`         // static response body
+	ContentType string `mapstructure:"content_type"` // default "text/plain; charset=utf-8"
+}
+
+// RouteRespondConfig mendefinisikan response statis yang dijawab langsung oleh proxy
+type RouteRespondConfig struct {
+	Status  int               `mapstructure:"status"`  // default 200
+	Body    string            `mapstructure:"body"`    // response body
+	Headers map[string]string `mapstructure:"headers"` // response headers (Content-Type defaults to text/plain)
+}
+
+// RouteRedirectConfig mendefinisikan redirect yang dijawab langsung oleh proxy.
+// To may contain {{host}}, {{path}}, {{query}} and path_regex captures such as {{1}} or {{id}};
+// the request's query string is appended when To has none.
+type RouteRedirectConfig struct {
+	To     string `mapstructure:"to"`     // target URL or path
+	Status int    `mapstructure:"status"` // 301, 302, 307 or 308 (default 302)
+}
+
+// RouteSplitConfig mendefinisikan pembagian traffic sebuah route ke beberapa service.
+// Requests satisfying match go to its service; the rest are split by weight,
+// or go to the route's service when no weights are set.
+type RouteSplitConfig struct {
+	Match    *RouteSplitMatch    `mapstructure:"match"`
+	Services []RouteSplitService `mapstructure:"services"`
+}
+
+// RouteSplitMatch mendefinisikan request yang selalu dikirim ke satu service
+type RouteSplitMatch struct {
+	Headers map[string]string `mapstructure:"headers"` // matched like the route's headers, e.g. X-Canary: "true"
+	Cookies map[string]string `mapstructure:"cookies"` // matched like the route's cookies
+	Service string            `mapstructure:"service"` // service for matching requests
+}
+
+// RouteSplitService mendefinisikan bagian traffic untuk satu service
+type RouteSplitService struct {
+	Service string `mapstructure:"service"`
+	Weight  int    `mapstructure:"weight"` // share relative to the other services' weights
+}
+
+// Services returns every service the route may send a request to
+func (r RouteRule) Services() []string {
+	var services []string
+	if r.ServiceName != "" {
+		services = append(services, r.ServiceName)
+	}
+	if r.Split != nil {
+		if r.Split.Match != nil && r.Split.Match.Service != "" {
+			services = append(services, r.Split.Match.Service)
+		}
+		for _, s := range r.Split.Services {
+			services = append(services, s.Service)
+		}
+	}
+	return services
+}
+
+// HeaderRulesConfig mendefinisikan manipulasi header per route.
+// Values may contain {{trace_id}}, {{client_ip}}, {{method}}, {{host}}, {{path}}, {{query}},
+// {{service}} and path_regex captures such as {{1}} or {{id}}.
+type HeaderRulesConfig struct {
+	Set    map[string]string `mapstructure:"set"`    // replace any existing values
+	Add    map[string]string `mapstructure:"add"`    // append to existing values
+	Remove []string          `mapstructure:"remove"` // delete headers (applied first)
+}
+
+// ClientCertConfig mendefinisikan atribut sertifikat klien yang diizinkan untuk sebuah route
+type ClientCertConfig struct {
+	AllowedCN  []string `mapstructure:"allowed_cn"`  // subject common names
+	AllowedOU  []string `mapstructure:"allowed_ou"`  // subject organizational units
+	AllowedOrg []string `mapstructure:"allowed_org"` // subject organizations
+	AllowedSAN []string `mapstructure:"allowed_san"` // DNS, email, IP or URI subject alternative names
+}
+
+// RouteCacheConfig mendefinisikan konfigurasi response cache per route
+type RouteCacheConfig struct {
+	TTL                  string `mapstructure:"ttl"`                    // how long a cached response is fresh (e.g. "30s")
+	StaleWhileRevalidate string `mapstructure:"stale_while_revalidate"` // serve stale while refreshing in background (e.g. "10s")
+}
+
+// RouteCompressConfig mendefinisikan kompresi body request ke upstream per route
+type RouteCompressConfig struct {
+	MinBytes int `mapstructure:"min_bytes"` // only compress bodies larger than this (default: 1024)
+}
+
+// HostAsServiceConfig mendefinisikan routing berbasis Host header tanpa aturan eksplisit
+type HostAsServiceConfig struct {
+	Enabled     bool   `mapstructure:"enabled"`      // derive service name from Host (default: false)
+	StripSuffix string `mapstructure:"strip_suffix"` // suffix removed from Host before lookup (e.g. ".internal")
+}
+
+// LoadBalancingConfig mendefinisikan konfigurasi load balancing
+type LoadBalancingConfig struct {
+	HealthLatencyWeighting bool    `mapstructure:"health_latency_weighting"` // shift traffic away from slow health checks (default: false)
+	MinLatencyFactor       float64 `mapstructure:"min_latency_factor"`       // lower bound for latency weight scaling (default: 0.1)
+	ErrorRateWeighting     bool    `mapstructure:"error_rate_weighting"`     // shift traffic away from upstreams returning errors (default: false)
+	ErrorRateDecay         float64 `mapstructure:"error_rate_decay"`         // EWMA smoothing factor per request outcome (default: 0.1)
+	Strategy               string  `mapstructure:"strategy"`                 // round_robin (default), consistent_hash, p2c or latency_ewma
+	HashOn                 string  `mapstructure:"hash_on"`                  // consistent_hash key: header:<Name>, cookie:<Name> or remote_ip
+	VirtualNodes           int     `mapstructure:"virtual_nodes"`            // ring points per upstream (default: 160)
+	LatencyDecay           float64 `mapstructure:"latency_decay"`            // latency_ewma: EWMA smoothing factor per request (default: 0.3)
+	LatencyHalfLife        string  `mapstructure:"latency_half_life"`        // latency_ewma: an idle upstream's average halves every period (default: "10s")
+
+	// Pin clients to the upstream that served them with a cookie
+	Sticky StickyConfig `mapstructure:"sticky"`
+}
+
+// StickyConfig mendefinisikan sticky session berbasis cookie
+type StickyConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	CookieName string `mapstructure:"cookie_name"` // prefix, suffixed with the service name (default: "CHARON_UPSTREAM")
+	MaxAge     string `mapstructure:"max_age"`     // cookie lifetime, e.g. "24h" (default: until the browser closes)
+	Secret     string `mapstructure:"secret"`      // key for the cookie tokens, shared by instances behind one address (default: random per process)
+}
+
+// OutlierDetectionConfig mendefinisikan deteksi outlier per pool service
+type OutlierDetectionConfig struct {
+	Enabled            bool    `mapstructure:"enabled"`
+	Window             string  `mapstructure:"window"`               // error rates are measured over this window (default "30s")
+	MinRequests        int     `mapstructure:"min_requests"`         // requests in the window before an upstream is judged (default 10)
+	ErrorMargin        float64 `mapstructure:"error_margin"`         // percentage points above the rest of the pool that eject (default 30)
+	EjectionTime       string  `mapstructure:"ejection_time"`        // how long an outlier is skipped (default "30s")
+	MaxEjectionPercent int     `mapstructure:"max_ejection_percent"` // at most this share of a pool is ejected at once (default 50)
+}
+
+// HealthCheckConfig mendefinisikan konfigurasi active health check
+type HealthCheckConfig struct {
+	MaxConcurrent      int `mapstructure:"max_concurrent"`      // parallel health checks per tick across all services (default: 50)
+	HealthyThreshold   int `mapstructure:"healthy_threshold"`   // consecutive successful probes to mark UP (default: 2)
+	UnhealthyThreshold int `mapstructure:"unhealthy_threshold"` // consecutive failed probes to mark DOWN (default: 2)
 }
 
 // CircuitBreakerConfig mendefinisikan konfigurasi circuit breaker
 type CircuitBreakerConfig struct {
 	FailureThreshold int    `mapstructure:"failure_threshold"` // consecutive failures to trip breaker
 	OpenDuration     string `mapstructure:"open_duration"`     // duration to keep breaker open (e.g. "30s")
+	// Each reopen without a successful close doubles open_duration up to this (default: no backoff)
+	MaxOpenDuration string `mapstructure:"max_open_duration"`
+	// How the breaker trips: "consecutive" (default, uses failure_threshold) or "error_rate"
+	Mode           string  `mapstructure:"mode"`
+	ErrorThreshold float64 `mapstructure:"error_threshold"` // error_rate: failed percentage of the window that trips (default 50)
+	Window         string  `mapstructure:"window"`          // error_rate: rolling window (default "1m")
+	MinRequests    int     `mapstructure:"min_requests"`    // error_rate: requests in the window before it can trip (default 20)
+	// Half-open: concurrent trial requests (default 1) and successes needed to close (default 1)
+	HalfOpenMaxRequests int `mapstructure:"half_open_max_requests"`
+	SuccessThreshold    int `mapstructure:"success_threshold"`
+	// Upstream statuses that count as failures for cooldown and the breaker (default: [500, 502, 503, 504])
+	TripStatuses []int `mapstructure:"trip_statuses"`
+	// Per-service overrides keyed by service name (case-insensitive); unset fields use the values above
+	Services map[string]CircuitBreakerOverride `mapstructure:"services"`
+}
+
+// CircuitBreakerOverride mendefinisikan circuit breaker untuk satu service
+type CircuitBreakerOverride struct {
+	FailureThreshold int    `mapstructure:"failure_threshold"` // consecutive failures to trip the breaker of this service's upstreams
+	OpenDuration     string `mapstructure:"open_duration"`     // duration to keep them open (e.g. "1m")
 }
 
 // RateLimitConfig mendefinisikan konfigurasi rate limiting
 type RateLimitConfig struct {
-	RequestsPerSecond int      `mapstructure:"requests_per_second"` // max requests per second (0 = disabled)
-	BurstSize         int      `mapstructure:"burst_size"`          // max burst requests
-	Routes            []string `mapstructure:"routes"`              // specific routes to apply rate limiting (empty = all routes)
+	RequestsPerSecond int `mapstructure:"requests_per_second"` // max requests per second (0 = disabled)
+	BurstSize         int `mapstructure:"burst_size"`          // max burst requests
+	// Path prefixes to limit, each either a plain prefix using the limits above or
+	// {path, requests_per_second, burst_size}. With plain prefixes listed, other paths
+	// are not limited; otherwise they use the limits above (0 = unlimited).
+	Routes []RateLimitRoute `mapstructure:"routes"`
+	// Additional independent limits; a request must pass all applicable rules
+	Rules []RateLimitRule `mapstructure:"rules"`
+	// Buckets unused (and full) for this long are evicted (default: "10m", "0" disables)
+	BucketIdleTTL string `mapstructure:"bucket_idle_ttl"`
+}
+
+// RateLimitRoute mendefinisikan rate limit untuk satu path prefix
+type RateLimitRoute struct {
+	Path              string `mapstructure:"path"`                // path prefix
+	RequestsPerSecond int    `mapstructure:"requests_per_second"` // limit for this prefix (0 = the global limit)
+	BurstSize         int    `mapstructure:"burst_size"`          // default: requests_per_second, or the global burst
+}
+
+// RateLimitRule mendefinisikan satu dimensi rate limit dengan skema key sendiri
+type RateLimitRule struct {
+	Name              string   `mapstructure:"name"`                // dimension name reported on 429 (default: key)
+	Key               string   `mapstructure:"key"`                 // route, ip, global, api_key or header:<Name> (default: route)
+	Tier              string   `mapstructure:"tier"`                // only requests authenticated with a key of this tier (default: all)
+	RequestsPerSecond int      `mapstructure:"requests_per_second"` // max requests per second per key
+	BurstSize         int      `mapstructure:"burst_size"`          // max burst requests per key
+	Routes            []string `mapstructure:"routes"`              // path prefixes the rule applies to (empty = all routes)
 }
 
 // LoggingConfig mendefinisikan konfigurasi logging
@@ -53,6 +457,18 @@ type LoggingConfig struct {
 	Level       string `mapstructure:"level"`       // log level: debug, info, warn, error
 	Format      string `mapstructure:"format"`      // log format: json, console
 	Environment string `mapstructure:"environment"` // environment: production, development
+
+	// Access log file, separate from the operational logs on stdout
+	AccessLog AccessLogConfig `mapstructure:"access_log"`
+}
+
+// AccessLogConfig mendefinisikan file access log beserta rotasinya
+type AccessLogConfig struct {
+	Path       string `mapstructure:"path"`         // access log file (empty = disabled)
+	Format     string `mapstructure:"format"`       // json (default) or combined (Apache/NGINX)
+	MaxSizeMB  int    `mapstructure:"max_size_mb"`  // rotate when the file reaches this size (default: 100)
+	MaxBackups int    `mapstructure:"max_backups"`  // rotated files to keep (default: 0, all)
+	MaxAgeDays int    `mapstructure:"max_age_days"` // delete rotated files older than this (default: 0, never)
 }
 
 // TracingConfig mendefinisikan konfigurasi tracing
@@ -60,14 +476,102 @@ type TracingConfig struct {
 	Enabled        bool   `mapstructure:"enabled"`         // enable tracing (default: false)
 	JaegerEndpoint string `mapstructure:"jaeger_endpoint"` // Jaeger collector endpoint
 	ServiceName    string `mapstructure:"service_name"`    // service name for tracing
+	// Request headers copied onto spans as attributes (e.g. X-Tenant-Id)
+	HeaderAttributes []string `mapstructure:"header_attributes"`
+	// Headers recorded as "[REDACTED]" (Authorization, Cookie, X-Api-Key and auth.api_key.header are always redacted)
+	RedactHeaders []string `mapstructure:"redact_headers"`
+	// Spans buffered while the collector is slow or down; extra spans are dropped (default: 2048)
+	QueueSize int `mapstructure:"queue_size"`
+	// Deadline for a single export call (default: "10s")
+	ExportTimeout string `mapstructure:"export_timeout"`
+	// Share of new traces sampled, 0.0-1.0 (default: 1.0); incoming sampled parents are always kept
+	SampleRate *float64 `mapstructure:"sample_rate"`
 }
 
 // TLSConfig mendefinisikan konfigurasi TLS/mTLS
 type TLSConfig struct {
-	Enabled     bool   `mapstructure:"enabled"`      // enable TLS (default: false)
-	CertDir     string `mapstructure:"cert_dir"`     // certificate directory
-	ServerPort  string `mapstructure:"server_port"`  // HTTPS server port (if different from HTTP)
-	UpstreamTLS bool   `mapstructure:"upstream_tls"` // use HTTPS for upstream connections
+	Enabled      bool       `mapstructure:"enabled"`       // enable TLS (default: false)
+	Mode         string     `mapstructure:"mode"`          // managed (generate a self-signed CA, default) or external
+	CertDir      string     `mapstructure:"cert_dir"`      // certificate directory
+	ServerCert   string     `mapstructure:"server_cert"`   // external mode: server certificate (PEM, chain allowed)
+	ServerKey    string     `mapstructure:"server_key"`    // external mode: server private key (PEM)
+	ClientCA     string     `mapstructure:"client_ca"`     // external mode: CA bundle for client certificates (empty = no mTLS)
+	ServerPort   string     `mapstructure:"server_port"`   // HTTPS server port (if different from HTTP)
+	UpstreamTLS  bool       `mapstructure:"upstream_tls"`  // use HTTPS for upstream connections
+	ACME         ACMEConfig `mapstructure:"acme"`          // publicly trusted certificates instead of the self-signed CA
+	MinVersion   string     `mapstructure:"min_version"`   // lowest TLS version: 1.0-1.3 (default: 1.2)
+	MaxVersion   string     `mapstructure:"max_version"`   // highest TLS version (default: 1.3)
+	CipherSuites []string   `mapstructure:"cipher_suites"` // TLS 1.2 cipher suites by Go name (default: Go's defaults)
+	// Forward the verified client certificate's identity to upstreams
+	ClientIdentity ClientIdentityConfig `mapstructure:"client_identity"`
+}
+
+// ClientIdentityConfig mendefinisikan header identitas sertifikat klien untuk upstream
+type ClientIdentityConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`    // set the headers from the verified client certificate (default: false)
+	CNHeader  string `mapstructure:"cn_header"`  // subject CommonName (default: X-Client-CN)
+	SANHeader string `mapstructure:"san_header"` // comma-separated DNS, email, IP and URI SANs (default: X-Client-SAN)
+}
+
+// ACMEConfig mendefinisikan konfigurasi sertifikat otomatis via ACME (Let's Encrypt)
+type ACMEConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`   // obtain certificates via ACME (default: false, self-signed/mTLS)
+	Domains  []string `mapstructure:"domains"`   // domains to request certificates for
+	Email    string   `mapstructure:"email"`     // contact address for expiry notices (optional)
+	CacheDir string   `mapstructure:"cache_dir"` // certificate cache (default: <cert_dir>/acme)
+	Staging  bool     `mapstructure:"staging"`   // use the Let's Encrypt staging environment
+}
+
+// AdminConfig mendefinisikan konfigurasi admin API
+type AdminConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`      // expose /admin/* endpoints (default: false)
+	ListenAddr string `mapstructure:"listen_addr"`  // serve admin, /metrics, /healthz, /readyz and /config here instead of on the proxy listener, e.g. "127.0.0.1:9901"
+	AuditLog   string `mapstructure:"audit_log"`    // audit destination: stdout, stderr or file path (default: stderr)
+	APIKeyTier string `mapstructure:"api_key_tier"` // with auth.api_key enabled, only keys of this tier may call the admin API (default: "admin")
+}
+
+// AuthConfig mendefinisikan autentikasi klien
+type AuthConfig struct {
+	APIKey APIKeyAuthConfig `mapstructure:"api_key"`
+}
+
+// APIKeyAuthConfig mendefinisikan autentikasi dengan API key
+type APIKeyAuthConfig struct {
+	Enabled    bool           `mapstructure:"enabled"`     // reject requests without a valid key with 401 (default: false)
+	Header     string         `mapstructure:"header"`      // header carrying the key (default: X-API-Key)
+	QueryParam string         `mapstructure:"query_param"` // query parameter accepted when the header is absent (default: none)
+	Keys       []APIKeyConfig `mapstructure:"keys"`        // accepted keys
+	KeysFile   string         `mapstructure:"keys_file"`   // file of "<sha256-hex> <name> [tier]" lines
+	Routes     []string       `mapstructure:"routes"`      // path prefixes that require a key (empty = all routes)
+}
+
+// APIKeyConfig mendefinisikan satu API key
+type APIKeyConfig struct {
+	Name string `mapstructure:"name"`               // identity used for rate limiting and audit records
+	Key  string `mapstructure:"key" redact:"true"`  // plain-text key, e.g. "${PARTNER_KEY}"
+	Hash string `mapstructure:"hash" redact:"true"` // hex SHA-256 of the key, instead of key
+	Tier string `mapstructure:"tier"`               // rate-limit tier matched by rate_limit.rules[].tier
+}
+
+// TCPConfig mendefinisikan konfigurasi TCP proxy
+type TCPConfig struct {
+	ListenPort   string            `mapstructure:"listen_port"`   // TCP proxy port (empty = disabled)
+	TargetAddr   string            `mapstructure:"target_addr"`   // default upstream host:port
+	Service      string            `mapstructure:"service"`       // registry service balanced across per connection (instead of target_addr)
+	DialAttempts int               `mapstructure:"dial_attempts"` // upstreams tried per connection when dialing fails (default: 3)
+	Sniff        map[string]string `mapstructure:"sniff"`         // protocol (tls, http, other) -> upstream host:port
+	SniffTimeout string            `mapstructure:"sniff_timeout"` // wait for first bytes when sniffing (default: "2s")
+
+	IdleTimeout           string `mapstructure:"idle_timeout"`            // close connections idle in both directions this long (e.g. "5m"; empty = never)
+	MaxConnectionDuration string `mapstructure:"max_connection_duration"` // close connections open this long (e.g. "1h"; empty = unlimited)
+	MaxConnections        int    `mapstructure:"max_connections"`         // concurrent connections; more are closed on accept (0 = unlimited; reloadable)
+}
+
+// ProxyProtocolConfig mendefinisikan penerimaan header PROXY protocol
+type ProxyProtocolConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`        // read v1/v2 headers on the HTTP and TCP listeners
+	Mode          string `mapstructure:"mode"`           // "optional" (default) passes connections without a header through, "require" rejects them
+	HeaderTimeout string `mapstructure:"header_timeout"` // wait for the header (default: "5s")
 }
 
 // LoadConfig membaca konfigurasi dari file
@@ -75,14 +579,203 @@ func LoadConfig(path string) (*Config, error) {
 	viper.SetConfigFile(path)
 	viper.SetConfigType("yaml")
 
-	if err := viper.ReadInConfig(); err != nil {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	// Substitute ${VAR} references before parsing
+	if data, err = expandEnv(data); err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	if err := viper.ReadConfig(bytes.NewReader(data)); err != nil {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	hooks := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		rateLimitRouteHook,
+	))
+	if err := viper.Unmarshal(&config, hooks); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
 
 	return &config, nil
 }
+
+// rateLimitRouteHook decodes a plain string in rate_limit.routes as a path prefix
+func rateLimitRouteHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() == reflect.String && to == reflect.TypeOf(RateLimitRoute{}) {
+		return RateLimitRoute{Path: data.(string)}, nil
+	}
+	return data, nil
+}
+
+// validate rejects values that can't be checked by their type alone
+func (c *Config) validate() error {
+	if r := c.Tracing.SampleRate; r != nil && (*r < 0 || *r > 1) {
+		return fmt.Errorf("tracing.sample_rate must be between 0.0 and 1.0, got %v", *r)
+	}
+	cb := c.CircuitBreaker
+	if cb.Mode != "" && cb.Mode != "consecutive" && cb.Mode != "error_rate" {
+		return fmt.Errorf("circuit_breaker.mode must be consecutive or error_rate, got %q", cb.Mode)
+	}
+	if cb.ErrorThreshold < 0 || cb.ErrorThreshold > 100 {
+		return fmt.Errorf("circuit_breaker.error_threshold must be a percentage between 0 and 100, got %v", cb.ErrorThreshold)
+	}
+	if cb.OpenDuration != "" {
+		if d, err := time.ParseDuration(cb.OpenDuration); err != nil || d <= 0 {
+			return fmt.Errorf("circuit_breaker.open_duration must be a positive duration, got %q", cb.OpenDuration)
+		}
+	}
+	for name, o := range cb.Services {
+		if o.FailureThreshold < 0 {
+			return fmt.Errorf("circuit_breaker.services.%s.failure_threshold must not be negative, got %d", name, o.FailureThreshold)
+		}
+		if o.OpenDuration == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(o.OpenDuration); err != nil || d <= 0 {
+			return fmt.Errorf("circuit_breaker.services.%s.open_duration must be a positive duration, got %q", name, o.OpenDuration)
+		}
+	}
+	if cb.MaxOpenDuration != "" {
+		if d, err := time.ParseDuration(cb.MaxOpenDuration); err != nil || d < 0 {
+			return fmt.Errorf("circuit_breaker.max_open_duration must be a duration, got %q", cb.MaxOpenDuration)
+		}
+	}
+	if cb.Window != "" {
+		if d, err := time.ParseDuration(cb.Window); err != nil || d <= 0 {
+			return fmt.Errorf("circuit_breaker.window must be a positive duration, got %q", cb.Window)
+		}
+	}
+	for _, s := range cb.TripStatuses {
+		if s < 100 || s > 599 {
+			return fmt.Errorf("circuit_breaker.trip_statuses must be HTTP statuses, got %d", s)
+		}
+		if slices.Contains(c.FailureClassification.NeutralStatuses, s) {
+			return fmt.Errorf("status %d is in both circuit_breaker.trip_statuses and failure_classification.neutral_statuses", s)
+		}
+	}
+	if lb := c.LoadBalancing; lb.LatencyHalfLife != "" {
+		if d, err := time.ParseDuration(lb.LatencyHalfLife); err != nil || d <= 0 {
+			return fmt.Errorf("load_balancing.latency_half_life must be a positive duration, got %q", lb.LatencyHalfLife)
+		}
+	}
+	if c.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests must not be negative, got %d", c.MaxConcurrentRequests)
+	}
+	tr := c.Transport
+	if tr.MaxIdleConns < 0 || tr.MaxIdleConnsPerHost < 0 || tr.MaxConnsPerHost < 0 {
+		return fmt.Errorf("transport connection counts must not be negative")
+	}
+	if tr.BufferSize < 0 {
+		return fmt.Errorf("transport.buffer_size must not be negative, got %d", tr.BufferSize)
+	}
+	for _, d := range []struct{ key, value string }{
+		{"dial_timeout", tr.DialTimeout},
+		{"tls_handshake_timeout", tr.TLSHandshakeTimeout},
+		{"response_header_timeout", tr.ResponseHeaderTimeout},
+		{"idle_conn_timeout", tr.IdleConnTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return fmt.Errorf("transport.%s must be a positive duration, got %q", d.key, d.value)
+		}
+	}
+	for i, b := range c.Metrics.LatencyBuckets {
+		if b <= 0 || (i > 0 && b <= c.Metrics.LatencyBuckets[i-1]) {
+			return fmt.Errorf("metrics.latency_buckets must be positive and increasing, got %v", c.Metrics.LatencyBuckets)
+		}
+	}
+	sv := c.Server
+	for _, d := range []struct{ key, value string }{
+		{"read_header_timeout", sv.ReadHeaderTimeout},
+		{"read_timeout", sv.ReadTimeout},
+		{"write_timeout", sv.WriteTimeout},
+		{"idle_timeout", sv.IdleTimeout},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return fmt.Errorf("server.%s must be a positive duration, got %q", d.key, d.value)
+		}
+	}
+	cc := c.Concurrency
+	if cc.InitialLimit < 0 || cc.MinLimit < 0 || cc.MaxLimit < 0 {
+		return fmt.Errorf("concurrency limits must not be negative")
+	}
+	if cc.MinLimit > 0 && cc.MaxLimit > 0 && cc.MinLimit > cc.MaxLimit {
+		return fmt.Errorf("concurrency.min_limit %d is above max_limit %d", cc.MinLimit, cc.MaxLimit)
+	}
+	for i, r := range c.RateLimit.Routes {
+		if r.Path == "" {
+			return fmt.Errorf("rate_limit.routes[%d] needs a path", i)
+		}
+		if r.RequestsPerSecond < 0 || r.BurstSize < 0 {
+			return fmt.Errorf("rate_limit.routes[%d] (%s): requests_per_second and burst_size must not be negative", i, r.Path)
+		}
+	}
+	for _, d := range []struct{ key, value string }{
+		{"shutdown_timeout", c.ShutdownTimeout},
+		{"default_timeout", c.DefaultTimeout},
+		{"retry.backoff", c.Retry.Backoff},
+		{"retry.backoff_max", c.Retry.BackoffMax},
+		{"hedging.delay", c.Hedging.Delay},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %q", d.key, d.value)
+		}
+	}
+	if ttl := c.RateLimit.BucketIdleTTL; ttl != "" {
+		if d, err := time.ParseDuration(ttl); err != nil || d < 0 {
+			return fmt.Errorf("rate_limit.bucket_idle_ttl must be a duration (\"0\" disables eviction), got %q", ttl)
+		}
+	}
+	if ha := c.Retry.HedgeAfter; ha != "" {
+		if d, err := time.ParseDuration(ha); err != nil || d <= 0 {
+			return fmt.Errorf("retry.hedge_after must be a positive duration, got %q", ha)
+		}
+		if c.Hedging.Enabled {
+			return fmt.Errorf("retry.hedge_after and hedging.enabled are mutually exclusive; use one of them")
+		}
+	}
+	if ma := c.LoadBalancing.Sticky.MaxAge; ma != "" {
+		if d, err := time.ParseDuration(ma); err != nil || d < 0 {
+			return fmt.Errorf("load_balancing.sticky.max_age must be a duration, got %q", ma)
+		}
+	}
+	od := c.OutlierDetection
+	if od.Window != "" {
+		if d, err := time.ParseDuration(od.Window); err != nil || d <= 0 {
+			return fmt.Errorf("outlier_detection.window must be a positive duration, got %q", od.Window)
+		}
+	}
+	if od.EjectionTime != "" {
+		if d, err := time.ParseDuration(od.EjectionTime); err != nil || d <= 0 {
+			return fmt.Errorf("outlier_detection.ejection_time must be a positive duration, got %q", od.EjectionTime)
+		}
+	}
+	if od.MaxEjectionPercent < 0 || od.MaxEjectionPercent > 100 {
+		return fmt.Errorf("outlier_detection.max_ejection_percent must be between 0 and 100, got %d", od.MaxEjectionPercent)
+	}
+	// The admin API drains the proxy, lifts limits and (with registry.type api)
+	// picks where traffic goes: it must not be open to any client of the proxy listener
+	if c.Admin.Enabled && !c.Auth.APIKey.Enabled && c.Admin.ListenAddr == "" {
+		return fmt.Errorf("admin.enabled needs auth.api_key or a separate admin.listen_addr")
+	}
+	if c.Registry.Type == "api" && !c.Admin.Enabled {
+		return fmt.Errorf("registry.type api needs admin.enabled")
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandEnv replaces ${VAR} and ${VAR:-default} in the raw config with values
+// from the environment. "$$" is a literal "$"; any other "$" is kept as is.
+// Comment lines are left untouched. All unresolved variables are reported at once.
+func expandEnv(data []byte) ([]byte, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+	var out strings.Builder
+	var problems []string
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			out.WriteString(line)
+			continue
+		}
+		expanded, errs := expandLine(line)
+		for _, e := range errs {
+			problems = append(problems, fmt.Sprintf("line %d: %s", i+1, e))
+		}
+		out.WriteString(expanded)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("environment substitution failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return []byte(out.String()), nil
+}
+
+func expandLine(line string) (string, []string) {
+	var b strings.Builder
+	var errs []string
+	for {
+		i := strings.IndexByte(line, '$')
+		if i < 0 || i == len(line)-1 {
+			break
+		}
+		b.WriteString(line[:i])
+		switch line[i+1] {
+		case '$':
+			b.WriteByte('$')
+			line = line[i+2:]
+			continue
+		case '{':
+		default:
+			b.WriteByte('$')
+			line = line[i+1:]
+			continue
+		}
+		end := strings.IndexByte(line[i:], '}')
+		if end < 0 {
+			errs = append(errs, fmt.Sprintf("unterminated %q", line[i:]))
+			b.WriteString(line[i:])
+			return b.String(), errs
+		}
+		expr := line[i+2 : i+end]
+		line = line[i+end+1:]
+		name, def, hasDef := strings.Cut(expr, ":-")
+		if !validEnvName(name) {
+			errs = append(errs, fmt.Sprintf("invalid variable name in ${%s}", expr))
+			continue
+		}
+		if v, ok := os.LookupEnv(name); ok && (v != "" || !hasDef) {
+			b.WriteString(v)
+		} else if hasDef {
+			b.WriteString(def)
+		} else {
+			errs = append(errs, fmt.Sprintf("environment variable %s is not set (use ${%s:-default} for a fallback)", name, name))
+		}
+	}
+	b.WriteString(line)
+	return b.String(), errs
+}
+
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		letter := c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
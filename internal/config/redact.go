@@ -0,0 +1,69 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+)
+
+// redactedValue replaces secrets in the redacted config, as in traced headers
+const redactedValue = "[REDACTED]"
+
+// TraceRedactHeaders returns the headers recorded as "[REDACTED]" on spans:
+// redact_headers plus the API key header, which carries a credential too
+func (c *Config) TraceRedactHeaders() []string {
+	if c.Auth.APIKey.Header == "" {
+		return c.Tracing.RedactHeaders
+	}
+	return append(slices.Clone(c.Tracing.RedactHeaders), c.Auth.APIKey.Header)
+}
+
+// Redacted returns the config as nested maps keyed like the config file, with
+// fields tagged `redact:"true"` (e.g. API keys) replaced by "[REDACTED]".
+func (c *Config) Redacted() map[string]interface{} {
+	return redactValue(reflect.ValueOf(c).Elem()).(map[string]interface{})
+}
+
+func redactValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			if f.Tag.Get("redact") == "true" && !v.Field(i).IsZero() {
+				out[fieldKey(f)] = redactedValue
+				continue
+			}
+			out[fieldKey(f)] = redactValue(v.Field(i))
+		}
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = redactValue(iter.Value())
+		}
+		return out
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem())
+	default:
+		return v.Interface()
+	}
+}
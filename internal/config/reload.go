@@ -0,0 +1,142 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ReloadableKeys are the sections that can change without a restart. Dotted
+// keys name a single field of a section whose other fields are startup-only;
+// "*" stands for every entry of a map section such as services.
+var ReloadableKeys = []string{
+	"routes",
+	"target_service_name",
+	"host_as_service",
+	"rate_limit",
+	"circuit_breaker",
+	"outlier_detection",
+	"health_check",
+	"tcp.max_connections",
+	"max_concurrent_requests",
+	"services.*.max_rps",
+}
+
+// RestartRequired lists the keys that differ between c and next but are only
+// read at startup, in field order. Sections with a reloadable field report
+// their changed fields as dotted keys.
+func (c *Config) RestartRequired(next *Config) []string {
+	return restartRequired("", reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem())
+}
+
+func restartRequired(prefix string, cur, nv reflect.Value) []string {
+	var keys []string
+	for i := 0; i < cur.NumField(); i++ {
+		key := prefix + fieldKey(cur.Type().Field(i))
+		if slices.Contains(ReloadableKeys, key) {
+			continue
+		}
+		if cur.Field(i).Kind() == reflect.Struct && hasReloadableField(key) {
+			keys = append(keys, restartRequired(key+".", cur.Field(i), nv.Field(i))...)
+			continue
+		}
+		if cur.Field(i).Kind() == reflect.Map && hasReloadableField(key+".*") && sameMapKeys(cur.Field(i), nv.Field(i)) {
+			keys = append(keys, restartRequiredEntries(key, cur.Field(i), nv.Field(i))...)
+			continue
+		}
+		if !reflect.DeepEqual(cur.Field(i).Interface(), nv.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// restartRequiredEntries lists the startup-only fields that differ between the
+// entries of two maps with the same keys, as key.<entry>.<field>
+func restartRequiredEntries(key string, cur, nv reflect.Value) []string {
+	names := make([]string, 0, cur.Len())
+	for _, k := range cur.MapKeys() {
+		names = append(names, k.String())
+	}
+	slices.Sort(names)
+	var keys []string
+	for _, name := range names {
+		k := reflect.ValueOf(name).Convert(cur.Type().Key())
+		for _, field := range restartRequired(key+".*.", cur.MapIndex(k), nv.MapIndex(k)) {
+			keys = append(keys, key+"."+name+"."+strings.TrimPrefix(field, key+".*."))
+		}
+	}
+	return keys
+}
+
+// sameMapKeys reports whether two maps have the same keys
+func sameMapKeys(a, b reflect.Value) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	for _, k := range a.MapKeys() {
+		if !b.MapIndex(k).IsValid() {
+			return false
+		}
+	}
+	return true
+}
+
+// WithReloadable returns a copy of c with the reloadable sections taken from next
+func (c *Config) WithReloadable(next *Config) *Config {
+	merged := *c
+	withReloadable("", reflect.ValueOf(&merged).Elem(), reflect.ValueOf(next).Elem())
+	return &merged
+}
+
+func withReloadable(prefix string, cur, nv reflect.Value) {
+	for i := 0; i < cur.NumField(); i++ {
+		key := prefix + fieldKey(cur.Type().Field(i))
+		switch {
+		case slices.Contains(ReloadableKeys, key):
+			cur.Field(i).Set(nv.Field(i))
+		case cur.Field(i).Kind() == reflect.Struct && hasReloadableField(key):
+			withReloadable(key+".", cur.Field(i), nv.Field(i))
+		case cur.Field(i).Kind() == reflect.Map && hasReloadableField(key+".*"):
+			cur.Field(i).Set(withReloadableEntries(key+".*.", cur.Field(i), nv.Field(i)))
+		}
+	}
+}
+
+// withReloadableEntries returns a copy of the map cur whose entries take their
+// reloadable fields from the entry of the same key in nv. Entries added or
+// removed in nv need a restart.
+func withReloadableEntries(prefix string, cur, nv reflect.Value) reflect.Value {
+	if cur.IsNil() {
+		return cur
+	}
+	merged := reflect.MakeMapWithSize(cur.Type(), cur.Len())
+	iter := cur.MapRange()
+	for iter.Next() {
+		entry := reflect.New(cur.Type().Elem()).Elem()
+		entry.Set(iter.Value())
+		if next := nv.MapIndex(iter.Key()); next.IsValid() {
+			withReloadable(prefix, entry, next)
+		}
+		merged.SetMapIndex(iter.Key(), entry)
+	}
+	return merged
+}
+
+// hasReloadableField reports whether a field nested under key is reloadable
+func hasReloadableField(key string) bool {
+	for _, k := range ReloadableKeys {
+		if strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldKey(f reflect.StructField) string {
+	key, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	if key == "" {
+		return strings.ToLower(f.Name)
+	}
+	return key
+}
@@ -0,0 +1,64 @@
+package config
+
+import "fmt"
+
+// Routing precedence, highest first:
+//  1. the first matching route rule with a service
+//  2. the service named by the Host header (host_as_service, unmatched requests only)
+//  3. target_service_name
+//  4. target_service_addr (static upstream, only when no service was selected)
+
+// RoutingMode summarizes the effective routing setup for the startup log
+func (c *Config) RoutingMode() string {
+	mode := "none"
+	switch {
+	case len(c.Routes) > 0 && c.TargetServiceName != "":
+		mode = "routes+service"
+	case len(c.Routes) > 0:
+		mode = "routes"
+	case c.TargetServiceName != "":
+		mode = "service"
+	case c.TargetServiceAddr != "":
+		mode = "static"
+	}
+	if c.HostAsService.Enabled {
+		mode += "+host_as_service"
+	}
+	return mode
+}
+
+// RoutingWarnings reports routing settings that are ambiguous or cannot work,
+// e.g. a static address that is shadowed by a service name.
+func (c *Config) RoutingWarnings() []string {
+	var warnings []string
+	usesRegistry := c.TargetServiceName != "" || c.HostAsService.Enabled
+	unnamedRoutes := 0
+	for i, r := range c.Routes {
+		switch {
+		case r.Respond != nil, r.Redirect != nil:
+			// answered by the proxy itself, no upstream needed
+		case len(r.Services()) > 0:
+			usesRegistry = true
+		case c.TargetServiceName != "":
+			warnings = append(warnings, fmt.Sprintf("route %d has no service and falls back to target_service_name %q", i, c.TargetServiceName))
+		case c.TargetServiceAddr != "":
+			unnamedRoutes++
+		default:
+			warnings = append(warnings, fmt.Sprintf("route %d has no service and there is no target_service_name or target_service_addr to fall back to", i))
+		}
+	}
+
+	if c.TargetServiceName != "" && c.TargetServiceAddr != "" {
+		warnings = append(warnings, fmt.Sprintf("target_service_addr %q is ignored because target_service_name %q takes precedence", c.TargetServiceAddr, c.TargetServiceName))
+	}
+	if unnamedRoutes > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d route(s) have no service and send traffic to the static target_service_addr %q", unnamedRoutes, c.TargetServiceAddr))
+	}
+	if usesRegistry && c.RegistryFile == "" && (c.Registry.Type == "" || c.Registry.Type == "file") {
+		warnings = append(warnings, "service-based routing is configured but registry_file is empty")
+	}
+	if len(c.Routes) == 0 && c.TargetServiceName == "" && c.TargetServiceAddr == "" && !c.HostAsService.Enabled {
+		warnings = append(warnings, "no routes, target_service_name or target_service_addr configured")
+	}
+	return warnings
+}
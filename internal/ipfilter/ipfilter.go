@@ -0,0 +1,76 @@
+// Package ipfilter allows or denies clients by IP address range.
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefixes parses CIDRs or single IPs (as /32 or /128 ranges)
+func ParsePrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			addr, err := netip.ParseAddr(e)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", e, err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", e, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Contains reports whether addr is in one of prefixes
+func Contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// List is an allow list and a deny list of address ranges
+type List struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// New parses the allow and deny lists. It returns nil when both are empty.
+func New(allow, deny []string) (*List, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	a, err := ParsePrefixes(allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	d, err := ParsePrefixes(deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	return &List{allow: a, deny: d}, nil
+}
+
+// Allows reports whether addr may pass: it must not be denied, and must be
+// allowed unless the allow list is empty. A nil List allows everything.
+func (l *List) Allows(addr netip.Addr) bool {
+	if l == nil {
+		return true
+	}
+	if Contains(l.deny, addr) {
+		return false
+	}
+	return len(l.allow) == 0 || Contains(l.allow, addr)
+}
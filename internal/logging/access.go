@@ -0,0 +1,170 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Access log formats
+const (
+	AccessFormatJSON     = "json"
+	AccessFormatCombined = "combined" // Apache/NGINX combined log format
+)
+
+// AccessEntry is one served request
+type AccessEntry struct {
+	Time       time.Time // when the request arrived
+	RemoteAddr string    // client IP
+	User       string    // authenticated client (API key name), if any
+	Method     string
+	URI        string
+	Proto      string
+	Host       string
+	Status     int
+	Size       int64 // response body bytes
+	Referer    string
+	UserAgent  string
+	Upstream   string
+	Latency    time.Duration
+	TraceID    string
+}
+
+// AccessLogOptions configures an AccessLogger
+type AccessLogOptions struct {
+	Path       string
+	Format     string // json (default) or combined
+	MaxSizeMB  int    // rotate at this size (default 100)
+	MaxBackups int    // rotated files kept (0 = all)
+	MaxAgeDays int    // rotated files deleted after this many days (0 = never)
+}
+
+// AccessLogger writes access entries to their own rotated file, separate from
+// the operational logs on stdout.
+type AccessLogger struct {
+	file   *RotatingFile
+	format string
+	json   *zap.Logger // json format
+	mu     sync.Mutex  // combined format: one line per write
+}
+
+// NewAccessLogger opens the access log file
+func NewAccessLogger(opts AccessLogOptions) (*AccessLogger, error) {
+	format := opts.Format
+	if format == "" {
+		format = AccessFormatJSON
+	}
+	if format != AccessFormatJSON && format != AccessFormatCombined {
+		return nil, fmt.Errorf("unknown access log format %q (want json or combined)", opts.Format)
+	}
+	file, err := NewRotatingFile(opts.Path, opts.MaxSizeMB, opts.MaxBackups, opts.MaxAgeDays)
+	if err != nil {
+		return nil, err
+	}
+	a := &AccessLogger{file: file, format: format}
+	if format == AccessFormatJSON {
+		enc := zap.NewProductionEncoderConfig()
+		enc.EncodeTime = zapcore.ISO8601TimeEncoder
+		enc.LevelKey, enc.CallerKey, enc.StacktraceKey = "", "", ""
+		a.json = zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(enc), zapcore.AddSync(file), zapcore.InfoLevel))
+	}
+	return a, nil
+}
+
+// Log writes e
+func (a *AccessLogger) Log(e AccessEntry) {
+	if a.json != nil {
+		fields := []zap.Field{
+			zap.Time("request_time", e.Time),
+			zap.String("remote_addr", e.RemoteAddr),
+			zap.String("method", e.Method),
+			zap.String("uri", e.URI),
+			zap.String("proto", e.Proto),
+			zap.String("host", e.Host),
+			zap.Int("status", e.Status),
+			zap.Int64("size_bytes", e.Size),
+			zap.String("referer", e.Referer),
+			zap.String("user_agent", e.UserAgent),
+			zap.String("upstream", e.Upstream),
+			zap.Int64("latency_ms", e.Latency.Milliseconds()),
+		}
+		if e.User != "" {
+			fields = append(fields, zap.String("user", e.User))
+		}
+		if e.TraceID != "" {
+			fields = append(fields, zap.String("trace_id", e.TraceID))
+		}
+		a.json.Info("access", fields...)
+		return
+	}
+	line := CombinedLine(e)
+	a.mu.Lock()
+	_, _ = io.WriteString(a.file, line)
+	a.mu.Unlock()
+}
+
+// Close flushes and closes the access log file
+func (a *AccessLogger) Close() error {
+	if a.json != nil {
+		_ = a.json.Sync()
+	}
+	return a.file.Close()
+}
+
+// CombinedLine formats e in the combined log format, newline terminated:
+//
+//	127.0.0.1 - alice [10/Oct/2024:13:55:36 +0000] "GET /a HTTP/1.1" 200 2326 "-" "curl/8.0"
+func CombinedLine(e AccessEntry) string {
+	size := "-"
+	if e.Size > 0 {
+		size = strconv.FormatInt(e.Size, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		orDash(e.RemoteAddr),
+		orDash(escapeCombined(e.User)),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeCombined(e.Method), escapeCombined(e.URI), escapeCombined(e.Proto),
+		e.Status,
+		size,
+		orDash(escapeCombined(e.Referer)),
+		orDash(escapeCombined(e.UserAgent)),
+	)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeCombined hex-escapes quotes, backslashes and control characters like
+// NGINX, so client-supplied values cannot break the line format.
+func escapeCombined(s string) string {
+	needs := false
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c == '\\' || c < 0x20 || c == 0x7f {
+			needs = true
+			break
+		}
+	}
+	if !needs {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' || c == '\\' || c < 0x20 || c == 0x7f {
+			fmt.Fprintf(&b, "\\x%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
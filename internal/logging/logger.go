@@ -2,6 +2,9 @@ package logging
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"os"
 
 	"go.uber.org/zap"
@@ -15,25 +18,30 @@ const TraceIDKey contextKey = "trace_id"
 
 var logger *zap.Logger
 
+// level is shared with the logger built by Init so SetLevel applies at runtime
+var level = zap.NewAtomicLevelAt(zap.InfoLevel)
+
+// levels are the accepted log level names
+var levels = map[string]zapcore.Level{
+	"debug": zap.DebugLevel,
+	"info":  zap.InfoLevel,
+	"warn":  zap.WarnLevel,
+	"error": zap.ErrorLevel,
+}
+
 // Init initializes the structured logger
-func Init(level string) error {
+func Init(name string) error {
 	config := zap.NewProductionConfig()
 	config.OutputPaths = []string{"stdout"}
 	config.ErrorOutputPaths = []string{"stderr"}
 
-	// Set log level
-	switch level {
-	case "debug":
-		config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	case "info":
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-	case "warn":
-		config.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
-	case "error":
-		config.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
-	default:
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+	// Set log level (unknown names fall back to info)
+	l, ok := levels[name]
+	if !ok {
+		l = zap.InfoLevel
 	}
+	level.SetLevel(l)
+	config.Level = level
 
 	// Development mode for better readability during development
 	if os.Getenv("CHARON_ENV") == "development" {
@@ -66,12 +74,37 @@ func Init(level string) error {
 // GetLogger returns the global logger instance
 func GetLogger() *zap.Logger {
 	if logger == nil {
-		// Fallback to default production logger
-		logger, _ = zap.NewProduction()
+		// Fallback to default production logger, still following SetLevel
+		config := zap.NewProductionConfig()
+		config.Level = level
+		logger, _ = config.Build()
 	}
 	return logger
 }
 
+// Level returns the current log level
+func Level() string {
+	return level.Level().String()
+}
+
+// SetLevel changes the level of the running logger; it takes effect for all
+// subsequent log calls. Only debug, info, warn and error are accepted.
+func SetLevel(name string) error {
+	l, ok := levels[name]
+	if !ok {
+		return fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+	}
+	prev := level.Level()
+	level.SetLevel(l)
+	// Record the change at a level that passes both the old and the new setting
+	at := max(prev, l, zap.InfoLevel)
+	GetLogger().Log(at, "log_level_changed",
+		zap.String("from", prev.String()),
+		zap.String("to", l.String()),
+	)
+	return nil
+}
+
 // WithTraceID adds trace ID to context
 func WithTraceID(ctx context.Context, traceID string) context.Context {
 	return context.WithValue(ctx, TraceIDKey, traceID)
@@ -103,6 +136,24 @@ func LogHTTPRequest(ctx context.Context, method, path, upstream, status string,
 	GetLogger().Info("http_request", fields...)
 }
 
+// LogGRPCRequest logs a proxied gRPC call with its gRPC status
+func LogGRPCRequest(ctx context.Context, method, upstream, status, grpcStatus string, latency, size int64) {
+	fields := []zap.Field{
+		zap.String("grpc_method", method),
+		zap.String("upstream", upstream),
+		zap.String("status", status),
+		zap.String("grpc_status", grpcStatus),
+		zap.Int64("latency_ms", latency),
+		zap.Int64("size_bytes", size),
+	}
+
+	if traceID := GetTraceID(ctx); traceID != "" {
+		fields = append(fields, zap.String("trace_id", traceID))
+	}
+
+	GetLogger().Info("grpc_request", fields...)
+}
+
 // LogUpstreamError logs upstream errors with context
 func LogUpstreamError(ctx context.Context, upstream string, err error) {
 	fields := []zap.Field{
@@ -158,42 +209,37 @@ func LogHTTPServerStart(addr string) {
 
 // LogInfo logs general info messages with structured fields
 func LogInfo(message string, fields map[string]interface{}) {
-	zapFields := make([]zap.Field, 0, len(fields))
-	for k, v := range fields {
-		switch val := v.(type) {
-		case string:
-			zapFields = append(zapFields, zap.String(k, val))
-		case int:
-			zapFields = append(zapFields, zap.Int(k, val))
-		case bool:
-			zapFields = append(zapFields, zap.Bool(k, val))
-		case float64:
-			zapFields = append(zapFields, zap.Float64(k, val))
-		default:
-			zapFields = append(zapFields, zap.Any(k, v))
-		}
-	}
-	GetLogger().Info(message, zapFields...)
+	GetLogger().Info(message, zapFields(fields)...)
+}
+
+// LogWarn logs warnings (e.g. questionable configuration) with structured fields
+func LogWarn(message string, fields map[string]interface{}) {
+	GetLogger().Warn(message, zapFields(fields)...)
 }
 
 // LogError logs error messages with structured fields
 func LogError(message string, fields map[string]interface{}) {
-	zapFields := make([]zap.Field, 0, len(fields))
+	GetLogger().Error(message, zapFields(fields)...)
+}
+
+// zapFields converts a field map to typed zap fields
+func zapFields(fields map[string]interface{}) []zap.Field {
+	out := make([]zap.Field, 0, len(fields))
 	for k, v := range fields {
 		switch val := v.(type) {
 		case string:
-			zapFields = append(zapFields, zap.String(k, val))
+			out = append(out, zap.String(k, val))
 		case int:
-			zapFields = append(zapFields, zap.Int(k, val))
+			out = append(out, zap.Int(k, val))
 		case bool:
-			zapFields = append(zapFields, zap.Bool(k, val))
+			out = append(out, zap.Bool(k, val))
 		case float64:
-			zapFields = append(zapFields, zap.Float64(k, val))
+			out = append(out, zap.Float64(k, val))
 		default:
-			zapFields = append(zapFields, zap.Any(k, v))
+			out = append(out, zap.Any(k, v))
 		}
 	}
-	GetLogger().Error(message, zapFields...)
+	return out
 }
 
 // Sync flushes any buffered log entries
@@ -204,18 +250,39 @@ func Sync() error {
 	return nil
 }
 
-// GenerateTraceID generates a simple trace ID
+// GenerateTraceID returns a random W3C trace-context compatible trace ID:
+// 16 bytes from crypto/rand as 32 lowercase hex characters, never all zeros.
 func GenerateTraceID() string {
-	// Simple implementation - in production you'd want something more sophisticated
-	return randomString(16)
+	b := make([]byte, 16)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			// crypto/rand does not fail on supported platforms
+			panic(fmt.Sprintf("logging: reading random bytes: %v", err))
+		}
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
 }
 
-// randomString generates a random string of given length
+// randomString returns a random string of the given length drawn from [a-z0-9]
 func randomString(length int) string {
 	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[len(charset)/2+i%len(charset)/2] // Simple deterministic pattern for demo
+	// Bytes at or above the largest multiple of 36 are redrawn to avoid modulo bias
+	const limit = 256 - 256%len(charset)
+	out := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(out) < length {
+		if _, err := rand.Read(buf); err != nil {
+			panic(fmt.Sprintf("logging: reading random bytes: %v", err))
+		}
+		for _, c := range buf {
+			if int(c) < limit && len(out) < length {
+				out = append(out, charset[int(c)%len(charset)])
+			}
+		}
 	}
-	return string(b)
+	return string(out)
 }
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Sink receives metrics mirrored from the Prometheus instrumentation
+type Sink interface {
+	Count(name string, value int64, tags map[string]string)
+	Timing(name string, d time.Duration, tags map[string]string)
+}
+
+var sink atomic.Pointer[Sink]
+
+// SetSink installs the global sink (nil disables mirroring)
+func SetSink(s Sink) {
+	if s == nil {
+		sink.Store(nil)
+		return
+	}
+	sink.Store(&s)
+}
+
+// Count mirrors a counter increment to the configured sink, if any
+func Count(name string, value int64, tags map[string]string) {
+	if s := sink.Load(); s != nil {
+		(*s).Count(name, value, tags)
+	}
+}
+
+// Timing mirrors a duration observation to the configured sink, if any
+func Timing(name string, d time.Duration, tags map[string]string) {
+	if s := sink.Load(); s != nil {
+		(*s).Timing(name, d, tags)
+	}
+}
+
+// StatsD writes metrics to a StatsD/DogStatsD agent over UDP. Sends are
+// fire-and-forget: a missing agent never blocks or fails requests.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	// tags enables DogStatsD "|#key:value" tags; plain StatsD drops them
+	tags bool
+}
+
+// NewStatsD creates a UDP StatsD client for addr (host:port)
+func NewStatsD(addr, prefix string, tags bool) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &StatsD{conn: conn, prefix: prefix, tags: tags}, nil
+}
+
+// Count sends a counter
+func (s *StatsD) Count(name string, value int64, tags map[string]string) {
+	s.send(fmt.Sprintf("%s%s:%d|c", s.prefix, name, value), tags)
+}
+
+// Timing sends a timer in milliseconds
+func (s *StatsD) Timing(name string, d time.Duration, tags map[string]string) {
+	s.send(fmt.Sprintf("%s%s:%g|ms", s.prefix, name, float64(d)/float64(time.Millisecond)), tags)
+}
+
+// Close closes the UDP socket
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+func (s *StatsD) send(line string, tags map[string]string) {
+	if s.tags && len(tags) > 0 {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, k := range keys {
+			parts = append(parts, k+":"+tags[k])
+		}
+		line += "|#" + strings.Join(parts, ",")
+	}
+	_, _ = s.conn.Write([]byte(line))
+}
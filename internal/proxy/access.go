@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xReLogic/Charon/internal/ipfilter"
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+var accessDeniedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "charon_http_access_denied_total",
+	Help: "Requests rejected with 403 by the IP allow/deny lists",
+}, []string{"scope"})
+
+// allowClient reports whether the client behind r passes list, answering 403
+// otherwise. scope ("global" or "route") labels the rejection.
+func (p *HTTPProxy) allowClient(w http.ResponseWriter, r *http.Request, list *ipfilter.List, scope string) bool {
+	if list == nil {
+		return true
+	}
+	addr, ok := p.clientAddr(r)
+	if ok && list.Allows(addr) {
+		return true
+	}
+	client := r.RemoteAddr
+	if ok {
+		client = addr.String()
+	}
+	accessDeniedTotal.WithLabelValues(scope).Inc()
+	logging.LogInfo("Client address denied", map[string]interface{}{
+		"client": client,
+		"path":   r.URL.Path,
+		"scope":  scope,
+	})
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	return false
+}
+
+// withAccessControl rejects clients not allowed by p.AccessControl before any
+// other handling, including the admin API served on the proxy listener.
+func (p *HTTPProxy) withAccessControl(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.allowClient(w, r, p.AccessControl, "global") {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+const accessKey ctxKey = 1
+
+// accessInfo collects what only the proxy handler knows about a request
+type accessInfo struct {
+	upstream string
+	user     string
+	traceID  string
+}
+
+// noteAccess records details for the access log entry of the request in ctx, if any
+func noteAccess(ctx context.Context, fn func(*accessInfo)) {
+	if info, ok := ctx.Value(accessKey).(*accessInfo); ok {
+		fn(info)
+	}
+}
+
+// withAccessLog logs every request served by next, including ones rejected
+// before reaching an upstream, to p.AccessLog.
+func (p *HTTPProxy) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &accessInfo{}
+		rec := &statusRecorder{ResponseWriter: w, status: 200}
+		defer func() {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			p.AccessLog.Log(logging.AccessEntry{
+				Time:       start,
+				RemoteAddr: host,
+				User:       info.user,
+				Method:     r.Method,
+				URI:        p.APIKeys.RedactURI(r.RequestURI),
+				Proto:      r.Proto,
+				Host:       r.Host,
+				Status:     rec.status,
+				Size:       int64(rec.size),
+				Referer:    r.Referer(),
+				UserAgent:  r.UserAgent(),
+				Upstream:   info.upstream,
+				Latency:    time.Since(start),
+				TraceID:    info.traceID,
+			})
+		}()
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessKey, info)))
+	})
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+// maxRequestBody returns the body limit for the route, falling back to the global one (0 = unlimited)
+func (p *HTTPProxy) maxRequestBody(rule *config.RouteRule) int64 {
+	if rule != nil && rule.MaxRequestBodyBytes > 0 {
+		return rule.MaxRequestBodyBytes
+	}
+	return p.MaxRequestBodyBytes
+}
+
+// limitRequestBody wraps r.Body in http.MaxBytesReader so reads past the limit fail
+// with *http.MaxBytesError. A declared Content-Length over the limit is rejected
+// up front; it reports false when the request was answered with 413.
+func (p *HTTPProxy) limitRequestBody(w http.ResponseWriter, r *http.Request, rule *config.RouteRule) bool {
+	limit := p.maxRequestBody(rule)
+	if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	if r.ContentLength > limit {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// recordBodyRejected logs and counts a request rejected over its body (413 for
+// its size, 400 when it could not be read) before reaching an upstream
+func (p *HTTPProxy) recordBodyRejected(r *http.Request, status int, start time.Time) {
+	latency := time.Since(start)
+	logging.LogHTTPRequest(r.Context(), r.Method, r.URL.Path, "", strconv.Itoa(status), latency.Milliseconds(), 0)
+	p.recordRequest(r, status, "", latency)
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import "sync"
+
+// tokenBudget is a token bucket refilled by eligible requests, so extra attempts
+// (hedges, retries) cannot amplify upstream load beyond the configured share of
+// traffic even when every upstream is slow or failing.
+type tokenBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+	max    float64
+}
+
+func newTokenBudget(percent float64) *tokenBudget {
+	// Allow a small burst so extra attempts work right after startup
+	return &tokenBudget{tokens: 10, ratio: percent / 100, max: 10}
+}
+
+// deposit credits the budget for one eligible request
+func (b *tokenBudget) deposit() {
+	b.mu.Lock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.mu.Unlock()
+}
+
+// refund returns an attempt that could not be made
+func (b *tokenBudget) refund() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+// withdraw spends one attempt, reporting false when the budget is exhausted
+func (b *tokenBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,261 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/cache"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+var (
+	cacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "charon_cache_requests_total",
+			Help: "Total number of cacheable requests by cache result",
+		},
+		[]string{"result"},
+	)
+	cacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "charon_cache_entries",
+		Help: "Number of responses currently held in the cache",
+	})
+	cacheSizeBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "charon_cache_size_bytes",
+		Help: "Approximate memory held by cached responses",
+	})
+	cacheHitRatio = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "charon_cache_hit_ratio",
+		Help: "Fraction of cache lookups served from the cache (fresh or stale)",
+	})
+	cacheEvictionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "charon_cache_evictions_total",
+		Help: "Total number of cache entries evicted to stay within max_size_bytes",
+	})
+	cacheSkippedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "charon_cache_skipped_too_large_total",
+		Help: "Total number of cacheable responses not stored because they exceeded max_entry_bytes",
+	})
+	cacheRevalidationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "charon_cache_revalidations_total",
+			Help: "Total number of background stale-while-revalidate refreshes",
+		},
+		[]string{"result"},
+	)
+)
+
+// Default cache bounds used when the proxy doesn't configure them
+const (
+	defaultCacheMaxEntryBytes = 1 << 20  // 1 MiB
+	defaultCacheMaxSizeBytes  = 64 << 20 // 64 MiB
+)
+
+// store puts the response to a request for base with header h in the cache,
+// under the key its Vary header selects, and refreshes the cache gauges
+func (p *HTTPProxy) store(base string, h http.Header, e *cache.Entry) {
+	stored, evicted := p.cache.SetVaried(base, h, e)
+	if !stored {
+		cacheSkippedTotal.Inc()
+	}
+	cacheEvictionsTotal.Add(float64(evicted))
+	p.observeCache()
+}
+
+// observeCache publishes cache size and hit ratio
+func (p *HTTPProxy) observeCache() {
+	st := p.cache.Stats()
+	cacheEntries.Set(float64(st.Entries))
+	cacheSizeBytes.Set(float64(st.Bytes))
+	if st.Lookups > 0 {
+		cacheHitRatio.Set(float64(st.Hits) / float64(st.Lookups))
+	}
+}
+
+// cachePolicy returns the cache durations for a route; ok is false when caching is disabled
+func cachePolicy(rule *config.RouteRule) (ttl, swr time.Duration, ok bool) {
+	if rule == nil || rule.Cache == nil || rule.Cache.TTL == "" {
+		return 0, 0, false
+	}
+	ttl, err := time.ParseDuration(rule.Cache.TTL)
+	if err != nil || ttl <= 0 {
+		return 0, 0, false
+	}
+	if rule.Cache.StaleWhileRevalidate != "" {
+		if d, err := time.ParseDuration(rule.Cache.StaleWhileRevalidate); err == nil && d > 0 {
+			swr = d
+		}
+	}
+	return ttl, swr, true
+}
+
+// cacheKey is the base cache key of r; the headers named by Vary extend it
+func cacheKey(r *http.Request) string {
+	return r.Host + r.URL.RequestURI()
+}
+
+// cacheFillWait bounds how long a miss waits for a concurrent fetch of the same
+// key before going upstream itself
+const cacheFillWait = 10 * time.Second
+
+// awaitFill waits for the concurrent fetch signalled by done and reports
+// whether it ended in time
+func awaitFill(r *http.Request, done <-chan struct{}) bool {
+	t := time.NewTimer(cacheFillWait)
+	defer t.Stop()
+	select {
+	case <-done:
+		return true
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+	return false
+}
+
+// isCacheable reports whether the upstream response to r may be stored. The
+// cache is shared, so a response to a request carrying credentials is only
+// stored when the upstream marks it shareable (Cache-Control: public or s-maxage).
+func (p *HTTPProxy) isCacheable(r *http.Request, status int, h http.Header) bool {
+	if status != http.StatusOK || h.Get("Set-Cookie") != "" {
+		return false
+	}
+	if _, ok := cache.VaryNames(h); !ok {
+		return false // Vary: * matches no later request
+	}
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return false
+	}
+	if p.authenticated(r) {
+		return strings.Contains(cc, "public") || strings.Contains(cc, "s-maxage")
+	}
+	return true
+}
+
+// authenticated reports whether r carries credentials: an Authorization header
+// or an API key
+func (p *HTTPProxy) authenticated(r *http.Request) bool {
+	if r.Header.Get("Authorization") != "" || p.APIKeys.Presented(r) {
+		return true
+	}
+	_, ok := auth.IdentityFromContext(r.Context())
+	return ok
+}
+
+func newEntry(status int, h http.Header, body []byte, ttl, swr time.Duration) *cache.Entry {
+	hdr := h.Clone()
+	hdr.Del("X-Cache")
+	return &cache.Entry{
+		Status: status,
+		Header: hdr,
+		Body:   append([]byte(nil), body...),
+		Stored: time.Now(),
+		TTL:    ttl,
+		SWR:    swr,
+	}
+}
+
+// writeCached writes a cached entry to the client. HEAD gets the headers of the
+// stored GET response, including its Content-Length, without the body.
+func writeCached(w http.ResponseWriter, r *http.Request, e *cache.Entry, st cache.State) {
+	h := w.Header()
+	for k, v := range e.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("X-Cache", st.String())
+	h.Set("Age", strconv.Itoa(int(e.Age(time.Now()).Seconds())))
+	h.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	w.WriteHeader(e.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(e.Body)
+	}
+}
+
+// revalidate refreshes a stale cache entry from the upstream in the background
+func (p *HTTPProxy) revalidate(rp http.Handler, r *http.Request, key string, ttl, swr time.Duration) {
+	defer p.cache.EndRevalidate(key)
+	base, h := cacheKey(r), r.Header.Clone()
+
+	r, up, _ := p.attachUpstream(r)
+	bw := &bufferWriter{header: http.Header{}, status: http.StatusOK}
+	aborted := serveUpstream(rp, bw, r)
+
+	if aborted || !p.isCacheable(r, bw.status, bw.header) {
+		cacheRevalidationsTotal.WithLabelValues("failure").Inc()
+		logging.LogInfo("Cache revalidation failed", map[string]interface{}{
+			"key":      key,
+			"upstream": up,
+			"status":   bw.status,
+		})
+		return
+	}
+	p.store(base, h, newEntry(bw.status, bw.header, bw.buf.Bytes(), ttl, swr))
+	cacheRevalidationsTotal.WithLabelValues("success").Inc()
+}
+
+// captureWriter tees the response body so it can be stored in the cache.
+// Once the body exceeds limit (if set) it stops buffering and marks itself overflowed.
+type captureWriter struct {
+	http.ResponseWriter
+	status   int
+	buf      bytes.Buffer
+	limit    int64
+	overflow bool
+	// header is the upstream header as written, before response compression rewrites it
+	header http.Header
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	c.status = code
+	c.header = c.ResponseWriter.Header().Clone()
+	c.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to flush streams
+func (c *captureWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// storedHeader returns the header to cache alongside the captured body
+func (c *captureWriter) storedHeader() http.Header {
+	if c.header == nil {
+		return c.ResponseWriter.Header()
+	}
+	return c.header
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.header == nil {
+		c.header = c.ResponseWriter.Header().Clone()
+	}
+	if !c.overflow {
+		if c.limit > 0 && int64(c.buf.Len()+len(b)) > c.limit {
+			c.overflow = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(b)
+		}
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// bufferWriter is an in-memory ResponseWriter used for background revalidation
+type bufferWriter struct {
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (b *bufferWriter) Header() http.Header { return b.header }
+
+func (b *bufferWriter) WriteHeader(code int) { b.status = code }
+
+func (b *bufferWriter) Write(p []byte) (int, error) { return b.buf.Write(p) }
@@ -0,0 +1,219 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+// Outcome is how a proxied request affects upstream health accounting
+type Outcome int
+
+const (
+	OutcomeSuccess Outcome = iota // resets failures (MarkSuccess)
+	OutcomeFailure                // counts toward cooldown and the breaker (MarkServiceFailure)
+	OutcomeNeutral                // leaves upstream health untouched
+)
+
+// Error classes used by failure classification
+const (
+	ErrorRefused  = "refused"  // connection refused
+	ErrorTimeout  = "timeout"  // dial or response timeout
+	ErrorReset    = "reset"    // connection reset or closed mid-response
+	ErrorCanceled = "canceled" // the client went away
+	ErrorDNS      = "dns"      // upstream name did not resolve
+	ErrorOther    = "other"
+)
+
+// FailureClassifier decides which upstream errors and statuses take an upstream
+// out of rotation. By default transport errors other than client cancellation
+// and the statuses 500, 502, 503 and 504 are failures, and 429 is neutral.
+type FailureClassifier struct {
+	TripStatuses    map[int]bool    // statuses treated as failures (nil = any 5xx)
+	FailureStatuses map[int]bool    // extra statuses treated as failures
+	NeutralStatuses map[int]bool    // statuses ignored for health, overriding the 5xx rule
+	NeutralErrors   map[string]bool // error classes ignored for health
+}
+
+// NewFailureClassifier builds a classifier from config, applying defaults for unset lists
+func NewFailureClassifier(cfg config.FailureClassificationConfig) *FailureClassifier {
+	c := &FailureClassifier{
+		TripStatuses:    map[int]bool{},
+		FailureStatuses: map[int]bool{},
+		NeutralStatuses: map[int]bool{},
+		NeutralErrors:   map[string]bool{},
+	}
+	for _, s := range defaultTripStatuses {
+		c.TripStatuses[s] = true
+	}
+	for _, s := range cfg.FailureStatuses {
+		c.FailureStatuses[s] = true
+	}
+	neutralStatuses := cfg.NeutralStatuses
+	if neutralStatuses == nil {
+		neutralStatuses = []int{429}
+	}
+	for _, s := range neutralStatuses {
+		c.NeutralStatuses[s] = true
+	}
+	neutralErrors := cfg.NeutralErrors
+	if neutralErrors == nil {
+		neutralErrors = []string{ErrorCanceled}
+	}
+	for _, e := range neutralErrors {
+		c.NeutralErrors[e] = true
+	}
+	return c
+}
+
+// defaultTripStatuses are the upstream statuses that count as failures unless
+// circuit_breaker.trip_statuses says otherwise
+var defaultTripStatuses = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+var defaultClassifier = NewFailureClassifier(config.FailureClassificationConfig{})
+
+// WithTripStatuses replaces the statuses that count as failures and returns c.
+// nil keeps them. A listed status is no longer neutral, so e.g. 429 can be made
+// to count against an overloaded upstream.
+func (c *FailureClassifier) WithTripStatuses(statuses []int) *FailureClassifier {
+	if statuses == nil {
+		return c
+	}
+	c.TripStatuses = make(map[int]bool, len(statuses))
+	for _, s := range statuses {
+		c.TripStatuses[s] = true
+		delete(c.NeutralStatuses, s)
+	}
+	return c
+}
+
+// trips reports whether an upstream status counts as a failure
+func (c *FailureClassifier) trips(status int) bool {
+	if c.FailureStatuses[status] {
+		return true
+	}
+	if c.TripStatuses == nil {
+		return status >= 500
+	}
+	return c.TripStatuses[status]
+}
+
+// Classify returns the outcome for a request that ended with transport error err
+// (nil if the upstream answered) and response status.
+func (c *FailureClassifier) Classify(err error, status int) Outcome {
+	if err != nil {
+		// An oversized request body is the client's fault, not the upstream's,
+		// and an attempt held back by max_rps never reached the upstream
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || errors.Is(err, errUpstreamRateLimited) || c.NeutralErrors[ErrorClass(err)] {
+			return OutcomeNeutral
+		}
+		return OutcomeFailure
+	}
+	switch {
+	case c.NeutralStatuses[status]:
+		return OutcomeNeutral
+	case c.trips(status):
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// ErrorClass maps a transport error to one of the Error* classes
+func ErrorClass(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorRefused
+	case errors.As(err, &dnsErr):
+		return ErrorDNS
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorReset
+	default:
+		return ErrorOther
+	}
+}
+
+// upstreamResult carries what happened upstream back to the handler: the transport
+// error from ErrorHandler, and the upstream that answered when a hedge won
+type upstreamResult struct {
+	err      error
+	upstream string
+}
+
+type resultKey struct{}
+
+func withUpstreamResult(ctx context.Context) (context.Context, *upstreamResult) {
+	res := &upstreamResult{}
+	return context.WithValue(ctx, resultKey{}, res), res
+}
+
+func upstreamResultFrom(ctx context.Context) *upstreamResult {
+	res, _ := ctx.Value(resultKey{}).(*upstreamResult)
+	return res
+}
+
+// SetFailureClassifier replaces the classifier used for new requests, e.g. after
+// a config reload changed circuit_breaker.trip_statuses
+func (p *HTTPProxy) SetFailureClassifier(c *FailureClassifier) {
+	p.classifierOverride.Store(c)
+}
+
+// classifier returns the classifier set by SetFailureClassifier, the configured
+// one or the defaults
+func (p *HTTPProxy) classifier() *FailureClassifier {
+	if c := p.classifierOverride.Load(); c != nil {
+		return c
+	}
+	if p.FailureClassifier != nil {
+		return p.FailureClassifier
+	}
+	return defaultClassifier
+}
+
+// reportOutcome notifies the health callbacks according to the classification
+// of r's attempt at upstream and returns it
+func (p *HTTPProxy) reportOutcome(r *http.Request, upstream string, err error, status int) Outcome {
+	if upstream == "" || upstream == "unknown" {
+		return OutcomeNeutral
+	}
+	outcome := p.classifier().Classify(err, status)
+	switch outcome {
+	case OutcomeFailure:
+		if p.OnUpstreamError != nil {
+			var service string
+			if m := routing.FromContext(r.Context()); m != nil {
+				service = m.Service
+			}
+			p.OnUpstreamError(service, upstream)
+		}
+	case OutcomeSuccess:
+		if p.OnUpstreamSuccess != nil {
+			p.OnUpstreamSuccess(upstream)
+		}
+	case OutcomeNeutral:
+		if p.OnUpstreamNeutral != nil {
+			p.OnUpstreamNeutral(upstream)
+		}
+	}
+	return outcome
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// clientCertAllowed reports whether cert satisfies the route's client_cert policy.
+// Every configured field must match; within a field any listed value is accepted.
+func clientCertAllowed(policy *config.ClientCertConfig, cert *x509.Certificate) bool {
+	if policy == nil {
+		return true
+	}
+	if cert == nil {
+		return false
+	}
+	if len(policy.AllowedCN) > 0 && !containsAny(policy.AllowedCN, []string{cert.Subject.CommonName}) {
+		return false
+	}
+	if len(policy.AllowedOU) > 0 && !containsAny(policy.AllowedOU, cert.Subject.OrganizationalUnit) {
+		return false
+	}
+	if len(policy.AllowedOrg) > 0 && !containsAny(policy.AllowedOrg, cert.Subject.Organization) {
+		return false
+	}
+	if len(policy.AllowedSAN) > 0 && !containsAny(policy.AllowedSAN, certSANs(cert)) {
+		return false
+	}
+	return true
+}
+
+// Default header names for the forwarded client identity
+const (
+	DefaultClientCNHeader  = "X-Client-CN"
+	DefaultClientSANHeader = "X-Client-SAN"
+)
+
+// ClientIdentityHeaders names the headers that carry the verified client
+// certificate's identity to the upstream
+type ClientIdentityHeaders struct {
+	CN  string // subject CommonName (default: X-Client-CN)
+	SAN string // comma-separated subject alternative names (default: X-Client-SAN)
+}
+
+// apply removes any client-supplied identity headers and sets them from cert.
+// Without a verified certificate (or without TLS) the headers are only removed.
+func (c *ClientIdentityHeaders) apply(h http.Header, cert *x509.Certificate) {
+	cnHeader, sanHeader := c.CN, c.SAN
+	if cnHeader == "" {
+		cnHeader = DefaultClientCNHeader
+	}
+	if sanHeader == "" {
+		sanHeader = DefaultClientSANHeader
+	}
+	h.Del(cnHeader)
+	h.Del(sanHeader)
+	if cert == nil {
+		return
+	}
+	if cn := cert.Subject.CommonName; cn != "" {
+		h.Set(cnHeader, cn)
+	}
+	if sans := certSANs(cert); len(sans) > 0 {
+		h.Set(sanHeader, strings.Join(sans, ","))
+	}
+}
+
+// certSANs flattens the DNS, email, IP and URI subject alternative names
+func certSANs(cert *x509.Certificate) []string {
+	sans := append([]string(nil), cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
+
+func containsAny(allowed, values []string) bool {
+	for _, a := range allowed {
+		for _, v := range values {
+			if a == v {
+				return true
+			}
+		}
+	}
+	return false
+}
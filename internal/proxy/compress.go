@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// defaultCompressMinBytes is the body size above which request compression kicks in
+const defaultCompressMinBytes = 1024
+
+// compressThreshold returns the minimum body size to compress for the route, or -1 if disabled
+func compressThreshold(rule *config.RouteRule) int {
+	if rule == nil || rule.CompressUpstreamRequest == nil {
+		return -1
+	}
+	if rule.CompressUpstreamRequest.MinBytes > 0 {
+		return rule.CompressUpstreamRequest.MinBytes
+	}
+	return defaultCompressMinBytes
+}
+
+// compressRequestBody gzips the request body in place when it is larger than minBytes.
+// The body is buffered either way so retries can replay it via GetBody.
+func compressRequestBody(r *http.Request, minBytes int) error {
+	if r.Body == nil || r.Body == http.NoBody || r.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	// Known small bodies are forwarded untouched without buffering
+	if r.ContentLength >= 0 && r.ContentLength <= int64(minBytes) {
+		return nil
+	}
+	raw, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return err
+	}
+	body := raw
+	if len(raw) > minBytes {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(raw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		r.Header.Set("Content-Encoding", "gzip")
+	}
+	setBufferedBody(r, body)
+	return nil
+}
+
+// setBufferedBody replaces the request body with b and makes it replayable
+func setBufferedBody(r *http.Request, b []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}
+	r.ContentLength = int64(len(b))
+	r.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	r.TransferEncoding = nil
+}
@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCompressMinLength is the response size above which gzip kicks in
+const defaultCompressMinLength = 1024
+
+// defaultCompressTypes are compressed when compression.content_types is empty
+var defaultCompressTypes = []string{
+	"text/html", "text/plain", "text/css", "text/javascript", "text/xml",
+	"application/json", "application/javascript", "application/xml", "image/svg+xml",
+}
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding with a non-zero q
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.TrimSpace(coding) != "*" {
+			continue
+		}
+		q := strings.TrimSpace(params)
+		if v, ok := strings.CutPrefix(q, "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// responseCompressor wraps w in a gzipResponseWriter when compression is enabled
+// and the client accepts gzip, or returns nil. Upgrade requests are left alone:
+// the connection they switch to is hijacked, not written through the wrapper.
+func (p *HTTPProxy) responseCompressor(w http.ResponseWriter, r *http.Request) *gzipResponseWriter {
+	c := p.Compression
+	if c == nil || !c.Enabled || isUpgrade(r) || !acceptsGzip(r) {
+		return nil
+	}
+	minLength := c.MinLength
+	if minLength <= 0 {
+		minLength = defaultCompressMinLength
+	}
+	types := c.ContentTypes
+	if len(types) == 0 {
+		types = defaultCompressTypes
+	}
+	return &gzipResponseWriter{ResponseWriter: w, minLength: minLength, types: types, head: r.Method == http.MethodHead}
+}
+
+// gzipResponseWriter compresses eligible responses. Bodies of unknown length are
+// buffered until minLength bytes arrive, so small responses go out unchanged.
+// Close must be called once the handler is done writing.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minLength int
+	types     []string
+	head      bool
+
+	status      int
+	wroteHeader bool
+	pending     bool   // eligible, buffering until minLength is reached
+	buf         []byte // body held back while pending
+	gz          *gzip.Writer
+}
+
+func (w *gzipResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+	if !w.eligible(code) {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cl, err := strconv.Atoi(w.Header().Get("Content-Length"))
+	known := err == nil
+	switch {
+	case known && cl < w.minLength:
+		w.ResponseWriter.WriteHeader(code)
+	case w.head:
+		// No body to compress; announce the encoding a GET would get
+		setGzipHeaders(w.Header())
+		w.ResponseWriter.WriteHeader(code)
+	case known:
+		w.startGzip()
+	default:
+		w.pending = true
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.gz != nil:
+		return w.gz.Write(b)
+	case w.pending:
+		w.buf = append(w.buf, b...)
+		if len(w.buf) >= w.minLength {
+			if err := w.startGzip(); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	default:
+		return w.ResponseWriter.Write(b)
+	}
+}
+
+// Close flushes a held-back small body uncompressed, or finishes the gzip stream
+func (w *gzipResponseWriter) Close() error {
+	if w.pending {
+		w.pending = false
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(w.buf)
+		w.buf = nil
+		return err
+	}
+	if w.gz == nil {
+		return nil
+	}
+	err := w.gz.Close()
+	w.gz.Reset(nil)
+	gzipWriters.Put(w.gz)
+	w.gz = nil
+	return err
+}
+
+// Flush commits to compression for a streamed body and flushes what is buffered
+func (w *gzipResponseWriter) Flush() {
+	if w.pending {
+		_ = w.startGzip()
+	}
+	if w.gz != nil {
+		_ = w.gz.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to hijack
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// eligible reports whether a response with this status and the current headers may be compressed
+func (w *gzipResponseWriter) eligible(code int) bool {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		return false
+	}
+	h := w.Header()
+	// Never double-compress, and leave ranges alone
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, t := range w.types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// startGzip sends the headers for a compressed response and writes any held-back body
+func (w *gzipResponseWriter) startGzip() error {
+	w.pending = false
+	setGzipHeaders(w.Header())
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	_, err := w.gz.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// setGzipHeaders rewrites h for a gzip-encoded body of unknown length
+func setGzipHeaders(h http.Header) {
+	h.Set("Content-Encoding", "gzip")
+	h.Add("Vary", "Accept-Encoding")
+	h.Del("Content-Length")
+	h.Del("Accept-Ranges")
+	// The encoded representation differs byte-wise, so a strong ETag must be weakened
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xReLogic/Charon/internal/metrics"
+)
+
+var (
+	inflightRequests = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "charon_inflight_requests",
+		Help: "HTTP requests currently being handled by the proxy",
+	})
+	concurrencyRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "charon_http_concurrency_rejected_total",
+		Help: "HTTP requests rejected with 503 because max_concurrent_requests was reached",
+	})
+	adaptiveLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "charon_adaptive_concurrency_limit",
+		Help: "Current in-flight request limit computed by the adaptive concurrency limiter",
+	})
+	adaptiveRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "charon_adaptive_concurrency_rejected_total",
+		Help: "HTTP requests rejected with 503 because the adaptive concurrency limit was reached",
+	})
+)
+
+// SetMaxConcurrentRequests changes the in-flight request limit of a running
+// proxy, e.g. after a config reload. Requests already admitted are kept.
+func (p *HTTPProxy) SetMaxConcurrentRequests(n int) {
+	p.concurrencyLimit.Store(&n)
+}
+
+// maxConcurrentRequests returns the limit set by SetMaxConcurrentRequests, or MaxConcurrentRequests
+func (p *HTTPProxy) maxConcurrentRequests() int {
+	if n := p.concurrencyLimit.Load(); n != nil {
+		return *n
+	}
+	return p.MaxConcurrentRequests
+}
+
+// InflightRequests returns the number of requests currently being handled
+func (p *HTTPProxy) InflightRequests() int {
+	return int(p.inflight.Load())
+}
+
+// admit takes an in-flight slot for a request, or reports false when the limit
+// is reached. Admitted requests must call release when they complete.
+func (p *HTTPProxy) admit() bool {
+	n := p.inflight.Add(1)
+	if limit := p.maxConcurrentRequests(); limit > 0 && n > int64(limit) {
+		p.inflight.Add(-1)
+		concurrencyRejectedTotal.Inc()
+		metrics.Count("http.concurrency_rejected", 1, nil)
+		return false
+	}
+	inflightRequests.Inc()
+	return true
+}
+
+// release frees the slot taken by admit
+func (p *HTTPProxy) release() {
+	p.inflight.Add(-1)
+	inflightRequests.Dec()
+}
+
+// adaptiveSample carries the upstream latency of a request back to withAdaptiveLimit
+type adaptiveSample struct {
+	start     time.Time
+	latency   time.Duration // until the exchange ended
+	firstByte time.Duration // until the response headers arrived
+}
+
+// rtt is the latency the limiter learns from: the time to the response headers
+// when there was a response, so streamed and upgraded responses (e.g. SSE,
+// WebSocket) don't pass their lifetime off as upstream latency
+func (s *adaptiveSample) rtt() time.Duration {
+	if s.firstByte > 0 {
+		return s.firstByte
+	}
+	return s.latency
+}
+
+type adaptiveKey struct{}
+
+// noteLatency records the latency of a request that went upstream, for the adaptive limiter
+func noteLatency(ctx context.Context, latency time.Duration) {
+	if s, ok := ctx.Value(adaptiveKey{}).(*adaptiveSample); ok && s != nil {
+		s.latency = latency
+	}
+}
+
+// noteFirstByte records that the upstream's response headers arrived, for the adaptive limiter
+func noteFirstByte(ctx context.Context) {
+	if s, ok := ctx.Value(adaptiveKey{}).(*adaptiveSample); ok && s != nil && s.firstByte == 0 {
+		s.firstByte = time.Since(s.start)
+	}
+}
+
+// withoutAdaptiveSample detaches ctx from the request's sample, for upstream
+// exchanges that outlive the request, e.g. a background revalidation
+func withoutAdaptiveSample(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adaptiveKey{}, (*adaptiveSample)(nil))
+}
+
+// withAdaptiveLimit rejects requests with 503 beyond AdaptiveConcurrency's
+// current limit and feeds it the latency of the requests it admits.
+func (p *HTTPProxy) withAdaptiveLimit(next http.Handler) http.Handler {
+	l := p.AdaptiveConcurrency
+	adaptiveLimit.Set(float64(l.Limit()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.Acquire() {
+			adaptiveRejectedTotal.Inc()
+			metrics.Count("http.adaptive_concurrency_rejected", 1, nil)
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+		sample := &adaptiveSample{start: time.Now()}
+		defer func() {
+			l.Release(sample.rtt())
+			adaptiveLimit.Set(float64(l.Limit()))
+		}()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adaptiveKey{}, sample)))
+	})
+}
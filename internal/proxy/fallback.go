@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/metrics"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+// ErrCircuitOpen is returned by a Resolver when the circuit breakers of all
+// upstreams of the matched service are open and the route has a fallback.
+var ErrCircuitOpen = errors.New("all upstreams are circuit-open")
+
+// fallbackUpstream is the upstream label of requests answered by a static fallback
+const fallbackUpstream = "fallback"
+
+var fallbackTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "charon_http_fallback_total",
+	Help: "Requests served by a route fallback because every upstream was circuit-open",
+}, []string{"service", "kind"})
+
+// fallback handles a request whose upstreams are all circuit-open. It resolves
+// r against fb.Service when set, and otherwise (or if that service is
+// circuit-open too) writes the static response to w and reports served.
+func (p *HTTPProxy) fallback(w http.ResponseWriter, r *http.Request, fb *config.RouteFallbackConfig) (*http.Request, string, bool) {
+	service, _ := p.metricLabels(r)
+	if m := routing.FromContext(r.Context()); m != nil && fb.Service != "" {
+		alt := *m
+		alt.Service = fb.Service
+		fr, up, err := p.attachUpstream(r.WithContext(routing.NewContext(r.Context(), &alt)))
+		if err == nil && up != "unknown" {
+			recordFallback(service, "service")
+			return fr, up, false
+		}
+	}
+	recordFallback(service, "static")
+	status := fb.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	var header map[string]string
+	if fb.ContentType != "" {
+		header = map[string]string{"Content-Type": fb.ContentType}
+	}
+	writeStatic(w, r, status, header, fb.Body)
+	return r, fallbackUpstream, true
+}
+
+// recordFallback counts a fallback activation for service in Prometheus and the optional StatsD sink
+func recordFallback(service, kind string) {
+	fallbackTotal.WithLabelValues(service, kind).Inc()
+	tags := map[string]string{"kind": kind}
+	if service != "" {
+		tags["service"] = service
+	}
+	metrics.Count("http.fallback", 1, tags)
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/0xReLogic/Charon/internal/ipfilter"
+)
+
+// ParseTrustedProxies parses CIDRs or single IPs of proxies whose forwarded headers are trusted
+func ParseTrustedProxies(entries []string) ([]netip.Prefix, error) {
+	prefixes, err := ipfilter.ParsePrefixes(entries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+	}
+	return prefixes, nil
+}
+
+// peerAddr returns the address of the connection r came in on
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return addr.Unmap(), err == nil
+}
+
+// trustedPeer reports whether the connection of r comes from a trusted proxy
+func (p *HTTPProxy) trustedPeer(r *http.Request) bool {
+	addr, ok := peerAddr(r)
+	return ok && ipfilter.Contains(p.TrustedProxies, addr)
+}
+
+// clientAddr returns the address of the client behind r. Starting from the
+// connection, X-Forwarded-For is walked from the right while the hop that
+// added an entry is a trusted proxy, so clients cannot spoof their address.
+func (p *HTTPProxy) clientAddr(r *http.Request) (netip.Addr, bool) {
+	addr, ok := peerAddr(r)
+	if !ok || !ipfilter.Contains(p.TrustedProxies, addr) {
+		return addr, ok
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // garbage: keep the last address vouched for
+		}
+		addr = hop.Unmap()
+		if !ipfilter.Contains(p.TrustedProxies, addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+// setForwarded sets X-Forwarded-Proto and X-Forwarded-Host on the outgoing
+// request from this hop. A trusted proxy's values are kept, since it saw the
+// original request. X-Forwarded-For is appended to by the ReverseProxy itself.
+// Call it before the Host is rewritten for the upstream.
+func (p *HTTPProxy) setForwarded(req *http.Request) {
+	trusted := p.trustedPeer(req)
+	if !trusted || req.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if req.TLS != nil {
+			proto = "https"
+		}
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if !trusted || req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", req.Host)
+	}
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+// ProtocolGRPC marks routes and services proxied as gRPC over HTTP/2
+const ProtocolGRPC = "grpc"
+
+// gRPC status codes the proxy reports itself
+const (
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnavailable       = 14
+)
+
+var grpcCodeNames = []string{
+	"OK", "CANCELLED", "UNKNOWN", "INVALID_ARGUMENT", "DEADLINE_EXCEEDED", "NOT_FOUND",
+	"ALREADY_EXISTS", "PERMISSION_DENIED", "RESOURCE_EXHAUSTED", "FAILED_PRECONDITION",
+	"ABORTED", "OUT_OF_RANGE", "UNIMPLEMENTED", "INTERNAL", "UNAVAILABLE", "DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// isGRPC reports whether r is proxied as gRPC. A route's protocol takes
+// precedence over its service's.
+func (p *HTTPProxy) isGRPC(r *http.Request) bool {
+	m := routing.FromContext(r.Context())
+	if m == nil {
+		return false
+	}
+	if m.Rule != nil && m.Rule.Protocol != "" {
+		return m.Rule.Protocol == ProtocolGRPC
+	}
+	return p.serviceConfig(m.Service).Protocol == ProtocolGRPC
+}
+
+// grpcTransport speaks HTTP/2 to upstreams: h2c for http:// and h2 over TLS for https://
+type grpcTransport struct {
+	h2c *http2.Transport
+	h2  *http2.Transport
+}
+
+func newGRPCTransport(clientTLS *tls.Config, dialTimeout time.Duration) *grpcTransport {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	return &grpcTransport{
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			// Prior-knowledge cleartext HTTP/2: dial plain TCP where TLS would go
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+		h2: &http2.Transport{TLSClientConfig: clientTLS},
+	}
+}
+
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.h2.RoundTrip(req)
+	}
+	return t.h2c.RoundTrip(req)
+}
+
+// protocolTransport sends gRPC requests over HTTP/2 and everything else over base
+type protocolTransport struct {
+	base   http.RoundTripper
+	grpc   http.RoundTripper
+	isGRPC func(req *http.Request) bool
+}
+
+func (t *protocolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.isGRPC(req) {
+		return t.grpc.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// writeGRPCError answers a gRPC call the proxy could not complete with a
+// Trailers-Only response, so clients see a gRPC status instead of an HTTP error body
+func writeGRPCError(w http.ResponseWriter, httpStatus int) {
+	code := grpcUnavailable
+	switch httpStatus {
+	case http.StatusGatewayTimeout:
+		code = grpcDeadlineExceeded
+	case http.StatusRequestEntityTooLarge:
+		code = grpcResourceExhausted
+	}
+	h := w.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	h.Set("Grpc-Message", strings.ToLower(http.StatusText(httpStatus)))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcStatus returns the gRPC status name sent to the client, from the headers
+// (Trailers-Only) or the trailers written after the body, or "" if none was sent
+func grpcStatus(h http.Header) string {
+	v := h.Get("Grpc-Status")
+	if v == "" {
+		v = h.Get(http.TrailerPrefix + "Grpc-Status")
+	}
+	if v == "" {
+		return ""
+	}
+	if code, err := strconv.Atoi(v); err == nil && code >= 0 && code < len(grpcCodeNames) {
+		return grpcCodeNames[code]
+	}
+	return v
+}
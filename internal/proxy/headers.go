@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/routing"
+	"github.com/0xReLogic/Charon/internal/tracing"
+	"golang.org/x/net/http/httpguts"
+)
+
+// hopHeaders are connection-specific and never set by header rules; ReverseProxy
+// manages them for each hop.
+var hopHeaders = map[string]bool{
+	"Connection":          true,
+	"Proxy-Connection":    true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// isUpgrade reports whether r asks to switch protocols (e.g. WebSocket). The
+// response to such a request becomes a raw connection, not a body.
+func isUpgrade(r *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(r.Header["Connection"], "Upgrade")
+}
+
+// applyHeaderRules removes, sets and then adds headers on h. Template values are
+// expanded against r, the client request.
+func applyHeaderRules(h http.Header, rules *config.HeaderRulesConfig, r *http.Request) {
+	if rules == nil {
+		return
+	}
+	for _, name := range rules.Remove {
+		h.Del(name)
+	}
+	for name, value := range rules.Set {
+		if name = http.CanonicalHeaderKey(name); !hopHeaders[name] {
+			h.Set(name, expandTemplate(value, r))
+		}
+	}
+	for name, value := range rules.Add {
+		if name = http.CanonicalHeaderKey(name); !hopHeaders[name] {
+			h.Add(name, expandTemplate(value, r))
+		}
+	}
+}
+
+// expandTemplate replaces {{variable}} placeholders with values from r.
+// Unknown placeholders are left untouched.
+func expandTemplate(value string, r *http.Request) string {
+	if !strings.Contains(value, "{{") {
+		return value
+	}
+	var b strings.Builder
+	for {
+		start := strings.Index(value, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(value[start:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start
+		b.WriteString(value[:start])
+		if v, ok := templateVar(strings.TrimSpace(value[start+2:end]), r); ok {
+			b.WriteString(v)
+		} else {
+			b.WriteString(value[start : end+2])
+		}
+		value = value[end+2:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
+
+func templateVar(name string, r *http.Request) (string, bool) {
+	switch name {
+	case "trace_id":
+		return tracing.TraceIDFromContext(r.Context()), true
+	case "client_ip":
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			return host, true
+		}
+		return r.RemoteAddr, true
+	case "method":
+		return r.Method, true
+	case "path":
+		return r.URL.Path, true
+	case "query":
+		return r.URL.RawQuery, true
+	case "host":
+		return requestHost(r), true
+	case "service":
+		if m := routing.FromContext(r.Context()); m != nil {
+			return m.Service, true
+		}
+		return "", true
+	}
+	if m := routing.FromContext(r.Context()); m != nil {
+		if v, ok := m.PathParams[name]; ok {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// routeRule returns the route rule matched for r, if any
+func routeRule(r *http.Request) *config.RouteRule {
+	if m := routing.FromContext(r.Context()); m != nil {
+		return m.Rule
+	}
+	return nil
+}
+
+// preserveHost reports whether r is sent upstream with the client's Host header:
+// the route's preserve_host if set, otherwise the global one
+func (p *HTTPProxy) preserveHost(r *http.Request) bool {
+	if rule := routeRule(r); rule != nil && rule.PreserveHost != nil {
+		return *rule.PreserveHost
+	}
+	return p.PreserveHost
+}
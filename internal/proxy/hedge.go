@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xReLogic/Charon/internal/metrics"
+)
+
+var (
+	httpHedgesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "charon_http_hedges_total",
+			Help: "Total number of hedged upstream requests fired",
+		},
+		[]string{"method"},
+	)
+	httpHedgeWinsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "charon_http_hedge_wins_total",
+			Help: "Total number of requests answered by a hedged attempt rather than the primary",
+		},
+		[]string{"method"},
+	)
+)
+
+// HedgePolicy configures hedged requests: when the primary attempt of a GET or
+// HEAD has not answered within Delay, another upstream is tried concurrently and
+// the first response wins.
+type HedgePolicy struct {
+	Delay     time.Duration // wait before each hedge
+	MaxHedges int           // extra attempts per request (default 1)
+	// BudgetPercent caps hedges to this share of eligible requests (default 10)
+	BudgetPercent float64
+	// Pick returns an upstream for r other than the hosts in exclude (nil = none left)
+	Pick func(r *http.Request, exclude []string) (*url.URL, error)
+}
+
+// hedgingTransport races hedged attempts against the primary. The primary goes
+// through the retrying transport; hedges use the plain transport so a request
+// never fans out into hedges times retries.
+type hedgingTransport struct {
+	primary http.RoundTripper
+	hedge   http.RoundTripper
+	policy  HedgePolicy
+	budget  *tokenBudget
+}
+
+func newHedgingTransport(primary, hedge http.RoundTripper, policy HedgePolicy) *hedgingTransport {
+	if policy.MaxHedges <= 0 {
+		policy.MaxHedges = 1
+	}
+	if policy.BudgetPercent <= 0 {
+		policy.BudgetPercent = 10
+	}
+	return &hedgingTransport{primary: primary, hedge: hedge, policy: policy, budget: newTokenBudget(policy.BudgetPercent)}
+}
+
+type attemptResult struct {
+	resp   *http.Response
+	err    error
+	host   string
+	cancel context.CancelFunc
+	hedged bool
+	idx    int
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.eligible(req) {
+		return t.primary.RoundTrip(req)
+	}
+	t.budget.deposit()
+
+	results := make(chan attemptResult, t.policy.MaxHedges+1)
+	var cancels []context.CancelFunc
+	launch := func(rt http.RoundTripper, r *http.Request, hedged bool) {
+		ctx, cancel := context.WithCancel(r.Context())
+		idx := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			resp, err := rt.RoundTrip(r.WithContext(ctx))
+			results <- attemptResult{resp: resp, err: err, host: r.URL.Host, cancel: cancel, hedged: hedged, idx: idx}
+		}()
+	}
+	launch(t.primary, req, false)
+	tried := []string{req.URL.Host}
+	pending, hedges := 1, 0
+
+	timer := time.NewTimer(t.policy.Delay)
+	defer timer.Stop()
+	var lastErr error
+	for {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if res.hedged {
+					httpHedgeWinsTotal.WithLabelValues(req.Method).Inc()
+					metrics.Count("http.hedge_wins", 1, map[string]string{"method": req.Method})
+					if holder := upstreamResultFrom(req.Context()); holder != nil {
+						holder.upstream = res.host
+					}
+				}
+				// Cancel the losers now rather than letting them run to completion
+				for i, cancel := range cancels {
+					if i != res.idx {
+						cancel()
+					}
+				}
+				go discardAttempts(results, pending)
+				res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+				return res.resp, nil
+			}
+			res.cancel()
+			lastErr = res.err
+			if pending == 0 {
+				if hedges >= t.policy.MaxHedges {
+					return nil, lastErr
+				}
+				// Every attempt so far failed; hedge right away instead of waiting
+				timer.Reset(0)
+			}
+		case <-timer.C:
+			if hedges < t.policy.MaxHedges && t.budget.withdraw() {
+				if hr := t.hedgeRequest(req, tried); hr != nil {
+					httpHedgesTotal.WithLabelValues(req.Method).Inc()
+					metrics.Count("http.hedges", 1, map[string]string{"method": req.Method})
+					tried = append(tried, hr.URL.Host)
+					launch(t.hedge, hr, true)
+					pending++
+					hedges++
+					if hedges < t.policy.MaxHedges {
+						timer.Reset(t.policy.Delay)
+					}
+					continue
+				}
+				t.budget.refund()
+			}
+			// No distinct upstream or budget left: settle for what is in flight
+			hedges = t.policy.MaxHedges
+			if pending == 0 {
+				return nil, lastErr
+			}
+		case <-req.Context().Done():
+			go discardAttempts(results, pending)
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// eligible reports whether req may be hedged: bodiless GET or HEAD only, and no
+// upgrades, whose switched connection cannot be raced or handed over twice
+func (t *hedgingTransport) eligible(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if isUpgrade(req) {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// hedgeRequest clones req towards an upstream not tried yet, or returns nil
+func (t *hedgingTransport) hedgeRequest(req *http.Request, tried []string) *http.Request {
+	if t.policy.Pick == nil {
+		return nil
+	}
+	u, err := t.policy.Pick(req, tried)
+	if err != nil || u == nil || u.Host == "" {
+		return nil
+	}
+	hr := req.Clone(req.Context())
+	hr.URL.Scheme = u.Scheme
+	hr.URL.Host = u.Host
+	if req.Host == req.URL.Host { // not the client's Host (preserve_host)
+		hr.Host = u.Host
+	}
+	return hr
+}
+
+// discardAttempts releases losing attempts as they finish
+func discardAttempts(results <-chan attemptResult, pending int) {
+	for ; pending > 0; pending-- {
+		res := <-results
+		res.cancel()
+		if res.resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(res.resp.Body, 4096))
+			res.resp.Body.Close()
+		}
+	}
+}
+
+// cancelOnClose releases the winning attempt's context once its body is consumed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
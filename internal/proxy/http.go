@@ -3,12 +3,18 @@ package proxy
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -16,9 +22,21 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/cache"
+	"github.com/0xReLogic/Charon/internal/concurrency"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/ipfilter"
 	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/metrics"
+	"github.com/0xReLogic/Charon/internal/proxyproto"
 	"github.com/0xReLogic/Charon/internal/ratelimit"
+	"github.com/0xReLogic/Charon/internal/routing"
+	tlsutils "github.com/0xReLogic/Charon/internal/tls"
 	"github.com/0xReLogic/Charon/internal/tracing"
 )
 
@@ -32,34 +50,127 @@ type HTTPProxy struct {
 	ListenAddr string
 	// Resolver resolves incoming requests to upstream URLs
 	Resolver func(r *http.Request) (*url.URL, error)
+	// Optional router; the match is attached to the request context before resolving
+	Router *routing.Router
+	// Per-service settings keyed by service name (optional)
+	Services map[string]config.ServiceConfig
 	// Optional fallback target URL
 	TargetURL *url.URL
-	// Optional callbacks
-	OnUpstreamError   func(host string)
+	// Optional callbacks. OnUpstreamError also gets the service the request was
+	// routed to ("" without one), whose circuit breaker settings apply.
+	OnUpstreamError   func(service, host string)
 	OnUpstreamSuccess func(host string)
+	OnUpstreamNeutral func(host string) // outcome ignored for health (frees a half-open trial)
+	// Called when an attempt is sent to an upstream and when its response body
+	// is closed (or it failed), e.g. to count requests in flight (optional, both or neither)
+	OnUpstreamStart func(host string)
+	OnUpstreamDone  func(host string)
+	// Called with the latency of each request an upstream answered (optional)
+	OnUpstreamComplete func(host string, latency time.Duration)
+	// Called instead of OnUpstreamComplete when the request failed, by an error
+	// or a status classified as a failure (optional)
+	OnUpstreamFailure func(host string, latency time.Duration)
+	// Add the matched route's name as a metric label (off by default, one series per named route)
+	RouteLabels bool
+	// Upstream retry settings for idempotent requests (nil = defaults)
+	Retry *RetryPolicy
+	// Hedge slow GET/HEAD requests to another upstream (nil = disabled)
+	Hedging *HedgePolicy
+	// Pin clients to an upstream with a cookie (nil = disabled)
+	Sticky *StickyPolicy
+	// Decides which errors/statuses trigger OnUpstreamError (nil = defaults)
+	FailureClassifier *FailureClassifier
 	// Rate limiter
 	RateLimiter *ratelimit.RateLimiter
+	// Multi-dimension rate limits; every applicable dimension must allow the request (optional)
+	RateLimits *ratelimit.Policy
+	// Reject requests without a valid API key with 401 (optional)
+	APIKeys *auth.APIKeyAuth
+	// Forward the verified mTLS client identity as request headers (optional)
+	ClientIdentity *ClientIdentityHeaders
+	// Optional admin API served on the proxy listener
+	Admin *admin.Server
+	// Don't serve /metrics on the proxy listener (a dedicated admin listener does)
+	DisableMetricsEndpoint bool
+	// Reports why the instance is not ready for /readyz, or nil when it is (optional)
+	Readiness func() error
+	// Read a PROXY protocol header from accepted connections so the client
+	// address reaches X-Forwarded-For and rate limiting (nil = disabled)
+	ProxyProtocol *proxyproto.Options
+	// Proxies whose X-Forwarded-Proto and X-Forwarded-Host are passed on; other
+	// clients' values are replaced (X-Forwarded-For is always appended to)
+	TrustedProxies []netip.Prefix
+	// Clients allowed on the listener by address (nil = all); routes may narrow it further
+	AccessControl *ipfilter.List
+	// Upstream connection pool and timeouts (zero fields keep the defaults)
+	Transport TransportSettings
+	// Client read, write and keep-alive timeouts of the listener (zero fields keep the defaults)
+	Timeouts ServerTimeouts
 	// TLS configuration
 	TLSConfig      *tls.Config
 	ClientTLS      *tls.Config
 	UseUpstreamTLS bool
+	// Send the client's Host header upstream instead of the upstream's address
+	// (routes may override with preserve_host)
+	PreserveHost bool
+	// Request headers recorded as span attributes (optional)
+	TraceHeaders *tracing.HeaderRecorder
+	// Write an entry per request to a dedicated access log (optional)
+	AccessLog *logging.AccessLogger
+	// Header carrying the request ID: reused when the client sends one, generated
+	// otherwise, and set on the upstream request and the response ("" = disabled)
+	RequestIDHeader string
+	// Accept cleartext HTTP/2 (h2c) from clients, needed for gRPC without TLS
+	H2C bool
+	// Upstream timeout for routes without their own (0 = only the transport's fixed timeouts)
+	DefaultTimeout time.Duration
+	// Reject request bodies larger than this with 413 (0 = unlimited; routes may override)
+	MaxRequestBodyBytes int64
+	// Requests handled at once; more are rejected with 503 (0 = unlimited)
+	MaxConcurrentRequests int
+	// Limit requests in flight by upstream latency; more are rejected with 503 (nil = disabled)
+	AdaptiveConcurrency *concurrency.AdaptiveLimiter
+	// Header rewrites for every upstream response, applied before the route's (nil = none)
+	ResponseHeaders *config.HeaderRulesConfig
+	// Gzip responses for clients that accept it (nil = disabled)
+	Compression *config.CompressionConfig
+	// Response cache bounds (0 = defaults of 1 MiB per entry, 64 MiB total)
+	CacheMaxEntryBytes int64
+	CacheMaxSizeBytes  int64
+
+	// response cache for routes with caching enabled
+	cache *cache.Cache
+	// upstream-side token buckets for services with max_rps, set by SetServiceLimits
+	serviceLimits atomic.Pointer[map[string]*serviceLimit]
+	// draining marks the instance not ready and turns new requests away (maintenance)
+	draining atomic.Bool
+	// inflight counts requests being handled; concurrencyLimit is set by SetMaxConcurrentRequests
+	inflight         atomic.Int64
+	concurrencyLimit atomic.Pointer[int]
+	// router replaces Router once SetRouter is called (config reload)
+	router atomic.Pointer[routing.Router]
+	// classifierOverride replaces FailureClassifier once SetFailureClassifier is called
+	classifierOverride atomic.Pointer[FailureClassifier]
+
+	// server is the running listener, set once Start has bound its address
+	mu          sync.Mutex
+	server      *http.Server
+	pools       []*hostTransports // per-upstream connection pools, set by Start
+	startedOnce sync.Once
+	started     chan struct{}
 }
 
 var (
+	drainingGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "charon_draining",
+		Help: "1 while the proxy is draining (maintenance or shutdown), otherwise 0",
+	})
 	httpRequestsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "charon_http_requests_total",
 			Help: "Total number of HTTP requests handled by Charon",
 		},
-		[]string{"method", "status", "upstream"},
-	)
-	httpRequestLatency = promauto.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    "charon_http_request_latency_seconds",
-			Help:    "Latency of HTTP requests handled by Charon",
-			Buckets: prometheus.DefBuckets,
-		},
-		[]string{"method", "upstream"},
+		[]string{"method", "status", "upstream", "service", "route_name"},
 	)
 	httpRetriesTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -68,15 +179,139 @@ var (
 		},
 		[]string{"method"},
 	)
+	httpRetryBudgetExhaustedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "charon_http_retry_budget_exhausted_total",
+			Help: "Total number of retries skipped because the retry budget was exhausted",
+		},
+		[]string{"method"},
+	)
 	httpRateLimitedTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "charon_http_rate_limited_total",
 			Help: "Total number of HTTP requests rate limited by Charon",
 		},
-		[]string{"route"},
+		[]string{"route", "service", "route_name"},
+	)
+	upstreamStreamErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "charon_upstream_stream_errors_total",
+			Help: "Total number of upstream responses that failed after headers were sent",
+		},
+		[]string{"upstream"},
 	)
 )
 
+// httpRequestLatency is registered with the default buckets and replaced by SetLatencyBuckets
+var httpRequestLatency atomic.Pointer[prometheus.HistogramVec]
+
+func init() {
+	h := newLatencyHistogram(prometheus.DefBuckets)
+	prometheus.MustRegister(h)
+	httpRequestLatency.Store(h)
+}
+
+func newLatencyHistogram(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "charon_http_request_latency_seconds",
+			Help:    "Latency of HTTP requests handled by Charon",
+			Buckets: buckets,
+		},
+		[]string{"method", "upstream", "service", "route_name"},
+	)
+}
+
+// SetLatencyBuckets re-registers charon_http_request_latency_seconds with the
+// given bucket upper bounds in seconds, which must be increasing. Observations
+// recorded so far are dropped, so call it before serving.
+func SetLatencyBuckets(buckets []float64) error {
+	h := newLatencyHistogram(buckets)
+	old := httpRequestLatency.Load()
+	prometheus.Unregister(old)
+	if err := prometheus.Register(h); err != nil {
+		prometheus.MustRegister(old)
+		return err
+	}
+	httpRequestLatency.Store(h)
+	return nil
+}
+
+// metricLabels returns the service and route name labels for r. The route name
+// is only reported when RouteLabels is enabled, to keep cardinality in check.
+func (p *HTTPProxy) metricLabels(r *http.Request) (service, routeName string) {
+	m := routing.FromContext(r.Context())
+	if m == nil {
+		return "", ""
+	}
+	if p.RouteLabels && m.Rule != nil {
+		routeName = m.Rule.Name
+	}
+	return m.Service, routeName
+}
+
+// recordRequest records a handled request in Prometheus and the optional StatsD sink
+func (p *HTTPProxy) recordRequest(r *http.Request, status int, upstream string, latency time.Duration) {
+	service, routeName := p.metricLabels(r)
+	code := strconv.Itoa(status)
+	httpRequestsTotal.WithLabelValues(r.Method, code, upstream, service, routeName).Inc()
+	httpRequestLatency.Load().WithLabelValues(r.Method, upstream, service, routeName).Observe(latency.Seconds())
+	tags := map[string]string{"method": r.Method, "status": code, "upstream": upstream}
+	addServiceTags(tags, service, routeName)
+	metrics.Count("http.requests", 1, tags)
+	metrics.Timing("http.latency", latency, tags)
+}
+
+// recordRetryBudgetExhausted records a retry skipped because the retry budget ran out
+func recordRetryBudgetExhausted(method string) {
+	httpRetryBudgetExhaustedTotal.WithLabelValues(method).Inc()
+	metrics.Count("http.retry_budget_exhausted", 1, map[string]string{"method": method})
+}
+
+// recordRetry records an upstream retry
+func recordRetry(method string) {
+	httpRetriesTotal.WithLabelValues(method).Inc()
+	metrics.Count("http.retries", 1, map[string]string{"method": method})
+}
+
+// recordRateLimited records a request rejected by the client rate limiter
+func (p *HTTPProxy) recordRateLimited(r *http.Request, route string) {
+	service, routeName := p.metricLabels(r)
+	httpRateLimitedTotal.WithLabelValues(route, service, routeName).Inc()
+	tags := map[string]string{"route": route}
+	addServiceTags(tags, service, routeName)
+	metrics.Count("http.rate_limited", 1, tags)
+}
+
+// setRateLimitHeaders advertises the bucket state as X-RateLimit-* headers, plus
+// Retry-After when the request was rejected. Reset and Retry-After are whole
+// seconds, rounded up. A zero state (limiting bypassed) sets nothing.
+func setRateLimitHeaders(h http.Header, st ratelimit.State, limited bool) {
+	if st.Limit == 0 {
+		return
+	}
+	reset := int64((st.Reset + time.Second - 1) / time.Second)
+	h.Set("X-RateLimit-Limit", strconv.Itoa(st.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(st.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+	if limited {
+		if reset < 1 {
+			reset = 1
+		}
+		h.Set("Retry-After", strconv.FormatInt(reset, 10))
+	}
+}
+
+// addServiceTags adds the non-empty service and route name to StatsD tags
+func addServiceTags(tags map[string]string, service, routeName string) {
+	if service != "" {
+		tags["service"] = service
+	}
+	if routeName != "" {
+		tags["route_name"] = routeName
+	}
+}
+
 // NewHTTPProxy creates a new HTTP reverse proxy. target can be a full URL or host:port.
 func NewHTTPProxy(listenAddr, target string) (*HTTPProxy, error) {
 	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
@@ -111,30 +346,108 @@ func (r *statusRecorder) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap lets http.ResponseController reach the connection, e.g. to flush streams
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 type retryTransport struct {
 	base            http.RoundTripper
 	maxRetries      int
 	idempotentOnly  bool
 	backoffFunc     func(int) time.Duration
 	onRetryCallback func(method string)
+	// statuses are response codes retried like transport errors
+	statuses map[int]bool
+	// backoffMax caps the computed backoff and upstream Retry-After (0 = no cap)
+	backoffMax time.Duration
+	// budget limits retries to a share of requests (nil = unlimited)
+	budget *tokenBudget
 }
 
 func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt.budget != nil {
+		rt.budget.deposit()
+	}
 	var resp *http.Response
 	var err error
 	retries := 0
 	for {
 		resp, err = rt.base.RoundTrip(req)
-		if err == nil || retries >= rt.maxRetries || !rt.isIdempotent(req.Method) {
+		// An attempt held back by max_rps would only be held back again
+		retryable := (err != nil && !errors.Is(err, errUpstreamRateLimited)) || (err == nil && rt.statuses[resp.StatusCode])
+		if !retryable || retries >= rt.maxRetries || !rt.isIdempotent(req.Method) {
+			break
+		}
+		// The client left or the route timeout expired; another attempt cannot succeed
+		if req.Context().Err() != nil {
+			break
+		}
+		// The previous attempt consumed the body; only retry if it can be replayed
+		next := req
+		if req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				break
+			}
+			body, gerr := req.GetBody()
+			if gerr != nil {
+				break
+			}
+			next = req.Clone(req.Context())
+			next.Body = body
+		}
+		// Out of budget: serve what we have rather than pile onto the upstream
+		if rt.budget != nil && !rt.budget.withdraw() {
+			recordRetryBudgetExhausted(req.Method)
 			break
 		}
-		rt.onRetryCallback(req.Method)
 		retries++
-		time.Sleep(rt.backoffFunc(retries))
+		wait := rt.backoffFunc(retries)
+		if resp != nil {
+			if d, ok := retryAfter(resp.Header, time.Now()); ok {
+				wait = d
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		if rt.backoffMax > 0 && wait > rt.backoffMax {
+			wait = rt.backoffMax
+		}
+		rt.onRetryCallback(req.Method)
+		req = next
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
 	}
 	return resp, err
 }
 
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
 func (rt *retryTransport) isIdempotent(method string) bool {
 	if !rt.idempotentOnly {
 		return true
@@ -147,21 +460,38 @@ func (rt *retryTransport) isIdempotent(method string) bool {
 	}
 }
 
+// keepAliveTransport forces a fresh upstream connection for flagged requests.
+// ReverseProxy resets outreq.Close after the Director, so this is applied at the transport.
+type keepAliveTransport struct {
+	base    http.RoundTripper
+	disable func(req *http.Request) bool
+}
+
+func (t *keepAliveTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.disable(req) {
+		req = req.Clone(req.Context())
+		req.Close = true
+	}
+	return t.base.RoundTrip(req)
+}
+
 // createReverseProxy creates the reverse proxy with TLS support
 func (p *HTTPProxy) createReverseProxy() *httputil.ReverseProxy {
 	// Configure transport with sane timeouts and connection pooling
+	settings := p.Transport.withDefaults()
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
-			Timeout:   5 * time.Second,
+			Timeout:   settings.DialTimeout,
 			KeepAlive: 30 * time.Second,
 		}).DialContext,
-		TLSHandshakeTimeout:   5 * time.Second,
-		ResponseHeaderTimeout: 10 * time.Second,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
 		ExpectContinueTimeout: 1 * time.Second,
-		MaxIdleConns:          100,
-		MaxIdleConnsPerHost:   10,
-		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          settings.MaxIdleConns,
+		MaxIdleConnsPerHost:   settings.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		IdleConnTimeout:       settings.IdleConnTimeout,
 	}
 
 	// Apply client TLS config if configured
@@ -169,25 +499,37 @@ func (p *HTTPProxy) createReverseProxy() *httputil.ReverseProxy {
 		transport.TLSClientConfig = p.ClientTLS
 	}
 
-	// Wrap with a retrying transport for idempotent methods
-	rt := &retryTransport{
-		base:            transport,
-		maxRetries:      2,
-		idempotentOnly:  true,
-		backoffFunc:     func(i int) time.Duration { return time.Duration(1<<i) * 150 * time.Millisecond },
-		onRetryCallback: func(method string) { httpRetriesTotal.WithLabelValues(method).Inc() },
+	// Requests with a route or default timeout are bounded by their deadline instead
+	// of the fixed response header timeout
+	untimed := transport.Clone()
+	untimed.ResponseHeaderTimeout = 0
+
+	// Wrap with a retrying transport for idempotent methods. Each upstream gets its own connection pool.
+	fixed, deadline := newHostTransports(transport), newHostTransports(untimed)
+	p.mu.Lock()
+	p.pools = []*hostTransports{fixed, deadline}
+	p.mu.Unlock()
+	var upstream http.RoundTripper = &deadlineTransport{fixed: fixed, deadline: deadline}
+	// gRPC routes and services need HTTP/2 to the upstream (h2c or TLS)
+	upstream = &protocolTransport{base: upstream, grpc: newGRPCTransport(p.ClientTLS, settings.DialTimeout), isGRPC: p.isGRPC}
+	var base http.RoundTripper = &keepAliveTransport{base: upstream, disable: p.disableKeepAlive}
+	if p.OnUpstreamStart != nil && p.OnUpstreamDone != nil {
+		base = &inflightTransport{base: base, start: p.OnUpstreamStart, done: p.OnUpstreamDone}
+	}
+	// Protect fragile backends from aggregate load, independent of the client limiter
+	base = &serviceLimitTransport{base: base, allow: p.allowUpstream}
+	var rt http.RoundTripper = p.retryPolicy().transport(base)
+	// Race slow GET/HEAD requests against another upstream when hedging is configured
+	if p.Hedging != nil {
+		rt = newHedgingTransport(rt, base, *p.Hedging)
 	}
 
 	// Build reverse proxy with custom Director. We expect the handler to resolve upstream
 	// and attach it to the context to avoid double-resolve inconsistencies (e.g. RR).
+	// A nil upstream in the context means resolution already ran and failed.
 	rp := &httputil.ReverseProxy{Director: func(req *http.Request) {
-		var upstream *url.URL
-		if v := req.Context().Value(upstreamKey); v != nil {
-			if u, ok := v.(*url.URL); ok {
-				upstream = u
-			}
-		}
-		if upstream == nil && p.Resolver != nil {
+		upstream, resolved := req.Context().Value(upstreamKey).(*url.URL)
+		if !resolved && p.Resolver != nil {
 			if u, err := p.Resolver(req); err == nil && u != nil {
 				upstream = u
 			}
@@ -203,76 +545,431 @@ func (p *HTTPProxy) createReverseProxy() *httputil.ReverseProxy {
 		if scheme == "" {
 			scheme = "http"
 		}
+		p.setForwarded(req)
+		// The API key is Charon's credential, not the upstream's
+		if p.APIKeys != nil && p.APIKeys.Applies(req.URL.Path) {
+			p.APIKeys.Strip(req)
+		}
+		if rule := routeRule(req); rule != nil {
+			applyHeaderRules(req.Header, rule.RequestHeaders, req)
+			if rule.Rewrite != "" {
+				rewritePath(req, rule.Rewrite)
+			}
+		}
 		req.URL.Scheme = scheme
 		req.URL.Host = upstream.Host
-		// Preserve incoming path/query; set Host header to upstream host
-		req.Host = upstream.Host
+		// Preserve incoming path/query; set Host header to upstream host unless
+		// the client's is kept for virtual-host routing (TLS SNI still names the upstream)
+		if !p.preserveHost(req) {
+			req.Host = upstream.Host
+		}
+		// Propagate trace context (traceparent + tracestate) to the upstream
+		tracing.Inject(req.Context(), req.Header)
 	}, Transport: rt,
+		BufferPool: NewBufferPool(settings.BufferSize),
+		ModifyResponse: func(resp *http.Response) error {
+			noteFirstByte(resp.Request.Context())
+			// The client gets the request ID set by the handler, not a second copy
+			if p.RequestIDHeader != "" {
+				resp.Header.Del(p.RequestIDHeader)
+			}
+			// Hop-by-hop headers are already stripped from resp at this point
+			applyHeaderRules(resp.Header, p.ResponseHeaders, resp.Request)
+			if rule := routeRule(resp.Request); rule != nil {
+				applyHeaderRules(resp.Header, rule.ResponseHeaders, resp.Request)
+			}
+			return nil
+		},
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			up := "unknown"
-			if upURL := r.Context().Value(upstreamKey); upURL != nil {
-				up = upURL.(*url.URL).Host
+			if u, _ := r.Context().Value(upstreamKey).(*url.URL); u != nil {
+				up = u.Host
+			}
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				if res := upstreamResultFrom(r.Context()); res != nil {
+					res.err = err
+				}
+				p.writeProxyError(w, r, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if errors.Is(err, errUpstreamRateLimited) {
+				if res := upstreamResultFrom(r.Context()); res != nil {
+					res.err = err
+				}
+				w.Header().Set("Retry-After", "1")
+				p.writeProxyError(w, r, http.StatusServiceUnavailable)
+				return
 			}
 			logging.LogUpstreamError(r.Context(), up, err)
-			if p.OnUpstreamError != nil && up != "" && up != "unknown" {
-				p.OnUpstreamError(up)
+			status := http.StatusBadGateway
+			if timedOut(r) {
+				status = http.StatusGatewayTimeout
+			}
+			// The handler classifies the error once the proxy returns; requests
+			// without a result holder (background revalidation) are reported here
+			if res := upstreamResultFrom(r.Context()); res != nil {
+				res.err = err
+			} else {
+				p.reportOutcome(r, up, err, status)
 			}
-			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			p.writeProxyError(w, r, status)
 		},
 	}
 
 	return rp
 }
 
+// writeProxyError answers a request the proxy could not complete: a gRPC
+// status for gRPC calls, a plain HTTP error otherwise
+func (p *HTTPProxy) writeProxyError(w http.ResponseWriter, r *http.Request, status int) {
+	if p.isGRPC(r) {
+		writeGRPCError(w, status)
+		return
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// disableKeepAlive reports whether the matched route or service opts out of connection reuse
+func (p *HTTPProxy) disableKeepAlive(req *http.Request) bool {
+	m := routing.FromContext(req.Context())
+	if m == nil {
+		return false
+	}
+	if m.Rule != nil && m.Rule.DisableKeepAlive {
+		return true
+	}
+	return p.serviceConfig(m.Service).DisableKeepAlive
+}
+
+// serviceConfig returns the settings of service. Names compare
+// case-insensitively since config keys arrive lowercased.
+func (p *HTTPProxy) serviceConfig(service string) config.ServiceConfig {
+	if svc, ok := p.Services[service]; ok {
+		return svc
+	}
+	return p.Services[strings.ToLower(service)]
+}
+
+// serveUpstream proxies r and reports whether the upstream failed after the response
+// headers were written. ReverseProxy aborts the handler with http.ErrAbortHandler then.
+func serveUpstream(rp http.Handler, w http.ResponseWriter, r *http.Request) (aborted bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			if v != http.ErrAbortHandler {
+				panic(v)
+			}
+			aborted = true
+		}
+	}()
+	rp.ServeHTTP(w, r)
+	return false
+}
+
+// attachUpstream resolves the upstream for r and attaches it to the request context.
+// It returns the request to forward, the upstream host ("unknown" if unresolved)
+// and the resolver error, if any. A failed resolution is attached as a nil URL
+// so the Director does not resolve again.
+func (p *HTTPProxy) attachUpstream(r *http.Request) (*http.Request, string, error) {
+	if p.Resolver == nil {
+		return r, "unknown", nil
+	}
+	u, err := p.Resolver(r)
+	if err != nil || u == nil || u.Host == "" {
+		return r.WithContext(context.WithValue(r.Context(), upstreamKey, (*url.URL)(nil))), "unknown", err
+	}
+	// Update scheme to https if upstream TLS is enabled
+	if p.UseUpstreamTLS {
+		u.Scheme = "https"
+	}
+	return r.Clone(context.WithValue(r.Context(), upstreamKey, u)), u.Host, nil
+}
+
+// SetDraining marks the proxy as draining (not ready, new requests rejected) or ready again
+func (p *HTTPProxy) SetDraining(draining bool) {
+	p.draining.Store(draining)
+	value := 0.0
+	if draining {
+		value = 1
+	}
+	drainingGauge.Set(value)
+}
+
+// Draining reports whether the proxy is in maintenance drain
+func (p *HTTPProxy) Draining() bool {
+	return p.draining.Load()
+}
+
+// handleReady reports readiness for load balancers and orchestrators
+func (p *HTTPProxy) handleReady(w http.ResponseWriter, r *http.Request) {
+	if p.Draining() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
+		return
+	}
+	if p.Readiness != nil {
+		if err := p.Readiness(); err != nil {
+			http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ready\n"))
+}
+
 // Start starts the HTTP proxy server
 func (p *HTTPProxy) Start() error {
 	// Create reverse proxy
 	rp := p.createReverseProxy()
+	if p.cache == nil {
+		maxEntry, maxSize := p.CacheMaxEntryBytes, p.CacheMaxSizeBytes
+		if maxEntry <= 0 {
+			maxEntry = defaultCacheMaxEntryBytes
+		}
+		if maxSize <= 0 {
+			maxSize = defaultCacheMaxSizeBytes
+		}
+		p.cache = cache.NewWithLimits(maxEntry, maxSize)
+	}
+	if p.serviceLimits.Load() == nil {
+		p.SetServiceLimits(p.Services)
+	}
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Create span for tracing
-		ctx, span := tracing.StartSpan(r.Context(), "http_request")
+	var proxied http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Correlate the request end to end; the ID is the trace_id of its log entries
+		var reqID string
+		if p.RequestIDHeader != "" {
+			reqID = requestID(r.Header, p.RequestIDHeader)
+			r.Header.Set(p.RequestIDHeader, reqID)
+			w.Header().Set(p.RequestIDHeader, reqID)
+			r = r.WithContext(logging.WithTraceID(r.Context(), reqID))
+		}
+
+		// Maintenance drain: in-flight requests finish, new ones are turned away
+		// and their connections closed so clients reconnect elsewhere
+		if p.Draining() {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Shed load beyond max_concurrent_requests instead of piling up goroutines
+		if !p.admit() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many concurrent requests", http.StatusServiceUnavailable)
+			return
+		}
+		defer p.release()
+
+		// Create span for tracing, continuing any incoming trace context
+		ctx, span := tracing.StartSpan(tracing.Extract(r.Context(), r.Header), "http_request")
 		defer span.End()
 
 		// Set basic span attributes
+		spanURL := *r.URL
+		spanURL.RawQuery = p.APIKeys.RedactQuery(spanURL.RawQuery)
 		span.SetAttributes(
 			attribute.String("http.method", r.Method),
-			attribute.String("http.url", r.URL.String()),
+			attribute.String("http.url", spanURL.String()),
 			attribute.String("http.user_agent", r.UserAgent()),
 		)
+		span.SetAttributes(p.TraceHeaders.Attributes(r.Header)...)
+		if reqID != "" {
+			span.SetAttributes(attribute.String("http.request_id", reqID))
+		}
+		noteAccess(ctx, func(a *accessInfo) { a.traceID = tracing.TraceIDFromContext(ctx) })
 
+		// Expose the verified mTLS client identity to routing and authorization
+		cert := tlsutils.VerifiedClientCert(r.TLS)
+		if cert != nil {
+			ctx = tlsutils.WithClientCert(ctx, cert)
+		}
+		// Identity headers are replaced before routing so clients cannot spoof them
+		if p.ClientIdentity != nil {
+			p.ClientIdentity.apply(r.Header, cert)
+		}
+		// API key authentication; the identity feeds api_key rate limits
+		if p.APIKeys != nil && p.APIKeys.Applies(r.URL.Path) {
+			id, reason, ok := p.APIKeys.Authenticate(r)
+			if !ok {
+				span.SetStatus(codes.Error, "api key "+reason)
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			ctx = auth.WithIdentity(ctx, id)
+			noteAccess(ctx, func(a *accessInfo) { a.user = id.Name })
+			span.SetAttributes(attribute.String("auth.key_name", id.Name))
+		}
 		r = r.WithContext(ctx)
 
+		// Route the request and make the decision available to the resolver
+		var rule *config.RouteRule
+		if router := p.currentRouter(); router != nil {
+			m := router.Match(r)
+			rule = m.Rule
+			r = r.WithContext(routing.NewContext(r.Context(), m))
+		}
+
+		// The route's IP allow/deny lists
+		if m := routing.FromContext(r.Context()); m != nil && !p.allowClient(w, r, m.Access, "route") {
+			span.SetStatus(codes.Error, "client address denied")
+			return
+		}
+
+		// Identity-based authorization for routes with a client_cert policy
+		if rule != nil && !clientCertAllowed(rule.ClientCert, tlsutils.ClientCertFromContext(r.Context())) {
+			span.SetStatus(codes.Error, "client certificate not allowed")
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
 		// Rate limiting check
 		if p.RateLimiter != nil {
 			route := r.URL.Path
-			if !p.RateLimiter.Allow(route) {
-				httpRateLimitedTotal.WithLabelValues(route).Inc()
+			ok, state := p.RateLimiter.AllowState(route)
+			setRateLimitHeaders(w.Header(), state, !ok)
+			if !ok {
+				p.recordRateLimited(r, route)
 				logging.LogRateLimited(ctx, route)
 				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 				return
 			}
 		}
+		if p.RateLimits != nil {
+			decision := p.RateLimits.Check(r)
+			setRateLimitHeaders(w.Header(), decision.State, !decision.Allowed)
+			if !decision.Allowed {
+				route := r.URL.Path
+				p.recordRateLimited(r, route)
+				logging.LogRateLimited(ctx, route)
+				w.Header().Set("X-RateLimit-Dimension", decision.Dimension)
+				http.Error(w, "Rate limit exceeded: "+decision.Dimension, http.StatusTooManyRequests)
+				return
+			}
+		}
 
 		start := time.Now()
 		rec := &statusRecorder{ResponseWriter: w, status: 200}
-		// Resolve upstream early for consistent logging/metrics and attach to context
-		resolvedUp := "unknown"
-		var chosen *url.URL
-		if p.Resolver != nil {
-			if u, err := p.Resolver(r); err == nil && u != nil && u.Host != "" {
-				chosen = u
-				resolvedUp = u.Host
-				// Update scheme to https if upstream TLS is enabled
-				if p.UseUpstreamTLS {
-					chosen.Scheme = "https"
+
+		// Routes with a static response or a redirect are answered here, without an upstream
+		if rule != nil && rule.Respond != nil {
+			status := rule.Respond.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			writeStatic(rec, r, status, rule.Respond.Headers, rule.Respond.Body)
+			p.finishLocal(ctx, span, rec, r, respondUpstream, start)
+			return
+		}
+		if rule != nil && rule.Redirect != nil {
+			status := rule.Redirect.Status
+			if status == 0 {
+				status = http.StatusFound
+			}
+			http.Redirect(rec, r, redirectTarget(rule.Redirect, r), status)
+			p.finishLocal(ctx, span, rec, r, redirectUpstream, start)
+			return
+		}
+
+		// Compress on the way out so rec accounts for the bytes actually sent
+		var cw http.ResponseWriter = rec
+		gz := p.responseCompressor(rec, r)
+		if gz != nil {
+			cw = gz
+		}
+
+		// Serve from cache when the route has caching enabled
+		var out http.ResponseWriter = cw
+		var capture *captureWriter
+		var cacheHeader http.Header // the request header the response is stored for
+		ttl, swr, cacheOn := cachePolicy(rule)
+		if cacheOn && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			key := p.cache.Key(cacheKey(r), r.Header)
+			e, st := p.cache.Get(key)
+			if st == cache.Miss && r.Method == http.MethodGet {
+				// Concurrent misses of a key wait for one upstream fetch
+				if done, leader := p.cache.BeginFill(key); leader {
+					defer p.cache.EndFill(key)
+				} else if awaitFill(r, done) {
+					key = p.cache.Key(cacheKey(r), r.Header)
+					e, st = p.cache.Get(key)
+				}
+			}
+			p.observeCache()
+			if st != cache.Miss {
+				cacheRequestsTotal.WithLabelValues(strings.ToLower(st.String())).Inc()
+				if st == cache.Stale && p.cache.BeginRevalidate(key) {
+					// Entries always hold a GET response, even when HEAD found them stale
+					rr := r.Clone(withoutAdaptiveSample(context.WithoutCancel(r.Context())))
+					rr.Method = http.MethodGet
+					go p.revalidate(rp, rr, key, ttl, swr)
+				}
+				writeCached(cw, r, e, st)
+				if gz != nil {
+					_ = gz.Close()
 				}
+				latency := time.Since(start)
+				span.SetAttributes(
+					attribute.String("cache.result", st.String()),
+					attribute.Int("http.status_code", rec.status),
+				)
+				logging.LogHTTPRequest(r.Context(), r.Method, r.URL.Path, "cache", strconv.Itoa(rec.status), latency.Milliseconds(), int64(rec.size))
+				noteAccess(ctx, func(a *accessInfo) { a.upstream = "cache" })
+				p.recordRequest(r, rec.status, "cache", latency)
+				return
+			}
+			cacheRequestsTotal.WithLabelValues("miss").Inc()
+			rec.Header().Set("X-Cache", cache.Miss.String())
+			// A HEAD response has no body to store; only GET populates the cache
+			if r.Method == http.MethodGet {
+				capture = &captureWriter{ResponseWriter: cw, status: 200, limit: p.cache.MaxEntryBytes()}
+				out = capture
+				cacheHeader = r.Header.Clone()
 			}
 		}
 
-		if chosen != nil {
-			r = r.Clone(context.WithValue(r.Context(), upstreamKey, chosen))
+		// Cap the request body before anything reads it
+		if !p.limitRequestBody(rec, r, rule) {
+			p.recordBodyRejected(r, http.StatusRequestEntityTooLarge, start)
+			return
+		}
+
+		// Compress large request bodies for routes whose upstream accepts gzip
+		if minBytes := compressThreshold(rule); minBytes >= 0 {
+			if err := compressRequestBody(r, minBytes); err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(rec, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				} else {
+					http.Error(rec, "failed to read request body", http.StatusBadRequest)
+				}
+				p.recordBodyRejected(r, rec.status, start)
+				return
+			}
+		}
+
+		// Resolve upstream early for consistent logging/metrics and attach to context
+		r, resolvedUp, resolveErr := p.attachUpstream(r)
+
+		// Every upstream is circuit-open: switch to the route's fallback service or response
+		if errors.Is(resolveErr, ErrCircuitOpen) && rule != nil && rule.Fallback != nil {
+			var served bool
+			if r, resolvedUp, served = p.fallback(rec, r, rule.Fallback); served {
+				latency := time.Since(start)
+				span.SetAttributes(
+					attribute.String("upstream.host", resolvedUp),
+					attribute.Int("http.status_code", rec.status),
+				)
+				logging.LogHTTPRequest(r.Context(), r.Method, r.URL.Path, resolvedUp, strconv.Itoa(rec.status), latency.Milliseconds(), int64(rec.size))
+				noteAccess(ctx, func(a *accessInfo) { a.upstream = resolvedUp })
+				p.recordRequest(r, rec.status, resolvedUp, latency)
+				return
+			}
+		}
+
+		// Keep the client on this upstream for its next requests
+		if p.Sticky != nil && resolveErr == nil {
+			p.Sticky.pin(rec, r, resolvedUp)
 		}
 
 		// Add upstream information to span
@@ -280,8 +977,46 @@ func (p *HTTPProxy) Start() error {
 			attribute.String("upstream.host", resolvedUp),
 		)
 
-		rp.ServeHTTP(rec, r)
+		// Bound the upstream exchange by the route's timeout (504 when it expires)
+		r, cancelTimeout := p.withTimeout(r, rule)
+		defer cancelTimeout()
+
+		ctx, result := withUpstreamResult(r.Context())
+		r = r.WithContext(ctx)
+		aborted := serveUpstream(rp, out, r)
 		latency := time.Since(start)
+		noteLatency(ctx, latency)
+		if result.upstream != "" {
+			resolvedUp = result.upstream // a hedged attempt answered
+		}
+		noteAccess(ctx, func(a *accessInfo) { a.upstream = resolvedUp })
+
+		// The upstream failed mid-body: the status is already sent, so count it as a
+		// failure (unless the client canceled) and abort the client connection to make the truncation visible
+		if aborted {
+			upstreamStreamErrorsTotal.WithLabelValues(resolvedUp).Inc()
+			logging.LogUpstreamError(r.Context(), resolvedUp, fmt.Errorf("upstream failed mid-stream after status %d (%d bytes sent)", rec.status, rec.size))
+			span.SetStatus(codes.Error, "upstream stream error")
+			streamErr := error(io.ErrUnexpectedEOF)
+			if err := r.Context().Err(); err != nil {
+				streamErr = err // the client went away, not the upstream
+			}
+			p.reportOutcome(r, resolvedUp, streamErr, rec.status)
+			p.recordRequest(r, rec.status, resolvedUp, latency)
+			panic(http.ErrAbortHandler)
+		}
+
+		if gz != nil {
+			_ = gz.Close()
+		}
+
+		if capture != nil && p.isCacheable(r, capture.status, capture.storedHeader()) {
+			if capture.overflow {
+				cacheSkippedTotal.Inc()
+			} else {
+				p.store(cacheKey(r), cacheHeader, newEntry(capture.status, capture.storedHeader(), capture.buf.Bytes(), ttl, swr))
+			}
+		}
 
 		// Set final span attributes
 		span.SetAttributes(
@@ -298,29 +1033,64 @@ func (p *HTTPProxy) Start() error {
 		}
 
 		// Log HTTP request with structured logging
-		logging.LogHTTPRequest(r.Context(), r.Method, r.URL.Path, resolvedUp, strconv.Itoa(rec.status), latency.Milliseconds(), int64(rec.size))
-
-		// Count server-side errors (>=500) as upstream errors for circuit breaker, but avoid double-counting 502 from ErrorHandler
-		if p.OnUpstreamError != nil && resolvedUp != "unknown" && rec.status >= 500 && rec.status != http.StatusBadGateway {
-			p.OnUpstreamError(resolvedUp)
+		if p.isGRPC(r) {
+			logging.LogGRPCRequest(r.Context(), r.URL.Path, resolvedUp, strconv.Itoa(rec.status), grpcStatus(rec.Header()), latency.Milliseconds(), int64(rec.size))
+		} else {
+			logging.LogHTTPRequest(r.Context(), r.Method, r.URL.Path, resolvedUp, strconv.Itoa(rec.status), latency.Milliseconds(), int64(rec.size))
 		}
 
-		// Notify success path for circuit breaker if applicable
-		if p.OnUpstreamSuccess != nil && resolvedUp != "unknown" && rec.status < 500 {
-			p.OnUpstreamSuccess(resolvedUp)
+		// Feed the circuit breaker according to the failure classification
+		outcome := p.reportOutcome(r, resolvedUp, result.err, rec.status)
+		switch {
+		case resolvedUp == "" || resolvedUp == "unknown":
+		case outcome == OutcomeFailure && p.OnUpstreamFailure != nil:
+			p.OnUpstreamFailure(resolvedUp, latency)
+		case outcome != OutcomeFailure && result.err == nil && p.OnUpstreamComplete != nil:
+			p.OnUpstreamComplete(resolvedUp, latency)
 		}
 
 		// Metrics
-		httpRequestsTotal.WithLabelValues(r.Method, strconv.Itoa(rec.status), resolvedUp).Inc()
-		httpRequestLatency.WithLabelValues(r.Method, resolvedUp).Observe(latency.Seconds())
+		p.recordRequest(r, rec.status, resolvedUp, latency)
 	})
+	if p.AdaptiveConcurrency != nil {
+		proxied = p.withAdaptiveLimit(proxied)
+	}
+	mux.Handle("/", proxied)
 
-	mux.Handle("/metrics", promhttp.Handler())
+	if !p.DisableMetricsEndpoint {
+		mux.Handle("/metrics", promhttp.Handler())
+	}
+	mux.HandleFunc("/readyz", p.handleReady)
+	if p.Admin != nil {
+		p.Admin.Register(mux)
+	}
 
+	var handler http.Handler = mux
+	if p.AccessControl != nil {
+		handler = p.withAccessControl(handler)
+	}
+	if p.AccessLog != nil {
+		handler = p.withAccessLog(handler)
+	}
+	if p.H2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
 	server := &http.Server{
 		Addr:    p.ListenAddr,
-		Handler: mux,
+		Handler: handler,
+	}
+	p.Timeouts.apply(server)
+	ln, err := net.Listen("tcp", p.ListenAddr)
+	if err != nil {
+		return err
+	}
+	if p.ProxyProtocol != nil {
+		ln = proxyproto.NewListener(ln, *p.ProxyProtocol)
 	}
+	p.mu.Lock()
+	p.server = server
+	p.mu.Unlock()
+	close(p.startedCh())
 
 	logging.LogHTTPServerStart(p.ListenAddr)
 
@@ -331,8 +1101,63 @@ func (p *HTTPProxy) Start() error {
 			"address": p.ListenAddr,
 			"tls":     true,
 		})
-		return server.ListenAndServeTLS("", "") // certificates in TLSConfig
+		err = server.ServeTLS(ln, "", "") // certificates in TLSConfig
+	} else {
+		err = server.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil // stopped by Stop
+	}
+	return err
+}
+
+// ForgetUpstream drops the connection pool of a registry address that is no
+// longer an upstream, closing its idle connections
+func (p *HTTPProxy) ForgetUpstream(addr string) {
+	u, err := UpstreamURL(addr, p.UseUpstreamTLS)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	pools := p.pools
+	p.mu.Unlock()
+	for _, pool := range pools {
+		pool.forget(u.Host)
+	}
+}
+
+// SetRouter replaces the route matcher used for new requests, e.g. after a config reload
+func (p *HTTPProxy) SetRouter(rt *routing.Router) {
+	p.router.Store(rt)
+}
+
+// currentRouter returns the router set by SetRouter, or Router
+func (p *HTTPProxy) currentRouter() *routing.Router {
+	if rt := p.router.Load(); rt != nil {
+		return rt
 	}
+	return p.Router
+}
+
+// Started returns a channel that is closed once Start has bound the listener
+func (p *HTTPProxy) Started() <-chan struct{} {
+	return p.startedCh()
+}
 
-	return server.ListenAndServe()
+func (p *HTTPProxy) startedCh() chan struct{} {
+	p.startedOnce.Do(func() { p.started = make(chan struct{}) })
+	return p.started
+}
+
+// Stop marks the proxy not ready, stops accepting connections and waits for
+// in-flight requests to finish until ctx expires.
+func (p *HTTPProxy) Stop(ctx context.Context) error {
+	p.SetDraining(true)
+	p.mu.Lock()
+	server := p.server
+	p.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
 }
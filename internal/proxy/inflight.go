@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// inflightTransport reports each upstream attempt to start when it is sent and
+// to done once its response body is closed or it failed, so a balancer can
+// count the requests an upstream is still serving.
+type inflightTransport struct {
+	base  http.RoundTripper
+	start func(host string)
+	done  func(host string)
+}
+
+func (t *inflightTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	t.start(host)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		t.done(host)
+		return nil, err
+	}
+	done := func() { t.done(host) }
+	if rwc, ok := resp.Body.(io.ReadWriteCloser); ok && resp.StatusCode == http.StatusSwitchingProtocols {
+		// The body of a 101 is the switched connection: ReverseProxy needs to
+		// write to it and closes it when either side hangs up
+		resp.Body = &doneConn{doneBody: doneBody{ReadCloser: rwc, done: done}, w: rwc}
+		return resp, nil
+	}
+	resp.Body = &doneBody{ReadCloser: resp.Body, done: done}
+	return resp, nil
+}
+
+// doneBody calls done once when the body is closed
+type doneBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *doneBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// doneConn is a doneBody that stays writable, for upgraded connections
+type doneConn struct {
+	doneBody
+	w io.Writer
+}
+
+func (c *doneConn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// redirectUpstream is the upstream label of requests answered by a route's redirect
+const redirectUpstream = "redirect"
+
+// redirectTarget expands the redirect's target against r and carries the
+// query string over unless the target sets its own.
+func redirectTarget(rd *config.RouteRedirectConfig, r *http.Request) string {
+	to := expandTemplate(rd.To, r)
+	if r.URL.RawQuery != "" && !strings.Contains(rd.To, "?") {
+		to += "?" + r.URL.RawQuery
+	}
+	return to
+}
+
+// rewritePath replaces the path sent upstream with the route's rewrite
+// template, expanded like a redirect target. The query string is kept.
+func rewritePath(req *http.Request, rewrite string) {
+	req.URL.Path = expandTemplate(rewrite, req)
+	req.URL.RawPath = ""
+}
+
+// requestHost returns the client's Host header without its port
+func requestHost(r *http.Request) string {
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		if strings.Contains(h, ":") {
+			return "[" + h + "]"
+		}
+		return h
+	}
+	return r.Host
+}
+
+// HTTPSRedirect returns a handler that answers every request with a 301 to
+// the same host and URI over https. port is the HTTPS port, omitted when 443.
+func HTTPSRedirect(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := requestHost(r)
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,34 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+// DefaultRequestIDHeader carries the request ID unless request_id_header says otherwise
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied IDs so they cannot bloat logs
+const maxRequestIDLength = 128
+
+// requestID returns the client's ID from header name when it is usable, or a new one
+func requestID(h http.Header, name string) string {
+	if id := h.Get(name); validRequestID(id) {
+		return id
+	}
+	return logging.GenerateTraceID()
+}
+
+// validRequestID accepts 1-128 visible ASCII characters, keeping log lines intact
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// respondUpstream is the upstream label of requests answered by a route's respond
+const respondUpstream = "respond"
+
+// writeStatic writes a response generated by the proxy itself. Content-Type
+// defaults to plain text; a HEAD request gets the headers only.
+func writeStatic(w http.ResponseWriter, r *http.Request, status int, header map[string]string, body string) {
+	h := w.Header()
+	for k, v := range header {
+		h.Set(k, v)
+	}
+	if h.Get("Content-Type") == "" {
+		h.Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+// finishLocal traces, logs and counts a request the proxy answered itself,
+// under the given upstream label.
+func (p *HTTPProxy) finishLocal(ctx context.Context, span trace.Span, rec *statusRecorder, r *http.Request, upstream string, start time.Time) {
+	latency := time.Since(start)
+	span.SetAttributes(
+		attribute.String("upstream.host", upstream),
+		attribute.Int("http.status_code", rec.status),
+	)
+	logging.LogHTTPRequest(r.Context(), r.Method, r.URL.Path, upstream, strconv.Itoa(rec.status), latency.Milliseconds(), int64(rec.size))
+	noteAccess(ctx, func(a *accessInfo) { a.upstream = upstream })
+	p.recordRequest(r, rec.status, upstream, latency)
+}
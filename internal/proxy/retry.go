@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// RetryPolicy configures retries of idempotent requests after transport errors
+// or retryable response statuses. Zero fields take the defaults.
+type RetryPolicy struct {
+	MaxRetries int           // attempts after the first (default 2, negative disables)
+	Backoff    time.Duration // base of the exponential backoff (default 150ms)
+	// BackoffMax caps the backoff and any upstream Retry-After (default 5s)
+	BackoffMax time.Duration
+	Statuses   []int // response statuses retried (default none)
+	// BudgetPercent caps retries to this share of requests (default 10, negative = unlimited)
+	BudgetPercent float64
+}
+
+// retryPolicy returns the configured policy with defaults applied
+func (p *HTTPProxy) retryPolicy() RetryPolicy {
+	var rp RetryPolicy
+	if p.Retry != nil {
+		rp = *p.Retry
+	}
+	if rp.MaxRetries == 0 {
+		rp.MaxRetries = 2
+	}
+	if rp.Backoff <= 0 {
+		rp.Backoff = 150 * time.Millisecond
+	}
+	if rp.BackoffMax <= 0 {
+		rp.BackoffMax = 5 * time.Second
+	}
+	if rp.BudgetPercent == 0 {
+		rp.BudgetPercent = 10
+	}
+	return rp
+}
+
+// transport builds the retrying transport over base
+func (rp RetryPolicy) transport(base http.RoundTripper) *retryTransport {
+	rt := &retryTransport{
+		base:            base,
+		maxRetries:      rp.MaxRetries,
+		idempotentOnly:  true,
+		backoffFunc:     func(i int) time.Duration { return time.Duration(1<<i) * rp.Backoff },
+		onRetryCallback: recordRetry,
+		statuses:        map[int]bool{},
+		backoffMax:      rp.BackoffMax,
+	}
+	if rt.maxRetries < 0 {
+		rt.maxRetries = 0
+	}
+	for _, s := range rp.Statuses {
+		rt.statuses[s] = true
+	}
+	if rp.BudgetPercent > 0 {
+		rt.budget = newTokenBudget(rp.BudgetPercent)
+	}
+	return rt
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// ServerTimeouts bounds how long the HTTP listener waits on clients. Zero
+// fields keep the defaults.
+type ServerTimeouts struct {
+	ReadHeaderTimeout time.Duration // for the request line and headers (default 10s)
+	ReadTimeout       time.Duration // for the whole request, body included (default 0, none)
+	WriteTimeout      time.Duration // from the end of the headers to the end of the response (default 0, none)
+	IdleTimeout       time.Duration // keep-alive wait for the next request (default 120s)
+}
+
+// withDefaults fills the unset fields with the defaults
+func (t ServerTimeouts) withDefaults() ServerTimeouts {
+	if t.ReadHeaderTimeout == 0 {
+		t.ReadHeaderTimeout = 10 * time.Second
+	}
+	if t.IdleTimeout == 0 {
+		t.IdleTimeout = 120 * time.Second
+	}
+	return t
+}
+
+// apply sets the timeouts on server. Upgraded connections (e.g. WebSocket) are
+// not bound by them: net/http clears the deadlines when the connection is hijacked.
+func (t ServerTimeouts) apply(server *http.Server) {
+	t = t.withDefaults()
+	server.ReadHeaderTimeout = t.ReadHeaderTimeout
+	server.ReadTimeout = t.ReadTimeout
+	server.WriteTimeout = t.WriteTimeout
+	server.IdleTimeout = t.IdleTimeout
+}
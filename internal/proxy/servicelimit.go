@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+// errUpstreamRateLimited fails an upstream attempt held back by its service's
+// max_rps. The upstream is never contacted, so it says nothing about its health.
+var errUpstreamRateLimited = errors.New("upstream rate limit exceeded")
+
+var upstreamRateLimitedTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "charon_upstream_rate_limited_total",
+		Help: "Total number of upstream attempts rejected because a service's max_rps was exceeded",
+	},
+	[]string{"service"},
+)
+
+// serviceLimit is the token bucket enforcing a service's max_rps
+type serviceLimit struct {
+	maxRPS int
+	bucket *ratelimit.TokenBucket
+}
+
+// SetServiceLimits applies the max_rps of services, e.g. after a config reload.
+// Services whose cap is unchanged keep their bucket.
+func (p *HTTPProxy) SetServiceLimits(services map[string]config.ServiceConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prev := p.serviceLimits.Load()
+	limits := make(map[string]*serviceLimit)
+	for name, svc := range services {
+		if svc.MaxRPS <= 0 {
+			continue
+		}
+		name = strings.ToLower(name)
+		if prev != nil {
+			if l := (*prev)[name]; l != nil && l.maxRPS == svc.MaxRPS {
+				limits[name] = l
+				continue
+			}
+		}
+		limits[name] = &serviceLimit{maxRPS: svc.MaxRPS, bucket: ratelimit.NewTokenBucket(svc.MaxRPS, svc.MaxRPS)}
+	}
+	p.serviceLimits.Store(&limits)
+}
+
+// allowUpstream takes a token for an attempt at the matched service, reporting
+// the service and whether its max_rps allows the attempt
+func (p *HTTPProxy) allowUpstream(r *http.Request) (string, bool) {
+	m := routing.FromContext(r.Context())
+	if m == nil || m.Service == "" {
+		return "", true
+	}
+	limits := p.serviceLimits.Load()
+	if limits == nil {
+		return m.Service, true
+	}
+	l := (*limits)[strings.ToLower(m.Service)]
+	if l == nil {
+		return m.Service, true
+	}
+	return m.Service, l.bucket.Allow()
+}
+
+// serviceLimitTransport enforces max_rps per upstream attempt, so retries and
+// hedges count against the cap like first attempts do
+type serviceLimitTransport struct {
+	base  http.RoundTripper
+	allow func(r *http.Request) (string, bool)
+}
+
+func (t *serviceLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if service, ok := t.allow(req); !ok {
+		upstreamRateLimitedTotal.WithLabelValues(service).Inc()
+		return nil, errUpstreamRateLimited
+	}
+	return t.base.RoundTrip(req)
+}
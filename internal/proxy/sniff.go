@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"time"
+)
+
+// Protocols reported by DetectProtocol
+const (
+	ProtocolTLS   = "tls"
+	ProtocolHTTP  = "http"
+	ProtocolOther = "other"
+)
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "), []byte("DELETE "),
+	[]byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "), []byte("TRACE "), []byte("PRI * "),
+}
+
+// DetectProtocol classifies the first bytes of a connection as a TLS
+// ClientHello record, an HTTP/1.x request line, or something else.
+func DetectProtocol(b []byte) string {
+	// TLS handshake record: content type 0x16, major version 3
+	if len(b) >= 2 && b[0] == 0x16 && b[1] == 0x03 {
+		return ProtocolTLS
+	}
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, m) || (len(b) < len(m) && len(b) > 0 && bytes.HasPrefix(m, b)) {
+			return ProtocolHTTP
+		}
+	}
+	return ProtocolOther
+}
+
+// peekConn is a net.Conn whose initial bytes were read ahead for protocol
+// detection; reads replay the buffered bytes before reading from the socket.
+type peekConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newPeekConn(c net.Conn) *peekConn {
+	return &peekConn{Conn: c, r: bufio.NewReader(c)}
+}
+
+func (c *peekConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// CloseWrite half-closes the underlying TCP connection when supported
+func (c *peekConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// sniff waits up to timeout for the first bytes and classifies them without consuming them.
+func (c *peekConn) sniff(timeout time.Duration) string {
+	_ = c.Conn.SetReadDeadline(time.Now().Add(timeout))
+	defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+
+	if _, err := c.r.Peek(1); err != nil {
+		return ProtocolOther
+	}
+	n := c.r.Buffered()
+	if n > 8 {
+		n = 8
+	}
+	b, _ := c.r.Peek(n)
+	return DetectProtocol(b)
+}
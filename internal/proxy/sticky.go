@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+// DefaultStickyCookie names the sticky session cookie unless configured otherwise
+const DefaultStickyCookie = "CHARON_UPSTREAM"
+
+// StickyPolicy pins a client to the upstream that served it with one cookie per
+// service. The resolver reads the cookie (Token) and keeps the upstream while it
+// is usable; the proxy sets the cookie whenever it names a different upstream.
+type StickyPolicy struct {
+	Cookie string        // cookie name prefix (default DefaultStickyCookie)
+	MaxAge time.Duration // cookie lifetime (0 = until the browser closes)
+	// Secret keys the cookie tokens. Instances sharing clients need the same
+	// one; when empty a random secret is made per process.
+	Secret []byte
+
+	secretOnce sync.Once
+	secret     []byte
+}
+
+// UpstreamToken returns the opaque cookie value naming upstream host of
+// service: an HMAC, so the cookie neither reveals internal addresses nor can
+// be computed by clients.
+func (s *StickyPolicy) UpstreamToken(service, host string) string {
+	mac := hmac.New(sha256.New, s.key())
+	mac.Write([]byte(service))
+	mac.Write([]byte{0})
+	mac.Write([]byte(host))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+func (s *StickyPolicy) key() []byte {
+	s.secretOnce.Do(func() {
+		s.secret = s.Secret
+		if len(s.secret) == 0 {
+			s.secret = make([]byte, 32)
+			_, _ = rand.Read(s.secret)
+		}
+	})
+	return s.secret
+}
+
+// CookieName returns the name of service's sticky cookie
+func (s *StickyPolicy) CookieName(service string) string {
+	name := s.Cookie
+	if name == "" {
+		name = DefaultStickyCookie
+	}
+	return name + "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, service)
+}
+
+// Token returns the upstream token of r's sticky cookie for service, or "" without one
+func (s *StickyPolicy) Token(r *http.Request, service string) string {
+	c, err := r.Cookie(s.CookieName(service))
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// pin sets the sticky cookie on w for upstream unless r already carries it.
+// Only requests routed to a service are pinned; a static target has no choice to keep.
+func (s *StickyPolicy) pin(w http.ResponseWriter, r *http.Request, upstream string) {
+	m := routing.FromContext(r.Context())
+	if m == nil || m.Service == "" {
+		return
+	}
+	token := s.UpstreamToken(m.Service, upstream)
+	if s.Token(r, m.Service) == token {
+		return
+	}
+	c := &http.Cookie{
+		Name:     s.CookieName(m.Service),
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.MaxAge > 0 {
+		c.MaxAge = int(s.MaxAge.Seconds())
+	}
+	http.SetCookie(w, c)
+}
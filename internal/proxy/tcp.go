@@ -1,18 +1,71 @@
 package proxy
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/0xReLogic/Charon/internal/metrics"
+	"github.com/0xReLogic/Charon/internal/proxyproto"
 )
 
 // TCPProxy implements a simple TCP proxy
 type TCPProxy struct {
 	ListenAddr string
 	TargetAddr string
+	// Optional per-protocol targets keyed by "tls", "http" or "other". When set, the
+	// first bytes of each connection are inspected (and replayed) to pick the target;
+	// protocols without an entry fall back to TargetAddr.
+	ProtocolTargets map[string]string
+	// How long to wait for the client's first bytes when sniffing (default 2s)
+	SniffTimeout time.Duration
+	// Picks the upstream for each connection from the client's address, e.g. from a
+	// registry service via the balancer (optional). Used instead of TargetAddr when set.
+	Resolver func(client net.Addr) (string, error)
+	// Passive health feedback for upstreams returned by Resolver (optional)
+	OnDialError   func(addr string)
+	OnDialSuccess func(addr string)
+	// Called when a connection to an upstream returned by Resolver opens and
+	// closes (optional), e.g. to count the connections each upstream is serving
+	OnUpstreamStart func(addr string)
+	OnUpstreamDone  func(addr string)
+	// Called with how long each successful dial to an upstream returned by
+	// Resolver took (optional)
+	OnDialLatency func(addr string, latency time.Duration)
+	// Upstreams tried per connection before the client is dropped (default 3)
+	DialAttempts int
+	// Close both sides after this long without data in either direction (0 = never)
+	IdleTimeout time.Duration
+	// Close both sides once a connection has been open this long (0 = unlimited)
+	MaxConnectionDuration time.Duration
+	// Read a PROXY protocol header from accepted connections (nil = disabled)
+	ProxyProtocol *proxyproto.Options
+	// Connections handled at once; further ones are closed right after accept (0 = unlimited)
+	MaxConnections int
+
+	active atomic.Int64
+	limit  atomic.Pointer[int] // set by SetMaxConnections
 }
 
+var (
+	tcpActiveConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "charon_tcp_active_connections",
+		Help: "TCP proxy connections currently being handled",
+	})
+	tcpConnectionsRejectedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "charon_tcp_connections_rejected_total",
+		Help: "TCP proxy connections closed because max_connections was reached",
+	})
+)
+
 // NewTCPProxy membuat instance baru TCPProxy
 func NewTCPProxy(listenAddr, targetAddr string) *TCPProxy {
 	return &TCPProxy{
@@ -28,8 +81,15 @@ func (p *TCPProxy) Start() error {
 		return err
 	}
 	defer listener.Close()
+	if p.ProxyProtocol != nil {
+		listener = proxyproto.NewListener(listener, *p.ProxyProtocol)
+	}
 
-	log.Printf("TCP Proxy listening on %s, forwarding to %s", p.ListenAddr, p.TargetAddr)
+	if p.Resolver != nil {
+		log.Printf("TCP Proxy listening on %s, balancing across resolved upstreams", p.ListenAddr)
+	} else {
+		log.Printf("TCP Proxy listening on %s, forwarding to %s", p.ListenAddr, p.TargetAddr)
+	}
 
 	for {
 		clientConn, err := listener.Accept()
@@ -38,23 +98,194 @@ func (p *TCPProxy) Start() error {
 			continue
 		}
 
-		go p.handleConnection(clientConn)
+		// Beyond the limit connections are shed instead of queueing goroutines
+		n := p.active.Add(1)
+		if limit := p.maxConnections(); limit > 0 && n > int64(limit) {
+			p.active.Add(-1)
+			tcpConnectionsRejectedTotal.Inc()
+			metrics.Count("tcp.connections_rejected", 1, nil)
+			log.Printf("Warning: rejecting connection from %s, %d connections active (max_connections)", acceptedAddr(clientConn), limit)
+			clientConn.Close()
+			continue
+		}
+		tcpActiveConnections.Inc()
+		go func() {
+			defer func() {
+				p.active.Add(-1)
+				tcpActiveConnections.Dec()
+			}()
+			p.handleConnection(clientConn)
+		}()
+	}
+}
+
+// acceptedAddr returns the address conn was accepted from. Unlike RemoteAddr on a
+// PROXY protocol connection, it never waits for the header.
+func acceptedAddr(conn net.Conn) net.Addr {
+	if pc, ok := conn.(*proxyproto.Conn); ok {
+		return pc.Conn.RemoteAddr()
+	}
+	return conn.RemoteAddr()
+}
+
+// SetMaxConnections changes the connection limit of a running proxy, e.g. after
+// a config reload. Connections already handled are kept.
+func (p *TCPProxy) SetMaxConnections(n int) {
+	p.limit.Store(&n)
+}
+
+// maxConnections returns the limit set by SetMaxConnections, or MaxConnections
+func (p *TCPProxy) maxConnections() int {
+	if n := p.limit.Load(); n != nil {
+		return *n
+	}
+	return p.MaxConnections
+}
+
+// ActiveConnections returns the number of connections currently being handled
+func (p *TCPProxy) ActiveConnections() int {
+	return int(p.active.Load())
+}
+
+// tcpDialTimeout bounds each upstream connection attempt
+const tcpDialTimeout = 5 * time.Second
+
+// dialResolved connects to an upstream picked by Resolver for client and returns
+// the connection and the upstream's address. When the dial fails the upstream is
+// reported through OnDialError and the next one is tried, up to DialAttempts
+// upstreams.
+func (p *TCPProxy) dialResolved(client net.Addr) (net.Conn, string, error) {
+	attempts := p.DialAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	tried := map[string]bool{}
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		addr, err := p.Resolver(client)
+		if err != nil {
+			if lastErr != nil {
+				return nil, "", lastErr
+			}
+			return nil, "", err
+		}
+		if tried[addr] {
+			// The balancer has nothing else to offer
+			break
+		}
+		tried[addr] = true
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", addr, tcpDialTimeout)
+		if err == nil {
+			if p.OnDialLatency != nil {
+				p.OnDialLatency(addr, time.Since(start))
+			}
+			if p.OnDialSuccess != nil {
+				p.OnDialSuccess(addr)
+			}
+			return conn, addr, nil
+		}
+		log.Printf("Error connecting to upstream %s: %v", addr, err)
+		if p.OnDialError != nil {
+			p.OnDialError(addr)
+		}
+		lastErr = err
 	}
+	return nil, "", fmt.Errorf("all %d upstream(s) tried failed: %w", len(tried), lastErr)
+}
+
+// closeWriter is implemented by connections that support half-close
+type closeWriter interface {
+	CloseWrite() error
 }
 
 // handleConnection menangani koneksi masuk
 func (p *TCPProxy) handleConnection(clientConn net.Conn) {
 	defer clientConn.Close()
 
+	// Recover the client address before anything is logged or sniffed
+	if pc, ok := clientConn.(*proxyproto.Conn); ok {
+		if err := pc.Handshake(); err != nil {
+			log.Printf("Rejecting connection from %s: %v", pc.Conn.RemoteAddr(), err)
+			return
+		}
+	}
+
 	log.Printf("New connection from %s", clientConn.RemoteAddr())
 
-	targetConn, err := net.Dial("tcp", p.TargetAddr)
+	target := ""
+	if p.Resolver == nil {
+		target = p.TargetAddr
+	}
+	if len(p.ProtocolTargets) > 0 {
+		timeout := p.SniffTimeout
+		if timeout <= 0 {
+			timeout = 2 * time.Second
+		}
+		pc := newPeekConn(clientConn)
+		proto := pc.sniff(timeout)
+		if t, ok := p.ProtocolTargets[proto]; ok && t != "" {
+			target = t
+		}
+		clientConn = pc
+		log.Printf("Detected %s from %s, forwarding to %s", proto, clientConn.RemoteAddr(), target)
+	}
+
+	var targetConn net.Conn
+	var err error
+	switch {
+	case target != "":
+		targetConn, err = net.DialTimeout("tcp", target, tcpDialTimeout)
+	case p.Resolver != nil:
+		var upstream string
+		targetConn, upstream, err = p.dialResolved(clientConn.RemoteAddr())
+		if err == nil && p.OnUpstreamStart != nil && p.OnUpstreamDone != nil {
+			p.OnUpstreamStart(upstream)
+			defer p.OnUpstreamDone(upstream)
+		}
+	default:
+		log.Printf("No target for connection from %s", clientConn.RemoteAddr())
+		return
+	}
 	if err != nil {
 		log.Printf("Error connecting to target: %v", err)
 		return
 	}
 	defer targetConn.Close()
 
+	// Without timeouts the copies run until either side closes
+	var deadline *connDeadline
+	if p.IdleTimeout > 0 || p.MaxConnectionDuration > 0 {
+		deadline = newConnDeadline(p.IdleTimeout, p.MaxConnectionDuration)
+	}
+	copyConn := func(dst, src net.Conn) error {
+		if deadline == nil {
+			_, err := io.Copy(dst, src)
+			return err
+		}
+		return deadline.pipe(dst, src)
+	}
+
+	// A timeout closes both connections so the other copy unblocks as well
+	var reaped atomic.Bool
+	reap := func(reason error) {
+		if reaped.CompareAndSwap(false, true) {
+			log.Printf("Closing connection from %s: %v", clientConn.RemoteAddr(), reason)
+			clientConn.Close()
+			targetConn.Close()
+		}
+	}
+	copyFailed := func(dir string, err error) {
+		switch {
+		case errors.Is(err, errIdleTimeout), errors.Is(err, errMaxDuration):
+			reap(err)
+		case reaped.Load() && errors.Is(err, net.ErrClosed):
+			// closed by reap
+		default:
+			log.Printf("Error copying %s: %v", dir, err)
+		}
+	}
+
 	// Gunakan WaitGroup untuk menunggu kedua goroutine selesai
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -62,11 +293,14 @@ func (p *TCPProxy) handleConnection(clientConn net.Conn) {
 	// Goroutine untuk menyalin data dari client ke target
 	go func() {
 		defer wg.Done()
-		if _, err := io.Copy(targetConn, clientConn); err != nil {
-			log.Printf("Error copying client -> target: %v", err)
+		if err := copyConn(targetConn, clientConn); err != nil {
+			copyFailed("client -> target", err)
+		}
+		if reaped.Load() {
+			return
 		}
 		// Tutup koneksi write ke target untuk memberi sinyal EOF
-		if conn, ok := targetConn.(*net.TCPConn); ok {
+		if conn, ok := targetConn.(closeWriter); ok {
 			if err := conn.CloseWrite(); err != nil {
 				log.Printf("Error CloseWrite target: %v", err)
 			}
@@ -76,11 +310,14 @@ func (p *TCPProxy) handleConnection(clientConn net.Conn) {
 	// Goroutine untuk menyalin data dari target ke client
 	go func() {
 		defer wg.Done()
-		if _, err := io.Copy(clientConn, targetConn); err != nil {
-			log.Printf("Error copying target -> client: %v", err)
+		if err := copyConn(clientConn, targetConn); err != nil {
+			copyFailed("target -> client", err)
+		}
+		if reaped.Load() {
+			return
 		}
 		// Tutup koneksi write ke client untuk memberi sinyal EOF
-		if conn, ok := clientConn.(*net.TCPConn); ok {
+		if conn, ok := clientConn.(closeWriter); ok {
 			if err := conn.CloseWrite(); err != nil {
 				log.Printf("Error CloseWrite client: %v", err)
 			}
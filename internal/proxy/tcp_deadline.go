@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// errIdleTimeout and errMaxDuration report why a TCP connection was torn down
+var (
+	errIdleTimeout = errors.New("idle timeout")
+	errMaxDuration = errors.New("max connection duration exceeded")
+)
+
+// connDeadline tracks the timeouts of one proxied TCP connection. Activity in
+// either direction extends the idle timeout; neither direction may run past end.
+type connDeadline struct {
+	idle time.Duration // 0 = no idle timeout
+	end  time.Time     // zero = no total limit
+	last atomic.Int64  // unix nanos of the last transferred bytes
+}
+
+func newConnDeadline(idle, total time.Duration) *connDeadline {
+	d := &connDeadline{idle: idle}
+	now := time.Now()
+	if total > 0 {
+		d.end = now.Add(total)
+	}
+	d.last.Store(now.UnixNano())
+	return d
+}
+
+func (d *connDeadline) touch() {
+	d.last.Store(time.Now().UnixNano())
+}
+
+// next returns the deadline for the next read or write
+func (d *connDeadline) next() time.Time {
+	if d.idle <= 0 {
+		return d.end
+	}
+	t := time.Unix(0, d.last.Load()).Add(d.idle)
+	if !d.end.IsZero() && d.end.Before(t) {
+		return d.end
+	}
+	return t
+}
+
+// expired returns why the connection must be closed, or nil if a deadline
+// elapsed only because the peer was quiet while the other direction was busy.
+func (d *connDeadline) expired() error {
+	now := time.Now()
+	if !d.end.IsZero() && !now.Before(d.end) {
+		return errMaxDuration
+	}
+	if d.idle > 0 && now.Sub(time.Unix(0, d.last.Load())) >= d.idle {
+		return errIdleTimeout
+	}
+	return nil
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// pipe copies src to dst like io.Copy while keeping the deadlines of both
+// sides current. It returns errIdleTimeout or errMaxDuration once the
+// connection has to be torn down.
+func (d *connDeadline) pipe(dst, src net.Conn) error {
+	buf := make([]byte, 32*1024)
+	for {
+		_ = src.SetReadDeadline(d.next())
+		n, err := src.Read(buf)
+		if n > 0 {
+			d.touch()
+			if werr := d.write(dst, buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if !isTimeout(err) {
+				return err
+			}
+			if reason := d.expired(); reason != nil {
+				return reason
+			}
+		}
+	}
+}
+
+// write sends b to dst, waiting on a slow reader only as long as the deadlines allow
+func (d *connDeadline) write(dst net.Conn, b []byte) error {
+	for len(b) > 0 {
+		_ = dst.SetWriteDeadline(d.next())
+		n, err := dst.Write(b)
+		b = b[n:]
+		if n > 0 {
+			d.touch()
+		}
+		if err != nil {
+			if !isTimeout(err) {
+				return err
+			}
+			if reason := d.expired(); reason != nil {
+				return reason
+			}
+		}
+	}
+	return nil
+}
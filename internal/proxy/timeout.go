@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// timeoutKey marks requests bounded by a route or default timeout
+type timeoutKey struct{}
+
+// upstreamTimeout returns the route's timeout, falling back to the default (0 = none)
+func (p *HTTPProxy) upstreamTimeout(rule *config.RouteRule) time.Duration {
+	if rule != nil && rule.Timeout != "" {
+		if d, err := time.ParseDuration(rule.Timeout); err == nil && d > 0 {
+			return d
+		}
+	}
+	return p.DefaultTimeout
+}
+
+// withTimeout bounds r by the upstream timeout for its route. The returned cancel
+// must be called once the response has been written.
+func (p *HTTPProxy) withTimeout(r *http.Request, rule *config.RouteRule) (*http.Request, context.CancelFunc) {
+	d := p.upstreamTimeout(rule)
+	if d <= 0 {
+		return r, func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(r.Context(), timeoutKey{}, d), d)
+	return r.WithContext(ctx), cancel
+}
+
+// timedOut reports whether r's upstream timeout has expired
+func timedOut(r *http.Request) bool {
+	_, bounded := r.Context().Value(timeoutKey{}).(time.Duration)
+	return bounded && r.Context().Err() == context.DeadlineExceeded
+}
+
+// deadlineTransport sends requests bounded by a timeout through a transport
+// without the fixed response header timeout, so the route's deadline alone
+// decides how long a slow endpoint may take.
+type deadlineTransport struct {
+	fixed    http.RoundTripper
+	deadline http.RoundTripper
+}
+
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := req.Context().Value(timeoutKey{}).(time.Duration); ok {
+		return t.deadline.RoundTrip(req)
+	}
+	return t.fixed.RoundTrip(req)
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+)
+
+// TransportSettings tunes the upstream connection pool and timeouts. Zero
+// fields keep the defaults.
+type TransportSettings struct {
+	MaxIdleConns          int           // idle connections kept per upstream pool (default 100)
+	MaxIdleConnsPerHost   int           // idle connections kept per upstream (default 10)
+	MaxConnsPerHost       int           // connections per upstream, dialing included (default 0, unlimited)
+	DialTimeout           time.Duration // default 5s
+	TLSHandshakeTimeout   time.Duration // default 5s
+	ResponseHeaderTimeout time.Duration // for requests without a route or default timeout (default 10s)
+	IdleConnTimeout       time.Duration // close idle connections after this long (default 90s)
+	BufferSize            int           // bytes per pooled body copy buffer (default 32 KiB)
+}
+
+// withDefaults fills the unset fields with the defaults
+func (s TransportSettings) withDefaults() TransportSettings {
+	if s.MaxIdleConns == 0 {
+		s.MaxIdleConns = 100
+	}
+	if s.MaxIdleConnsPerHost == 0 {
+		s.MaxIdleConnsPerHost = 10
+	}
+	if s.DialTimeout == 0 {
+		s.DialTimeout = 5 * time.Second
+	}
+	if s.TLSHandshakeTimeout == 0 {
+		s.TLSHandshakeTimeout = 5 * time.Second
+	}
+	if s.ResponseHeaderTimeout == 0 {
+		s.ResponseHeaderTimeout = 10 * time.Second
+	}
+	if s.IdleConnTimeout == 0 {
+		s.IdleConnTimeout = 90 * time.Second
+	}
+	if s.BufferSize == 0 {
+		s.BufferSize = 32 * 1024
+	}
+	return s
+}
+
+// bufferPool reuses the buffers the reverse proxy copies bodies through,
+// instead of allocating one per request
+type bufferPool struct {
+	size int
+	pool sync.Pool // *[]byte
+}
+
+// NewBufferPool returns a pool of size-byte buffers for httputil.ReverseProxy
+func NewBufferPool(size int) httputil.BufferPool {
+	return &bufferPool{size: size}
+}
+
+func (p *bufferPool) Get() []byte {
+	if b, ok := p.pool.Get().(*[]byte); ok {
+		return *b
+	}
+	return make([]byte, p.size)
+}
+
+func (p *bufferPool) Put(b []byte) {
+	if len(b) != p.size {
+		return
+	}
+	p.pool.Put(&b)
+}
+
+// hostTransports keeps a transport per upstream host, cloned from base when the
+// host is first seen. Idle connections and connection limits are accounted per
+// upstream, so a busy upstream cannot evict another one's idle connections.
+// HTTPProxy.ForgetUpstream drops the pool of an upstream that leaves the registry.
+type hostTransports struct {
+	base  *http.Transport
+	mu    sync.Mutex
+	hosts map[string]*http.Transport
+}
+
+func newHostTransports(base *http.Transport) *hostTransports {
+	return &hostTransports{base: base, hosts: make(map[string]*http.Transport)}
+}
+
+func (t *hostTransports) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.get(req.URL.Host).RoundTrip(req)
+}
+
+// get returns the transport for host, creating it on first use
+func (t *hostTransports) get(host string) *http.Transport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tr, ok := t.hosts[host]
+	if !ok {
+		tr = t.base.Clone()
+		t.hosts[host] = tr
+	}
+	return tr
+}
+
+// forget closes the idle connections to host and drops its transport. Requests
+// in flight finish on it; a later request to host starts a new pool.
+func (t *hostTransports) forget(host string) {
+	t.mu.Lock()
+	tr, ok := t.hosts[host]
+	delete(t.hosts, host)
+	t.mu.Unlock()
+	if ok {
+		tr.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections closes the idle connections to every upstream
+func (t *hostTransports) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tr := range t.hosts {
+		tr.CloseIdleConnections()
+	}
+}
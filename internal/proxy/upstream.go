@@ -0,0 +1,27 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// UpstreamURL builds the upstream URL for a registry address. addr may be a
+// host:port pair (IPv6 hosts must be bracketed, e.g. "[::1]:8080") or a full
+// http(s) URL. useTLS selects https when addr carries no scheme.
+func UpstreamURL(addr string, useTLS bool) (*url.URL, error) {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return url.Parse(addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream address %q: %w", addr, err)
+	}
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	// JoinHostPort re-adds brackets for IPv6; url.URL escapes zone identifiers
+	return &url.URL{Scheme: scheme, Host: net.JoinHostPort(host, port)}, nil
+}
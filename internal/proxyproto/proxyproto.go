@@ -0,0 +1,212 @@
+// Package proxyproto reads PROXY protocol v1 and v2 headers sent by an L4 load
+// balancer in front of Charon, so the original client address is not lost.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHeaderTimeout bounds how long a connection may take to send its header
+const DefaultHeaderTimeout = 5 * time.Second
+
+// ErrNoHeader is returned for connections without a header when one is required
+var ErrNoHeader = errors.New("proxy protocol header missing")
+
+// v2Signature starts every PROXY protocol v2 header
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1MaxLength is the longest valid v1 header, including the trailing CRLF
+const v1MaxLength = 107
+
+// Options configures how accepted connections are handled
+type Options struct {
+	// Reject connections that don't start with a header (default: pass them through)
+	Require bool
+	// How long to wait for the header (default 5s)
+	HeaderTimeout time.Duration
+}
+
+// Listener wraps accepted connections so their RemoteAddr reports the client
+// address from the PROXY protocol header.
+type Listener struct {
+	net.Listener
+	opts Options
+}
+
+// NewListener wraps ln
+func NewListener(ln net.Listener, opts Options) *Listener {
+	if opts.HeaderTimeout <= 0 {
+		opts.HeaderTimeout = DefaultHeaderTimeout
+	}
+	return &Listener{Listener: ln, opts: opts}
+}
+
+// Accept returns the next connection. The header is read lazily on the first
+// Read, RemoteAddr or Handshake call, so a slow client never blocks Accept.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c, r: bufio.NewReader(c), opts: l.opts}, nil
+}
+
+// Conn is a connection that may start with a PROXY protocol header
+type Conn struct {
+	net.Conn
+	r    *bufio.Reader
+	opts Options
+
+	once   sync.Once
+	err    error
+	remote net.Addr // from the header, nil if absent or LOCAL
+}
+
+// Handshake reads the header if that hasn't happened yet. It fails for
+// malformed headers, and for missing ones when the listener requires them;
+// the connection is then closed so nothing is ever answered on it.
+// Any read deadline set before the header was read is cleared.
+func (c *Conn) Handshake() error {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.opts.HeaderTimeout))
+		c.remote, c.err = readHeader(c.r, c.opts.Require)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			_ = c.Conn.Close()
+		}
+	})
+	return c.err
+}
+
+// Read reads the payload after the header
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the peer address
+// of the connection when there is none.
+func (c *Conn) RemoteAddr() net.Addr {
+	_ = c.Handshake()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// CloseWrite half-closes the underlying TCP connection when supported
+func (c *Conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// readHeader consumes a v1 or v2 header from r and returns the source address
+// it carries (nil for UNKNOWN/LOCAL headers, or when there is no header).
+func readHeader(r *bufio.Reader, require bool) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		if require {
+			return nil, ErrNoHeader
+		}
+		// Let the caller's own read report EOF or the error
+		return nil, nil
+	}
+	switch first[0] {
+	case 'P':
+		if b, err := r.Peek(6); err == nil && string(b) == "PROXY " {
+			return readV1(r)
+		}
+	case '\r':
+		if b, err := r.Peek(len(v2Signature)); err == nil && bytes.Equal(b, v2Signature) {
+			return readV2(r)
+		}
+	}
+	if require {
+		return nil, ErrNoHeader
+	}
+	return nil, nil
+}
+
+// readV1 parses "PROXY TCP4|TCP6|UNKNOWN src dst sport dport\r\n"
+func readV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("proxy protocol v1: %w", err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, errors.New("proxy protocol v1: header too long or not CRLF terminated")
+	}
+	fields := strings.Split(s, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("proxy protocol v1: malformed header %q", s)
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("proxy protocol v1: invalid source address in %q", s)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readV2 parses the binary header: signature, version/command, family,
+// length and the address block, skipping any TLVs.
+func readV2(r *bufio.Reader) (net.Addr, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("proxy protocol v2: %w", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, fmt.Errorf("proxy protocol v2: unsupported version %d", hdr[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("proxy protocol v2: %w", err)
+	}
+	switch hdr[12] & 0x0f {
+	case 0x0: // LOCAL: health checks of the load balancer itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("proxy protocol v2: unsupported command %d", hdr[12]&0x0f)
+	}
+	var ipLen int
+	switch hdr[13] >> 4 {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default: // AF_UNSPEC or AF_UNIX: no usable client address
+		return nil, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, errors.New("proxy protocol v2: address block too short")
+	}
+	ip := net.IP(append([]byte(nil), body[:ipLen]...))
+	port := binary.BigEndian.Uint16(body[2*ipLen : 2*ipLen+2])
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// Dimensions builds the limits of the rate_limit section: the legacy per-route
+// limit plus any extra rules, with idle bucket eviction started
+func Dimensions(cfg config.RateLimitConfig) ([]*Dimension, error) {
+	var dimensions []*Dimension
+	if cfg.RequestsPerSecond > 0 || len(cfg.Routes) > 0 {
+		// Plain prefixes gate the global limit to those paths; prefixes with their
+		// own limits are enforced on top of it, one bucket for the whole prefix
+		var listed []string
+		gated := false
+		var limits []RouteLimit
+		for _, r := range cfg.Routes {
+			listed = append(listed, r.Path)
+			if r.RequestsPerSecond == 0 {
+				gated = true
+				limits = append(limits, RouteLimit{Prefix: r.Path, RPS: cfg.RequestsPerSecond, Burst: cfg.BurstSize, PerPath: true})
+				continue
+			}
+			burst := r.BurstSize
+			if burst <= 0 {
+				burst = r.RequestsPerSecond
+			}
+			limits = append(limits, RouteLimit{Prefix: r.Path, RPS: r.RequestsPerSecond, Burst: burst})
+		}
+		var routes []string
+		if gated {
+			routes = listed
+		}
+		key, _ := ParseKey("route")
+		dimensions = append(dimensions, &Dimension{
+			Name:    "route",
+			Key:     key,
+			Routes:  routes,
+			Limiter: NewRouteRateLimiter(cfg.RequestsPerSecond, cfg.BurstSize, limits),
+		})
+	}
+	for _, rule := range cfg.Rules {
+		key, err := ParseKey(rule.Key)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit rule %q: %w", rule.Name, err)
+		}
+		if rule.RequestsPerSecond <= 0 {
+			return nil, fmt.Errorf("rate limit rule %q: requests_per_second must be positive", rule.Name)
+		}
+		name := rule.Name
+		if name == "" {
+			name = rule.Key
+		}
+		burst := rule.BurstSize
+		if burst <= 0 {
+			burst = rule.RequestsPerSecond
+		}
+		dimensions = append(dimensions, &Dimension{
+			Name:    name,
+			Key:     key,
+			Routes:  rule.Routes,
+			Tier:    rule.Tier,
+			Limiter: NewRateLimiter(rule.RequestsPerSecond, burst),
+		})
+	}
+
+	// Evict idle buckets so per-IP/per-key limiting doesn't grow without bound;
+	// an explicit 0 keeps them forever
+	idleTTL := 10 * time.Minute
+	if cfg.BucketIdleTTL != "" {
+		d, err := time.ParseDuration(cfg.BucketIdleTTL)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("rate_limit.bucket_idle_ttl must be a duration, got %q", cfg.BucketIdleTTL)
+		}
+		idleTTL = d
+	}
+	for _, d := range dimensions {
+		d.Limiter.StartEviction(idleTTL)
+	}
+	return dimensions, nil
+}
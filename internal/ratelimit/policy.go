@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/0xReLogic/Charon/internal/auth"
+)
+
+// KeyFunc derives the bucket key for a request within one rate-limit dimension
+type KeyFunc func(r *http.Request) string
+
+// ParseKey returns the KeyFunc for a key scheme: "route" (request path), "ip"
+// (client address), "global" (one shared bucket), "api_key" (name of the
+// authenticated API key) or "header:<Name>".
+func ParseKey(scheme string) (KeyFunc, error) {
+	switch {
+	case scheme == "" || scheme == "route":
+		return func(r *http.Request) string { return r.URL.Path }, nil
+	case scheme == "ip":
+		return clientIP, nil
+	case scheme == "global":
+		return func(*http.Request) string { return "global" }, nil
+	case scheme == "api_key":
+		return func(r *http.Request) string {
+			id, _ := auth.IdentityFromContext(r.Context())
+			return id.Name
+		}, nil
+	case strings.HasPrefix(scheme, "header:"):
+		name := http.CanonicalHeaderKey(strings.TrimSpace(strings.TrimPrefix(scheme, "header:")))
+		if name == "" {
+			return nil, fmt.Errorf("rate limit key %q: missing header name", scheme)
+		}
+		return func(r *http.Request) string { return r.Header.Get(name) }, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit key %q (use route, ip, global, api_key or header:<Name>)", scheme)
+	}
+}
+
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// Dimension is one independently enforced rate limit with its own key scheme
+type Dimension struct {
+	Name    string
+	Key     KeyFunc
+	Routes  []string // path prefixes the dimension applies to (empty = all)
+	Tier    string   // only requests authenticated with an API key of this tier ("" = all)
+	Limiter *RateLimiter
+}
+
+// applies reports whether the dimension covers the request
+func (d *Dimension) applies(r *http.Request) bool {
+	if d.Tier != "" {
+		if id, _ := auth.IdentityFromContext(r.Context()); id.Tier != d.Tier {
+			return false
+		}
+	}
+	path := r.URL.Path
+	if len(d.Routes) == 0 {
+		return true
+	}
+	for _, prefix := range d.Routes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy enforces several rate-limit dimensions together: a request is allowed
+// only if every applicable dimension allows it.
+type Policy struct {
+	dimensions atomic.Pointer[[]*Dimension]
+	disabled   atomic.Bool
+}
+
+// NewPolicy creates a policy from dimensions, evaluated in order
+func NewPolicy(dimensions ...*Dimension) *Policy {
+	p := &Policy{}
+	p.dimensions.Store(&dimensions)
+	return p
+}
+
+// Dimensions returns the configured dimensions
+func (p *Policy) Dimensions() []*Dimension {
+	return *p.dimensions.Load()
+}
+
+// SetDimensions atomically replaces the dimensions, e.g. on a config reload, and
+// returns the previous ones so the caller can close their limiters. The enabled
+// switch is kept.
+func (p *Policy) SetDimensions(dimensions ...*Dimension) []*Dimension {
+	return *p.dimensions.Swap(&dimensions)
+}
+
+// SetEnabled turns enforcement of every dimension on or off at runtime
+func (p *Policy) SetEnabled(enabled bool) {
+	p.disabled.Store(!enabled)
+}
+
+// Enabled reports whether the policy is currently enforced
+func (p *Policy) Enabled() bool {
+	return !p.disabled.Load()
+}
+
+// Decision is the outcome of checking a request against a policy
+type Decision struct {
+	Allowed bool
+	// Dimension is the exceeded dimension when rejected, otherwise the most
+	// constrained applicable one ("" when no dimension applied)
+	Dimension string
+	State     State // bucket state of Dimension after the decision
+}
+
+// Allow checks r against every applicable dimension. When rejected it returns the
+// name of the first dimension that was exceeded.
+func (p *Policy) Allow(r *http.Request) (string, bool) {
+	d := p.Check(r)
+	if !d.Allowed {
+		return d.Dimension, false
+	}
+	return "", true
+}
+
+// Check evaluates r against every applicable dimension, stopping at the first
+// one that is exceeded, and reports the state used for rate-limit headers. A
+// rejected request gives back the tokens the dimensions before it took, so it
+// only counts against the limit that turned it away.
+func (p *Policy) Check(r *http.Request) Decision {
+	if p.disabled.Load() {
+		return Decision{Allowed: true}
+	}
+	decision := Decision{Allowed: true}
+	type taken struct {
+		limiter *RateLimiter
+		key     string
+	}
+	var charged []taken
+	for _, d := range p.Dimensions() {
+		if !d.applies(r) {
+			continue
+		}
+		// Requests without a key (e.g. missing header) are not limited by this dimension
+		key := d.Key(r)
+		if key == "" {
+			continue
+		}
+		ok, st := d.Limiter.AllowState(key)
+		if !ok {
+			for _, t := range charged {
+				t.limiter.Refund(t.key)
+			}
+			return Decision{Dimension: d.Name, State: st}
+		}
+		if st.Limit > 0 { // a token was taken, not bypassed
+			charged = append(charged, taken{d.Limiter, key})
+		}
+		if decision.Dimension == "" || st.Remaining < decision.State.Remaining {
+			decision.Dimension, decision.State = d.Name, st
+		}
+	}
+	return decision
+}
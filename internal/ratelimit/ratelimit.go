@@ -1,10 +1,20 @@
 package ratelimit
 
 import (
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+var liveBuckets = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "charon_ratelimit_buckets",
+	Help: "Number of live rate-limit token buckets across all limiters",
+})
+
 // TokenBucket implements token bucket rate limiting
 type TokenBucket struct {
 	capacity   int // maximum tokens
@@ -24,30 +34,94 @@ func NewTokenBucket(capacity, refillRate int) *TokenBucket {
 	}
 }
 
+// State is a snapshot of a token bucket, as reported in X-RateLimit headers
+type State struct {
+	Limit     int           // bucket capacity
+	Remaining int           // tokens currently available
+	Reset     time.Duration // time until the next token is added (0 when full)
+}
+
 // Allow checks if a request is allowed (consumes 1 token if available)
 func (tb *TokenBucket) Allow() bool {
+	ok, _ := tb.AllowState()
+	return ok
+}
+
+// AllowState is Allow that also returns the bucket state right after the decision
+func (tb *TokenBucket) AllowState() (bool, State) {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
 	now := time.Now()
 	elapsed := now.Sub(tb.lastRefill)
 
-	// Refill tokens based on elapsed time
+	// Refill whole tokens based on elapsed time. lastRefill only advances by the
+	// time those tokens took, so the fraction of the next one carries over
+	// instead of being lost when requests arrive faster than one token per call.
 	if elapsed > 0 {
 		tokensToAdd := int(elapsed.Seconds() * float64(tb.refillRate))
 		tb.tokens += tokensToAdd
-		if tb.tokens > tb.capacity {
+		if tb.tokens >= tb.capacity {
 			tb.tokens = tb.capacity
+			tb.lastRefill = now // a full bucket accrues nothing
+		} else if tokensToAdd > 0 {
+			tb.lastRefill = tb.lastRefill.Add(time.Duration(tokensToAdd) * time.Second / time.Duration(tb.refillRate))
 		}
-		tb.lastRefill = now
 	}
 
 	// Try to consume 1 token
+	ok := false
 	if tb.tokens > 0 {
 		tb.tokens--
-		return true
+		ok = true
+	}
+	return ok, tb.state(now)
+}
+
+// Refund returns a token taken by a request that was rejected elsewhere, up to
+// the capacity
+func (tb *TokenBucket) Refund() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.tokens < tb.capacity {
+		tb.tokens++
+	}
+}
+
+// State returns the current bucket state without consuming a token
+func (tb *TokenBucket) State() State {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.state(time.Now())
+}
+
+// state computes the state at now without refilling. Caller holds tb.mu.
+func (tb *TokenBucket) state(now time.Time) State {
+	st := State{Limit: tb.capacity}
+	accrued := now.Sub(tb.lastRefill).Seconds() * float64(tb.refillRate)
+	st.Remaining = tb.tokens + int(accrued)
+	if st.Remaining >= tb.capacity {
+		st.Remaining = tb.capacity
+		return st
+	}
+	if tb.refillRate > 0 {
+		// the fractional token accrued so far counts toward the next one
+		frac := accrued - float64(int(accrued))
+		st.Reset = time.Duration((1 - frac) / float64(tb.refillRate) * float64(time.Second))
+	}
+	return st
+}
+
+// idleSince reports whether the bucket has been unused for at least ttl and
+// would be full again, so dropping it cannot loosen an in-progress limit.
+func (tb *TokenBucket) idleSince(now time.Time, ttl time.Duration) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	elapsed := now.Sub(tb.lastRefill)
+	if elapsed < ttl {
+		return false
 	}
-	return false
+	return tb.tokens+int(elapsed.Seconds()*float64(tb.refillRate)) >= tb.capacity
 }
 
 // RateLimiter manages multiple token buckets for different routes
@@ -58,32 +132,169 @@ type RateLimiter struct {
 	// Default settings
 	defaultRPS   int
 	defaultBurst int
+	// routes override the defaults for keys (request paths) under a prefix
+	routes []RouteLimit
+
+	// disabled bypasses limiting at runtime (operational escape hatch)
+	disabled atomic.Bool
+
+	// stop ends the idle-bucket sweeper started by StartEviction
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(defaultRPS, defaultBurst int) *RateLimiter {
 	return &RateLimiter{
 		buckets:      make(map[string]*TokenBucket),
+		stop:         make(chan struct{}),
 		defaultRPS:   defaultRPS,
 		defaultBurst: defaultBurst,
 	}
 }
 
+// RouteLimit gives the request paths under Prefix their own limits, shared by
+// the whole prefix
+type RouteLimit struct {
+	Prefix string
+	RPS    int
+	Burst  int
+	// PerPath keeps one bucket per request path instead, as for unlisted paths
+	PerPath bool
+}
+
+// NewRouteRateLimiter creates a rate limiter for request paths: a path takes
+// the bucket of the longest matching route prefix, or its own bucket with the
+// defaults otherwise.
+func NewRouteRateLimiter(defaultRPS, defaultBurst int, routes []RouteLimit) *RateLimiter {
+	rl := NewRateLimiter(defaultRPS, defaultBurst)
+	rl.routes = routes
+	return rl
+}
+
+// limitsFor returns the bucket key, refill rate and capacity for key
+func (rl *RateLimiter) limitsFor(key string) (bucket string, rps, burst int) {
+	bucket, rps, burst = key, rl.defaultRPS, rl.defaultBurst
+	matched := -1
+	for _, route := range rl.routes {
+		if len(route.Prefix) > matched && strings.HasPrefix(key, route.Prefix) {
+			rps, burst, matched = route.RPS, route.Burst, len(route.Prefix)
+			bucket = key
+			if !route.PerPath {
+				bucket = route.Prefix
+			}
+		}
+	}
+	return bucket, rps, burst
+}
+
+// SetEnabled turns rate limiting on or off at runtime without touching bucket state
+func (rl *RateLimiter) SetEnabled(enabled bool) {
+	rl.disabled.Store(!enabled)
+}
+
+// Enabled reports whether rate limiting is currently enforced
+func (rl *RateLimiter) Enabled() bool {
+	return !rl.disabled.Load()
+}
+
 // Allow checks if a request for the given route is allowed
 func (rl *RateLimiter) Allow(route string) bool {
+	ok, _ := rl.AllowState(route)
+	return ok
+}
+
+// AllowState is Allow that also returns the route's bucket state after the
+// decision. The state is zero when limiting is bypassed.
+func (rl *RateLimiter) AllowState(route string) (bool, State) {
+	if rl.disabled.Load() {
+		return true, State{}
+	}
+
+	key, rps, burst := rl.limitsFor(route)
 	rl.mu.RLock()
-	bucket, exists := rl.buckets[route]
+	bucket, exists := rl.buckets[key]
 	rl.mu.RUnlock()
 
 	if !exists {
+		if rps <= 0 {
+			return true, State{} // no limit for this key
+		}
 		rl.mu.Lock()
 		// Double-check after acquiring write lock
-		if bucket, exists = rl.buckets[route]; !exists {
-			bucket = NewTokenBucket(rl.defaultBurst, rl.defaultRPS)
-			rl.buckets[route] = bucket
+		if bucket, exists = rl.buckets[key]; !exists {
+			bucket = NewTokenBucket(burst, rps)
+			rl.buckets[key] = bucket
+			liveBuckets.Inc()
 		}
 		rl.mu.Unlock()
 	}
 
-	return bucket.Allow()
+	return bucket.AllowState()
+}
+
+// Refund returns the token AllowState took for route, e.g. when another limit
+// rejected the request after all
+func (rl *RateLimiter) Refund(route string) {
+	key, _, _ := rl.limitsFor(route)
+	rl.mu.RLock()
+	bucket, exists := rl.buckets[key]
+	rl.mu.RUnlock()
+	if exists {
+		bucket.Refund()
+	}
+}
+
+// EvictIdle removes buckets that have been idle for ttl and are full again.
+// It returns the number of buckets removed.
+func (rl *RateLimiter) EvictIdle(ttl time.Duration) int {
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	evicted := 0
+	for key, bucket := range rl.buckets {
+		if bucket.idleSince(now, ttl) {
+			delete(rl.buckets, key)
+			evicted++
+		}
+	}
+	liveBuckets.Sub(float64(evicted))
+	return evicted
+}
+
+// Len returns the number of live buckets
+func (rl *RateLimiter) Len() int {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return len(rl.buckets)
+}
+
+// StartEviction periodically drops buckets idle for longer than ttl, so keys such
+// as client IPs that stop sending traffic don't accumulate forever. A ttl of 0
+// or less starts nothing: buckets are kept until the limiter is dropped.
+func (rl *RateLimiter) StartEviction(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	interval := ttl / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rl.stop:
+				return
+			case <-ticker.C:
+				rl.EvictIdle(ttl)
+			}
+		}
+	}()
+}
+
+// Close stops the idle-bucket sweeper. Limiting keeps working afterwards.
+func (rl *RateLimiter) Close() {
+	rl.closeOnce.Do(func() { close(rl.stop) })
 }
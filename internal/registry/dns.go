@@ -0,0 +1,168 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// dnsIdleRefreshes is how many refresh intervals a hostname may go unrequested
+// before it is no longer re-resolved
+const dnsIdleRefreshes = 10
+
+// DNSExpander expands hostname registry entries into one entry per resolved
+// A/AAAA record, so each IP becomes its own balancer target. A hostname is
+// resolved when first seen; after that requests are served from the cache and
+// Start re-resolves the known hostnames in the background. On lookup failure
+// the last good answer is kept.
+type DNSExpander struct {
+	interval time.Duration
+	// Lookup resolves a hostname (net.DefaultResolver when nil). Set it before use.
+	Lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry // hostname -> resolved IPs
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type dnsEntry struct {
+	ips      []string
+	ready    chan struct{} // closed once the first lookup finished
+	lastUsed time.Time
+}
+
+// NewDNSExpander creates an expander that re-resolves hostnames every interval (default 30s)
+func NewDNSExpander(interval time.Duration) *DNSExpander {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &DNSExpander{
+		interval: interval,
+		entries:  map[string]*dnsEntry{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// Expand replaces every hostname entry in addrs by its resolved IPs, keeping
+// the port and any URL scheme. IP entries and unresolvable hosts pass through.
+func (e *DNSExpander) Expand(addrs []string) []string {
+	out := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		out = append(out, e.expandOne(addr)...)
+	}
+	return out
+}
+
+func (e *DNSExpander) expandOne(addr string) []string {
+	scheme, hostport := "", addr
+	if u, err := url.Parse(addr); err == nil && u.Scheme != "" && u.Host != "" {
+		scheme, hostport = u.Scheme+"://", u.Host
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil || net.ParseIP(host) != nil {
+		return []string{addr}
+	}
+	ips := e.resolve(host)
+	if len(ips) == 0 {
+		return []string{addr}
+	}
+	out := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, scheme+net.JoinHostPort(ip, port))
+	}
+	return out
+}
+
+// resolve returns the cached IPs for host. Only the first request for a host
+// waits for a lookup, and concurrent first requests share it.
+func (e *DNSExpander) resolve(host string) []string {
+	e.mu.Lock()
+	entry, known := e.entries[host]
+	if !known {
+		entry = &dnsEntry{ready: make(chan struct{})}
+		e.entries[host] = entry
+	}
+	entry.lastUsed = time.Now()
+	e.mu.Unlock()
+
+	if !known {
+		e.lookupHost(host, entry)
+		close(entry.ready)
+	}
+	<-entry.ready
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return entry.ips
+}
+
+// lookupHost resolves host into entry, keeping the last good answer on failure
+func (e *DNSExpander) lookupHost(host string, entry *dnsEntry) {
+	lookup := e.Lookup
+	if lookup == nil {
+		lookup = net.DefaultResolver.LookupIPAddr
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	records, err := lookup(ctx, host)
+	if err != nil || len(records) == 0 {
+		return
+	}
+	ips := make([]string, 0, len(records))
+	for _, r := range records {
+		ips = append(ips, r.IP.String())
+	}
+	// stable order keeps round-robin positions meaningful between refreshes
+	sort.Strings(ips)
+	e.mu.Lock()
+	entry.ips = ips
+	e.mu.Unlock()
+}
+
+// Start re-resolves the known hostnames every interval in the background.
+// Hostnames nobody requested for a while are forgotten.
+func (e *DNSExpander) Start() {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				e.refresh()
+			}
+		}
+	}()
+}
+
+// Close stops the background refresh
+func (e *DNSExpander) Close() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// refresh re-resolves every hostname requested recently
+func (e *DNSExpander) refresh() {
+	cutoff := time.Now().Add(-dnsIdleRefreshes * e.interval)
+	e.mu.Lock()
+	due := map[string]*dnsEntry{}
+	for host, entry := range e.entries {
+		if entry.lastUsed.Before(cutoff) {
+			delete(e.entries, host)
+			continue
+		}
+		due[host] = entry
+	}
+	e.mu.Unlock()
+	for host, entry := range due {
+		select {
+		case <-entry.ready:
+			e.lookupHost(host, entry)
+		default: // the first lookup is still running
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Resolver resolves a service name to its endpoints. It is implemented by the
+// file registry (FileResolver), DNS SRV lookups and the dynamic registry.
+type Resolver interface {
+	ResolveServiceEndpoints(service string) ([]Endpoint, error)
+}
+
+// FileResolver resolves services from a YAML registry file
+type FileResolver string
+
+// ResolveServiceEndpoints returns the endpoints listed for service in the file
+func (f FileResolver) ResolveServiceEndpoints(service string) ([]Endpoint, error) {
+	if f == "" {
+		return nil, fmt.Errorf("registry_file is required when service-based routing is used")
+	}
+	return ResolveServiceEndpoints(string(f), service)
+}
+
+var (
+	registrationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "charon_registry_registrations_total",
+		Help: "Instance registrations and heartbeats received by the dynamic registry",
+	}, []string{"service"})
+	expirationsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "charon_registry_expirations_total",
+		Help: "Instances removed from the dynamic registry because their TTL elapsed",
+	}, []string{"service"})
+	registeredInstances = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "charon_registry_instances",
+		Help: "Live instances in the dynamic registry",
+	}, []string{"service"})
+)
+
+// DefaultInstanceTTL applies to registrations that do not set a TTL
+const DefaultInstanceTTL = 30 * time.Second
+
+// Instance is a dynamically registered service address
+type Instance struct {
+	Addr    string    `json:"address"`
+	Weight  int       `json:"weight"`
+	Expires time.Time `json:"expires_at"`
+}
+
+// DynamicRegistry holds service instances registered at runtime, e.g. through
+// the admin API. Instances expire unless they are registered again (heartbeat)
+// within their TTL.
+type DynamicRegistry struct {
+	mu       sync.Mutex
+	services map[string]map[string]*Instance // service -> addr -> instance
+	now      func() time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewDynamicRegistry creates an empty registry
+func NewDynamicRegistry() *DynamicRegistry {
+	return &DynamicRegistry{
+		services: map[string]map[string]*Instance{},
+		now:      time.Now,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Register adds or refreshes an instance of service. A weight of 0 drains it; a
+// ttl of 0 uses DefaultInstanceTTL.
+func (d *DynamicRegistry) Register(service, addr string, weight int, ttl time.Duration) (Instance, error) {
+	if service == "" {
+		return Instance{}, fmt.Errorf("service name is required")
+	}
+	addr, err := normalizeAddr(addr)
+	if err != nil {
+		return Instance{}, err
+	}
+	if weight < 0 {
+		return Instance{}, fmt.Errorf("weight must not be negative")
+	}
+	if ttl <= 0 {
+		ttl = DefaultInstanceTTL
+	}
+	d.mu.Lock()
+	instances := d.services[service]
+	if instances == nil {
+		instances = map[string]*Instance{}
+		d.services[service] = instances
+	}
+	inst := &Instance{Addr: addr, Weight: weight, Expires: d.now().Add(ttl)}
+	instances[addr] = inst
+	count := len(instances)
+	d.mu.Unlock()
+
+	registrationsTotal.WithLabelValues(service).Inc()
+	registeredInstances.WithLabelValues(service).Set(float64(count))
+	metrics.Count("registry.registrations", 1, map[string]string{"service": service})
+	return *inst, nil
+}
+
+// Deregister removes an instance and reports whether it was registered
+func (d *DynamicRegistry) Deregister(service, addr string) bool {
+	if a, err := normalizeAddr(addr); err == nil {
+		addr = a
+	}
+	d.mu.Lock()
+	_, ok := d.services[service][addr]
+	if ok {
+		delete(d.services[service], addr)
+	}
+	count := len(d.services[service])
+	if count == 0 {
+		delete(d.services, service)
+	}
+	d.mu.Unlock()
+	if ok {
+		registeredInstances.WithLabelValues(service).Set(float64(count))
+	}
+	return ok
+}
+
+// Instances returns the live instances of service ordered by address. Expired
+// instances are skipped here and removed by the StartExpiry loop.
+func (d *DynamicRegistry) Instances(service string) []Instance {
+	now := d.now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make([]Instance, 0, len(d.services[service]))
+	for _, inst := range d.services[service] {
+		if !now.After(inst.Expires) {
+			out = append(out, *inst)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Addr < out[j].Addr })
+	return out
+}
+
+// ResolveServiceEndpoints returns the live instances of service
+func (d *DynamicRegistry) ResolveServiceEndpoints(service string) ([]Endpoint, error) {
+	instances := d.Instances(service)
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("service %q has no registered instances", service)
+	}
+	endpoints := make([]Endpoint, len(instances))
+	weighted := false
+	for i, inst := range instances {
+		endpoints[i] = Endpoint{Addr: inst.Addr, Weight: inst.Weight}
+		weighted = weighted || inst.Weight != 1
+	}
+	for i := range endpoints {
+		endpoints[i].Weighted = weighted
+	}
+	return endpoints, nil
+}
+
+// StartExpiry removes expired instances every interval in the background and
+// reports the expirations
+func (d *DynamicRegistry) StartExpiry(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.expire()
+			}
+		}
+	}()
+}
+
+// Close stops the background expiry
+func (d *DynamicRegistry) Close() {
+	d.stopOnce.Do(func() { close(d.stop) })
+}
+
+// expire removes instances whose TTL elapsed
+func (d *DynamicRegistry) expire() {
+	now := d.now()
+	type expired struct {
+		service, addr string
+		remaining     int
+	}
+	var gone []expired
+	d.mu.Lock()
+	for service, instances := range d.services {
+		for addr, inst := range instances {
+			if now.After(inst.Expires) {
+				delete(instances, addr)
+				gone = append(gone, expired{service, addr, len(instances)})
+			}
+		}
+		if len(instances) == 0 {
+			delete(d.services, service)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, e := range gone {
+		expirationsTotal.WithLabelValues(e.service).Inc()
+		metrics.Count("registry.expirations", 1, map[string]string{"service": e.service})
+		logging.LogWarn("Registered instance expired", map[string]interface{}{
+			"service": e.service,
+			"address": e.addr,
+		})
+	}
+	for _, e := range gone {
+		registeredInstances.WithLabelValues(e.service).Set(float64(e.remaining))
+	}
+}
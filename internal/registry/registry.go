@@ -2,11 +2,15 @@ package registry
 
 import (
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/0xReLogic/Charon/internal/logging"
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
@@ -20,7 +24,15 @@ var (
 
 type cachedRegistry struct {
 	modTime  time.Time
-	services map[string][]string
+	services map[string][]Endpoint
+}
+
+// Endpoint is a registry address with its load-balancing weight
+type Endpoint struct {
+	Addr   string
+	Weight int // relative share of traffic; 0 drains the instance (default 1)
+	// Weighted reports whether the registry gave an explicit weight
+	Weighted bool
 }
 
 // ensureWatcher starts a file watcher for the given registry path (idempotent).
@@ -49,13 +61,16 @@ func ensureWatcher(registryPath string) {
 	go func() {
 		for {
 			select {
-			case _, ok := <-w.Events:
+			case ev, ok := <-w.Events:
 				if !ok {
 					return
 				}
-				mu.Lock()
-				delete(cache, registryPath)
-				mu.Unlock()
+				invalidate(registryPath)
+				// Editors and deploy tools replace the file by renaming a new one
+				// over it; the watch went away with the old file, so watch the new one
+				if ev.Has(fsnotify.Rename) || ev.Has(fsnotify.Remove) {
+					rewatch(w, registryPath)
+				}
 			case _, ok := <-w.Errors:
 				if !ok {
 					return
@@ -66,7 +81,42 @@ func ensureWatcher(registryPath string) {
 	}()
 }
 
-func loadRegistry(registryPath string) (map[string][]string, error) {
+// rewatchAttempts and rewatchInterval bound how long rewatch waits for a
+// replaced registry file to reappear
+const (
+	rewatchAttempts = 20
+	rewatchInterval = 50 * time.Millisecond
+)
+
+// rewatch watches registryPath again after the watched file was renamed or
+// removed. The cache is invalidated once more since the new file may have been
+// written before the watch was in place.
+func rewatch(w *fsnotify.Watcher, registryPath string) {
+	_ = w.Remove(registryPath)
+	for i := 0; i < rewatchAttempts; i++ {
+		if err := w.Add(registryPath); err == nil {
+			invalidate(registryPath)
+			return
+		}
+		time.Sleep(rewatchInterval)
+	}
+	// Gone for good: forget the watcher so the next successful load starts a new one
+	mu.Lock()
+	if watch[registryPath] == w {
+		delete(watch, registryPath)
+	}
+	mu.Unlock()
+	_ = w.Close()
+}
+
+// invalidate drops the cached contents of registryPath
+func invalidate(registryPath string) {
+	mu.Lock()
+	delete(cache, registryPath)
+	mu.Unlock()
+}
+
+func loadRegistry(registryPath string) (map[string][]Endpoint, error) {
 	fi, err := os.Stat(registryPath)
 	if err != nil {
 		return nil, fmt.Errorf("stat registry: %w", err)
@@ -86,32 +136,42 @@ func loadRegistry(registryPath string) (map[string][]string, error) {
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("read registry: %w", err)
 	}
-	// Support both string and list of strings for each service entry
+	// Each service is a single entry or a list of entries; an entry is
+	// "host:port", "host:port|weight" or a map with addr and weight fields
 	raw := v.Get("services")
-	out := map[string][]string{}
+	out := map[string][]Endpoint{}
 	if raw != nil {
 		if mp, ok := raw.(map[string]interface{}); ok {
 			for k, val := range mp {
+				var items []interface{}
 				switch vv := val.(type) {
-				case string:
-					if s := strings.TrimSpace(vv); s != "" {
-						out[k] = []string{s}
-					}
 				case []interface{}:
-					var list []string
+					items = vv
+				case []string:
 					for _, it := range vv {
-						if s, ok := it.(string); ok && strings.TrimSpace(s) != "" {
-							list = append(list, s)
-						}
+						items = append(items, it)
 					}
-					if len(list) > 0 {
-						out[k] = list
+				default:
+					items = []interface{}{vv}
+				}
+				var list []Endpoint
+				for _, it := range items {
+					ep, ok, err := parseEndpoint(it)
+					if err != nil {
+						// One bad entry must not take the rest of the registry down
+						logging.LogWarn("Skipping invalid registry entry", map[string]interface{}{
+							"service": k,
+							"error":   err.Error(),
+						})
+						continue
 					}
-				case []string:
-					if len(vv) > 0 {
-						out[k] = vv
+					if ok {
+						list = append(list, ep)
 					}
 				}
+				if len(list) > 0 {
+					out[k] = list
+				}
 			}
 		}
 	}
@@ -126,6 +186,68 @@ func loadRegistry(registryPath string) (map[string][]string, error) {
 	return out, nil
 }
 
+// parseEndpoint parses one registry entry. It reports false for empty entries.
+func parseEndpoint(it interface{}) (Endpoint, bool, error) {
+	ep := Endpoint{Weight: 1}
+	switch vv := it.(type) {
+	case string:
+		s := strings.TrimSpace(vv)
+		if s == "" {
+			return ep, false, nil
+		}
+		ep.Addr = s
+		if i := strings.LastIndex(s, "|"); i >= 0 {
+			w, err := strconv.Atoi(strings.TrimSpace(s[i+1:]))
+			if err != nil || w < 0 {
+				return ep, false, fmt.Errorf("invalid weight in %q (use host:port|weight)", s)
+			}
+			ep.Addr, ep.Weight, ep.Weighted = strings.TrimSpace(s[:i]), w, true
+		}
+	case map[string]interface{}:
+		addr, _ := vv["addr"].(string)
+		ep.Addr = strings.TrimSpace(addr)
+		if ep.Addr == "" {
+			return ep, false, fmt.Errorf("registry entry %v has no addr", vv)
+		}
+		if raw, ok := vv["weight"]; ok {
+			w, err := strconv.Atoi(strings.TrimSpace(fmt.Sprint(raw)))
+			if err != nil || w < 0 {
+				return ep, false, fmt.Errorf("invalid weight %v for %q", raw, ep.Addr)
+			}
+			ep.Weight, ep.Weighted = w, true
+		}
+	default:
+		return ep, false, nil
+	}
+	addr, err := normalizeAddr(ep.Addr)
+	if err != nil {
+		return ep, false, err
+	}
+	ep.Addr = addr
+	return ep, true, nil
+}
+
+// normalizeAddr checks that a registry entry is a usable host:port (or URL) and
+// returns it in canonical form, so one upstream always gets the same key in the
+// balancer: IP hosts are rewritten the way net/netip prints them, e.g.
+// "[2001:DB8:0::1]:80" becomes "[2001:db8::1]:80". IPv6 hosts must be bracketed.
+func normalizeAddr(addr string) (string, error) {
+	if strings.Contains(addr, "://") {
+		return addr, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q (use host:port, IPv6 as \"[::1]:8080\"): %w", addr, err)
+	}
+	if host == "" || port == "" {
+		return "", fmt.Errorf("invalid address %q: host and port are required", addr)
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		host = ip.String()
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
 // ResolveServiceAddress reads a YAML registry file and returns the address for a given service name.
 // Expected format:
 // services:
@@ -135,15 +257,28 @@ func loadRegistry(registryPath string) (map[string][]string, error) {
 // ResolveServiceAddresses returns a list of addresses for a given service name.
 // Each address is in host:port form.
 func ResolveServiceAddresses(registryPath, serviceName string) ([]string, error) {
+	endpoints, err := ResolveServiceEndpoints(registryPath, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		addrs[i] = ep.Addr
+	}
+	return addrs, nil
+}
+
+// ResolveServiceEndpoints returns the addresses of a service with their weights
+func ResolveServiceEndpoints(registryPath, serviceName string) ([]Endpoint, error) {
 	m, err := loadRegistry(registryPath)
 	if err != nil {
 		return nil, err
 	}
-	addrs, ok := m[serviceName]
-	if !ok || len(addrs) == 0 {
+	endpoints, ok := m[serviceName]
+	if !ok || len(endpoints) == 0 {
 		return nil, fmt.Errorf("service %q not found in registry", serviceName)
 	}
-	return addrs, nil
+	return endpoints, nil
 }
 
 // ResolveServiceAddress returns the first address for backward compatibility.
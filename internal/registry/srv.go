@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// minSRVTTL keeps records with a zero or tiny TTL from being looked up per request
+	minSRVTTL = time.Second
+	// srvRetryInterval is how long a failed or empty lookup is remembered before retrying
+	srvRetryInterval = 5 * time.Second
+	srvQueryTimeout  = 2 * time.Second
+)
+
+// SRVResolver resolves service names to endpoints through DNS SRV records, as
+// published for headless Kubernetes services. Answers are cached until their
+// TTL expires. When a lookup fails or returns no records, the last good answer
+// keeps being served.
+type SRVResolver struct {
+	namespace string
+	domain    string
+	server    string // nameserver host:port
+
+	mu      sync.Mutex
+	entries map[string]*srvEntry // service -> cached answer
+}
+
+type srvEntry struct {
+	endpoints  []Endpoint
+	expires    time.Time
+	refreshing bool // a lookup is in flight; others keep using endpoints
+}
+
+// NewSRVResolver creates a resolver that looks up _<service>._tcp.<namespace>.<domain>.
+// namespace defaults to "default", domain to "svc.cluster.local" and server to the
+// first nameserver in /etc/resolv.conf.
+func NewSRVResolver(namespace, domain, server string) (*SRVResolver, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+	if domain == "" {
+		domain = "svc.cluster.local"
+	}
+	if server == "" {
+		var err error
+		if server, err = systemNameserver("/etc/resolv.conf"); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &SRVResolver{
+		namespace: namespace,
+		domain:    strings.Trim(domain, "."),
+		server:    server,
+		entries:   map[string]*srvEntry{},
+	}, nil
+}
+
+// Name returns the SRV record name queried for service
+func (r *SRVResolver) Name(service string) string {
+	return fmt.Sprintf("_%s._tcp.%s.%s.", service, r.namespace, r.domain)
+}
+
+// ResolveServiceEndpoints returns the endpoints of service. Only the records
+// with the lowest SRV priority are used; their SRV weights become balancer
+// weights (0 is treated as 1 so such targets still get traffic).
+func (r *SRVResolver) ResolveServiceEndpoints(service string) ([]Endpoint, error) {
+	now := time.Now()
+	r.mu.Lock()
+	entry := r.entries[service]
+	if entry != nil && (now.Before(entry.expires) || (entry.refreshing && len(entry.endpoints) > 0)) {
+		defer r.mu.Unlock()
+		if len(entry.endpoints) == 0 {
+			return nil, fmt.Errorf("service %s not found: no SRV records for %s", service, r.Name(service))
+		}
+		return entry.endpoints, nil
+	}
+	if entry != nil {
+		entry.refreshing = true
+	}
+	r.mu.Unlock()
+
+	name := r.Name(service)
+	ctx, cancel := context.WithTimeout(context.Background(), srvQueryTimeout)
+	defer cancel()
+	records, ttl, err := querySRV(ctx, r.server, name)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry != nil {
+		entry.refreshing = false
+	}
+	if err == nil && len(records) > 0 {
+		if ttl < minSRVTTL {
+			ttl = minSRVTTL
+		}
+		entry = &srvEntry{endpoints: srvEndpoints(records), expires: now.Add(ttl)}
+		r.entries[service] = entry
+		return entry.endpoints, nil
+	}
+
+	fields := map[string]interface{}{"service": service, "name": name}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+	if entry != nil && len(entry.endpoints) > 0 {
+		logging.LogWarn("SRV lookup returned no records, keeping previous endpoints", fields)
+		entry.expires = now.Add(srvRetryInterval)
+		return entry.endpoints, nil
+	}
+	logging.LogWarn("SRV lookup returned no records", fields)
+	r.entries[service] = &srvEntry{expires: now.Add(srvRetryInterval)}
+	if err != nil {
+		return nil, fmt.Errorf("service %s not found: SRV lookup for %s failed: %w", service, name, err)
+	}
+	return nil, fmt.Errorf("service %s not found: no SRV records for %s", service, name)
+}
+
+// srvEndpoints keeps the lowest-priority records and converts them to endpoints
+func srvEndpoints(records []dnsmessage.SRVResource) []Endpoint {
+	best := records[0].Priority
+	for _, rec := range records {
+		best = min(best, rec.Priority)
+	}
+	var endpoints []Endpoint
+	weighted := false
+	for _, rec := range records {
+		if rec.Priority != best {
+			continue
+		}
+		weight := max(int(rec.Weight), 1)
+		weighted = weighted || (len(endpoints) > 0 && weight != endpoints[0].Weight)
+		host := strings.TrimSuffix(rec.Target.String(), ".")
+		endpoints = append(endpoints, Endpoint{Addr: net.JoinHostPort(host, strconv.Itoa(int(rec.Port))), Weight: weight})
+	}
+	for i := range endpoints {
+		endpoints[i].Weighted = weighted
+	}
+	return endpoints
+}
+
+// querySRV asks server for the SRV records of name over UDP, retrying over TCP
+// when the answer is truncated. ttl is the lowest TTL among the records.
+func querySRV(ctx context.Context, server, name string) ([]dnsmessage.SRVResource, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	id := uint16(rand.Uint32())
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := exchange(ctx, "udp", server, query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return nil, 0, err
+	}
+	if msg.Truncated {
+		if resp, err = exchange(ctx, "tcp", server, query); err != nil {
+			return nil, 0, err
+		}
+		if err := msg.Unpack(resp); err != nil {
+			return nil, 0, err
+		}
+	}
+	if msg.ID != id {
+		return nil, 0, errors.New("dns response id mismatch")
+	}
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+	default:
+		return nil, 0, fmt.Errorf("dns server returned %v", msg.RCode)
+	}
+	var records []dnsmessage.SRVResource
+	var ttl uint32
+	for _, ans := range msg.Answers {
+		srv, ok := ans.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		if len(records) == 0 || ans.Header.TTL < ttl {
+			ttl = ans.Header.TTL
+		}
+		records = append(records, *srv)
+	}
+	return records, time.Duration(ttl) * time.Second, nil
+}
+
+// exchange sends one DNS message and returns the reply; TCP messages carry a length prefix
+func exchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if network == "udp" {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+	msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// systemNameserver returns the first nameserver listed in a resolv.conf file
+func systemNameserver(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("no dns server configured and %s is unreadable: %w", path, err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("no nameserver found in %s", path)
+}
@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"sort"
+	"strings"
+)
+
+// trieNode is a byte-wise prefix trie node. rules holds the indexes of rules
+// whose path prefix ends at this node, in ascending (config) order.
+type trieNode struct {
+	children map[byte]*trieNode
+	rules    []int
+}
+
+func (n *trieNode) insert(prefix string, idx int) {
+	cur := n
+	for i := 0; i < len(prefix); i++ {
+		if cur.children == nil {
+			cur.children = make(map[byte]*trieNode)
+		}
+		next, ok := cur.children[prefix[i]]
+		if !ok {
+			next = &trieNode{}
+			cur.children[prefix[i]] = next
+		}
+		cur = next
+	}
+	cur.rules = append(cur.rules, idx)
+}
+
+// collect appends the indexes of every rule whose prefix is a prefix of path
+func (n *trieNode) collect(path string, out []int) []int {
+	cur := n
+	out = append(out, cur.rules...)
+	for i := 0; i < len(path); i++ {
+		next, ok := cur.children[path[i]]
+		if !ok {
+			break
+		}
+		cur = next
+		out = append(out, cur.rules...)
+	}
+	return out
+}
+
+// routeIndex narrows the rules that can match a request by host and path
+type routeIndex struct {
+	byHost  map[string]*trieNode // lowercased host -> path trie
+	anyHost *trieNode            // rules without a host constraint
+	exact   map[string][]int     // exactKey(host, path) -> path_exact rules ("" host = any)
+	regex   []int                // path_regex rules, in config order
+}
+
+func exactKey(host, path string) string {
+	return strings.ToLower(host) + "\x00" + path
+}
+
+func buildIndex(rules []compiledRule) *routeIndex {
+	ix := &routeIndex{byHost: make(map[string]*trieNode), anyHost: &trieNode{}, exact: make(map[string][]int)}
+	for i := range rules {
+		r := rules[i].rule
+		switch {
+		case r.PathExact != "":
+			k := exactKey(r.Host, r.PathExact)
+			ix.exact[k] = append(ix.exact[k], i)
+			continue
+		case r.PathRegex != "":
+			ix.regex = append(ix.regex, i)
+			continue
+		}
+		root := ix.anyHost
+		if r.Host != "" {
+			h := strings.ToLower(r.Host)
+			if root = ix.byHost[h]; root == nil {
+				root = &trieNode{}
+				ix.byHost[h] = root
+			}
+		}
+		root.insert(r.PathPrefix, i)
+	}
+	return ix
+}
+
+// exactCandidates returns, in config order, the path_exact rules matching host and path
+func (ix *routeIndex) exactCandidates(host, path string, buf []int) []int {
+	if len(ix.exact) == 0 {
+		return buf[:0]
+	}
+	out := append(buf[:0], ix.exact[exactKey("", path)]...)
+	if host != "" {
+		out = append(out, ix.exact[exactKey(host, path)]...)
+	}
+	sort.Ints(out)
+	return out
+}
+
+// candidates returns, in config order, the indexes of rules whose host and
+// path prefix match. Remaining predicates still have to be checked.
+func (ix *routeIndex) candidates(host, path string, buf []int) []int {
+	out := ix.anyHost.collect(path, buf[:0])
+	if root, ok := ix.byHost[strings.ToLower(host)]; ok {
+		out = root.collect(path, out)
+	}
+	// the trie walk yields shorter prefixes first; restore config order
+	sort.Ints(out)
+	return out
+}
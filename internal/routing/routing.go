@@ -0,0 +1,373 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/ipfilter"
+)
+
+// Router matches incoming requests against the configured route rules.
+// Rules are evaluated in order; first match wins. Host and path prefix are
+// looked up through an index built once, so large route tables stay cheap.
+type Router struct {
+	rules          []compiledRule
+	index          *routeIndex
+	defaultService string
+
+	// host-as-service fallback (optional)
+	hostAsService bool
+	stripSuffix   string
+	serviceExists func(service string) bool
+}
+
+// compiledRule holds a route rule with its predicates prepared for matching
+type compiledRule struct {
+	rule    *config.RouteRule
+	pathRe  *regexp.Regexp // anchored path_regex, nil for exact and prefix rules
+	query   map[string]valueMatcher
+	headers map[string]valueMatcher // keyed by canonical header name
+	cookies map[string]valueMatcher // keyed by lowercased cookie name
+	methods map[string]bool         // uppercased; nil matches any method
+	access  *ipfilter.List          // allow_cidrs/deny_cidrs, nil = any client
+	split   *compiledSplit          // nil = always the rule's service
+}
+
+// valueMatcher matches a single value either exactly or against a regex
+type valueMatcher struct {
+	exact string
+	re    *regexp.Regexp
+}
+
+func newValueMatcher(pattern string) (valueMatcher, error) {
+	if strings.HasPrefix(pattern, "~") {
+		re, err := regexp.Compile(pattern[1:])
+		if err != nil {
+			return valueMatcher{}, err
+		}
+		return valueMatcher{re: re}, nil
+	}
+	return valueMatcher{exact: pattern}, nil
+}
+
+// compilePath validates the rule's path matcher and compiles path_regex, anchored
+// so it has to match the whole path
+func compilePath(rule config.RouteRule) (*regexp.Regexp, error) {
+	set := 0
+	for _, v := range []string{rule.PathPrefix, rule.PathExact, rule.PathRegex} {
+		if v != "" {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("set only one of path_prefix, path_exact and path_regex")
+	}
+	if rule.PathRegex == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + rule.PathRegex + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid path_regex %q: %w", rule.PathRegex, err)
+	}
+	return re, nil
+}
+
+// compileMatchers prepares predicates keyed by name; key normalizes names (optional)
+func compileMatchers(preds map[string]string, key func(string) string) (map[string]valueMatcher, error) {
+	if len(preds) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]valueMatcher, len(preds))
+	for k, v := range preds {
+		m, err := newValueMatcher(v)
+		if err != nil {
+			return nil, fmt.Errorf("for %q: %w", k, err)
+		}
+		if key != nil {
+			k = key(k)
+		}
+		out[k] = m
+	}
+	return out, nil
+}
+
+func (m valueMatcher) match(v string) bool {
+	if m.re != nil {
+		return m.re.MatchString(v)
+	}
+	return v == m.exact
+}
+
+// Match is the result of routing a single request.
+type Match struct {
+	// Rule is the matched route rule, nil when no rule matched
+	Rule *config.RouteRule
+	// Service is the target service name ("" means use the static target address)
+	Service string
+	// PathParams holds the capture groups of a path_regex match, by position
+	// ("1", "2", ...) and by name for named groups (nil otherwise). Rewrite,
+	// redirect and header templates expand them as {{1}} or {{name}}.
+	PathParams map[string]string
+	// Access holds the matched rule's client address lists (nil = any client)
+	Access *ipfilter.List
+}
+
+// New creates a router for the given rules. defaultService is used when no
+// rule matches (or the matched rule has no service). It returns an error if a
+// rule contains an invalid pattern.
+func New(rules []config.RouteRule, defaultService string) (*Router, error) {
+	rt := &Router{rules: make([]compiledRule, 0, len(rules)), defaultService: defaultService}
+	for i := range rules {
+		cr := compiledRule{rule: &rules[i]}
+		switch rules[i].Protocol {
+		case "", "http", "grpc":
+		default:
+			return nil, fmt.Errorf("route %d: unknown protocol %q (use http or grpc)", i, rules[i].Protocol)
+		}
+		if t := rules[i].Timeout; t != "" {
+			if d, err := time.ParseDuration(t); err != nil || d <= 0 {
+				return nil, fmt.Errorf("route %d: invalid timeout %q", i, t)
+			}
+		}
+		if fb := rules[i].Fallback; fb != nil && fb.Status != 0 && (fb.Status < 100 || fb.Status > 599) {
+			return nil, fmt.Errorf("route %d: invalid fallback status %d", i, fb.Status)
+		}
+		if rs := rules[i].Respond; rs != nil && rs.Status != 0 && (rs.Status < 100 || rs.Status > 599) {
+			return nil, fmt.Errorf("route %d: invalid respond status %d", i, rs.Status)
+		}
+		if rd := rules[i].Redirect; rd != nil {
+			if rd.To == "" {
+				return nil, fmt.Errorf("route %d: redirect needs a to", i)
+			}
+			switch rd.Status {
+			case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			default:
+				return nil, fmt.Errorf("route %d: invalid redirect status %d (use 301, 302, 307 or 308)", i, rd.Status)
+			}
+		}
+		var err error
+		if cr.pathRe, err = compilePath(rules[i]); err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+		if rw := rules[i].Rewrite; rw != "" && !strings.HasPrefix(rw, "/") {
+			return nil, fmt.Errorf("route %d: rewrite %q must start with /", i, rw)
+		}
+		for _, m := range rules[i].Methods {
+			if cr.methods == nil {
+				cr.methods = make(map[string]bool, len(rules[i].Methods))
+			}
+			cr.methods[strings.ToUpper(strings.TrimSpace(m))] = true
+		}
+		if cr.query, err = compileMatchers(rules[i].QueryMatch, strings.ToLower); err != nil {
+			return nil, fmt.Errorf("route %d: invalid query_match pattern %w", i, err)
+		}
+		if cr.headers, err = compileMatchers(rules[i].Headers, http.CanonicalHeaderKey); err != nil {
+			return nil, fmt.Errorf("route %d: invalid headers pattern %w", i, err)
+		}
+		if cr.cookies, err = compileMatchers(rules[i].Cookies, strings.ToLower); err != nil {
+			return nil, fmt.Errorf("route %d: invalid cookies pattern %w", i, err)
+		}
+		if cr.access, err = ipfilter.New(rules[i].AllowCIDRs, rules[i].DenyCIDRs); err != nil {
+			return nil, fmt.Errorf("route %d: invalid client address list %w", i, err)
+		}
+		if rules[i].Split != nil {
+			if cr.split, err = compileSplit(rules[i].Split); err != nil {
+				return nil, fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+		rt.rules = append(rt.rules, cr)
+	}
+	rt.index = buildIndex(rt.rules)
+	return rt, nil
+}
+
+// EnableHostAsService makes requests that match no rule route to the service
+// named by their Host header, after removing stripSuffix (e.g. ".internal").
+// exists reports whether a derived service is known; unknown services fall
+// back to the default service.
+func (rt *Router) EnableHostAsService(stripSuffix string, exists func(service string) bool) {
+	rt.hostAsService = true
+	rt.stripSuffix = strings.ToLower(stripSuffix)
+	rt.serviceExists = exists
+}
+
+// Match returns the routing decision for r. It never returns nil.
+// Exact paths take precedence over path regexes, which take precedence over
+// path prefixes; within each kind the first matching rule wins.
+func (rt *Router) Match(r *http.Request) *Match {
+	host := stripPort(r.Host)
+	path := r.URL.Path
+	var buf [16]int
+	var query map[string][]string
+	for _, i := range rt.index.exactCandidates(host, path, buf[:]) {
+		if rt.predicatesMatch(&rt.rules[i], r, &query) {
+			return rt.matched(&rt.rules[i], r)
+		}
+	}
+	for _, i := range rt.index.regex {
+		cr := &rt.rules[i]
+		if cr.rule.Host != "" && !strings.EqualFold(cr.rule.Host, host) {
+			continue
+		}
+		sub := cr.pathRe.FindStringSubmatch(path)
+		if sub == nil || !rt.predicatesMatch(cr, r, &query) {
+			continue
+		}
+		m := rt.matched(cr, r)
+		m.PathParams = pathParams(cr.pathRe, sub)
+		return m
+	}
+	for _, i := range rt.index.candidates(host, path, buf[:]) {
+		if rt.predicatesMatch(&rt.rules[i], r, &query) {
+			return rt.matched(&rt.rules[i], r)
+		}
+	}
+	if rt.hostAsService {
+		if svc := rt.hostService(host); svc != "" {
+			return &Match{Service: svc}
+		}
+	}
+	return &Match{Service: rt.defaultService}
+}
+
+// predicatesMatch checks the method, query, header and cookie predicates of cr.
+// The parsed query, keyed by lowercased name, is cached in *query across rules.
+func (rt *Router) predicatesMatch(cr *compiledRule, r *http.Request, query *map[string][]string) bool {
+	if cr.methods != nil && !cr.methods[r.Method] {
+		return false
+	}
+	if len(cr.query) > 0 {
+		if *query == nil {
+			*query = lowerQuery(r.URL.Query())
+		}
+		if !matchValues(cr.query, *query) {
+			return false
+		}
+	}
+	if len(cr.headers) > 0 && !matchValues(cr.headers, r.Header) {
+		return false
+	}
+	return len(cr.cookies) == 0 || matchCookies(cr.cookies, r)
+}
+
+func (rt *Router) matched(cr *compiledRule, r *http.Request) *Match {
+	m := &Match{Rule: cr.rule, Service: cr.rule.ServiceName, Access: cr.access}
+	if cr.split != nil {
+		if svc := cr.split.service(r); svc != "" {
+			m.Service = svc
+		}
+	}
+	if m.Service == "" {
+		m.Service = rt.defaultService
+	}
+	return m
+}
+
+// pathParams maps the capture groups of a path_regex match by position ("1",
+// "2", ...) and, for named groups, by name
+func pathParams(re *regexp.Regexp, sub []string) map[string]string {
+	if len(sub) < 2 {
+		return nil
+	}
+	params := make(map[string]string, 2*(len(sub)-1))
+	for i, name := range re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		params[strconv.Itoa(i)] = sub[i]
+		if name != "" {
+			params[name] = sub[i]
+		}
+	}
+	return params
+}
+
+// hostService derives a service name from host, or "" if it is unknown
+func (rt *Router) hostService(host string) string {
+	svc := strings.TrimSuffix(strings.ToLower(host), rt.stripSuffix)
+	if svc == "" || (rt.serviceExists != nil && !rt.serviceExists(svc)) {
+		return ""
+	}
+	return svc
+}
+
+// matchValues reports whether every predicate is satisfied by at least one
+// value of the corresponding query parameter or header.
+func matchValues(preds map[string]valueMatcher, values map[string][]string) bool {
+	for key, m := range preds {
+		ok := false
+		for _, v := range values[key] {
+			if m.match(v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// lowerQuery merges the query parameters by lowercased name: config keys
+// arrive lowercased, so query_match names compare case-insensitively.
+func lowerQuery(q url.Values) map[string][]string {
+	lowered := make(map[string][]string, len(q))
+	for k, vs := range q {
+		lk := strings.ToLower(k)
+		lowered[lk] = append(lowered[lk], vs...)
+	}
+	return lowered
+}
+
+// matchCookies reports whether every predicate is satisfied by a cookie of that
+// name. Names compare case-insensitively since config keys arrive lowercased.
+func matchCookies(preds map[string]valueMatcher, r *http.Request) bool {
+	cookies := r.Cookies()
+	for name, m := range preds {
+		ok := false
+		for _, c := range cookies {
+			if strings.EqualFold(c.Name, name) && m.match(c.Value) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// stripPort removes an optional port (and IPv6 brackets) from a Host header value
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+}
+
+type ctxKey int
+
+const matchKey ctxKey = 0
+
+// NewContext returns a copy of ctx carrying the routing match.
+func NewContext(ctx context.Context, m *Match) context.Context {
+	return context.WithValue(ctx, matchKey, m)
+}
+
+// FromContext returns the routing match stored in ctx, or nil.
+func FromContext(ctx context.Context) *Match {
+	if m, ok := ctx.Value(matchKey).(*Match); ok {
+		return m
+	}
+	return nil
+}
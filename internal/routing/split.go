@@ -0,0 +1,76 @@
+package routing
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// compiledSplit is a route's split with its match predicates prepared
+type compiledSplit struct {
+	headers      map[string]valueMatcher // keyed by canonical header name
+	cookies      map[string]valueMatcher // keyed by lowercased cookie name
+	matchService string                  // "" = no match condition
+	services     []string
+	cumulative   []int // running total of the weights, parallel to services
+}
+
+func compileSplit(split *config.RouteSplitConfig) (*compiledSplit, error) {
+	cs := &compiledSplit{}
+	if m := split.Match; m != nil {
+		if m.Service == "" {
+			return nil, fmt.Errorf("split match needs a service")
+		}
+		if len(m.Headers) == 0 && len(m.Cookies) == 0 {
+			return nil, fmt.Errorf("split match needs headers or cookies")
+		}
+		var err error
+		if cs.headers, err = compileMatchers(m.Headers, http.CanonicalHeaderKey); err != nil {
+			return nil, fmt.Errorf("invalid split match headers pattern %w", err)
+		}
+		if cs.cookies, err = compileMatchers(m.Cookies, strings.ToLower); err != nil {
+			return nil, fmt.Errorf("invalid split match cookies pattern %w", err)
+		}
+		cs.matchService = m.Service
+	}
+	total := 0
+	for _, s := range split.Services {
+		if s.Service == "" {
+			return nil, fmt.Errorf("split services need a service name")
+		}
+		if s.Weight < 0 {
+			return nil, fmt.Errorf("split weight of %s must not be negative, got %d", s.Service, s.Weight)
+		}
+		total += s.Weight
+		cs.services = append(cs.services, s.Service)
+		cs.cumulative = append(cs.cumulative, total)
+	}
+	if len(split.Services) > 0 && total == 0 {
+		return nil, fmt.Errorf("split weights must not all be 0")
+	}
+	if cs.matchService == "" && len(cs.services) == 0 {
+		return nil, fmt.Errorf("split needs a match or services")
+	}
+	return cs, nil
+}
+
+// service picks the service for r, or "" to use the route's service
+func (cs *compiledSplit) service(r *http.Request) string {
+	if cs.matchService != "" && (len(cs.headers) == 0 || matchValues(cs.headers, r.Header)) &&
+		(len(cs.cookies) == 0 || matchCookies(cs.cookies, r)) {
+		return cs.matchService
+	}
+	if len(cs.services) == 0 {
+		return ""
+	}
+	n := rand.IntN(cs.cumulative[len(cs.cumulative)-1])
+	for i, c := range cs.cumulative {
+		if n < c {
+			return cs.services[i]
+		}
+	}
+	return cs.services[len(cs.services)-1]
+}
@@ -0,0 +1,88 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// LetsEncryptStagingURL is the ACME directory of the Let's Encrypt staging environment
+const LetsEncryptStagingURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+
+// ACMEManager obtains and renews publicly trusted certificates over ACME
+// (Let's Encrypt by default), as an alternative to the self-signed CertManager.
+type ACMEManager struct {
+	manager *autocert.Manager
+	domains []string
+	opts    Options
+}
+
+// NewACMEManager creates an ACME manager for domains. Certificates and the
+// account key are cached in cacheDir; staging selects the Let's Encrypt
+// staging environment, whose certificates are not trusted by browsers.
+func NewACMEManager(domains []string, email, cacheDir string, staging bool) (*ACMEManager, error) {
+	if len(domains) == 0 {
+		return nil, errors.New("acme requires at least one domain")
+	}
+	if cacheDir == "" {
+		return nil, errors.New("acme requires a cache directory")
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      email,
+	}
+	if staging {
+		m.Client = &acme.Client{DirectoryURL: LetsEncryptStagingURL}
+	}
+	return &ACMEManager{manager: m, domains: domains, opts: DefaultOptions}, nil
+}
+
+// Domains returns the domains certificates are issued for
+func (am *ACMEManager) Domains() []string {
+	return am.domains
+}
+
+// SetOptions sets the TLS versions and cipher suites of subsequently built configs
+func (am *ACMEManager) SetOptions(opts Options) {
+	am.opts = opts
+}
+
+// GetServerTLSConfig returns TLS config for server, with certificates issued on demand
+func (am *ACMEManager) GetServerTLSConfig() *tls.Config {
+	cfg := am.manager.TLSConfig()
+	cfg.GetCertificate = am.getCertificate
+	return am.opts.apply(cfg)
+}
+
+// HTTPHandler serves HTTP-01 challenges and passes other requests to fallback.
+// A nil fallback redirects them to HTTPS.
+func (am *ACMEManager) HTTPHandler(fallback http.Handler) http.Handler {
+	return am.manager.HTTPHandler(fallback)
+}
+
+// getCertificate wraps autocert's GetCertificate with hints on the usual causes
+// of a failed issuance
+func (am *ACMEManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, err := am.manager.GetCertificate(hello)
+	if err == nil {
+		return cert, nil
+	}
+	name := hello.ServerName
+	switch {
+	case name == "":
+		return nil, fmt.Errorf("acme: client sent no server name (SNI); connect using one of %s: %w", strings.Join(am.domains, ", "), err)
+	case am.manager.HostPolicy(context.Background(), strings.ToLower(name)) != nil:
+		return nil, fmt.Errorf("acme: %q is not in tls.acme.domains: %w", name, err)
+	default:
+		return nil, fmt.Errorf("acme: obtaining certificate for %q: %w "+
+			"(check that the domain resolves to this host and that port 80 is reachable from the internet for the HTTP-01 challenge)", name, err)
+	}
+}
@@ -22,6 +22,11 @@ type CertManager struct {
 	caKey      *rsa.PrivateKey
 	serverCert tls.Certificate
 	clientCert tls.Certificate
+	opts       Options
+
+	// external mode: certificates come from an existing PKI
+	external  bool
+	clientCAs *x509.CertPool // nil disables client certificate verification
 }
 
 // NewCertManager creates a new certificate manager
@@ -30,7 +35,7 @@ func NewCertManager(certDir string) (*CertManager, error) {
 		return nil, fmt.Errorf("failed to create cert directory: %w", err)
 	}
 
-	cm := &CertManager{certDir: certDir}
+	cm := &CertManager{certDir: certDir, opts: DefaultOptions}
 
 	// Load or generate CA
 	if err := cm.setupCA(); err != nil {
@@ -108,9 +113,15 @@ func (cm *CertManager) generateCA(keyPath, certPath string) error {
 	}
 	cm.caKey = caKey
 
+	// Random serial so regenerated certificates never collide
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
 	// Create CA certificate template
 	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			Organization:  []string{"Charon Service Mesh"},
 			Country:       []string{"US"},
@@ -200,9 +211,15 @@ func (cm *CertManager) generateServerCert(keyPath, certPath string) error {
 		return err
 	}
 
+	// Generate serial number
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
 	// Create server certificate template
 	template := x509.Certificate{
-		SerialNumber: big.NewInt(2),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			Organization: []string{"Charon Service Mesh"},
 			CommonName:   "charon-server",
@@ -285,9 +302,15 @@ func (cm *CertManager) generateClientCert(keyPath, certPath string) error {
 		return err
 	}
 
+	// Generate serial number
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
 	// Create client certificate template
 	template := x509.Certificate{
-		SerialNumber: big.NewInt(3),
+		SerialNumber: serial,
 		Subject: pkix.Name{
 			Organization: []string{"Charon Service Mesh"},
 			CommonName:   "charon-client",
@@ -340,28 +363,48 @@ func (cm *CertManager) generateClientCert(keyPath, certPath string) error {
 	return err
 }
 
+// randomSerial returns a random 128-bit certificate serial number
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// SetOptions sets the TLS versions and cipher suites of subsequently built configs
+func (cm *CertManager) SetOptions(opts Options) {
+	cm.opts = opts
+}
+
 // GetServerTLSConfig returns TLS config for server
 func (cm *CertManager) GetServerTLSConfig() *tls.Config {
+	if cm.external {
+		cfg := &tls.Config{Certificates: []tls.Certificate{cm.serverCert}}
+		if cm.clientCAs != nil {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			cfg.ClientCAs = cm.clientCAs
+		}
+		return cm.opts.apply(cfg)
+	}
 	caCertPool := x509.NewCertPool()
 	caCertPool.AddCert(cm.caCert)
 
-	return &tls.Config{
+	return cm.opts.apply(&tls.Config{
 		Certificates: []tls.Certificate{cm.serverCert},
 		ClientAuth:   tls.RequireAndVerifyClientCert,
 		ClientCAs:    caCertPool,
-		MinVersion:   tls.VersionTLS12,
-	}
+	})
 }
 
-// GetClientTLSConfig returns TLS config for client
+// GetClientTLSConfig returns TLS config for client. In external mode upstreams
+// are verified against the system roots and no client certificate is sent.
 func (cm *CertManager) GetClientTLSConfig() *tls.Config {
+	if cm.external {
+		return cm.opts.apply(&tls.Config{})
+	}
 	caCertPool := x509.NewCertPool()
 	caCertPool.AddCert(cm.caCert)
 
-	return &tls.Config{
+	return cm.opts.apply(&tls.Config{
 		Certificates: []tls.Certificate{cm.clientCert},
 		RootCAs:      caCertPool,
-		MinVersion:   tls.VersionTLS12,
 		ServerName:   "charon-server", // Must match server cert CommonName
-	}
+	})
 }
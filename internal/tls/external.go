@@ -0,0 +1,33 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// NewExternalCertManager creates a certificate manager from certificates issued
+// by an existing PKI. Nothing is generated. When clientCAPath is set, clients
+// must present a certificate signed by one of the CAs in that PEM bundle (mTLS).
+func NewExternalCertManager(serverCertPath, serverKeyPath, clientCAPath string) (*CertManager, error) {
+	if serverCertPath == "" || serverKeyPath == "" {
+		return nil, fmt.Errorf("external mode requires tls.server_cert and tls.server_key")
+	}
+	cert, err := tls.LoadX509KeyPair(serverCertPath, serverKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	cm := &CertManager{external: true, serverCert: cert, opts: DefaultOptions}
+	if clientCAPath != "" {
+		data, err := os.ReadFile(clientCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		cm.clientCAs = x509.NewCertPool()
+		if !cm.clientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no PEM certificates found in client CA %s", clientCAPath)
+		}
+	}
+	return cm, nil
+}
@@ -0,0 +1,29 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+)
+
+type clientCertKey struct{}
+
+// WithClientCert attaches the verified client certificate to ctx
+func WithClientCert(ctx context.Context, cert *x509.Certificate) context.Context {
+	return context.WithValue(ctx, clientCertKey{}, cert)
+}
+
+// ClientCertFromContext returns the verified client certificate, or nil if there is none
+func ClientCertFromContext(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(clientCertKey{}).(*x509.Certificate)
+	return cert
+}
+
+// VerifiedClientCert returns the leaf of the first verified client chain.
+// Certificates that were presented but not verified are ignored.
+func VerifiedClientCert(cs *tls.ConnectionState) *x509.Certificate {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return cs.VerifiedChains[0][0]
+}
@@ -0,0 +1,111 @@
+package tls
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// certFiles lists the certificates managed in a cert directory, in chain order
+var certFiles = []struct {
+	Name string
+	File string
+}{
+	{"ca", "ca-cert.pem"},
+	{"server", "server-cert.pem"},
+	{"client", "client-cert.pem"},
+}
+
+// CertInfo describes a certificate on disk
+type CertInfo struct {
+	Name      string
+	Path      string
+	Subject   string
+	Issuer    string
+	Serial    string
+	DNSNames  []string
+	IPs       []string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// InspectCerts reads the CA, server and client certificates in certDir
+func InspectCerts(certDir string) ([]CertInfo, error) {
+	infos := make([]CertInfo, 0, len(certFiles))
+	for _, f := range certFiles {
+		path := filepath.Join(certDir, f.File)
+		cert, err := readCert(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s certificate: %w", f.Name, err)
+		}
+		info := CertInfo{
+			Name:      f.Name,
+			Path:      path,
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			Serial:    cert.SerialNumber.Text(16),
+			DNSNames:  cert.DNSNames,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		}
+		for _, ip := range cert.IPAddresses {
+			info.IPs = append(info.IPs, ip.String())
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// RotateCerts regenerates the server and client certificates in certDir, signed by
+// the existing CA. With rotateCA the CA is regenerated first, invalidating every
+// certificate it issued. The new files are generated in a temporary directory
+// and renamed into place, so a failed rotation leaves the old set untouched.
+func RotateCerts(certDir string, rotateCA bool) (*CertManager, error) {
+	tmp, err := os.MkdirTemp(certDir, ".rotate-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rotation directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if !rotateCA {
+		for _, f := range []string{"ca-key.pem", "ca-cert.pem"} {
+			data, err := os.ReadFile(filepath.Join(certDir, f))
+			if err != nil {
+				return nil, fmt.Errorf("existing CA: %w", err)
+			}
+			if err := os.WriteFile(filepath.Join(tmp, f), data, 0600); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if _, err := NewCertManager(tmp); err != nil {
+		return nil, err
+	}
+
+	// Keys before certificates, so a certificate on disk never lacks its key
+	rotated := []string{"server-key.pem", "client-key.pem", "server-cert.pem", "client-cert.pem"}
+	if rotateCA {
+		rotated = append([]string{"ca-key.pem", "ca-cert.pem"}, rotated...)
+	}
+	for _, f := range rotated {
+		if err := os.Rename(filepath.Join(tmp, f), filepath.Join(certDir, f)); err != nil {
+			return nil, fmt.Errorf("failed to install %s: %w", f, err)
+		}
+	}
+	return NewCertManager(certDir)
+}
+
+func readCert(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
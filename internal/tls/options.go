@@ -0,0 +1,107 @@
+package tls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Options restricts the protocol versions and cipher suites of server and client configs
+type Options struct {
+	MinVersion   uint16
+	MaxVersion   uint16   // 0 means the highest version Go supports
+	CipherSuites []uint16 // nil means Go's defaults; ignored for TLS 1.3
+}
+
+// DefaultOptions is used when no versions or cipher suites are configured
+var DefaultOptions = Options{MinVersion: tls.VersionTLS12}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseOptions builds Options from config values. Versions are written as
+// "1.2" or "1.3"; cipher suites use Go's names, e.g.
+// "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+func ParseOptions(minVersion, maxVersion string, cipherSuites []string) (Options, error) {
+	opts := DefaultOptions
+	var err error
+	if minVersion != "" {
+		if opts.MinVersion, err = parseVersion(minVersion); err != nil {
+			return Options{}, fmt.Errorf("min_version: %w", err)
+		}
+	}
+	if maxVersion != "" {
+		if opts.MaxVersion, err = parseVersion(maxVersion); err != nil {
+			return Options{}, fmt.Errorf("max_version: %w", err)
+		}
+		if opts.MaxVersion < opts.MinVersion {
+			return Options{}, fmt.Errorf("max_version %s is lower than min_version", maxVersion)
+		}
+	}
+	if len(cipherSuites) == 0 {
+		return opts, nil
+	}
+	if opts.MinVersion == tls.VersionTLS13 {
+		return Options{}, fmt.Errorf("cipher_suites cannot be set when min_version is 1.3; TLS 1.3 suites are not configurable")
+	}
+	known := make(map[string]uint16)
+	tls13 := make(map[string]bool)
+	for _, cs := range tls.CipherSuites() {
+		if slices.Contains(cs.SupportedVersions, tls.VersionTLS12) {
+			known[cs.Name] = cs.ID
+		} else {
+			tls13[cs.Name] = true
+		}
+	}
+	insecure := make(map[string]bool)
+	for _, cs := range tls.InsecureCipherSuites() {
+		insecure[cs.Name] = true
+	}
+	for _, name := range cipherSuites {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		id, ok := known[name]
+		switch {
+		case ok:
+			opts.CipherSuites = append(opts.CipherSuites, id)
+		case tls13[name]:
+			return Options{}, fmt.Errorf("cipher suite %s is a TLS 1.3 suite, which is always enabled and cannot be configured", name)
+		case insecure[name]:
+			return Options{}, fmt.Errorf("cipher suite %s is insecure and not supported", name)
+		default:
+			return Options{}, fmt.Errorf("unknown cipher suite %q (supported: %s)", name, supportedSuites(known))
+		}
+	}
+	return opts, nil
+}
+
+func parseVersion(v string) (uint16, error) {
+	name := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(v)), "TLS")
+	id, ok := tlsVersions[strings.TrimPrefix(strings.TrimSpace(name), "V")]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q (use 1.0, 1.1, 1.2 or 1.3)", v)
+	}
+	return id, nil
+}
+
+func supportedSuites(known map[string]uint16) string {
+	names := make([]string, 0, len(known))
+	for name := range known {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// apply sets the versions and cipher suites on cfg
+func (o Options) apply(cfg *tls.Config) *tls.Config {
+	cfg.MinVersion = o.MinVersion
+	cfg.MaxVersion = o.MaxVersion
+	cfg.CipherSuites = o.CipherSuites
+	return cfg
+}
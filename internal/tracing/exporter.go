@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+var spansDroppedTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "charon_trace_spans_dropped_total",
+		Help: "Total number of spans dropped before reaching the trace collector",
+	},
+	[]string{"reason"}, // queue_full, export_failed
+)
+
+// ExporterOptions bounds how spans are buffered and exported
+type ExporterOptions struct {
+	QueueSize     int           // max spans buffered before new spans are dropped (default 2048)
+	BatchSize     int           // max spans per export call (default 512)
+	BatchTimeout  time.Duration // flush interval for partial batches (default 5s)
+	ExportTimeout time.Duration // deadline for a single export call (default 10s)
+	ErrorInterval time.Duration // minimum gap between exporter error logs (default 1m)
+	SampleRate    *float64      // share of new traces sampled, 0..1 (nil = all); sampled parents are always honored
+}
+
+func (o ExporterOptions) withDefaults() ExporterOptions {
+	if o.QueueSize <= 0 {
+		o.QueueSize = 2048
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 512
+	}
+	if o.BatchSize > o.QueueSize {
+		o.BatchSize = o.QueueSize
+	}
+	if o.BatchTimeout <= 0 {
+		o.BatchTimeout = 5 * time.Second
+	}
+	if o.ExportTimeout <= 0 {
+		o.ExportTimeout = 10 * time.Second
+	}
+	if o.ErrorInterval <= 0 {
+		o.ErrorInterval = time.Minute
+	}
+	return o
+}
+
+// queueProcessor batches ended spans through a bounded queue. OnEnd never blocks:
+// when the collector is slow or down the queue fills up and new spans are dropped.
+type queueProcessor struct {
+	exp    tracesdk.SpanExporter
+	opts   ExporterOptions
+	errors *errorLimiter
+
+	queue    chan tracesdk.ReadOnlySpan
+	flushCh  chan chan struct{}
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newQueueProcessor(exp tracesdk.SpanExporter, opts ExporterOptions, errors *errorLimiter) *queueProcessor {
+	p := &queueProcessor{
+		exp:     exp,
+		opts:    opts,
+		errors:  errors,
+		queue:   make(chan tracesdk.ReadOnlySpan, opts.QueueSize),
+		flushCh: make(chan chan struct{}),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *queueProcessor) OnStart(context.Context, tracesdk.ReadWriteSpan) {}
+
+func (p *queueProcessor) OnEnd(s tracesdk.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	select {
+	case <-p.stopCh:
+		return
+	default:
+	}
+	select {
+	case p.queue <- s:
+	default:
+		spansDroppedTotal.WithLabelValues("queue_full").Inc()
+	}
+}
+
+func (p *queueProcessor) ForceFlush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case p.flushCh <- ack:
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *queueProcessor) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stopCh) })
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.exp.Shutdown(ctx)
+}
+
+func (p *queueProcessor) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.BatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]tracesdk.ReadOnlySpan, 0, p.opts.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			p.export(batch)
+			batch = make([]tracesdk.ReadOnlySpan, 0, p.opts.BatchSize)
+		}
+	}
+	drain := func() {
+		for {
+			select {
+			case s := <-p.queue:
+				batch = append(batch, s)
+				if len(batch) >= p.opts.BatchSize {
+					flush()
+				}
+			default:
+				flush()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			if len(batch) >= p.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case ack := <-p.flushCh:
+			drain()
+			close(ack)
+		case <-p.stopCh:
+			drain()
+			return
+		}
+	}
+}
+
+func (p *queueProcessor) export(batch []tracesdk.ReadOnlySpan) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.ExportTimeout)
+	defer cancel()
+	if err := p.exp.ExportSpans(ctx, batch); err != nil {
+		spansDroppedTotal.WithLabelValues("export_failed").Add(float64(len(batch)))
+		p.errors.report(err)
+		return
+	}
+	p.errors.recovered()
+}
+
+// errorLimiter logs exporter errors at most once per interval and reports how many were suppressed
+type errorLimiter struct {
+	mu         sync.Mutex
+	interval   time.Duration
+	last       time.Time
+	suppressed int
+	failing    bool
+}
+
+func (l *errorLimiter) report(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failing = true
+	now := time.Now()
+	if !l.last.IsZero() && now.Sub(l.last) < l.interval {
+		l.suppressed++
+		return
+	}
+	logging.LogError("Trace exporter error; spans are being dropped", map[string]interface{}{
+		"error":      err.Error(),
+		"suppressed": l.suppressed,
+	})
+	l.last = now
+	l.suppressed = 0
+}
+
+func (l *errorLimiter) recovered() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.failing {
+		return
+	}
+	logging.LogInfo("Trace exporter recovered", map[string]interface{}{
+		"suppressed": l.suppressed,
+	})
+	l.failing = false
+	l.last = time.Time{}
+	l.suppressed = 0
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// redactedValue replaces the value of sensitive headers recorded on spans
+const redactedValue = "[REDACTED]"
+
+// defaultRedactedHeaders are never recorded in clear text
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Extract returns ctx with the remote span context (traceparent/tracestate/baggage) from h
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// Inject writes the span context of ctx (traceparent/tracestate/baggage) into h
+func Inject(ctx context.Context, h http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// HeaderRecorder copies selected request headers onto spans as attributes
+type HeaderRecorder struct {
+	headers []string
+	redact  map[string]bool
+}
+
+// NewHeaderRecorder records the given headers, redacting any listed in redact
+// as well as well-known credential headers. Returns nil when headers is empty.
+func NewHeaderRecorder(headers, redact []string) *HeaderRecorder {
+	if len(headers) == 0 {
+		return nil
+	}
+	hr := &HeaderRecorder{redact: map[string]bool{}}
+	for _, h := range headers {
+		hr.headers = append(hr.headers, http.CanonicalHeaderKey(h))
+	}
+	for _, h := range append(defaultRedactedHeaders, redact...) {
+		hr.redact[http.CanonicalHeaderKey(h)] = true
+	}
+	return hr
+}
+
+// Attributes returns span attributes (http.request.header.<name>) for headers present in h
+func (hr *HeaderRecorder) Attributes(h http.Header) []attribute.KeyValue {
+	if hr == nil {
+		return nil
+	}
+	var attrs []attribute.KeyValue
+	for _, name := range hr.headers {
+		vals := h.Values(name)
+		if len(vals) == 0 {
+			continue
+		}
+		key := "http.request.header." + strings.ToLower(name)
+		if hr.redact[name] {
+			attrs = append(attrs, attribute.String(key, redactedValue))
+			continue
+		}
+		attrs = append(attrs, attribute.StringSlice(key, vals))
+	}
+	return attrs
+}
@@ -19,20 +19,37 @@ const serviceName = "charon"
 
 // InitTracing initializes OpenTelemetry tracing with service name using OTLP HTTP exporter.
 func InitTracing(serviceName, jaegerEndpoint string) (func(), error) {
+	return InitTracingWithOptions(serviceName, jaegerEndpoint, ExporterOptions{})
+}
+
+// InitTracingWithOptions is InitTracing with explicit queue and export bounds.
+// Spans are dropped (and counted) rather than slowing down requests when the collector is unreachable.
+func InitTracingWithOptions(serviceName, jaegerEndpoint string, opts ExporterOptions) (func(), error) {
+	opts = opts.withDefaults()
 	// Derive OTLP endpoint from provided Jaeger endpoint (fallback to localhost:4318)
 	endpoint := deriveOTLPEndpoint(jaegerEndpoint)
 	// Create the OTLP HTTP exporter
 	exp, err := otlptracehttp.New(context.Background(),
 		otlptracehttp.WithEndpoint(endpoint),
 		otlptracehttp.WithInsecure(),
+		otlptracehttp.WithTimeout(opts.ExportTimeout),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// Exporter errors are rate limited so a down collector doesn't flood the logs
+	errors := &errorLimiter{interval: opts.ErrorInterval}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(errors.report))
+
+	rate := 1.0
+	if opts.SampleRate != nil {
+		rate = *opts.SampleRate
+	}
 	tp := tracesdk.NewTracerProvider(
-		// Always be sure to batch in production
-		tracesdk.WithBatcher(exp),
+		tracesdk.WithSampler(NewSampler(rate)),
+		// Bounded, non-blocking batching
+		tracesdk.WithSpanProcessor(newQueueProcessor(exp, opts, errors)),
 		// Record information about this application in a Resource
 		tracesdk.WithResource(resource.NewWithAttributes(
 			semconv.SchemaURL,
@@ -46,45 +63,24 @@ func InitTracing(serviceName, jaegerEndpoint string) (func(), error) {
 
 	// Return a shutdown function
 	return func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*opts.ExportTimeout)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
 			log.Printf("Error shutting down tracer provider: %v", err)
 		}
 	}, nil
 }
 
+// NewSampler samples rate (0..1) of the traces started here, by trace ID.
+// Requests that arrive with a parent span follow the parent's decision, so a
+// trace sampled upstream stays complete even at rate 0.
+func NewSampler(rate float64) tracesdk.Sampler {
+	return tracesdk.ParentBased(tracesdk.TraceIDRatioBased(rate))
+}
+
 // Init initializes OpenTelemetry tracing
 func Init(jaegerEndpoint string) (func(), error) {
-	// Derive OTLP endpoint from provided Jaeger endpoint (fallback to localhost:4318)
-	endpoint := deriveOTLPEndpoint(jaegerEndpoint)
-	// Create the OTLP HTTP exporter
-	exp, err := otlptracehttp.New(context.Background(),
-		otlptracehttp.WithEndpoint(endpoint),
-		otlptracehttp.WithInsecure(),
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	tp := tracesdk.NewTracerProvider(
-		// Always be sure to batch in production
-		tracesdk.WithBatcher(exp),
-		// Record information about this application in a Resource
-		tracesdk.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion("v0.1.0"),
-		)),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-
-	// Return a shutdown function
-	return func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			log.Printf("Error shutting down tracer provider: %v", err)
-		}
-	}, nil
+	return InitTracing(serviceName, jaegerEndpoint)
 }
 
 // GetTracer returns the tracer for charon
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/ipfilter"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestIPFilterList(t *testing.T) {
+	list, err := ipfilter.New(
+		[]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"},
+		[]string{"10.1.0.0/16", "2001:db8:bad::/48"},
+	)
+	if err != nil {
+		t.Fatalf("Failed to parse lists: %v", err)
+	}
+	cases := map[string]bool{
+		"10.2.3.4":         true,
+		"10.1.2.3":         false, // deny wins over allow
+		"192.0.2.1":        true,
+		"192.0.2.2":        false, // not allowed
+		"::ffff:10.2.3.4":  true,  // IPv4-mapped
+		"2001:db8::1":      true,
+		"2001:db8:bad::1":  false,
+		"2001:db9::1":      false,
+		"::ffff:10.1.0.20": false,
+	}
+	for ip, want := range cases {
+		if got := list.Allows(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("Allows(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	denyOnly, _ := ipfilter.New(nil, []string{"203.0.113.0/24", "fe80::/10"})
+	for ip, want := range map[string]bool{"203.0.113.9": false, "198.51.100.1": true, "fe80::1": false, "::1": true} {
+		if got := denyOnly.Allows(netip.MustParseAddr(ip)); got != want {
+			t.Errorf("empty allow list: Allows(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/40", "not-an-ip", "2001:db8::/129"} {
+		if _, err := ipfilter.New([]string{bad}, nil); err == nil {
+			t.Errorf("Expected %q rejected", bad)
+		}
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	global, _ := ipfilter.New(nil, []string{"198.51.100.0/24", "2001:db8:dead::/48"})
+	start := func(trusted []string) string {
+		rules := []config.RouteRule{
+			{PathPrefix: "/admin", ServiceName: "app", AllowCIDRs: []string{"10.0.0.0/8", "fd00::/8"}, DenyCIDRs: []string{"10.9.0.0/16"}},
+			{PathPrefix: "/", ServiceName: "app"},
+		}
+		addr, _ := startProxy(t, backend.URL, withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+			p.AccessControl = global
+			p.TrustedProxies, _ = proxy.ParseTrustedProxies(trusted)
+		})
+		return "http://" + addr
+	}
+	status := func(base, path, xff string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, base+path, nil)
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the test client plays a trusted load balancer, so X-Forwarded-For names the client
+	behindLB := start([]string{"127.0.0.1", "::1"})
+	cases := []struct {
+		path, xff string
+		want      int
+	}{
+		{"/admin", "10.2.3.4", http.StatusOK},
+		{"/admin", "203.0.113.5", http.StatusForbidden},
+		{"/admin", "10.9.1.1", http.StatusForbidden}, // route deny wins
+		{"/admin", "fd00::1", http.StatusOK},
+		{"/admin", "2001:db8::1", http.StatusForbidden},
+		{"/admin", "203.0.113.5, 10.2.3.4", http.StatusOK}, // rightmost untrusted hop
+		{"/", "203.0.113.5", http.StatusOK},
+		{"/", "198.51.100.7", http.StatusForbidden}, // global deny
+		{"/", "2001:db8:dead::7", http.StatusForbidden},
+		{"/admin/", "198.51.100.7", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		if got := status(behindLB, tc.path, tc.xff); got != tc.want {
+			t.Errorf("%s from %s: expected %d, got %d", tc.path, tc.xff, tc.want, got)
+		}
+	}
+
+	// without trusted proxies a client cannot claim an allowed address
+	direct := start(nil)
+	if got := status(direct, "/admin", "10.2.3.4"); got != http.StatusForbidden {
+		t.Errorf("Expected a spoofed X-Forwarded-For ignored, got %d", got)
+	}
+}
@@ -0,0 +1,151 @@
+package test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// startAccessLogProxy proxies to a backend answering "hello", logging to a file in format
+func startAccessLogProxy(t *testing.T, format string) (base, path string) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	t.Cleanup(backend.Close)
+
+	path = filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := logging.NewAccessLogger(logging.AccessLogOptions{Path: path, Format: format})
+	if err != nil {
+		t.Fatalf("Failed to open access log: %v", err)
+	}
+	t.Cleanup(func() { accessLog.Close() })
+	keys, err := auth.NewAPIKeyAuth("", "", []string{"/api"}, []auth.Key{{Name: "alice", Key: "secret"}}, "")
+	if err != nil {
+		t.Fatalf("Failed to create API key auth: %v", err)
+	}
+
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.AccessLog = accessLog
+		p.APIKeys = keys
+	})
+	return "http://" + addr, path
+}
+
+func accessGet(t *testing.T, target string, header http.Header) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", target, err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// accessLines returns the log lines once want of them have been written
+func accessLines(t *testing.T, path string, want int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(data) > 0 && len(lines) >= want {
+			return lines
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d access log lines, got %q", want, data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAccessLogCombined(t *testing.T) {
+	base, path := startAccessLogProxy(t, logging.AccessFormatCombined)
+
+	accessGet(t, base+"/api/users?page=2", http.Header{
+		"X-Api-Key":  {"secret"},
+		"User-Agent": {`curl/8.4.0 "quoted"`},
+		"Referer":    {"https://example.com/"},
+	})
+	accessGet(t, base+"/api/users", nil) // rejected: no API key
+
+	lines := accessLines(t, path, 2)
+	combined := regexp.MustCompile(`^127\.0\.0\.1 - (\S+) \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "([^"]*)" (\d{3}) (\S+) "([^"]*)" "([^"]*)"$`)
+	m := combined.FindStringSubmatch(lines[0])
+	if m == nil {
+		t.Fatalf("Expected a combined log line, got %q", lines[0])
+	}
+	if m[1] != "alice" || m[2] != "GET /api/users?page=2 HTTP/1.1" || m[3] != "200" || m[4] != "5" {
+		t.Errorf("Unexpected fields in %q", lines[0])
+	}
+	if m[5] != "https://example.com/" || m[6] != `curl/8.4.0 \x22quoted\x22` {
+		t.Errorf("Expected the referer and an escaped user agent, got %q", lines[0])
+	}
+	if m := combined.FindStringSubmatch(lines[1]); m == nil || m[1] != "-" || m[3] != "401" {
+		t.Errorf("Expected the rejected request logged with 401, got %q", lines[1])
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	base, path := startAccessLogProxy(t, logging.AccessFormatJSON)
+
+	accessGet(t, base+"/hello", nil)
+
+	var entry map[string]interface{}
+	line := accessLines(t, path, 1)[0]
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("Expected a JSON line, got %q: %v", line, err)
+	}
+	if entry["uri"] != "/hello" || entry["status"] != float64(200) || entry["size_bytes"] != float64(5) {
+		t.Errorf("Unexpected entry %v", entry)
+	}
+	if up, _ := entry["upstream"].(string); !strings.HasPrefix(up, "127.0.0.1:") {
+		t.Errorf("Expected the upstream in the entry, got %v", entry["upstream"])
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := logging.NewRotatingFile(path, 1, 2, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < 4*1024+10; i++ { // a little over 4 MiB
+		if _, err := f.Write(line); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "access-*.log"))
+	if len(matches) != 2 {
+		t.Errorf("Expected 2 rotated files kept (max_backups), got %v", matches)
+	}
+	for _, m := range append(matches, path) {
+		info, err := os.Stat(m)
+		if err != nil {
+			t.Fatalf("Stat %s: %v", m, err)
+		}
+		if info.Size() > 1024*1024 {
+			t.Errorf("%s is %d bytes, over the 1 MiB limit", m, info.Size())
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/concurrency"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// saturate takes every free slot of l and releases them all with latency rtt
+func saturate(t *testing.T, l *concurrency.AdaptiveLimiter, rtt time.Duration) {
+	t.Helper()
+	n := 0
+	for l.Acquire() {
+		n++
+	}
+	if n == 0 {
+		t.Fatal("Expected at least one free slot")
+	}
+	for ; n > 0; n-- {
+		l.Release(rtt)
+	}
+}
+
+func TestAdaptiveLimiterFollowsLatency(t *testing.T) {
+	l := concurrency.NewAdaptiveLimiter(10, 2, 200)
+	if l.Limit() != 10 {
+		t.Fatalf("Expected the initial limit, got %d", l.Limit())
+	}
+
+	// Steady latency at full utilization: the limit probes upwards
+	for i := 0; i < 20; i++ {
+		saturate(t, l, 10*time.Millisecond)
+	}
+	grown := l.Limit()
+	if grown <= 10 {
+		t.Fatalf("Expected the limit to grow under steady latency, got %d", grown)
+	}
+
+	// The upstreams slow down: the limit sheds load
+	for i := 0; i < 10; i++ {
+		saturate(t, l, 100*time.Millisecond)
+	}
+	if shrunk := l.Limit(); shrunk >= grown || shrunk < 2 {
+		t.Errorf("Expected the limit to shrink within bounds after latency rose, got %d (was %d)", shrunk, grown)
+	}
+	if l.Inflight() != 0 {
+		t.Errorf("Expected every slot released, %d still held", l.Inflight())
+	}
+
+	// Traffic well below the limit says nothing about capacity
+	idle := concurrency.NewAdaptiveLimiter(10, 2, 200)
+	for i := 0; i < 50; i++ {
+		if !idle.Acquire() {
+			t.Fatal("Expected a slot")
+		}
+		idle.Release(10 * time.Millisecond)
+	}
+	if idle.Limit() != 10 {
+		t.Errorf("Expected an underused limit to stay put, got %d", idle.Limit())
+	}
+
+	// Requests without an upstream latency leave the limit alone
+	for i := 0; i < 5; i++ {
+		saturate(t, idle, 0)
+	}
+	if idle.Limit() != 10 {
+		t.Errorf("Expected samples without latency ignored, got %d", idle.Limit())
+	}
+}
+
+func TestAdaptiveConcurrencyRejects(t *testing.T) {
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	addr, p := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.AdaptiveConcurrency = concurrency.NewAdaptiveLimiter(1, 1, 1)
+	})
+
+	if got := metricValue(t, "charon_adaptive_concurrency_limit", nil); got != 1 {
+		t.Errorf("Expected the limit exported, got %v", got)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.AdaptiveConcurrency.Inflight() < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	rejected := metricValue(t, "charon_adaptive_concurrency_rejected_total", nil)
+	resp, err := http.Get("http://" + addr + "/other")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("Expected 503 with Retry-After over the adaptive limit, got %d", resp.StatusCode)
+	}
+	if got := metricValue(t, "charon_adaptive_concurrency_rejected_total", nil) - rejected; got != 1 {
+		t.Errorf("Expected 1 rejection counted, got %v", got)
+	}
+
+	// The metrics endpoint is never limited
+	if resp, err = http.Get("http://" + addr + "/metrics"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected /metrics served at the limit, got %v %v", resp, err)
+	} else {
+		resp.Body.Close()
+	}
+
+	close(unblock)
+	<-done
+}
+
+func TestAdaptiveConcurrencyStreamedResponses(t *testing.T) {
+	// Every response starts after 50ms; /stream then keeps the body open
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if r.URL.Path == "/stream" {
+			time.Sleep(500 * time.Millisecond)
+			_, _ = io.WriteString(w, "data: done\n\n")
+		}
+	}))
+	defer backend.Close()
+
+	addr, p := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.AdaptiveConcurrency = concurrency.NewAdaptiveLimiter(16, 1, 16)
+	})
+	get := func(path string) {
+		if resp, err := http.Get("http://" + addr + path); err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+
+	// The baseline is the time to the response headers
+	for i := 0; i < 10; i++ {
+		get("/")
+	}
+	// Long-lived bodies at full utilization must not read as an upstream slowdown
+	done := make(chan struct{})
+	for i := 0; i < 12; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			get("/stream")
+		}()
+	}
+	for i := 0; i < 12; i++ {
+		<-done
+	}
+	if got := p.AdaptiveConcurrency.Limit(); got != 16 {
+		t.Errorf("Expected streamed responses sampled by their time to first byte, limit shrank to %d", got)
+	}
+}
@@ -0,0 +1,171 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/registry"
+)
+
+// auditRecords reads the JSON lines of an audit log file
+func auditRecords(t *testing.T, path string) []map[string]interface{} {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer f.Close()
+	var records []map[string]interface{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", sc.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestAdminAuditRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := admin.NewAuditLogger(path)
+	if err != nil {
+		t.Fatalf("NewAuditLogger failed: %v", err)
+	}
+	keys, err := auth.NewAPIKeyAuth("", "api_key", nil, []auth.Key{{Name: "ops", Key: "ops-secret", Tier: "admin"}}, "")
+	if err != nil {
+		t.Fatalf("NewAPIKeyAuth failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	(&admin.Server{Audit: audit, APIKeys: keys, Registry: registry.NewDynamicRegistry()}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	call := func(method, path, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// The key travels in the query; the body carries a field the call doesn't know
+	if got := call("POST", "/admin/registry/orders?api_key=ops-secret",
+		`{"address": "10.0.0.7:80", "weight": 2, "password": "hunter2"}`); got != http.StatusOK {
+		t.Fatalf("Expected the registration accepted, got %d", got)
+	}
+	if got := call("PUT", "/admin/loglevel?api_key=ops-secret", `{"level": "shout"}`); got != http.StatusBadRequest {
+		t.Fatalf("Expected an unknown level rejected, got %d", got)
+	}
+	if got := call("POST", "/admin/drain?api_key=ops-secret", `{"token": "t0p"}`); got != http.StatusNotFound {
+		t.Fatalf("Expected drain without a drainer to 404, got %d", got)
+	}
+	_ = audit.Sync()
+
+	raw, _ := os.ReadFile(path)
+	for _, secret := range []string{"ops-secret", "hunter2", "password", "t0p", "api_key"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("Expected %q kept out of the audit log:\n%s", secret, raw)
+		}
+	}
+	records := auditRecords(t, path)
+	if len(records) != 3 {
+		t.Fatalf("Expected three audit records, got %d:\n%s", len(records), raw)
+	}
+	want := []struct {
+		action, params, result string
+	}{
+		{"registry.register", `{"address":"10.0.0.7:80","weight":2}`, "success"},
+		{"loglevel.set", `{"level":"shout"}`, "failure"},
+		{"drain", "", "failure"},
+	}
+	for i, w := range want {
+		rec := records[i]
+		if rec["action"] != w.action || rec["params"] != w.params || rec["result"] != w.result {
+			t.Errorf("Record %d: expected %s %s %s, got %v", i, w.action, w.params, w.result, rec)
+		}
+		if rec["principal"] != "ops" || rec["path"] == nil || rec["source_ip"] != "127.0.0.1" {
+			t.Errorf("Record %d: expected the principal, path and source, got %v", i, rec)
+		}
+	}
+}
+
+func TestAdminAuditDenied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := admin.NewAuditLogger(path)
+	if err != nil {
+		t.Fatalf("NewAuditLogger failed: %v", err)
+	}
+	keys, err := auth.NewAPIKeyAuth("", "", nil, []auth.Key{
+		{Name: "ops", Key: "ops-secret", Tier: "admin"},
+		{Name: "partner", Key: "partner-secret", Tier: "gold"},
+	}, "")
+	if err != nil {
+		t.Fatalf("NewAPIKeyAuth failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	(&admin.Server{Audit: audit, APIKeys: keys, Registry: registry.NewDynamicRegistry()}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	call := func(method, path, key string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(`{"level": "debug"}`))
+		if key != "" {
+			req.Header.Set(auth.DefaultHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := call("PUT", "/admin/loglevel", ""); got != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a key, got %d", got)
+	}
+	if got := call("PUT", "/admin/loglevel", "wrong"); got != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an unknown key, got %d", got)
+	}
+	if got := call("PUT", "/admin/loglevel", "partner-secret"); got != http.StatusForbidden {
+		t.Fatalf("Expected 403 for a non-admin key, got %d", got)
+	}
+	if got := call("GET", "/admin/upstreams", "partner-secret"); got != http.StatusForbidden {
+		t.Fatalf("Expected 403 for a non-admin read, got %d", got)
+	}
+	_ = audit.Sync()
+
+	records := auditRecords(t, path)
+	want := []struct {
+		action, principal string
+		status            float64
+	}{
+		{"loglevel.set", "", 401},
+		{"loglevel.set", "", 401},
+		{"loglevel.set", "partner", 403},
+		{"read", "partner", 403},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d audit records, got %v", len(want), records)
+	}
+	for i, w := range want {
+		rec := records[i]
+		if rec["action"] != w.action || rec["principal"] != w.principal || rec["status"] != w.status || rec["result"] != "denied" {
+			t.Errorf("Record %d: expected %s by %q denied with %v, got %v", i, w.action, w.principal, w.status, rec)
+		}
+		if rec["source_ip"] != "127.0.0.1" || rec["params"] != "" {
+			t.Errorf("Record %d: expected the source and no params, got %v", i, rec)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestAdminListener(t *testing.T) {
+	cfg := &config.Config{
+		ListenPort: "8080",
+		Auth: config.AuthConfig{APIKey: config.APIKeyAuthConfig{
+			Enabled: true,
+			Keys:    []config.APIKeyConfig{{Name: "partner", Key: "s3cret", Tier: "gold"}},
+		}},
+	}
+	var ready atomic.Bool
+	p := proxy.NewHTTPProxyWithResolver(freeAddr(t), nil)
+	l := &admin.Listener{
+		Addr:  freeAddr(t),
+		Admin: &admin.Server{Drainer: p},
+		Ready: func() error {
+			if !ready.Load() {
+				return errors.New("service orders has no healthy upstream")
+			}
+			return nil
+		},
+		Config: func() interface{} { return cfg.Redacted() },
+	}
+	go func() {
+		if err := l.Start(); err != nil {
+			t.Errorf("Admin listener failed: %v", err)
+		}
+	}()
+	waitListening(t, l.Addr)
+	base := "http://" + l.Addr
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, body := get("/metrics"); status != http.StatusOK || !strings.Contains(body, "go_goroutines") {
+		t.Errorf("Expected Prometheus metrics, got %d", status)
+	}
+	if status, _ := get("/healthz"); status != http.StatusOK {
+		t.Errorf("Expected /healthz 200, got %d", status)
+	}
+	if status, body := get("/readyz"); status != http.StatusServiceUnavailable || !strings.Contains(body, "orders") {
+		t.Errorf("Expected /readyz 503 with the reason, got %d %q", status, body)
+	}
+	ready.Store(true)
+	if status, _ := get("/readyz"); status != http.StatusOK {
+		t.Errorf("Expected /readyz 200, got %d", status)
+	}
+
+	status, body := get("/config")
+	var effective map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &effective); err != nil || status != http.StatusOK {
+		t.Fatalf("Expected JSON config, got %d %q", status, body)
+	}
+	if effective["listen_port"] != "8080" {
+		t.Errorf("Expected config keys as in the config file, got %v", effective["listen_port"])
+	}
+	if strings.Contains(body, "s3cret") || !strings.Contains(body, `"[REDACTED]"`) {
+		t.Errorf("Expected the API key to be redacted: %s", body)
+	}
+
+	resp, err := http.Post(base+"/admin/drain", "", nil)
+	if err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !p.Draining() {
+		t.Errorf("Expected admin endpoints on the admin listener, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := l.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Error("Expected the admin listener to be closed")
+	}
+}
+
+func TestProxyWithoutMetricsEndpoint(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	listenAddr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.DisableMetricsEndpoint = true
+	})
+
+	resp, err := http.Get("http://" + listenAddr + "/metrics")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "backend" {
+		t.Errorf("Expected /metrics to be proxied like any other path, got %q", body)
+	}
+}
+
+func TestAdminConfigRequiresProtection(t *testing.T) {
+	if _, err := config.LoadConfig(writeConfig(t, "admin:\n  enabled: true\n")); err == nil {
+		t.Error("Expected an admin API without auth or its own listener to be rejected")
+	}
+	for _, good := range []string{
+		"admin:\n  enabled: true\n  listen_addr: \"127.0.0.1:9901\"\n",
+		"admin:\n  enabled: true\nauth:\n  api_key:\n    enabled: true\n    keys:\n      - name: ops\n        key: secret\n        tier: admin\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, good)); err != nil {
+			t.Errorf("Expected config accepted, got %v:\n%s", err, good)
+		}
+	}
+}
+
+func TestAdminEndpointsRequireKey(t *testing.T) {
+	keys, err := auth.NewAPIKeyAuth("", "", nil, []auth.Key{
+		{Name: "ops", Key: "ops-secret", Tier: "admin"},
+		{Name: "client", Key: "client-secret", Tier: "free"},
+	}, "")
+	if err != nil {
+		t.Fatalf("NewAPIKeyAuth failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	(&admin.Server{APIKeys: keys}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	for _, ep := range []struct{ method, path string }{
+		{"GET", "/admin/upstreams"},
+		{"GET", "/admin/ratelimit"},
+		{"GET", "/admin/loglevel"},
+		{"GET", "/admin/registry/orders"},
+		{"POST", "/admin/drain"},
+		{"POST", "/admin/breaker/10.0.0.1:80/trip"},
+	} {
+		for key, want := range map[string]int{"": http.StatusUnauthorized, "client-secret": http.StatusForbidden} {
+			req, _ := http.NewRequest(ep.method, srv.URL+ep.path, nil)
+			if key != "" {
+				req.Header.Set("X-API-Key", key)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s failed: %v", ep.method, ep.path, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != want {
+				t.Errorf("%s %s with key %q: expected %d, got %d", ep.method, ep.path, key, want, resp.StatusCode)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+)
+
+func TestAdminRateLimitBypass(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	keys, err := auth.NewAPIKeyAuth("", "", nil, []auth.Key{
+		{Name: "ops", Key: "admin-key", Tier: "admin"},
+		{Name: "partner", Key: "partner-key", Tier: "gold"},
+	}, "")
+	if err != nil {
+		t.Fatalf("Failed to create API key auth: %v", err)
+	}
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.RateLimits = ratelimit.NewPolicy(newDimension(t, "global", "global", 2))
+		p.Admin = &admin.Server{RateLimiter: p.RateLimits, APIKeys: keys}
+	})
+	base := "http://" + addr
+
+	proxied := func(n int) []int {
+		t.Helper()
+		var got []int
+		for i := 0; i < n; i++ {
+			resp, err := http.Get(base + "/items")
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+			resp.Body.Close()
+			got = append(got, resp.StatusCode)
+		}
+		return got
+	}
+	toggle := func(key, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, base+"/admin/ratelimit", strings.NewReader(body))
+		req.Header.Set(auth.DefaultHeader, key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST /admin/ratelimit failed: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Exhaust the burst of 2
+	if got := proxied(3); got[2] != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the limit was exhausted, got %v", got)
+	}
+
+	// Only the admin tier may switch limiting off
+	if status := toggle("partner-key", `{"enabled": false}`); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a non-admin key, got %d", status)
+	}
+	if status := toggle("", `{"enabled": false}`); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", status)
+	}
+	if got := proxied(1); got[0] != http.StatusTooManyRequests {
+		t.Errorf("Expected limiting still enforced after the rejected toggles, got %v", got)
+	}
+
+	if status := toggle("admin-key", `{"enabled": false}`); status != http.StatusOK {
+		t.Fatalf("Expected the admin key to disable limiting, got %d", status)
+	}
+	for _, status := range proxied(5) {
+		if status != http.StatusOK {
+			t.Fatalf("Expected over-limit requests to pass while bypassed, got %d", status)
+		}
+	}
+
+	if status := toggle("admin-key", `{"enabled": true}`); status != http.StatusOK {
+		t.Fatalf("Expected the admin key to re-enable limiting, got %d", status)
+	}
+	if got := proxied(3); got[2] != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 again once limiting was re-enabled, got %v", got)
+	}
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+type upstreamRow struct {
+	Healthy       bool       `json:"healthy"`
+	LastCheck     *time.Time `json:"last_check"`
+	LastLatencyMs *float64   `json:"last_latency_ms"`
+	CooldownUntil *time.Time `json:"cooldown_until"`
+	BreakerState  string     `json:"breaker_state"`
+}
+
+func TestAdminUpstreams(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	up := ln.Addr().String()
+	down := "upstreams-down:1"
+
+	b := balancer.New(balancer.Options{HealthInterval: 20 * time.Millisecond, CoolDown: time.Minute, FailureThreshold: 1, OpenDuration: time.Minute})
+	defer b.Close()
+	b.SetServiceAddrs("table", []string{up, down})
+	deadline := time.Now().Add(2 * time.Second)
+	for b.HealthLatency(up) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	b.MarkFailure(down)
+
+	mux := http.NewServeMux()
+	(&admin.Server{Upstreams: b}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/admin/upstreams")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var table map[string]map[string]upstreamRow
+	if err := json.NewDecoder(resp.Body).Decode(&table); err != nil {
+		t.Fatalf("Failed to decode the health table: %v", err)
+	}
+
+	healthy := table["table"][up]
+	if !healthy.Healthy || healthy.BreakerState != "closed" || healthy.CooldownUntil != nil {
+		t.Errorf("Expected %s healthy and closed, got %+v", up, healthy)
+	}
+	if healthy.LastCheck == nil || healthy.LastLatencyMs == nil || time.Since(*healthy.LastCheck) > time.Second {
+		t.Errorf("Expected a recent health check recorded for %s, got %+v", up, healthy)
+	}
+
+	forced, ok := table["table"][down]
+	if !ok {
+		t.Fatalf("Expected %s in the table, got %v", down, table)
+	}
+	if forced.Healthy || forced.BreakerState != "open" {
+		t.Errorf("Expected %s down with an open breaker, got %+v", down, forced)
+	}
+	if forced.CooldownUntil == nil || time.Until(*forced.CooldownUntil) < 30*time.Second {
+		t.Errorf("Expected %s in its cooldown, got %+v", down, forced)
+	}
+}
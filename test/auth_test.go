@@ -0,0 +1,147 @@
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	sum := sha256.Sum256([]byte("free-secret"))
+	keysFile := filepath.Join(t.TempDir(), "keys")
+	content := "# hashed keys\n" + hex.EncodeToString(sum[:]) + " free-client free\n"
+	if err := os.WriteFile(keysFile, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+	keys, err := auth.NewAPIKeyAuth("", "api_key", []string{"/api"}, []auth.Key{
+		{Name: "gold-client", Key: "gold-secret", Tier: "gold"},
+		{Name: "ops", Key: "ops-secret", Tier: "admin"},
+	}, keysFile)
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	if _, err := auth.NewAPIKeyAuth("", "", nil, []auth.Key{{Name: "x", Hash: "zz"}}, ""); err == nil {
+		t.Error("Expected an invalid hash to be rejected")
+	}
+
+	// One request per second for free keys, none for the gold tier
+	key, _ := ratelimit.ParseKey("api_key")
+	policy := ratelimit.NewPolicy(&ratelimit.Dimension{
+		Name:    "free",
+		Key:     key,
+		Tier:    "free",
+		Limiter: ratelimit.NewRateLimiter(1, 1),
+	})
+
+	listenAddr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.APIKeys = keys
+		p.RateLimits = policy
+		p.Admin = &admin.Server{Drainer: p, APIKeys: keys}
+	})
+
+	get := func(method, path, apiKey string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://"+listenAddr+path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		key    string
+		want   int
+	}{
+		{"missing key", "GET", "/api/orders", "", http.StatusUnauthorized},
+		{"wrong key", "GET", "/api/orders", "nope", http.StatusUnauthorized},
+		{"inline key", "GET", "/api/orders", "gold-secret", http.StatusOK},
+		{"inline key again, gold is not limited", "GET", "/api/orders", "gold-secret", http.StatusOK},
+		{"query parameter", "GET", "/api/orders?api_key=gold-secret", "", http.StatusOK},
+		{"hashed key from file", "GET", "/api/orders", "free-secret", http.StatusOK},
+		{"free tier limited", "GET", "/api/orders", "free-secret", http.StatusTooManyRequests},
+		{"unprotected path", "GET", "/public", "", http.StatusOK},
+		{"admin without key", "POST", "/admin/drain", "", http.StatusUnauthorized},
+		{"admin with non-admin key", "POST", "/admin/drain", "gold-secret", http.StatusForbidden},
+		{"admin with admin key", "POST", "/admin/drain", "ops-secret", http.StatusOK},
+	}
+	for _, tc := range cases {
+		if got := get(tc.method, tc.path, tc.key); got != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestAPIKeyNotForwardedOrLogged(t *testing.T) {
+	seen := make(chan *http.Request, 2)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r
+	}))
+	defer backend.Close()
+
+	logPath := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := logging.NewAccessLogger(logging.AccessLogOptions{Path: logPath})
+	if err != nil {
+		t.Fatalf("Failed to open access log: %v", err)
+	}
+	defer accessLog.Close()
+	keys, err := auth.NewAPIKeyAuth("", "api_key", nil, []auth.Key{{Name: "alice", Key: "top-secret"}}, "")
+	if err != nil {
+		t.Fatalf("Failed to create authenticator: %v", err)
+	}
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.APIKeys = keys
+		p.AccessLog = accessLog
+	})
+
+	accessGet(t, "http://"+addr+"/orders?page=2&api_key=top-secret&sort=id", nil)
+	r := <-seen
+	if r.URL.RawQuery != "page=2&sort=id" {
+		t.Errorf("Expected the key parameter stripped upstream, got %q", r.URL.RawQuery)
+	}
+	accessGet(t, "http://"+addr+"/orders", http.Header{"X-Api-Key": {"top-secret"}})
+	if r := <-seen; r.Header.Get("X-API-Key") != "" {
+		t.Errorf("Expected the key header stripped upstream, got %q", r.Header.Get("X-API-Key"))
+	}
+
+	lines := accessLines(t, logPath, 2)
+	if !strings.Contains(lines[0], "/orders?page=2&api_key=REDACTED&sort=id") {
+		t.Errorf("Expected the key redacted in the access log, got %q", lines[0])
+	}
+	for _, line := range lines {
+		if strings.Contains(line, "top-secret") {
+			t.Errorf("Expected no key in the access log, got %q", line)
+		}
+	}
+
+	if got := keys.RedactQuery("api_key=a&api%5Fkey=b&x=1"); got != "api_key=REDACTED&api%5Fkey=REDACTED&x=1" {
+		t.Errorf("Unexpected redaction %q", got)
+	}
+	var none *auth.APIKeyAuth
+	if got := none.RedactQuery("api_key=a"); got != "api_key=a" {
+		t.Errorf("Expected a nil authenticator to leave the query alone, got %q", got)
+	}
+}
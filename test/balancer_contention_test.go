@@ -0,0 +1,133 @@
+package test
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+func TestNextConcurrentRoundRobin(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, CoolDown: time.Minute})
+	defer b.Close()
+	addrs := []string{"rr-a:1", "rr-b:1", "rr-c:1", "rr-d:1"}
+	b.SetServiceAddrs("rr", addrs)
+
+	const workers, picks = 8, 1000
+	var mu sync.Mutex
+	counts := map[string]int{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			local := map[string]int{}
+			for i := 0; i < picks; i++ {
+				local[b.Next("rr", addrs)]++
+			}
+			mu.Lock()
+			for a, n := range local {
+				counts[a] += n
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	for _, a := range addrs {
+		if got := counts[a]; got != workers*picks/len(addrs) {
+			t.Errorf("Expected %s picked exactly %d times, got %d", a, workers*picks/len(addrs), got)
+		}
+	}
+
+	// Failures, breakers and recovery still steer the lock-free picks
+	b.MarkFailure("rr-b:1")
+	for i := 0; i < 8; i++ {
+		if got := b.Next("rr", addrs); got == "rr-b:1" {
+			t.Fatalf("Expected the cooled-down upstream skipped, got %s", got)
+		}
+	}
+	if !b.TripBreaker("rr-c:1", time.Minute) {
+		t.Fatal("Expected rr-c:1 to be a known upstream")
+	}
+	for i := 0; i < 8; i++ {
+		if got := b.Next("rr", addrs); got == "rr-b:1" || got == "rr-c:1" {
+			t.Fatalf("Expected only rr-a:1 and rr-d:1 picked, got %s", got)
+		}
+	}
+	b.ResetBreaker("rr-c:1")
+	seen := map[string]bool{}
+	for i := 0; i < 8; i++ {
+		seen[b.Next("rr", addrs)] = true
+	}
+	if !seen["rr-c:1"] || seen["rr-b:1"] {
+		t.Errorf("Expected rr-c:1 back after the reset and rr-b:1 still out, got %v", seen)
+	}
+}
+
+func TestSyncServiceAppliesChanges(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour})
+	defer b.Close()
+	addrs := []string{"sync-a:1", "sync-b:1"}
+	b.SyncService("sync", addrs, nil)
+	b.SyncService("sync", slices.Clone(addrs), nil) // unchanged: nothing to apply
+
+	// New weights take effect: a weight of 0 drains sync-a
+	b.SyncService("sync", addrs, map[string]int{"sync-a:1": 0, "sync-b:1": 1})
+	for i := 0; i < 4; i++ {
+		if got := b.Next("sync", addrs); got != "sync-b:1" {
+			t.Fatalf("Expected the drained upstream skipped, got %s", got)
+		}
+	}
+
+	// Dropping the weights restores plain round-robin
+	b.SyncService("sync", addrs, nil)
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[b.Next("sync", addrs)] = true
+	}
+	if !seen["sync-a:1"] || !seen["sync-b:1"] {
+		t.Errorf("Expected both upstreams picked without weights, got %v", seen)
+	}
+
+	// An address that leaves the service is forgotten
+	b.SyncService("sync", addrs[1:], nil)
+	if _, ok := b.UpstreamSnapshot()["sync"]["sync-a:1"]; ok {
+		t.Error("Expected sync-a:1 dropped after it left the service")
+	}
+}
+
+// BenchmarkNext picks upstreams of one service from many goroutines, the
+// contention a busy proxy puts on the balancer. "next" measures Next alone;
+// "resolve" also records the resolved addresses first, as the proxy's resolver
+// does on every request.
+func BenchmarkNext(b *testing.B) {
+	bal := balancer.New(balancer.Options{HealthInterval: time.Hour})
+	defer bal.Close()
+	addrs := make([]string, 8)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("bench-%d:80", i)
+	}
+	bal.SyncService("bench", addrs, nil)
+
+	b.Run("next", func(b *testing.B) {
+		b.SetParallelism(8)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				bal.Next("bench", addrs)
+			}
+		})
+	})
+	b.Run("resolve", func(b *testing.B) {
+		b.SetParallelism(8)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				resolved := slices.Clone(addrs) // each lookup returns a fresh slice
+				bal.SyncService("bench", resolved, nil)
+				bal.Next("bench", resolved)
+			}
+		})
+	})
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+func TestServiceShrinkClearsUpstreamState(t *testing.T) {
+	health := func(service, upstream string) map[string]string {
+		return map[string]string{"service": service, "upstream": upstream}
+	}
+	breaker := func(upstream string) map[string]string { return map[string]string{"upstream": upstream} }
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, FailureThreshold: 2, OpenDuration: time.Minute})
+	defer b.Close()
+	b.SetServiceAddrs("shrink", []string{"shrink-a:1", "shrink-b:1"})
+	b.SetServiceAddrs("other", []string{"shrink-a:1"})
+
+	b.MarkFailure("shrink-a:1")
+	b.MarkFailure("shrink-b:1")
+	if len(metricSeries(t, "charon_upstream_health", health("shrink", "shrink-b:1"))) != 1 || len(metricSeries(t, "charon_circuit_breaker_state", breaker("shrink-b:1"))) != 1 {
+		t.Fatalf("Expected health and breaker series for shrink-b:1")
+	}
+
+	b.SetServiceAddrs("shrink", []string{"shrink-a:1"})
+	if len(metricSeries(t, "charon_upstream_health", health("shrink", "shrink-b:1"))) != 0 {
+		t.Error("Expected the health series of a removed upstream deleted")
+	}
+	if len(metricSeries(t, "charon_circuit_breaker_state", breaker("shrink-b:1"))) != 0 {
+		t.Error("Expected the breaker series of a removed upstream deleted")
+	}
+
+	// Re-added later, it starts over: one more failure does not reach the threshold
+	b.SetServiceAddrs("shrink", []string{"shrink-a:1", "shrink-b:1"})
+	b.MarkFailure("shrink-b:1")
+	if metricValue(t, "charon_circuit_breaker_state", breaker("shrink-b:1")) != 0 {
+		t.Errorf("Expected a re-added upstream to start with a fresh breaker")
+	}
+
+	// shrink-a:1 is still an upstream of "other", so only its "shrink" health series goes
+	b.SetServiceAddrs("shrink", []string{"shrink-b:1"})
+	if len(metricSeries(t, "charon_upstream_health", health("shrink", "shrink-a:1"))) != 0 {
+		t.Error("Expected the shrink/shrink-a:1 health series deleted")
+	}
+	if len(metricSeries(t, "charon_upstream_health", health("other", "shrink-a:1"))) != 1 || metricValue(t, "charon_circuit_breaker_state", breaker("shrink-a:1")) != 0 {
+		t.Errorf("Expected the state of an upstream still used by another service kept")
+	}
+	b.MarkFailure("shrink-a:1")
+	if metricValue(t, "charon_circuit_breaker_state", breaker("shrink-a:1")) != 1 {
+		t.Errorf("Expected the failure count of a shared upstream kept (second failure trips)")
+	}
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/logging"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// streamBody hides the length of s so the request is sent chunked
+type streamBody struct{ io.Reader }
+
+func startBodyLimitProxy(t *testing.T, limit int64, rules []config.RouteRule) (string, *atomic.Int32) {
+	t.Helper()
+	failures := &atomic.Int32{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		_, _ = io.WriteString(w, strings.Repeat("x", int(n)))
+	}))
+	t.Cleanup(backend.Close)
+
+	opts := []func(*proxy.HTTPProxy){func(p *proxy.HTTPProxy) {
+		p.MaxRequestBodyBytes = limit
+		p.OnUpstreamError = func(string, string) { failures.Add(1) }
+	}}
+	if rules != nil {
+		opts = append(opts, withRoutes(t, rules))
+	}
+	listenAddr, _ := startProxy(t, backend.URL, opts...)
+	return listenAddr, failures
+}
+
+func postSize(t *testing.T, addr, path string, size int, chunked bool) int {
+	t.Helper()
+	var body io.Reader = strings.NewReader(strings.Repeat("a", size))
+	if chunked {
+		body = streamBody{body}
+	}
+	resp, err := http.Post("http://"+addr+path, "text/plain", body)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	addr, failures := startBodyLimitProxy(t, 1024, nil)
+	for _, chunked := range []bool{false, true} {
+		if got := postSize(t, addr, "/", 1024, chunked); got != http.StatusOK {
+			t.Errorf("chunked=%v: body at the limit got %d, want 200", chunked, got)
+		}
+		if got := postSize(t, addr, "/", 1025, chunked); got != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked=%v: body over the limit got %d, want 413", chunked, got)
+		}
+	}
+	if n := failures.Load(); n != 0 {
+		t.Errorf("Oversized bodies counted %d upstream failures", n)
+	}
+	if got := metricValue(t, "charon_http_requests_total", map[string]string{"status": "413"}); got < 2 {
+		t.Errorf("Expected 413s in request metrics, got %v", got)
+	}
+}
+
+func TestRequestBodyLimitPerRoute(t *testing.T) {
+	addr, _ := startBodyLimitProxy(t, 100, []config.RouteRule{{PathPrefix: "/upload", MaxRequestBodyBytes: 4096}})
+	if got := postSize(t, addr, "/upload", 4000, true); got != http.StatusOK {
+		t.Errorf("Route override: got %d, want 200", got)
+	}
+	if got := postSize(t, addr, "/other", 200, true); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("Global limit: got %d, want 413", got)
+	}
+}
+
+func TestCompressedRequestBodyRejections(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	path := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := logging.NewAccessLogger(logging.AccessLogOptions{Path: path, Format: logging.AccessFormatJSON})
+	if err != nil {
+		t.Fatalf("Failed to open access log: %v", err)
+	}
+	defer accessLog.Close()
+
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, []config.RouteRule{{
+		PathPrefix:              "/upload",
+		CompressUpstreamRequest: &config.RouteCompressConfig{MinBytes: 10},
+	}}), func(p *proxy.HTTPProxy) {
+		p.MaxRequestBodyBytes = 1024
+		p.AccessLog = accessLog
+	})
+
+	// A chunked body passes the Content-Length check and fails while being compressed
+	tooLarge := metricValue(t, "charon_http_requests_total", map[string]string{"status": "413"})
+	if got := postSize(t, addr, "/upload", 2000, true); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a chunked body over the limit, got %d", got)
+	}
+	if got := metricValue(t, "charon_http_requests_total", map[string]string{"status": "413"}) - tooLarge; got != 1 {
+		t.Errorf("Expected the 413 in request metrics, got %v", got)
+	}
+
+	// A body cut short by the client cannot be read: 400
+	badRequest := metricValue(t, "charon_http_requests_total", map[string]string{"status": "400"})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	_, _ = io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: charon\r\nTransfer-Encoding: chunked\r\n\r\n20\r\ntruncated")
+	_ = conn.(*net.TCPConn).CloseWrite()
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a truncated body, got %d", resp.StatusCode)
+	}
+	if got := metricValue(t, "charon_http_requests_total", map[string]string{"status": "400"}) - badRequest; got != 1 {
+		t.Errorf("Expected the 400 in request metrics, got %v", got)
+	}
+
+	lines := accessLines(t, path, 2)
+	for i, want := range []float64{413, 400} {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &entry); err != nil {
+			t.Fatalf("Expected a JSON line, got %q: %v", lines[i], err)
+		}
+		if entry["status"] != want || entry["size_bytes"] == float64(0) {
+			t.Errorf("Expected an access log entry with status %v and a body, got %v", want, entry)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+func TestAdminBreakerOverride(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, FailureThreshold: 2, OpenDuration: time.Minute})
+	defer b.Close()
+	addrs := []string{"manual-a:1", "manual-b:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.MarkFailure(addrs[1])
+
+	mux := http.NewServeMux()
+	(&admin.Server{Breakers: b}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	post := func(path, body string) int {
+		t.Helper()
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post("/admin/breaker/manual-a:1/trip", `{"duration":"10m"}`); status != http.StatusOK {
+		t.Fatalf("Expected 200 from trip, got %d", status)
+	}
+	if !breakerOpen(b, "svc", addrs) || metricValue(t, "charon_circuit_breaker_state", map[string]string{"upstream": addrs[0]}) != 1 {
+		t.Errorf("Expected the breaker open after a manual trip")
+	}
+	if got := metricValue(t, "charon_circuit_breaker_open_duration_seconds", map[string]string{"upstream": addrs[0]}); got != 600 {
+		t.Errorf("Expected the requested 10m open duration, got %vs", got)
+	}
+
+	if status := post("/admin/breaker/manual-a:1/reset", ""); status != http.StatusOK {
+		t.Fatalf("Expected 200 from reset, got %d", status)
+	}
+	if breakerOpen(b, "svc", addrs) || metricValue(t, "charon_circuit_breaker_state", map[string]string{"upstream": addrs[0]}) != 0 {
+		t.Errorf("Expected the breaker closed after a manual reset")
+	}
+	// the failure count was cleared too: one more failure does not trip it
+	b.MarkFailure(addrs[0])
+	if breakerOpen(b, "svc", addrs) {
+		t.Errorf("Expected reset to clear the failure count")
+	}
+
+	if status := post("/admin/breaker/manual-a:1/trip", ""); status != http.StatusOK {
+		t.Errorf("Expected a trip without a body to use the open duration, got %d", status)
+	}
+	if status := post("/admin/breaker/manual-a:1/trip", `{"duration":"soon"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid duration, got %d", status)
+	}
+	for _, action := range []string{"trip", "reset"} {
+		if status := post("/admin/breaker/unknown:1/"+action, ""); status != http.StatusNotFound {
+			t.Errorf("Expected 404 when trying to %s an unknown upstream, got %d", action, status)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// cachedGet sends a GET with the given header and returns X-Cache and the body
+func cachedGet(t *testing.T, url string, header http.Header) (string, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.Header.Get("X-Cache"), string(body)
+}
+
+func TestCacheHitStaleMiss(t *testing.T) {
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = io.WriteString(w, "catalog")
+	}))
+	defer backend.Close()
+	rules := []config.RouteRule{
+		{PathPrefix: "/swr", Cache: &config.RouteCacheConfig{TTL: "200ms", StaleWhileRevalidate: "1m"}},
+		{PathPrefix: "/short", Cache: &config.RouteCacheConfig{TTL: "100ms"}},
+	}
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, rules))
+	base := "http://" + addr
+
+	if st, body := cachedGet(t, base+"/swr", nil); st != "MISS" || body != "catalog" {
+		t.Fatalf("Expected a MISS first, got %s %q", st, body)
+	}
+	if st, _ := cachedGet(t, base+"/swr", nil); st != "HIT" || calls.Load() != 1 {
+		t.Fatalf("Expected a HIT without an upstream call, got %s after %d calls", st, calls.Load())
+	}
+
+	// Past the TTL the stale entry is served while it is refreshed in the background
+	time.Sleep(250 * time.Millisecond)
+	if st, body := cachedGet(t, base+"/swr", nil); st != "STALE" || body != "catalog" {
+		t.Fatalf("Expected a STALE answer, got %s %q", st, body)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond) // let the refreshed entry be stored
+	if st, _ := cachedGet(t, base+"/swr", nil); st != "HIT" {
+		t.Errorf("Expected a HIT after the revalidation, got %s", st)
+	}
+
+	// Without stale-while-revalidate an expired entry is a MISS
+	cachedGet(t, base+"/short", nil)
+	time.Sleep(150 * time.Millisecond)
+	if st, _ := cachedGet(t, base+"/short", nil); st != "MISS" {
+		t.Errorf("Expected an expired entry to MISS, got %s", st)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/any" {
+			w.Header().Set("Vary", "*")
+		} else {
+			w.Header().Set("Vary", "Accept-Language")
+		}
+		_, _ = io.WriteString(w, "lang="+r.Header.Get("Accept-Language"))
+	}))
+	defer backend.Close()
+	rules := []config.RouteRule{
+		{PathPrefix: "/", Cache: &config.RouteCacheConfig{TTL: "1m"}},
+	}
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, rules))
+	base := "http://" + addr
+	en := http.Header{"Accept-Language": {"en"}}
+	fr := http.Header{"Accept-Language": {"fr"}}
+
+	cases := []struct {
+		header    http.Header
+		wantCache string
+		wantBody  string
+	}{
+		{en, "MISS", "lang=en"},
+		{fr, "MISS", "lang=fr"}, // not served the English variant
+		{en, "HIT", "lang=en"},
+		{fr, "HIT", "lang=fr"},
+		{nil, "MISS", "lang="},
+	}
+	for i, c := range cases {
+		if st, body := cachedGet(t, base+"/page", c.header); st != c.wantCache || body != c.wantBody {
+			t.Errorf("Request %d: expected %s %q, got %s %q", i, c.wantCache, c.wantBody, st, body)
+		}
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected one upstream call per variant, got %d", calls.Load())
+	}
+
+	// Vary: * is never served from the cache
+	cachedGet(t, base+"/any", nil)
+	if st, _ := cachedGet(t, base+"/any", nil); st != "MISS" {
+		t.Errorf("Expected a Vary: * response not cached, got %s", st)
+	}
+}
+
+func TestCacheMissCoalescing(t *testing.T) {
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = io.WriteString(w, "expensive")
+	}))
+	defer backend.Close()
+	rules := []config.RouteRule{
+		{PathPrefix: "/", Cache: &config.RouteCacheConfig{TTL: "1m"}},
+	}
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, rules))
+
+	const clients = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	results := map[string]int{}
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st, body := cachedGet(t, "http://"+addr+"/report", nil)
+			mu.Lock()
+			results[st+" "+body]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Errorf("Expected concurrent misses to share one upstream call, got %d", calls.Load())
+	}
+	if results["MISS expensive"] != 1 || results["HIT expensive"] != clients-1 {
+		t.Errorf("Expected one MISS and the rest served from its fill, got %v", results)
+	}
+}
+
+func TestCacheSizeLimits(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := 1000
+		if strings.HasSuffix(r.URL.Path, "/big") {
+			size = 2000
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, strings.Repeat("x", size))
+	}))
+	defer backend.Close()
+	// Entries are a 1000 byte body plus headers: two fit, a third does not
+	addr, _ := startProxy(t, backend.URL,
+		withRoutes(t, []config.RouteRule{{PathPrefix: "/cache", Cache: &config.RouteCacheConfig{TTL: "1m"}}}),
+		func(p *proxy.HTTPProxy) {
+			p.CacheMaxEntryBytes = 1500
+			p.CacheMaxSizeBytes = 2500
+		})
+	base := "http://" + addr + "/cache"
+	expect := func(path, want string) {
+		t.Helper()
+		if st, _ := cachedGet(t, base+path, nil); st != want {
+			t.Errorf("GET %s: expected %s, got %s", path, want, st)
+		}
+	}
+
+	// A response over max_entry_bytes is passed through but never stored
+	skipped := metricValue(t, "charon_cache_skipped_too_large_total", nil)
+	expect("/big", "MISS")
+	expect("/big", "MISS")
+	if got := metricValue(t, "charon_cache_skipped_too_large_total", nil) - skipped; got != 2 {
+		t.Errorf("Expected both oversized responses counted as skipped, got %v", got)
+	}
+
+	evictions := metricValue(t, "charon_cache_evictions_total", nil)
+	expect("/a", "MISS")
+	expect("/b", "MISS")
+	expect("/a", "HIT") // /b is now the least recently used
+	if got := metricValue(t, "charon_cache_evictions_total", nil) - evictions; got != 0 {
+		t.Fatalf("Expected no evictions while within max_size_bytes, got %v", got)
+	}
+
+	// Storing /c goes over max_size_bytes and evicts /b, not the recently read /a
+	expect("/c", "MISS")
+	if got := metricValue(t, "charon_cache_evictions_total", nil) - evictions; got != 1 {
+		t.Errorf("Expected 1 eviction, got %v", got)
+	}
+	expect("/a", "HIT")
+	expect("/c", "HIT")
+
+	// An authenticated response fits but is never stored, so it evicts nothing
+	evictions = metricValue(t, "charon_cache_evictions_total", nil)
+	private := http.Header{"Authorization": {"Bearer token"}}
+	for i := 0; i < 2; i++ {
+		if st, _ := cachedGet(t, base+"/account", private); st != "MISS" {
+			t.Errorf("GET /account with credentials: expected MISS, got %s", st)
+		}
+	}
+	if got := metricValue(t, "charon_cache_evictions_total", nil) - evictions; got != 0 {
+		t.Errorf("Expected no evictions for an unstored response, got %v", got)
+	}
+	expect("/a", "HIT")
+	expect("/c", "HIT")
+	expect("/b", "MISS")
+}
+
+func TestCacheAuthenticatedRequests(t *testing.T) {
+	var calls atomic.Int64
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if strings.HasSuffix(r.URL.Path, "/public") {
+			w.Header().Set("Cache-Control", "public, max-age=60")
+		}
+		_, _ = io.WriteString(w, fmt.Sprintf("account data %d", n))
+	}))
+	defer backend.Close()
+	keys, err := auth.NewAPIKeyAuth("", "", []string{"/account"}, []auth.Key{{Name: "alice", Key: "alice-key"}, {Name: "bob", Key: "bob-key"}}, "")
+	if err != nil {
+		t.Fatalf("Failed to create API key auth: %v", err)
+	}
+	rules := []config.RouteRule{
+		{PathPrefix: "/account", Cache: &config.RouteCacheConfig{TTL: "1m"}},
+		{PathPrefix: "/open", Cache: &config.RouteCacheConfig{TTL: "1m"}},
+	}
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+		p.APIKeys = keys
+	})
+	base := "http://" + addr + "/account"
+	open := "http://" + addr + "/open"
+	alice := http.Header{auth.DefaultHeader: {"alice-key"}}
+	bob := http.Header{auth.DefaultHeader: {"bob-key"}}
+
+	// Bob must never be served the response Alice's request fetched
+	_, aliceBody := cachedGet(t, base+"/private", alice)
+	if st, body := cachedGet(t, base+"/private", bob); st != "MISS" || body == aliceBody {
+		t.Errorf("Expected another caller's response not served from the cache, got %s %q", st, body)
+	}
+	if st, body := cachedGet(t, base+"/private", alice); st != "MISS" || body == aliceBody {
+		t.Errorf("Expected an authenticated response never stored, got %s %q", st, body)
+	}
+
+	// Credentials the proxy does not check itself count too
+	bearer := http.Header{"Authorization": {"Bearer token"}}
+	cachedGet(t, open+"/bearer", bearer)
+	if st, _ := cachedGet(t, open+"/bearer", bearer); st != "MISS" {
+		t.Errorf("Expected a response to an Authorization request never stored, got %s", st)
+	}
+	cachedGet(t, open+"/anonymous", nil)
+	if st, _ := cachedGet(t, open+"/anonymous", nil); st != "HIT" {
+		t.Errorf("Expected an anonymous response stored, got %s", st)
+	}
+
+	// Unless the upstream marks it shareable
+	_, aliceBody = cachedGet(t, base+"/public", alice)
+	if st, body := cachedGet(t, base+"/public", bob); st != "HIT" || body != aliceBody {
+		t.Errorf("Expected a Cache-Control: public response shared, got %s %q", st, body)
+	}
+}
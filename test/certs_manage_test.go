@@ -0,0 +1,115 @@
+package test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	tlsutils "github.com/0xReLogic/Charon/internal/tls"
+)
+
+// certSerials returns the serial of each certificate in dir by name
+func certSerials(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	infos, err := tlsutils.InspectCerts(dir)
+	if err != nil {
+		t.Fatalf("InspectCerts failed: %v", err)
+	}
+	serials := map[string]string{}
+	for _, c := range infos {
+		serials[c.Name] = c.Serial
+	}
+	return serials
+}
+
+func TestCertsInitAndInfo(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := tlsutils.NewCertManager(dir); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	infos, err := tlsutils.InspectCerts(dir)
+	if err != nil || len(infos) != 3 {
+		t.Fatalf("Expected three certificates, got %v (%v)", infos, err)
+	}
+	ca, server, client := infos[0], infos[1], infos[2]
+	if ca.Name != "ca" || server.Name != "server" || client.Name != "client" {
+		t.Errorf("Unexpected certificate order: %s, %s, %s", ca.Name, server.Name, client.Name)
+	}
+	if server.Issuer != ca.Subject || client.Issuer != ca.Subject {
+		t.Errorf("Expected the server and client certificates issued by the CA")
+	}
+	if !server.NotAfter.After(server.NotBefore) || len(server.DNSNames)+len(server.IPs) == 0 {
+		t.Errorf("Expected a valid server certificate with SANs, got %+v", server)
+	}
+
+	// A second init keeps the existing files
+	before := certSerials(t, dir)
+	if _, err := tlsutils.NewCertManager(dir); err != nil {
+		t.Fatalf("second init failed: %v", err)
+	}
+	if after := certSerials(t, dir); after["ca"] != before["ca"] || after["server"] != before["server"] {
+		t.Errorf("Expected init to keep existing certificates, got %v then %v", before, after)
+	}
+
+	if _, err := tlsutils.InspectCerts(t.TempDir()); err == nil {
+		t.Error("Expected info on an empty directory to fail")
+	}
+}
+
+func TestCertsRotate(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := tlsutils.NewCertManager(dir); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	before := certSerials(t, dir)
+
+	if _, err := tlsutils.RotateCerts(dir, false); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	after := certSerials(t, dir)
+	if after["ca"] != before["ca"] {
+		t.Error("Expected the CA kept without --ca")
+	}
+	if after["server"] == before["server"] || after["client"] == before["client"] {
+		t.Errorf("Expected new server and client certificates, got %v then %v", before, after)
+	}
+
+	if _, err := tlsutils.RotateCerts(dir, true); err != nil {
+		t.Fatalf("rotate --ca failed: %v", err)
+	}
+	infos, _ := tlsutils.InspectCerts(dir)
+	if infos[0].Serial == after["ca"] || infos[1].Issuer != infos[0].Subject {
+		t.Errorf("Expected a new CA issuing the server certificate, got %+v", infos)
+	}
+
+	// Nothing is left over from the rotations
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 6 {
+		t.Errorf("Expected only the six certificate files, got %v", entries)
+	}
+}
+
+func TestCertsRotateFailureKeepsFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := tlsutils.NewCertManager(dir); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	serverCert, _ := os.ReadFile(filepath.Join(dir, "server-cert.pem"))
+	serverKey, _ := os.ReadFile(filepath.Join(dir, "server-key.pem"))
+	if err := os.WriteFile(filepath.Join(dir, "ca-key.pem"), []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("Failed to corrupt the CA key: %v", err)
+	}
+
+	if _, err := tlsutils.RotateCerts(dir, false); err == nil {
+		t.Fatal("Expected the rotation to fail with an unusable CA key")
+	}
+	cert, _ := os.ReadFile(filepath.Join(dir, "server-cert.pem"))
+	key, _ := os.ReadFile(filepath.Join(dir, "server-key.pem"))
+	if !bytes.Equal(cert, serverCert) || !bytes.Equal(key, serverKey) {
+		t.Error("Expected the server certificate and key untouched by the failed rotation")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 6 {
+		t.Errorf("Expected no temporary files left, got %v", entries)
+	}
+}
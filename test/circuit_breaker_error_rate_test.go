@@ -0,0 +1,185 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// breakerOpen reports whether Next skips addrs[0]. addrs[1] is failed once so
+// passive health does not decide the pick, only the breaker of addrs[0].
+func breakerOpen(b *balancer.Balancer, svc string, addrs []string) bool {
+	for i := 0; i < 4; i++ {
+		if b.Next(svc, addrs) == addrs[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCircuitBreakerErrorRate(t *testing.T) {
+	newBalancer := func(mode string, window time.Duration) (*balancer.Balancer, []string) {
+		b := balancer.New(balancer.Options{
+			HealthInterval:        time.Hour,
+			FailureThreshold:      3,
+			OpenDuration:          time.Minute,
+			BreakerMode:           mode,
+			BreakerErrorThreshold: 30,
+			BreakerWindow:         window,
+			BreakerMinRequests:    10,
+		})
+		t.Cleanup(b.Close)
+		addrs := []string{"flaky:1", "spare:1"}
+		b.SetServiceAddrs("svc", addrs)
+		b.MarkFailure(addrs[1])
+		return b, addrs
+	}
+	// every third request fails: never 3 in a row, but 33% of them
+	mixed := func(b *balancer.Balancer, addr string) {
+		b.MarkSuccess(addr)
+		b.MarkSuccess(addr)
+		b.MarkFailure(addr)
+	}
+
+	b, addrs := newBalancer(balancer.BreakerConsecutive, time.Minute)
+	for i := 0; i < 10; i++ {
+		mixed(b, addrs[0])
+	}
+	if breakerOpen(b, "svc", addrs) {
+		t.Errorf("Expected interleaved successes to keep a consecutive breaker closed")
+	}
+
+	b, addrs = newBalancer(balancer.BreakerErrorRate, time.Minute)
+	for i := 0; i < 3; i++ {
+		mixed(b, addrs[0])
+	}
+	if breakerOpen(b, "svc", addrs) {
+		t.Fatalf("Expected no trip below min_requests (9 requests)")
+	}
+	mixed(b, addrs[0])
+	if !breakerOpen(b, "svc", addrs) {
+		t.Errorf("Expected 4 of 12 failed requests (33%%) to trip a 30%% breaker")
+	}
+
+	// outcomes older than the window no longer count
+	b, addrs = newBalancer(balancer.BreakerErrorRate, 200*time.Millisecond)
+	for i := 0; i < 3; i++ {
+		mixed(b, addrs[0])
+	}
+	time.Sleep(250 * time.Millisecond)
+	mixed(b, addrs[0])
+	if breakerOpen(b, "svc", addrs) {
+		t.Errorf("Expected requests outside the window to be forgotten")
+	}
+}
+
+func TestCircuitBreakerModeValidation(t *testing.T) {
+	cfg := loadConfigFile(t, `
+circuit_breaker:
+  mode: error_rate
+  error_threshold: 30
+  window: "30s"
+  min_requests: 50
+`)
+	cb := cfg.CircuitBreaker
+	if cb.Mode != "error_rate" || cb.ErrorThreshold != 30 || cb.Window != "30s" || cb.MinRequests != 50 {
+		t.Errorf("Unexpected circuit_breaker config %+v", cb)
+	}
+	for _, bad := range []string{"mode: percent", "error_threshold: 130", `window: "soon"`} {
+		_, err := config.LoadConfig(writeConfig(t, "circuit_breaker:\n  "+bad+"\n"))
+		if err == nil || !strings.Contains(err.Error(), "circuit_breaker.") {
+			t.Errorf("Expected %q rejected at load, got %v", bad, err)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenLimits(t *testing.T) {
+	b := balancer.New(balancer.Options{
+		HealthInterval:             time.Hour,
+		FailureThreshold:           2,
+		OpenDuration:               50 * time.Millisecond,
+		BreakerHalfOpenMaxRequests: 2,
+		BreakerSuccessThreshold:    2,
+	})
+	defer b.Close()
+	addrs := []string{"recovering:1", "spare:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.MarkFailure(addrs[1])
+	// picks counts how often 4 selections land on the recovering upstream
+	picks := func() int {
+		n := 0
+		for i := 0; i < 4; i++ {
+			if b.Next("svc", addrs) == addrs[0] {
+				n++
+			}
+		}
+		return n
+	}
+	open := func() {
+		b.MarkFailure(addrs[0])
+		b.MarkFailure(addrs[0])
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	open()
+	if n := picks(); n != 2 {
+		t.Fatalf("Expected 2 concurrent half-open trials, got %d", n)
+	}
+	b.MarkNeutral(addrs[0])
+	if n := picks(); n != 1 {
+		t.Errorf("Expected a neutral trial to free one slot, got %d picks", n)
+	}
+	b.MarkSuccess(addrs[0])
+	if n := picks(); n != 1 {
+		t.Errorf("Expected one success to stay half-open and free one slot, got %d picks", n)
+	}
+	b.MarkSuccess(addrs[0])
+	if n := picks(); n != 2 {
+		t.Errorf("Expected the breaker closed after 2 successes (round-robin again), got %d picks", n)
+	}
+
+	open()
+	picks()
+	b.MarkSuccess(addrs[0])
+	b.MarkFailure(addrs[0])
+	if n := picks(); n != 0 {
+		t.Errorf("Expected a failed trial to reopen the breaker, got %d picks", n)
+	}
+}
+
+func TestCircuitBreakerOpenBackoff(t *testing.T) {
+	b := balancer.New(balancer.Options{
+		HealthInterval:         time.Hour,
+		FailureThreshold:       1,
+		OpenDuration:           20 * time.Millisecond,
+		BreakerMaxOpenDuration: 70 * time.Millisecond,
+	})
+	defer b.Close()
+	addrs := []string{"backoff:1", "spare:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.MarkFailure(addrs[1])
+	// trial waits out the open duration and lets Next move the breaker to half-open
+	trial := func(wait time.Duration) {
+		time.Sleep(wait + 5*time.Millisecond)
+		b.Next("svc", addrs)
+	}
+
+	b.MarkFailure(addrs[0])
+	for i, want := range []float64{0.02, 0.04, 0.07, 0.07} {
+		if got := metricValue(t, "charon_circuit_breaker_open_duration_seconds", map[string]string{"upstream": addrs[0]}); got != want {
+			t.Fatalf("Open %d: expected %vs, got %vs", i+1, want, got)
+		}
+		trial(time.Duration(want * float64(time.Second)))
+		b.MarkFailure(addrs[0])
+	}
+
+	trial(70 * time.Millisecond)
+	b.MarkSuccess(addrs[0])
+	b.MarkFailure(addrs[0])
+	if got := metricValue(t, "charon_circuit_breaker_open_duration_seconds", map[string]string{"upstream": addrs[0]}); got != 0.02 {
+		t.Errorf("Expected the base open duration after a close, got %vs", got)
+	}
+}
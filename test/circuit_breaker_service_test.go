@@ -0,0 +1,145 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+func TestCircuitBreakerPerServiceThreshold(t *testing.T) {
+	b := balancer.New(balancer.Options{
+		HealthInterval:   time.Hour,
+		FailureThreshold: 5,
+		OpenDuration:     time.Minute,
+		ServiceBreakers: map[string]balancer.BreakerSettings{
+			"fragile": {FailureThreshold: 2},
+			"sturdy":  {FailureThreshold: 10},
+		},
+	})
+	defer b.Close()
+	pools := map[string][]string{
+		"fragile": {"fragile-a:1", "fragile-b:1"},
+		"sturdy":  {"sturdy-a:1", "sturdy-b:1"},
+		"plain":   {"plain-a:1", "plain-b:1"},
+	}
+	for svc, addrs := range pools {
+		b.SetServiceAddrs(svc, addrs)
+	}
+	// picked reports whether the first upstream of svc is still selected. The
+	// second one is failed once too, so only an open breaker excludes the first.
+	picked := func(svc string) bool {
+		for i := 0; i < 4; i++ {
+			if b.Next(svc, pools[svc]) == pools[svc][0] {
+				return true
+			}
+		}
+		return false
+	}
+	// tripsAt fails the first upstream of svc until its breaker opens
+	tripsAt := func(svc string) int {
+		b.MarkFailure(pools[svc][1])
+		for n := 1; n <= 20; n++ {
+			b.MarkFailure(pools[svc][0])
+			if !picked(svc) {
+				return n
+			}
+		}
+		return -1
+	}
+
+	if n := tripsAt("fragile"); n != 2 {
+		t.Errorf("Expected fragile to trip at 2 failures, tripped at %d", n)
+	}
+	if n := tripsAt("sturdy"); n != 10 {
+		t.Errorf("Expected sturdy to trip at 10 failures, tripped at %d", n)
+	}
+	if n := tripsAt("plain"); n != 5 {
+		t.Errorf("Expected a service without override to use the global 5, tripped at %d", n)
+	}
+}
+
+func TestCircuitBreakerServiceNamesIgnoreCase(t *testing.T) {
+	// Config keys arrive lowercased while registry names keep their case
+	cfg := loadConfigFile(t, "circuit_breaker:\n  failure_threshold: 5\n  services:\n    Payments:\n      failure_threshold: 2\n")
+	settings, ok := cfg.CircuitBreaker.Services["payments"]
+	if !ok || settings.FailureThreshold != 2 {
+		t.Fatalf("Expected the override loaded under its lowercased name, got %v", cfg.CircuitBreaker.Services)
+	}
+	b := balancer.New(balancer.Options{
+		HealthInterval:   time.Hour,
+		FailureThreshold: 5,
+		OpenDuration:     time.Minute,
+		ServiceBreakers:  map[string]balancer.BreakerSettings{"payments": {FailureThreshold: settings.FailureThreshold}},
+	})
+	defer b.Close()
+	addrs := []string{"pay-a:1", "pay-b:1"}
+	b.SetServiceAddrs("Payments", addrs)
+	b.MarkFailure("pay-b:1")
+	b.MarkFailure("pay-a:1")
+	b.MarkFailure("pay-a:1")
+	for i := 0; i < 4; i++ {
+		if got := b.Next("Payments", addrs); got == "pay-a:1" {
+			t.Fatal("Expected the Payments override to open the breaker after 2 failures")
+		}
+	}
+}
+
+func TestCircuitBreakerSharedUpstream(t *testing.T) {
+	b := balancer.New(balancer.Options{
+		HealthInterval:   time.Hour,
+		FailureThreshold: 5,
+		OpenDuration:     time.Minute,
+		ServiceBreakers: map[string]balancer.BreakerSettings{
+			"fragile": {FailureThreshold: 2},
+			"sturdy":  {FailureThreshold: 10},
+		},
+	})
+	defer b.Close()
+	state := func(addr string) float64 {
+		return metricValue(t, "charon_circuit_breaker_state", map[string]string{"upstream": addr})
+	}
+
+	// Both upstreams are listed by both services; "sturdy" resolved them last
+	addrs := []string{"shared-a:1", "shared-b:1"}
+	b.SetServiceAddrs("fragile", addrs)
+	b.SetServiceAddrs("sturdy", addrs)
+
+	// Failures routed for fragile trip at its threshold, not the last resolver's
+	b.MarkServiceFailure("fragile", "shared-a:1")
+	b.MarkServiceFailure("fragile", "shared-a:1")
+	if got := state("shared-a:1"); got != 1 {
+		t.Errorf("Expected fragile's 2 failures to open the shared breaker, state=%v", got)
+	}
+
+	// Once "fragile" resolved them last, failures routed for sturdy still use sturdy's
+	b.SetServiceAddrs("fragile", addrs[1:])
+	b.SetServiceAddrs("fragile", addrs)
+	for i := 0; i < 9; i++ {
+		b.MarkServiceFailure("sturdy", "shared-b:1")
+	}
+	if got := state("shared-b:1"); got != 0 {
+		t.Errorf("Expected sturdy's breaker closed below 10 failures, state=%v", got)
+	}
+	b.MarkServiceFailure("sturdy", "shared-b:1")
+	if got := state("shared-b:1"); got != 1 {
+		t.Errorf("Expected sturdy's 10th failure to open the breaker, state=%v", got)
+	}
+}
+
+func TestCircuitBreakerServiceConfigValidation(t *testing.T) {
+	for _, bad := range []string{
+		"circuit_breaker:\n  open_duration: \"soon\"\n",
+		"circuit_breaker:\n  services:\n    api:\n      open_duration: \"soon\"\n",
+		"circuit_breaker:\n  services:\n    api:\n      open_duration: \"-1s\"\n",
+		"circuit_breaker:\n  services:\n    api:\n      failure_threshold: -1\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+	if _, err := config.LoadConfig(writeConfig(t, "circuit_breaker:\n  services:\n    api:\n      open_duration: \"1m\"\n")); err != nil {
+		t.Errorf("Expected a valid override accepted, got %v", err)
+	}
+}
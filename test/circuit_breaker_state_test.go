@@ -0,0 +1,50 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+func TestCircuitBreakerStateGauge(t *testing.T) {
+	b := balancer.New(balancer.Options{
+		HealthInterval:   time.Hour,
+		FailureThreshold: 2,
+		OpenDuration:     30 * time.Millisecond,
+	})
+	defer b.Close()
+	addrs := []string{"state-a:1", "state-b:1"}
+	b.SetServiceAddrs("svc", addrs)
+	labels := map[string]string{"upstream": addrs[0], "service": "svc"}
+	expect := func(want float64, when string) {
+		t.Helper()
+		if got := metricValue(t, "charon_circuit_breaker_state", labels); got != want {
+			t.Errorf("Expected state %v %s, got %v", want, when, got)
+		}
+	}
+
+	b.MarkFailure(addrs[0])
+	expect(0, "below the threshold")
+	b.MarkFailure(addrs[0])
+	expect(1, "after tripping")
+	time.Sleep(40 * time.Millisecond)
+	b.Next("svc", addrs)
+	expect(2, "once the open duration elapsed")
+	b.MarkSuccess(addrs[0])
+	expect(0, "after a successful trial")
+
+	b.SetServiceAddrs("svc", addrs[1:])
+	if len(metricSeries(t, "charon_circuit_breaker_state", labels)) != 0 {
+		t.Error("Expected no state series once the upstream is removed")
+	}
+
+	// An upstream resolved for another service is relabelled, not duplicated
+	b.MarkFailure(addrs[1])
+	b.SetServiceAddrs("other", addrs[1:])
+	all := metricSeries(t, "charon_circuit_breaker_state", map[string]string{"upstream": addrs[1]})
+	other := metricSeries(t, "charon_circuit_breaker_state", map[string]string{"upstream": addrs[1], "service": "other"})
+	if len(all) != 1 || len(other) != 1 {
+		t.Errorf("Expected one state series for %s, under service other, got %v", addrs[1], all)
+	}
+}
@@ -0,0 +1,136 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// testCA issues certificates for the client certificate policy tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue signs a leaf certificate built from tmpl
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to issue certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertPolicy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	ca := newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	rules := []config.RouteRule{
+		{PathPrefix: "/cn", ServiceName: "app", ClientCert: &config.ClientCertConfig{AllowedCN: []string{"billing"}}},
+		{PathPrefix: "/ou", ServiceName: "app", ClientCert: &config.ClientCertConfig{AllowedOU: []string{"payments"}}},
+		{PathPrefix: "/san", ServiceName: "app", ClientCert: &config.ClientCertConfig{AllowedSAN: []string{"billing.internal"}}},
+		{PathPrefix: "/", ServiceName: "app"},
+	}
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+		p.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{ca.issue(t, &x509.Certificate{
+				Subject:     pkix.Name{CommonName: "charon"},
+				IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+			}, x509.ExtKeyUsageServerAuth)},
+			ClientCAs:  pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			MinVersion: tls.VersionTLS12,
+		}
+	})
+
+	matching := ca.issue(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "billing", OrganizationalUnit: []string{"payments"}},
+		DNSNames: []string{"billing.internal"},
+	}, x509.ExtKeyUsageClientAuth)
+	other := ca.issue(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "reports", OrganizationalUnit: []string{"analytics"}},
+		DNSNames: []string{"reports.internal"},
+	}, x509.ExtKeyUsageClientAuth)
+
+	status := func(cert *tls.Certificate, path string) int {
+		t.Helper()
+		cfg := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+		if cert != nil {
+			cfg.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}, Timeout: 5 * time.Second}
+		resp, err := client.Get("https://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cases := []struct {
+		name string
+		cert *tls.Certificate
+		path string
+		want int
+	}{
+		{"cn allowed", &matching, "/cn", http.StatusOK},
+		{"cn denied", &other, "/cn", http.StatusForbidden},
+		{"ou allowed", &matching, "/ou", http.StatusOK},
+		{"ou denied", &other, "/ou", http.StatusForbidden},
+		{"san allowed", &matching, "/san", http.StatusOK},
+		{"san denied", &other, "/san", http.StatusForbidden},
+		{"no certificate", nil, "/cn", http.StatusForbidden},
+		{"no policy", nil, "/open", http.StatusOK},
+	}
+	for _, c := range cases {
+		if got := status(c.cert, c.path); got != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+	tlsutils "github.com/0xReLogic/Charon/internal/tls"
+)
+
+func TestClientIdentityHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Seen-CN", r.Header.Get("X-Client-CN"))
+		w.Header().Set("Seen-SAN", r.Header.Get("X-Client-SAN"))
+		w.Header().Set("Seen-Service", r.Header.Get("X-Service-Identity"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	resolver := func(r *http.Request) (*url.URL, error) { return u, nil }
+
+	certManager, err := tlsutils.NewCertManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create cert manager: %v", err)
+	}
+
+	// mTLS listener: the verified identity replaces spoofed headers
+	tlsAddr, _ := startProxy(t, "", func(p *proxy.HTTPProxy) {
+		p.Resolver = resolver
+		p.TLSConfig = certManager.GetServerTLSConfig()
+		p.ClientIdentity = &proxy.ClientIdentityHeaders{CN: "X-Service-Identity"}
+	})
+
+	clientConfig := certManager.GetClientTLSConfig()
+	clientConfig.ServerName = "localhost"
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 5 * time.Second}
+	req, _ := http.NewRequest("GET", "https://"+tlsAddr+"/", nil)
+	req.Header.Set("X-Service-Identity", "admin")
+	req.Header.Set("X-Client-SAN", "spoofed.example.com")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("mTLS request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Seen-Service"); got != "charon-client" {
+		t.Errorf("Expected CN from the client certificate, got %q", got)
+	}
+	if got := resp.Header.Get("Seen-SAN"); got != "" {
+		t.Errorf("Expected spoofed SAN header to be stripped, got %q", got)
+	}
+
+	// Plain HTTP: no identity, but spoofed headers are still removed
+	plainAddr, _ := startProxy(t, "", func(p *proxy.HTTPProxy) {
+		p.Resolver = resolver
+		p.ClientIdentity = &proxy.ClientIdentityHeaders{}
+	})
+
+	req, _ = http.NewRequest("GET", "http://"+plainAddr+"/", nil)
+	req.Header.Set("X-Client-CN", "admin")
+	req.Header.Set("X-Client-SAN", "spoofed.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Plain request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Seen-CN") != "" || resp.Header.Get("Seen-SAN") != "" {
+		t.Errorf("Expected identity headers to be stripped, got status %d CN %q SAN %q",
+			resp.StatusCode, resp.Header.Get("Seen-CN"), resp.Header.Get("Seen-SAN"))
+	}
+}
@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// receivedBody is what the backend saw for a single request
+type receivedBody struct {
+	encoding string
+	length   int64
+	body     string
+}
+
+// decodingBackend records each request body, transparently gunzipping it
+func decodingBackend(t *testing.T, got chan<- receivedBody) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			reader = zr
+		}
+		b, err := io.ReadAll(reader)
+		if err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		got <- receivedBody{encoding: r.Header.Get("Content-Encoding"), length: r.ContentLength, body: string(b)}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func compressRoutes(minBytes int) []config.RouteRule {
+	return []config.RouteRule{{
+		PathPrefix:              "/upload",
+		CompressUpstreamRequest: &config.RouteCompressConfig{MinBytes: minBytes},
+	}}
+}
+
+func TestCompressUpstreamRequestLargeBody(t *testing.T) {
+	got := make(chan receivedBody, 1)
+	backend := decodingBackend(t, got)
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, compressRoutes(100)))
+
+	payload := strings.Repeat("charon compresses this body ", 100)
+	resp, err := http.Post("http://"+addr+"/upload", "text/plain", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	rb := <-got
+	if rb.encoding != "gzip" {
+		t.Fatalf("Expected gzip Content-Encoding, got %q", rb.encoding)
+	}
+	if rb.body != payload {
+		t.Errorf("Decompressed body does not match the original")
+	}
+	if rb.length <= 0 || rb.length >= int64(len(payload)) {
+		t.Errorf("Expected compressed Content-Length below %d, got %d", len(payload), rb.length)
+	}
+}
+
+func TestCompressUpstreamRequestSkips(t *testing.T) {
+	got := make(chan receivedBody, 1)
+	backend := decodingBackend(t, got)
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, compressRoutes(100)))
+
+	// Below the threshold
+	resp, err := http.Post("http://"+addr+"/upload", "text/plain", strings.NewReader("small"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if rb := <-got; rb.encoding != "" || rb.body != "small" {
+		t.Errorf("Small body should pass through untouched, got %+v", rb)
+	}
+
+	// Already encoded by the client
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(strings.Repeat("x", 500)))
+	zw.Close()
+	req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/upload", &buf)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if rb := <-got; rb.body != strings.Repeat("x", 500) {
+		t.Errorf("Pre-encoded body should not be compressed twice")
+	}
+
+	// Route without compression
+	resp, err = http.Post("http://"+addr+"/other", "text/plain", strings.NewReader(strings.Repeat("y", 500)))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if rb := <-got; rb.encoding != "" {
+		t.Errorf("Route without compress_upstream_request got Content-Encoding %q", rb.encoding)
+	}
+}
+
+func TestCompressUpstreamRequestRetryReplaysBody(t *testing.T) {
+	var attempts int32
+	got := make(chan receivedBody, 1)
+	decoder := decodingBackend(t, got)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Drop the first connection mid-request to force a retry
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			_, _ = io.Copy(io.Discard, r.Body)
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		r.URL.Scheme, r.URL.Host, r.RequestURI = "http", strings.TrimPrefix(decoder.URL, "http://"), ""
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer backend.Close()
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, compressRoutes(100)))
+
+	payload := strings.Repeat("retry me ", 200)
+	req, _ := http.NewRequest(http.MethodPut, "http://"+addr+"/upload", strings.NewReader(payload))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 after retry, got %d", resp.StatusCode)
+	}
+	if n := atomic.LoadInt32(&attempts); n < 2 {
+		t.Fatalf("Expected the upstream to be retried, got %d attempts", n)
+	}
+	rb := <-got
+	if rb.encoding != "gzip" || rb.body != payload {
+		t.Errorf("Retried request did not carry a valid gzip body (encoding=%q)", rb.encoding)
+	}
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// startCompressingProxy proxies to a backend serving bodies by path
+func startCompressingProxy(t *testing.T, cfg config.CompressionConfig) string {
+	t.Helper()
+	large := strings.Repeat("charon compresses responses ", 100)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = io.WriteString(w, large)
+		case "/small":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, "tiny")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, large)
+		case "/encoded":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = io.WriteString(w, large)
+		}
+	}))
+	t.Cleanup(backend.Close)
+
+	listenAddr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.Compression = &cfg
+	})
+	return listenAddr
+}
+
+func getEncoded(t *testing.T, addr, path, acceptEncoding string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+	// Setting the header disables the client's transparent decompression
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return resp, body
+}
+
+func TestResponseCompression(t *testing.T) {
+	addr := startCompressingProxy(t, config.CompressionConfig{Enabled: true, MinLength: 100})
+
+	resp, body := getEncoded(t, addr, "/large", "gzip, deflate")
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip response, got headers %v", resp.Header)
+	}
+	if !strings.Contains(resp.Header.Get("Vary"), "Accept-Encoding") {
+		t.Error("Compressed response should vary on Accept-Encoding")
+	}
+	zr, err := gzip.NewReader(strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	if !strings.HasPrefix(string(plain), "charon compresses responses") || len(plain) <= len(body) {
+		t.Errorf("Unexpected decompressed body (%d bytes from %d)", len(plain), len(body))
+	}
+
+	for _, tc := range []struct{ path, accept string }{
+		{"/large", "identity"},
+		{"/large", "gzip;q=0"},
+		{"/small", "gzip"},
+		{"/image", "gzip"},
+	} {
+		resp, body := getEncoded(t, addr, tc.path, tc.accept)
+		if resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("%s with %q: expected no compression", tc.path, tc.accept)
+		}
+		if len(body) == 0 {
+			t.Errorf("%s with %q: empty body", tc.path, tc.accept)
+		}
+	}
+
+	// Upstream encodings are never double-compressed
+	resp, _ = getEncoded(t, addr, "/encoded", "gzip, br")
+	if got := resp.Header.Values("Content-Encoding"); len(got) != 1 || got[0] != "br" {
+		t.Errorf("Expected upstream encoding kept, got %v", got)
+	}
+}
+
+func TestResponseCompressionDisabled(t *testing.T) {
+	addr := startCompressingProxy(t, config.CompressionConfig{})
+	resp, _ := getEncoded(t, addr, "/large", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Error("Compression applied while disabled")
+	}
+}
+
+func TestResponseCompressionWithCache(t *testing.T) {
+	large := strings.Repeat("cached and compressed ", 100)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, large)
+	}))
+	defer backend.Close()
+	listenAddr, _ := startProxy(t, backend.URL, withRoutes(t, []config.RouteRule{{PathPrefix: "/", Cache: &config.RouteCacheConfig{TTL: "1m"}}}), func(p *proxy.HTTPProxy) {
+		p.Compression = &config.CompressionConfig{Enabled: true}
+	})
+
+	// The cache holds the identity body, compressed per client on the way out
+	resp, _ := getEncoded(t, listenAddr, "/doc", "gzip")
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Expected compressed cache miss")
+	}
+	resp, body := getEncoded(t, listenAddr, "/doc", "identity")
+	if resp.Header.Get("X-Cache") != "HIT" || resp.Header.Get("Content-Encoding") != "" || string(body) != large {
+		t.Fatalf("Expected plain cache hit, got %v (%d bytes)", resp.Header, len(body))
+	}
+	resp, body = getEncoded(t, listenAddr, "/doc", "gzip")
+	zr, err := gzip.NewReader(strings.NewReader(string(body)))
+	if err != nil || resp.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("Expected compressed cache hit, got %v: %v", resp.Header, err)
+	}
+	if plain, _ := io.ReadAll(zr); string(plain) != large {
+		t.Error("Compressed cache hit does not decode to the original body")
+	}
+}
+
+func TestResponseCompressionSparesUpgrades(t *testing.T) {
+	u := upgradeEchoBackend(t)
+	addr, _ := startProxy(t, u.String(), func(p *proxy.HTTPProxy) {
+		p.Compression = &config.CompressionConfig{Enabled: true}
+	})
+
+	// A WebSocket client offering gzip still gets the switched connection
+	conn, br := dialUpgrade(t, addr, "Accept-Encoding: gzip\r\n")
+	expectEcho(t, conn, br, "ping\n")
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	unblock := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-unblock
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	addr, p := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.MaxConcurrentRequests = 2
+	})
+
+	get := func(path string) (*http.Response, error) {
+		resp, err := http.Get("http://" + addr + path)
+		if err == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, err := get("/slow")
+			if err != nil {
+				done <- 0
+				return
+			}
+			done <- resp.StatusCode
+		}()
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for p.InflightRequests() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := metricValue(t, "charon_inflight_requests", nil); got < 2 {
+		t.Errorf("Expected charon_inflight_requests to count the slow requests, got %v", got)
+	}
+
+	rejected := metricValue(t, "charon_http_concurrency_rejected_total", nil)
+	resp, err := get("/fast")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("Expected 503 with Retry-After over the limit, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if got := metricValue(t, "charon_http_concurrency_rejected_total", nil) - rejected; got != 1 {
+		t.Errorf("Expected 1 rejection counted, got %v", got)
+	}
+
+	// Raising the limit at runtime admits more requests without touching those in flight
+	p.SetMaxConcurrentRequests(3)
+	if resp, err = get("/fast"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a request admitted after raising the limit, got %v %v", resp, err)
+	}
+
+	close(unblock)
+	statuses := []int{<-done, <-done}
+	if !slices.Equal(statuses, []int{http.StatusOK, http.StatusOK}) {
+		t.Errorf("Expected the admitted slow requests to complete, got %v", statuses)
+	}
+	deadline = time.Now().Add(time.Second)
+	for p.InflightRequests() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := p.InflightRequests(); n != 0 {
+		t.Errorf("Expected every slot released, %d still held", n)
+	}
+}
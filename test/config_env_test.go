@@ -0,0 +1,82 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestConfigEnvSubstitution(t *testing.T) {
+	t.Setenv("CHARON_TEST_PORT", "9443")
+	t.Setenv("CHARON_TEST_EMPTY", "")
+	path := writeConfig(t, `
+# ${CHARON_TEST_IN_COMMENT} is not expanded
+listen_port: "${CHARON_TEST_PORT}"
+target_service_addr: "${CHARON_TEST_UNSET:-127.0.0.1:9000}"
+target_service_name: "${CHARON_TEST_EMPTY:-api}"
+tracing:
+  jaeger_endpoint: "http://${CHARON_TEST_JAEGER_HOST:-localhost}:14268/api/traces"
+routes:
+  - path_prefix: "/price$$"
+    service: "cost$1"
+`)
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ListenPort != "9443" {
+		t.Errorf("Expected listen_port from env, got %q", cfg.ListenPort)
+	}
+	if cfg.TargetServiceAddr != "127.0.0.1:9000" {
+		t.Errorf("Expected default for unset variable, got %q", cfg.TargetServiceAddr)
+	}
+	if cfg.TargetServiceName != "api" {
+		t.Errorf("Expected default for empty variable, got %q", cfg.TargetServiceName)
+	}
+	if cfg.Tracing.JaegerEndpoint != "http://localhost:14268/api/traces" {
+		t.Errorf("Unexpected jaeger_endpoint %q", cfg.Tracing.JaegerEndpoint)
+	}
+	// $$ escapes a literal $, a lone $ is kept
+	if r := cfg.Routes[0]; r.PathPrefix != "/price$" || r.ServiceName != "cost$1" {
+		t.Errorf("Unexpected escaping: path_prefix=%q service=%q", r.PathPrefix, r.ServiceName)
+	}
+
+	// A literal ${...} can be written as $${...}
+	path = writeConfig(t, `listen_port: "$${NOT_EXPANDED}"`)
+	if cfg, err = config.LoadConfig(path); err != nil || cfg.ListenPort != "${NOT_EXPANDED}" {
+		t.Errorf("Expected literal ${NOT_EXPANDED}, got %q (%v)", cfg.ListenPort, err)
+	}
+}
+
+func TestConfigEnvSubstitutionErrors(t *testing.T) {
+	path := writeConfig(t, `
+listen_port: "${CHARON_TEST_MISSING_PORT}"
+target_service_addr: "${CHARON_TEST_MISSING_ADDR}"
+target_service_name: "${not-valid}"
+`)
+	_, err := config.LoadConfig(path)
+	if err == nil {
+		t.Fatal("Expected an error for unresolved variables")
+	}
+	for _, want := range []string{
+		"line 2: environment variable CHARON_TEST_MISSING_PORT is not set",
+		"line 3: environment variable CHARON_TEST_MISSING_ADDR is not set",
+		"line 4: invalid variable name",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in error, got: %v", want, err)
+		}
+	}
+}
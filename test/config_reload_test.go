@@ -0,0 +1,224 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func loadConfigFile(t *testing.T, yaml string) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadConfig(writeConfig(t, yaml))
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	return cfg
+}
+
+func TestConfigReloadableSections(t *testing.T) {
+	cur := loadConfigFile(t, `
+listen_port: "8080"
+routes:
+  - path_prefix: "/api"
+    service: "api-v1"
+rate_limit:
+  requests_per_second: 10
+tls:
+  enabled: false
+`)
+	next := loadConfigFile(t, `
+listen_port: "9090"
+routes:
+  - path_prefix: "/api"
+    service: "api-v2"
+rate_limit:
+  requests_per_second: 50
+circuit_breaker:
+  failure_threshold: 7
+tls:
+  enabled: true
+`)
+
+	if got := cur.RestartRequired(next); !slices.Equal(got, []string{"listen_port", "tls"}) {
+		t.Errorf("Expected listen_port and tls to require a restart, got %v", got)
+	}
+	applied := cur.WithReloadable(next)
+	if applied.Routes[0].ServiceName != "api-v2" || applied.RateLimit.RequestsPerSecond != 50 || applied.CircuitBreaker.FailureThreshold != 7 {
+		t.Errorf("Reloadable sections not applied: %+v", applied)
+	}
+	if applied.ListenPort != "8080" || applied.TLS.Enabled {
+		t.Errorf("Restart-only sections changed at runtime: listen_port=%q tls=%v", applied.ListenPort, applied.TLS.Enabled)
+	}
+	if cur.Routes[0].ServiceName != "api-v1" {
+		t.Error("WithReloadable modified the current config")
+	}
+	if got := cur.RestartRequired(cur); len(got) != 0 {
+		t.Errorf("Unchanged config reported %v", got)
+	}
+}
+
+func TestConfigReloadableTCPLimit(t *testing.T) {
+	cur := loadConfigFile(t, `
+tcp:
+  listen_port: "9000"
+  target_addr: "localhost:6379"
+  max_connections: 100
+`)
+	next := loadConfigFile(t, `
+tcp:
+  listen_port: "9001"
+  target_addr: "localhost:6379"
+  max_connections: 10
+`)
+
+	// Only the limit is reloadable; the rest of the section still needs a restart
+	if got := cur.RestartRequired(next); !slices.Equal(got, []string{"tcp.listen_port"}) {
+		t.Errorf("Expected tcp.listen_port to require a restart, got %v", got)
+	}
+	applied := cur.WithReloadable(next)
+	if applied.TCP.MaxConnections != 10 || applied.TCP.ListenPort != "9000" {
+		t.Errorf("Expected only tcp.max_connections applied, got %+v", applied.TCP)
+	}
+	if cur.TCP.MaxConnections != 100 {
+		t.Error("WithReloadable modified the current config")
+	}
+}
+
+func TestConfigReloadableServiceMaxRPS(t *testing.T) {
+	cur := loadConfigFile(t, `
+services:
+  payments:
+    max_rps: 10
+  legacy:
+    protocol: http
+`)
+	next := loadConfigFile(t, `
+services:
+  payments:
+    max_rps: 20
+  legacy:
+    protocol: grpc
+`)
+
+	// max_rps is reloadable per service; the rest of a service needs a restart
+	if got := cur.RestartRequired(next); !slices.Equal(got, []string{"services.legacy.protocol"}) {
+		t.Errorf("Expected services.legacy.protocol to require a restart, got %v", got)
+	}
+	applied := cur.WithReloadable(next)
+	if applied.Services["payments"].MaxRPS != 20 || applied.Services["legacy"].Protocol != "http" {
+		t.Errorf("Expected only max_rps applied, got %+v", applied.Services)
+	}
+	if cur.Services["payments"].MaxRPS != 10 {
+		t.Error("WithReloadable modified the current config")
+	}
+
+	// Adding or removing a service still needs a restart
+	added := loadConfigFile(t, `
+services:
+  payments:
+    max_rps: 20
+  legacy:
+    protocol: http
+  search:
+    max_rps: 5
+`)
+	if got := cur.RestartRequired(added); !slices.Equal(got, []string{"services"}) {
+		t.Errorf("Expected a new service to require a restart, got %v", got)
+	}
+	if _, ok := cur.WithReloadable(added).Services["search"]; ok {
+		t.Error("Expected a new service not to be applied at runtime")
+	}
+}
+
+func TestProxySetRouter(t *testing.T) {
+	seen := make(chan string, 4)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	v1, _ := routing.New([]config.RouteRule{{PathPrefix: "/api", ServiceName: "api-v1"}}, "")
+	v2, _ := routing.New([]config.RouteRule{{PathPrefix: "/api", ServiceName: "api-v2"}}, "")
+
+	listenAddr, p := startProxy(t, "", func(p *proxy.HTTPProxy) {
+		p.Resolver = func(r *http.Request) (*url.URL, error) {
+			seen <- routing.FromContext(r.Context()).Service
+			return u, nil
+		}
+		p.Router = v1
+	})
+
+	for _, want := range []string{"api-v1", "api-v2"} {
+		if want == "api-v2" {
+			p.SetRouter(v2)
+		}
+		resp, err := http.Get("http://" + listenAddr + "/api/items")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if got := <-seen; got != want {
+			t.Errorf("Expected service %q, got %q", want, got)
+		}
+	}
+}
+
+func TestPolicySetDimensions(t *testing.T) {
+	key, _ := ratelimit.ParseKey("global")
+	strict := &ratelimit.Dimension{Name: "global", Key: key, Limiter: ratelimit.NewRateLimiter(1, 1)}
+	policy := ratelimit.NewPolicy(strict)
+	policy.SetEnabled(true)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	policy.Check(req)
+	if policy.Check(req).Allowed {
+		t.Fatal("Expected the strict limit to reject the second request")
+	}
+
+	relaxed := &ratelimit.Dimension{Name: "global", Key: key, Limiter: ratelimit.NewRateLimiter(100, 100)}
+	if old := policy.SetDimensions(relaxed); len(old) != 1 || old[0] != strict {
+		t.Errorf("Expected the previous dimensions back, got %v", old)
+	}
+	if !policy.Check(req).Allowed {
+		t.Error("Replaced dimensions not enforced")
+	}
+	policy.SetDimensions()
+	if d := policy.Check(req); !d.Allowed || d.Dimension != "" {
+		t.Errorf("Expected no limits after clearing dimensions, got %+v", d)
+	}
+}
+
+func TestBalancerReconfigure(t *testing.T) {
+	b := balancer.New(balancer.Options{FailureThreshold: 3, OpenDuration: time.Minute})
+	defer b.Close()
+	addrs := []string{"a:1", "b:1"}
+	picks := func() map[string]bool {
+		got := map[string]bool{}
+		for i := 0; i < 4; i++ {
+			got[b.Next("svc", addrs)] = true
+		}
+		return got
+	}
+
+	// Both are passively unhealthy now, so only an open breaker excludes one
+	b.MarkFailure("a:1")
+	b.MarkFailure("b:1")
+	if !picks()["a:1"] {
+		t.Fatal("Breaker opened below the configured threshold")
+	}
+	b.Reconfigure(balancer.Options{FailureThreshold: 1, OpenDuration: time.Minute})
+	b.MarkFailure("a:1")
+	if picks()["a:1"] {
+		t.Error("Breaker did not open with the reloaded threshold")
+	}
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+func hashAssignments(b *balancer.Balancer, service string, addrs []string, keys int) map[string]string {
+	out := make(map[string]string, keys)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		out[key] = b.NextHash(service, addrs, key)
+	}
+	return out
+}
+
+func TestConsistentHashRemovalMovesOnlyItsKeys(t *testing.T) {
+	b := balancer.New(balancer.Options{})
+	addrs := []string{"a:1", "b:1", "c:1", "d:1"}
+	before := metricValue(t, "charon_balancer_ring_rebuilds_total", nil)
+	first := hashAssignments(b, "cache", addrs, 1000)
+
+	// Stable: the same keys map to the same upstreams, without rebuilding the ring
+	again := hashAssignments(b, "cache", []string{"d:1", "c:1", "b:1", "a:1"}, 1000)
+	for k, v := range first {
+		if again[k] != v {
+			t.Fatalf("Key %s moved from %s to %s without a membership change", k, v, again[k])
+		}
+	}
+	if got := metricValue(t, "charon_balancer_ring_rebuilds_total", nil) - before; got != 1 {
+		t.Errorf("Expected 1 ring build, got %v", got)
+	}
+
+	// Every upstream gets a reasonable share
+	share := map[string]int{}
+	for _, v := range first {
+		share[v]++
+	}
+	for _, a := range addrs {
+		if share[a] < 150 || share[a] > 350 {
+			t.Errorf("Unbalanced ring: %s owns %d of 1000 keys", a, share[a])
+		}
+	}
+
+	// Removing c:1 only moves the keys it owned
+	after := hashAssignments(b, "cache", []string{"a:1", "b:1", "d:1"}, 1000)
+	for k, v := range first {
+		if v != "c:1" && after[k] != v {
+			t.Errorf("Key %s moved from %s to %s although its upstream stayed", k, v, after[k])
+		}
+		if after[k] == "c:1" {
+			t.Errorf("Key %s still maps to removed upstream", k)
+		}
+	}
+	if got := metricValue(t, "charon_balancer_ring_rebuilds_total", nil) - before; got != 2 {
+		t.Errorf("Expected 2 ring builds after removal, got %v", got)
+	}
+}
+
+func TestConsistentHashSkipsTrippedUpstream(t *testing.T) {
+	b := balancer.New(balancer.Options{FailureThreshold: 1, OpenDuration: time.Hour})
+	addrs := []string{"a:1", "b:1", "c:1"}
+	first := hashAssignments(b, "cache", addrs, 500)
+
+	b.MarkFailure("b:1") // trips the breaker
+	after := hashAssignments(b, "cache", addrs, 500)
+	for k, v := range first {
+		switch {
+		case v == "b:1" && after[k] == "b:1":
+			t.Errorf("Key %s still routed to tripped upstream", k)
+		case v != "b:1" && after[k] != v:
+			t.Errorf("Key %s moved from %s to %s although its upstream is healthy", k, v, after[k])
+		}
+	}
+}
+
+func TestParseHashOn(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.1.2.3:5555"
+	r.Header.Set("X-Tenant", "acme")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s-42"})
+
+	for spec, want := range map[string]string{
+		"header:x-tenant": "acme",
+		"cookie:session":  "s-42",
+		"remote_ip":       "10.1.2.3",
+		"cookie:missing":  "",
+	} {
+		key, err := balancer.ParseHashOn(spec)
+		if err != nil {
+			t.Fatalf("ParseHashOn(%q): %v", spec, err)
+		}
+		if got := key(r); got != want {
+			t.Errorf("ParseHashOn(%q) = %q, want %q", spec, got, want)
+		}
+	}
+	for _, spec := range []string{"", "path", "header:"} {
+		if _, err := balancer.ParseHashOn(spec); err == nil {
+			t.Errorf("Expected error for hash_on %q", spec)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestAdminDrain(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer backend.Close()
+
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.Admin = &admin.Server{Drainer: p}
+	})
+	base := "http://" + addr
+
+	inflight := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(base + "/slow")
+		if err != nil {
+			inflight <- err.Error()
+			return
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		inflight <- string(b)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	post := func(path string) {
+		t.Helper()
+		resp, err := http.Post(base+path, "", nil)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s: expected 200, got %d", path, resp.StatusCode)
+		}
+	}
+	get := func(path string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	post("/admin/drain")
+	if v := metricValue(t, "charon_draining", nil); v != 1 {
+		t.Errorf("Expected charon_draining 1, got %v", v)
+	}
+	if resp := get("/readyz"); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 while draining, got %d", resp.StatusCode)
+	}
+	resp := get("/fast")
+	if resp.StatusCode != http.StatusServiceUnavailable || !resp.Close {
+		t.Errorf("Expected 503 with Connection: close for new requests, got %d (close=%v)", resp.StatusCode, resp.Close)
+	}
+
+	close(release)
+	if body := <-inflight; body != "done" {
+		t.Errorf("Expected the in-flight request to complete, got %q", body)
+	}
+
+	post("/admin/undrain")
+	if v := metricValue(t, "charon_draining", nil); v != 0 {
+		t.Errorf("Expected charon_draining 0, got %v", v)
+	}
+	if resp := get("/fast"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected requests to be served after undrain, got %d", resp.StatusCode)
+	}
+	if resp := get("/readyz"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected /readyz 200 after undrain, got %d", resp.StatusCode)
+	}
+}
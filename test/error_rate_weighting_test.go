@@ -0,0 +1,142 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+// newErrorRateBalancer returns a balancer with error rate weighting over the
+// upstreams good:1 and flaky:1, whose health checks always pass. good:1 probes
+// slower, so p2c settles ties the same way every time.
+func newErrorRateBalancer(t *testing.T) (*balancer.Balancer, []string) {
+	t.Helper()
+	b := balancer.New(balancer.Options{
+		HealthInterval: 10 * time.Millisecond,
+		HealthCheck: func(addr string) error {
+			if addr == "good:1" {
+				time.Sleep(2 * time.Millisecond)
+			}
+			return nil
+		},
+		HealthyThreshold:   1,
+		FailureThreshold:   1000,
+		ErrorRateWeighting: true,
+		P2CSeed:            1,
+	})
+	t.Cleanup(b.Close)
+	addrs := []string{"good:1", "flaky:1"}
+	b.SetServiceAddrs("svc", addrs)
+	return b, addrs
+}
+
+// failRequests records n failed requests to addr, then waits for its health
+// checks to bring it back, leaving only the error rate to hold it back
+func failRequests(t *testing.T, b *balancer.Balancer, addr string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		b.MarkFailure(addr)
+	}
+	if rate := b.ErrorRate(addr); rate < 0.5 {
+		t.Fatalf("Expected a high error rate for %s, got %.2f", addr, rate)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !b.UpstreamSnapshot()["svc"][addr].Healthy {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s healthy again", addr)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitProbed waits until every address has passed a health check
+func waitProbed(t *testing.T, b *balancer.Balancer, addrs []string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for _, addr := range addrs {
+		for b.HealthLatency(addr) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %s to be health checked", addr)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+// succeedRequests records n successful requests to addr, decaying its error rate
+func succeedRequests(t *testing.T, b *balancer.Balancer, addr string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		b.MarkSuccess(addr)
+	}
+	if rate := b.ErrorRate(addr); rate > 0.01 {
+		t.Fatalf("Expected the error rate of %s to decay, got %.3f", addr, rate)
+	}
+}
+
+func TestErrorRateWeightingPerStrategy(t *testing.T) {
+	strategies := map[string]func(b *balancer.Balancer, addrs []string, i int) string{
+		"round_robin": func(b *balancer.Balancer, addrs []string, _ int) string {
+			return b.Next("svc", addrs)
+		},
+		"p2c": func(b *balancer.Balancer, addrs []string, _ int) string {
+			return b.NextP2C("svc", addrs)
+		},
+		"consistent_hash": func(b *balancer.Balancer, addrs []string, i int) string {
+			return b.NextHash("svc", addrs, fmt.Sprintf("key-%d", i))
+		},
+	}
+	const picks = 2000
+	share := func(b *balancer.Balancer, addrs []string, pick func(*balancer.Balancer, []string, int) string) float64 {
+		n := 0
+		for i := 0; i < picks; i++ {
+			if pick(b, addrs, i) == "flaky:1" {
+				n++
+			}
+		}
+		return float64(n) / picks
+	}
+	for name, pick := range strategies {
+		t.Run(name, func(t *testing.T) {
+			b, addrs := newErrorRateBalancer(t)
+			waitProbed(t, b, addrs)
+			baseline := share(b, addrs, pick)
+
+			failRequests(t, b, "flaky:1", 10) // error rate ~0.65
+			if got := share(b, addrs, pick); got > baseline-0.2 {
+				t.Errorf("Expected the flaky upstream's share to drop well below %.2f, got %.2f", baseline, got)
+			}
+
+			succeedRequests(t, b, "flaky:1", 60)
+			if got := share(b, addrs, pick); got < baseline-0.1 {
+				t.Errorf("Expected the recovered upstream's share back near %.2f, got %.2f", baseline, got)
+			}
+		})
+	}
+}
+
+func TestErrorRateWeightingComposesWithLatency(t *testing.T) {
+	b, addrs := newErrorRateBalancer(t)
+	// flaky is the faster upstream, so it gets every request while it is healthy
+	b.RecordLatency("good:1", 10*time.Millisecond)
+	b.RecordLatency("flaky:1", 8*time.Millisecond)
+	if got := b.NextLatency("svc", addrs); got != "flaky:1" {
+		t.Fatalf("Expected the faster upstream picked, got %s", got)
+	}
+
+	// An error rate of ~0.65 makes its score 8ms / 0.35, worse than 10ms
+	failRequests(t, b, "flaky:1", 10)
+	for i := 0; i < 10; i++ {
+		if got := b.NextLatency("svc", addrs); got != "good:1" {
+			t.Fatalf("Expected the erroring upstream deprioritized despite its latency, got %s", got)
+		}
+	}
+
+	// As the error rate decays, its lower latency wins again
+	succeedRequests(t, b, "flaky:1", 60)
+	if got := b.NextLatency("svc", addrs); got != "flaky:1" {
+		t.Errorf("Expected the recovered faster upstream picked again, got %s", got)
+	}
+}
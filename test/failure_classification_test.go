@@ -0,0 +1,260 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestFailureClassifierDefaults(t *testing.T) {
+	c := proxy.NewFailureClassifier(config.FailureClassificationConfig{})
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	timeout := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+
+	cases := []struct {
+		name   string
+		err    error
+		status int
+		want   proxy.Outcome
+	}{
+		{"refused", refused, http.StatusBadGateway, proxy.OutcomeFailure},
+		{"timeout", timeout, http.StatusBadGateway, proxy.OutcomeFailure},
+		{"canceled", context.Canceled, http.StatusBadGateway, proxy.OutcomeNeutral},
+		{"503", nil, http.StatusServiceUnavailable, proxy.OutcomeFailure},
+		{"502 from upstream", nil, http.StatusBadGateway, proxy.OutcomeFailure},
+		{"504", nil, http.StatusGatewayTimeout, proxy.OutcomeFailure},
+		{"501", nil, http.StatusNotImplemented, proxy.OutcomeSuccess},
+		{"429", nil, http.StatusTooManyRequests, proxy.OutcomeNeutral},
+		{"404", nil, http.StatusNotFound, proxy.OutcomeSuccess},
+		{"200", nil, http.StatusOK, proxy.OutcomeSuccess},
+	}
+	for _, tc := range cases {
+		if got := c.Classify(tc.err, tc.status); got != tc.want {
+			t.Errorf("%s: expected outcome %v, got %v", tc.name, tc.want, got)
+		}
+	}
+
+	if got := proxy.ErrorClass(refused); got != proxy.ErrorRefused {
+		t.Errorf("Expected refused class, got %q", got)
+	}
+	if got := proxy.ErrorClass(timeout); got != proxy.ErrorTimeout {
+		t.Errorf("Expected timeout class, got %q", got)
+	}
+	if got := proxy.ErrorClass(errors.Join(errors.New("proxy"), context.Canceled)); got != proxy.ErrorCanceled {
+		t.Errorf("Expected canceled class, got %q", got)
+	}
+}
+
+func TestFailureClassifierConfigured(t *testing.T) {
+	c := proxy.NewFailureClassifier(config.FailureClassificationConfig{
+		FailureStatuses: []int{http.StatusTooManyRequests},
+		NeutralStatuses: []int{http.StatusServiceUnavailable},
+		NeutralErrors:   []string{proxy.ErrorTimeout},
+	})
+	if got := c.Classify(nil, http.StatusTooManyRequests); got != proxy.OutcomeFailure {
+		t.Errorf("Expected configured 429 to be a failure, got %v", got)
+	}
+	if got := c.Classify(nil, http.StatusServiceUnavailable); got != proxy.OutcomeNeutral {
+		t.Errorf("Expected configured 503 to be neutral, got %v", got)
+	}
+	if got := c.Classify(context.DeadlineExceeded, http.StatusBadGateway); got != proxy.OutcomeNeutral {
+		t.Errorf("Expected configured timeout to be neutral, got %v", got)
+	}
+	// Overriding neutral errors replaces the default list
+	if got := c.Classify(context.Canceled, http.StatusBadGateway); got != proxy.OutcomeFailure {
+		t.Errorf("Expected cancel to count once defaults are replaced, got %v", got)
+	}
+}
+
+func TestFailureClassifierTripStatuses(t *testing.T) {
+	cfg := loadConfigFile(t, "circuit_breaker:\n  trip_statuses: [503, 429]\n")
+	c := proxy.NewFailureClassifier(cfg.FailureClassification).WithTripStatuses(cfg.CircuitBreaker.TripStatuses)
+	for status, want := range map[int]proxy.Outcome{
+		http.StatusTooManyRequests:     proxy.OutcomeFailure, // no longer neutral once listed
+		http.StatusServiceUnavailable:  proxy.OutcomeFailure,
+		http.StatusInternalServerError: proxy.OutcomeSuccess,
+	} {
+		if got := c.Classify(nil, status); got != want {
+			t.Errorf("Status %d: expected outcome %v, got %v", status, want, got)
+		}
+	}
+	// Transport errors don't depend on the statuses
+	if got := c.Classify(syscall.ECONNREFUSED, http.StatusBadGateway); got != proxy.OutcomeFailure {
+		t.Errorf("Expected a refused connection to stay a failure, got %v", got)
+	}
+
+	for _, bad := range []string{
+		"circuit_breaker:\n  trip_statuses: [5000]\n",
+		"circuit_breaker:\n  trip_statuses: [429]\nfailure_classification:\n  neutral_statuses: [429]\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+
+	// A 503 from the upstream is reported exactly once
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+	failures, successes := new(int32), new(int32)
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) { p.FailureClassifier = c }, countOutcomes(failures, successes))
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := atomic.LoadInt32(failures); got != 1 {
+		t.Errorf("Expected exactly 1 failure recorded for a 503, got %d", got)
+	}
+	if got := atomic.LoadInt32(successes); got != 0 {
+		t.Errorf("Expected no successes, got %d", got)
+	}
+}
+
+// countOutcomes counts the proxy's upstream failure and success callbacks
+func countOutcomes(failures, successes *int32) func(*proxy.HTTPProxy) {
+	return func(p *proxy.HTTPProxy) {
+		p.OnUpstreamError = func(string, string) { atomic.AddInt32(failures, 1) }
+		p.OnUpstreamSuccess = func(string) { atomic.AddInt32(successes, 1) }
+	}
+}
+
+func TestFailureClassificationUpstreamStatuses(t *testing.T) {
+	status := int32(http.StatusServiceUnavailable)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer backend.Close()
+	failures, successes := new(int32), new(int32)
+	addr, _ := startProxy(t, backend.URL, countOutcomes(failures, successes))
+
+	cases := []struct {
+		status              int
+		failures, successes int32
+	}{
+		{http.StatusServiceUnavailable, 1, 0},
+		{http.StatusBadGateway, 1, 0}, // a 502 sent by the upstream itself counts too
+		{http.StatusTooManyRequests, 0, 0},
+		{http.StatusOK, 0, 1},
+	}
+	for _, tc := range cases {
+		atomic.StoreInt32(&status, int32(tc.status))
+		atomic.StoreInt32(failures, 0)
+		atomic.StoreInt32(successes, 0)
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Fatalf("Expected status %d, got %d", tc.status, resp.StatusCode)
+		}
+		if got := atomic.LoadInt32(failures); got != tc.failures {
+			t.Errorf("Status %d: expected %d failures, got %d", tc.status, tc.failures, got)
+		}
+		if got := atomic.LoadInt32(successes); got != tc.successes {
+			t.Errorf("Status %d: expected %d successes, got %d", tc.status, tc.successes, got)
+		}
+	}
+}
+
+func TestFailureClassificationConnectionRefused(t *testing.T) {
+	// Reserve a port and close it so the dial is refused
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	u := &url.URL{Scheme: "http", Host: ln.Addr().String()}
+	ln.Close()
+	failures, successes := new(int32), new(int32)
+	addr, _ := startProxy(t, u.String(), countOutcomes(failures, successes))
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected 502, got %d", resp.StatusCode)
+	}
+	if got := atomic.LoadInt32(failures); got != 1 {
+		t.Errorf("Expected refused connection to be reported once, got %d", got)
+	}
+	if got := atomic.LoadInt32(successes); got != 0 {
+		t.Errorf("Expected no successes, got %d", got)
+	}
+}
+
+func TestFailureClassificationClientCancel(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer backend.Close()
+	failures, successes := new(int32), new(int32)
+	addr, _ := startProxy(t, backend.URL, countOutcomes(failures, successes))
+
+	before := metricValue(t, "charon_http_requests_total", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/slow", nil)
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected the client request to be canceled")
+	}
+
+	// Wait for the proxy to finish handling the canceled request
+	deadline := time.Now().Add(2 * time.Second)
+	for metricValue(t, "charon_http_requests_total", nil) == before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := atomic.LoadInt32(failures); got != 0 {
+		t.Errorf("Client cancellation must not count against the upstream, got %d failures", got)
+	}
+	if got := atomic.LoadInt32(successes); got != 0 {
+		t.Errorf("Client cancellation must not count as success, got %d", got)
+	}
+}
+
+func TestProxySetFailureClassifier(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer backend.Close()
+	failures, successes := new(int32), new(int32)
+	addr, p := startProxy(t, backend.URL, countOutcomes(failures, successes))
+	get := func() {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	get()
+	if atomic.LoadInt32(failures) != 1 {
+		t.Fatalf("Expected a 500 to count as a failure by default, got %d", atomic.LoadInt32(failures))
+	}
+	// A reload that narrows circuit_breaker.trip_statuses applies to new requests
+	p.SetFailureClassifier(proxy.NewFailureClassifier(config.FailureClassificationConfig{}).WithTripStatuses([]int{503}))
+	get()
+	if atomic.LoadInt32(failures) != 1 || atomic.LoadInt32(successes) != 1 {
+		t.Errorf("Expected the 500 counted as a success after the swap, got %d failures and %d successes",
+			atomic.LoadInt32(failures), atomic.LoadInt32(successes))
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func TestRouteFallbackWhenCircuitOpen(t *testing.T) {
+	backend := func(name string) string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		}))
+		t.Cleanup(srv.Close)
+		return srv.Listener.Addr().String()
+	}
+	primary, secondary := backend("primary"), backend("secondary")
+	pools := map[string][]string{"primary": {primary}, "secondary": {secondary}}
+
+	bal := balancer.New(balancer.Options{HealthInterval: time.Hour, FailureThreshold: 1, OpenDuration: time.Minute})
+	defer bal.Close()
+	for svc, addrs := range pools {
+		bal.SetServiceAddrs(svc, addrs)
+	}
+	// Resolves like cmd/charon: routes with a fallback report ErrCircuitOpen
+	resolver := func(r *http.Request) (*url.URL, error) {
+		m := routing.FromContext(r.Context())
+		addrs := pools[m.Service]
+		if m.Rule != nil && m.Rule.Fallback != nil && bal.BreakersOpen(addrs) {
+			return nil, proxy.ErrCircuitOpen
+		}
+		return proxy.UpstreamURL(bal.Next(m.Service, addrs), false)
+	}
+	rules := []config.RouteRule{
+		{PathPrefix: "/chained", ServiceName: "primary", Fallback: &config.RouteFallbackConfig{
+			Service: "secondary", Status: 200, ContentType: "application/json", Body: `{"degraded":true}`,
+		}},
+		{PathPrefix: "/static", ServiceName: "primary", Fallback: &config.RouteFallbackConfig{Body: "down"}},
+		{PathPrefix: "/plain", ServiceName: "primary"},
+	}
+	addr, _ := startProxy(t, "", withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+		p.Resolver = resolver
+	})
+
+	get := func(path string) (int, string, string) {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), resp.Header.Get("Content-Type")
+	}
+
+	if _, body, _ := get("/chained"); body != "primary" {
+		t.Errorf("Expected the primary service while its breaker is closed, got %q", body)
+	}
+
+	before := metricValue(t, "charon_http_fallback_total", nil)
+	bal.MarkFailure(primary)
+	if _, body, _ := get("/chained"); body != "secondary" {
+		t.Errorf("Expected the fallback service, got %q", body)
+	}
+	if status, body, _ := get("/static"); status != http.StatusServiceUnavailable || body != "down" {
+		t.Errorf("Expected the static fallback with 503, got %d %q", status, body)
+	}
+	if _, body, _ := get("/plain"); body != "primary" {
+		t.Errorf("Expected a route without fallback to keep using the open upstream, got %q", body)
+	}
+
+	bal.MarkFailure(secondary)
+	status, body, contentType := get("/chained")
+	if status != http.StatusOK || body != `{"degraded":true}` || contentType != "application/json" {
+		t.Errorf("Expected the static response once the fallback service is open too, got %d %q %q", status, body, contentType)
+	}
+	if n := metricValue(t, "charon_http_fallback_total", nil) - before; n != 3 {
+		t.Errorf("Expected 3 fallback activations, got %v", n)
+	}
+
+	fb := &config.RouteFallbackConfig{Status: 1000}
+	if _, err := routing.New([]config.RouteRule{{PathPrefix: "/", Fallback: fb}}, ""); err == nil {
+		t.Error("Expected error for an invalid fallback status")
+	}
+}
@@ -0,0 +1,93 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// startForwardedProxy proxies to a backend that answers with the forwarded headers it received
+func startForwardedProxy(t *testing.T, trusted []netip.Prefix) string {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"for":   r.Header.Get("X-Forwarded-For"),
+			"proto": r.Header.Get("X-Forwarded-Proto"),
+			"host":  r.Header.Get("X-Forwarded-Host"),
+		})
+	}))
+	t.Cleanup(backend.Close)
+
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.TrustedProxies = trusted
+	})
+	return "http://" + addr
+}
+
+func forwardedHeaders(t *testing.T, base string, header http.Header) map[string]string {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, base+"/", nil)
+	req.Host = "shop.example.com"
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var got map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode backend answer: %v", err)
+	}
+	return got
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	chained := http.Header{
+		"X-Forwarded-For":   {"203.0.113.7"},
+		"X-Forwarded-Proto": {"https"},
+		"X-Forwarded-Host":  {"www.example.com"},
+	}
+	trusted, err := proxy.ParseTrustedProxies([]string{"127.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+
+	untrustedBase := startForwardedProxy(t, nil)
+	trustedBase := startForwardedProxy(t, trusted)
+	cases := []struct {
+		name   string
+		base   string
+		header http.Header
+		want   map[string]string
+	}{
+		{"direct", untrustedBase, http.Header{},
+			map[string]string{"for": "127.0.0.1", "proto": "http", "host": "shop.example.com"}},
+		{"chained untrusted", untrustedBase, chained.Clone(),
+			map[string]string{"for": "203.0.113.7, 127.0.0.1", "proto": "http", "host": "shop.example.com"}},
+		{"chained trusted", trustedBase, chained.Clone(),
+			map[string]string{"for": "203.0.113.7, 127.0.0.1", "proto": "https", "host": "www.example.com"}},
+		{"direct trusted", trustedBase, http.Header{},
+			map[string]string{"for": "127.0.0.1", "proto": "http", "host": "shop.example.com"}},
+	}
+	for _, tc := range cases {
+		got := forwardedHeaders(t, tc.base, tc.header)
+		for k, v := range tc.want {
+			if got[k] != v {
+				t.Errorf("%s: expected X-Forwarded-%s %q, got %q", tc.name, k, v, got[k])
+			}
+		}
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := proxy.ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("Expected an invalid CIDR rejected")
+	}
+	if _, err := proxy.ParseTrustedProxies([]string{"proxy.local"}); err == nil {
+		t.Errorf("Expected a hostname rejected")
+	}
+}
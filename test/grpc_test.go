@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// grpcFrame wraps msg in the gRPC length-prefixed message framing
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame
+}
+
+// startGRPCEcho serves a minimal unary gRPC echo over h2c, sending grpc-status as
+// an unannounced trailer the way gRPC servers do
+func startGRPCEcho(t *testing.T) (*httptest.Server, chan int) {
+	t.Helper()
+	protos := make(chan int, 4)
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protos <- r.ProtoMajor
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "")
+	}), &http2.Server{}))
+	t.Cleanup(srv.Close)
+	return srv, protos
+}
+
+// h2cClient speaks prior-knowledge cleartext HTTP/2, like a gRPC client without TLS
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+}
+
+// withGRPC routes the Echo service as gRPC over h2c
+func withGRPC(t *testing.T) func(*proxy.HTTPProxy) {
+	t.Helper()
+	routes := withRoutes(t, []config.RouteRule{{PathPrefix: "/echo.Echo/", Protocol: "grpc"}})
+	return func(p *proxy.HTTPProxy) {
+		routes(p)
+		p.H2C = true
+	}
+}
+
+func grpcCall(t *testing.T, addr string, msg []byte) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "http://"+addr+"/echo.Echo/Say", bytes.NewReader(grpcFrame(msg)))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := h2cClient().Do(req)
+	if err != nil {
+		t.Fatalf("gRPC call failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Reading gRPC response failed: %v", err)
+	}
+	return resp, body
+}
+
+func TestGRPCProxyH2C(t *testing.T) {
+	echo, protos := startGRPCEcho(t)
+	addr, _ := startProxy(t, echo.URL, withGRPC(t))
+
+	resp, body := grpcCall(t, addr, []byte("hello charon"))
+	if resp.ProtoMajor != 2 {
+		t.Errorf("Expected HTTP/2 to the client, got %s", resp.Proto)
+	}
+	if got := <-protos; got != 2 {
+		t.Errorf("Expected HTTP/2 to the upstream, got HTTP/%d", got)
+	}
+	if !bytes.Equal(body, grpcFrame([]byte("hello charon"))) {
+		t.Errorf("Unexpected echo body %q", body)
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != "0" {
+		t.Errorf("Expected grpc-status trailer 0, got %q (trailers %v)", got, resp.Trailer)
+	}
+}
+
+func TestGRPCProxyUnavailable(t *testing.T) {
+	// Nothing listens on the upstream address
+	addr, _ := startProxy(t, "http://"+freeAddr(t), withGRPC(t))
+
+	resp, body := grpcCall(t, addr, []byte("anyone?"))
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a Trailers-Only 200 response, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Grpc-Status"); got != "14" {
+		t.Errorf("Expected grpc-status 14 (UNAVAILABLE), got %q", got)
+	}
+	if len(body) != 0 {
+		t.Errorf("Expected no HTTP error body, got %q", body)
+	}
+}
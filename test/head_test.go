@@ -0,0 +1,130 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+// methodCountingBackend serves body for GET/HEAD and counts requests per method
+type methodCountingBackend struct {
+	mu     sync.Mutex
+	counts map[string]int
+	// Content-Encoding of the last request body seen
+	encoding string
+}
+
+func (b *methodCountingBackend) count(method string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.counts[method]
+}
+
+func startMethodCountingBackend(t *testing.T, body string) (*methodCountingBackend, *httptest.Server) {
+	t.Helper()
+	b := &methodCountingBackend{counts: map[string]int{}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		b.counts[r.Method]++
+		b.encoding = r.Header.Get("Content-Encoding")
+		b.mu.Unlock()
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Method != http.MethodHead {
+			_, _ = io.WriteString(w, body)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return b, srv
+}
+
+func doRequest(t *testing.T, method, url string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestHeadServedFromCachedGet(t *testing.T) {
+	const body = "cached catalog payload"
+	backend, srv := startMethodCountingBackend(t, body)
+	addr, _ := startProxy(t, srv.URL, withRoutes(t, []config.RouteRule{{
+		PathPrefix: "/catalog",
+		Cache:      &config.RouteCacheConfig{TTL: "1m"},
+	}}))
+
+	resp, _ := doRequest(t, http.MethodGet, "http://"+addr+"/catalog")
+	if got := resp.Header.Get("X-Cache"); got != "MISS" {
+		t.Fatalf("First GET: expected MISS, got %q", got)
+	}
+
+	resp, got := doRequest(t, http.MethodHead, "http://"+addr+"/catalog")
+	if resp.Header.Get("X-Cache") != "HIT" {
+		t.Errorf("HEAD after GET: expected HIT, got %q", resp.Header.Get("X-Cache"))
+	}
+	if resp.ContentLength != int64(len(body)) {
+		t.Errorf("HEAD Content-Length = %d, want %d", resp.ContentLength, len(body))
+	}
+	if resp.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("HEAD missing cached headers: %v", resp.Header)
+	}
+	if got != "" {
+		t.Errorf("HEAD returned a body: %q", got)
+	}
+	if n := backend.count(http.MethodHead); n != 0 {
+		t.Errorf("HEAD hit should not reach the upstream, got %d HEAD requests", n)
+	}
+}
+
+func TestHeadMissDoesNotPopulateCache(t *testing.T) {
+	const body = "fresh payload"
+	backend, srv := startMethodCountingBackend(t, body)
+	addr, _ := startProxy(t, srv.URL, withRoutes(t, []config.RouteRule{{
+		PathPrefix: "/catalog",
+		Cache:      &config.RouteCacheConfig{TTL: "1m"},
+	}}))
+
+	resp, _ := doRequest(t, http.MethodHead, "http://"+addr+"/catalog")
+	if resp.Header.Get("X-Cache") != "MISS" || resp.ContentLength != int64(len(body)) {
+		t.Fatalf("HEAD miss: X-Cache=%q Content-Length=%d", resp.Header.Get("X-Cache"), resp.ContentLength)
+	}
+	if n := backend.count(http.MethodHead); n != 1 {
+		t.Fatalf("HEAD miss should be forwarded as HEAD, got %d", n)
+	}
+
+	// The empty HEAD body must not have been stored as the GET response
+	resp, got := doRequest(t, http.MethodGet, "http://"+addr+"/catalog")
+	if resp.Header.Get("X-Cache") != "MISS" || got != body {
+		t.Errorf("GET after HEAD: X-Cache=%q body=%q", resp.Header.Get("X-Cache"), got)
+	}
+}
+
+func TestHeadWithRequestCompression(t *testing.T) {
+	const body = "compressible route"
+	backend, srv := startMethodCountingBackend(t, body)
+	addr, _ := startProxy(t, srv.URL, withRoutes(t, compressRoutes(0)))
+
+	resp, got := doRequest(t, http.MethodHead, "http://"+addr+"/upload")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if resp.ContentLength != int64(len(body)) || got != "" {
+		t.Errorf("HEAD Content-Length = %d body=%q, want %d and no body", resp.ContentLength, got, len(body))
+	}
+	backend.mu.Lock()
+	encoding := backend.encoding
+	backend.mu.Unlock()
+	if encoding != "" {
+		t.Errorf("HEAD without a body was sent with Content-Encoding %q", encoding)
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+func TestRouteHeaderRules(t *testing.T) {
+	seen := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Clone()
+		w.Header().Set("Server", "internal-backend/1.2")
+		w.Header().Set("X-Powered-By", "go")
+		w.Header().Add("X-Upstream", "a")
+	}))
+	defer backend.Close()
+
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, []config.RouteRule{{
+		PathPrefix: "/api",
+		RequestHeaders: &config.HeaderRulesConfig{
+			// viper lowercases map keys; names are canonicalized when applied
+			Set:    map[string]string{"x-internal-auth": "secret", "x-origin": "{{client_ip}} {{method}} {{path}}", "connection": "close"},
+			Add:    map[string]string{"x-tag": "charon"},
+			Remove: []string{"Cookie"},
+		},
+		ResponseHeaders: &config.HeaderRulesConfig{
+			Remove: []string{"Server", "X-Powered-By"},
+			Add:    map[string]string{"x-upstream": "b"},
+		},
+	}}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/api/items", nil)
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("X-Internal-Auth", "forged")
+	req.Header.Set("X-Tag", "client")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	got := <-seen
+	if v := got.Get("X-Internal-Auth"); v != "secret" {
+		t.Errorf("Expected injected auth header, got %q", v)
+	}
+	if v := got.Get("X-Origin"); v != "127.0.0.1 GET /api/items" {
+		t.Errorf("Unexpected templated header %q", v)
+	}
+	if v := got.Values("X-Tag"); len(v) != 2 {
+		t.Errorf("Expected appended X-Tag, got %v", v)
+	}
+	if got.Get("Cookie") != "" {
+		t.Error("Cookie should have been removed")
+	}
+	if got.Get("Connection") == "close" {
+		t.Error("Hop-by-hop header from a rule leaked upstream")
+	}
+
+	if resp.Header.Get("Server") != "" || resp.Header.Get("X-Powered-By") != "" {
+		t.Errorf("Sensitive response headers leaked: %v", resp.Header)
+	}
+	if v := resp.Header.Values("X-Upstream"); len(v) != 2 {
+		t.Errorf("Expected appended X-Upstream, got %v", v)
+	}
+
+	// Routes without rules are untouched
+	resp, err = http.Get("http://" + addr + "/other")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := <-seen; got.Get("X-Internal-Auth") != "" {
+		t.Error("Header rules applied outside their route")
+	}
+	if resp.Header.Get("Server") == "" {
+		t.Error("Response rules applied outside their route")
+	}
+}
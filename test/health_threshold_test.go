@@ -0,0 +1,167 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func waitGauge(t *testing.T, service, upstream string, want float64, timeout time.Duration) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		series := metricSeries(t, "charon_upstream_health", map[string]string{"service": service, "upstream": upstream})
+		if len(series) == 1 && series[0].GetGauge().GetValue() == want {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestHealthCheckUnhealthyThreshold(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+
+	const interval = 100 * time.Millisecond
+	b := balancer.New(balancer.Options{HealthInterval: interval, UnhealthyThreshold: 3})
+	defer b.Close()
+	b.SetServiceAddrs("threshold-svc", []string{addr})
+	if !waitGauge(t, "threshold-svc", addr, 1, 2*time.Second) {
+		t.Fatal("Expected the upstream to be reported UP after the first probe")
+	}
+
+	// Fewer than 3 failed probes must not flip the upstream DOWN
+	ln.Close()
+	time.Sleep(interval + interval/2)
+	if got := metricValue(t, "charon_upstream_health", map[string]string{"service": "threshold-svc", "upstream": addr}); got != 1 {
+		t.Errorf("Expected upstream to stay UP before the threshold is reached, gauge=%v", got)
+	}
+	if !waitGauge(t, "threshold-svc", addr, 0, 2*time.Second) {
+		t.Error("Expected upstream DOWN after 3 consecutive failed probes")
+	}
+}
+
+func TestReadySnapshot(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	b := balancer.New(balancer.Options{HealthInterval: 50 * time.Millisecond, HealthyThreshold: 1, UnhealthyThreshold: 1})
+	defer b.Close()
+	b.SetServiceAddrs("ready-svc", []string{addr})
+
+	// The readiness check of the proxy, as wired in main
+	listenAddr, _ := startProxy(t, "", func(p *proxy.HTTPProxy) {
+		p.Readiness = func() error {
+			for svc, h := range b.ReadySnapshot() {
+				if h.Healthy == 0 {
+					return fmt.Errorf("service %s has no healthy upstream", svc)
+				}
+			}
+			return nil
+		}
+	})
+	readyz := func() int {
+		resp, err := http.Get("http://" + listenAddr + "/readyz")
+		if err != nil {
+			t.Fatalf("readyz failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if !waitGauge(t, "ready-svc", addr, 0, 2*time.Second) {
+		t.Fatal("Expected the closed upstream to be reported DOWN")
+	}
+	if h := b.ReadySnapshot()["ready-svc"]; h.Healthy != 0 || h.Total != 1 {
+		t.Errorf("Expected 0/1 healthy, got %+v", h)
+	}
+	if status := readyz(); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without healthy upstreams, got %d", status)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("Could not rebind %s: %v", addr, err)
+	}
+	defer ln.Close()
+	if !waitGauge(t, "ready-svc", addr, 1, 2*time.Second) {
+		t.Fatal("Expected the upstream to be reported UP")
+	}
+	if h := b.ReadySnapshot()["ready-svc"]; h.Healthy != 1 {
+		t.Errorf("Expected 1/1 healthy, got %+v", h)
+	}
+	if status := readyz(); status != http.StatusOK {
+		t.Errorf("Expected 200 with a healthy upstream, got %d", status)
+	}
+}
+
+func TestHealthCheckMaxConcurrent(t *testing.T) {
+	var active, peak, probes atomic.Int32
+	opts := balancer.Options{
+		HealthInterval:      10 * time.Millisecond,
+		HealthMaxConcurrent: 4,
+		HealthCheck: func(addr string) error {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			probes.Add(1)
+			return nil
+		},
+	}
+	b := balancer.New(opts)
+	defer b.Close()
+	// More upstreams than the limit, spread over two services
+	for i, svc := range []string{"orders", "billing"} {
+		var addrs []string
+		for j := 0; j < 12; j++ {
+			addrs = append(addrs, fmt.Sprintf("10.0.%d.%d:80", i, j))
+		}
+		b.SetServiceAddrs(svc, addrs)
+	}
+
+	waitProbes := func(n int32) {
+		t.Helper()
+		start := probes.Load()
+		deadline := time.Now().Add(5 * time.Second)
+		for probes.Load()-start < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d health checks, got %d", n, probes.Load()-start)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitProbes(48) // two full ticks
+	if got := peak.Load(); got != 4 {
+		t.Errorf("Expected at most 4 concurrent health checks, and the limit used, got a peak of %d", got)
+	}
+
+	// A reload lowers the limit from the next tick on
+	opts.HealthMaxConcurrent = 2
+	b.Reconfigure(opts)
+	waitProbes(24) // lets the tick in flight at the reload finish
+	peak.Store(0)
+	waitProbes(48)
+	if got := peak.Load(); got > 2 {
+		t.Errorf("Expected at most 2 concurrent health checks after Reconfigure, got a peak of %d", got)
+	}
+}
@@ -0,0 +1,201 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// hedgeTo hedges every request to secondary after 50ms
+func hedgeTo(secondary *httptest.Server) func(*proxy.HTTPProxy) {
+	su, _ := url.Parse(secondary.URL)
+	return func(p *proxy.HTTPProxy) {
+		p.Hedging = &proxy.HedgePolicy{
+			Delay: 50 * time.Millisecond,
+			Pick: func(r *http.Request, exclude []string) (*url.URL, error) {
+				for _, h := range exclude {
+					if h == su.Host {
+						return nil, nil
+					}
+				}
+				return su, nil
+			},
+		}
+	}
+}
+
+func TestHedgingSlowPrimary(t *testing.T) {
+	var primaryCanceled atomic.Bool
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			primaryCanceled.Store(true)
+		case <-time.After(2 * time.Second):
+			_, _ = io.WriteString(w, "primary")
+		}
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "secondary")
+	}))
+	defer secondary.Close()
+	var successHost atomic.Value
+	addr, _ := startProxy(t, primary.URL, hedgeTo(secondary), func(p *proxy.HTTPProxy) {
+		p.OnUpstreamSuccess = func(host string) { successHost.Store(host) }
+	})
+
+	hedges := metricValue(t, "charon_http_hedges_total", nil)
+	wins := metricValue(t, "charon_http_hedge_wins_total", nil)
+	start := time.Now()
+	resp, err := http.Get("http://" + addr + "/read")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "secondary" {
+		t.Errorf("Expected the hedged upstream to answer, got %q", body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Hedging should avoid waiting for the slow primary, took %v", elapsed)
+	}
+	if got := metricValue(t, "charon_http_hedges_total", nil) - hedges; got != 1 {
+		t.Errorf("Expected 1 hedge fired, got %v", got)
+	}
+	if got := metricValue(t, "charon_http_hedge_wins_total", nil) - wins; got != 1 {
+		t.Errorf("Expected 1 hedge win, got %v", got)
+	}
+	su, _ := url.Parse(secondary.URL)
+	if got, _ := successHost.Load().(string); got != su.Host {
+		t.Errorf("Expected success to be credited to the hedge upstream %s, got %q", su.Host, got)
+	}
+
+	// The losing primary attempt is cancelled
+	deadline := time.Now().Add(time.Second)
+	for !primaryCanceled.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !primaryCanceled.Load() {
+		t.Error("Expected the losing primary request to be cancelled")
+	}
+}
+
+func TestHedgingSkipsFastAndNonIdempotent(t *testing.T) {
+	var primaryCalls, secondaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		if r.Method == http.MethodPost {
+			time.Sleep(150 * time.Millisecond)
+		}
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&secondaryCalls, 1)
+	}))
+	defer secondary.Close()
+	addr, _ := startProxy(t, primary.URL, hedgeTo(secondary))
+
+	// Fast GET: answered before the hedge delay
+	resp, err := http.Get("http://" + addr + "/fast")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// Slow POST: never hedged
+	resp, err = http.Post("http://"+addr+"/write", "text/plain", strings.NewReader("data"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if n := atomic.LoadInt32(&primaryCalls); n != 2 {
+		t.Errorf("Expected 2 primary calls, got %d", n)
+	}
+	if n := atomic.LoadInt32(&secondaryCalls); n != 0 {
+		t.Errorf("Expected no hedged calls, got %d", n)
+	}
+}
+
+func TestHedgingCancelsLoserBeforeWinnerFinishes(t *testing.T) {
+	primaryCanceled := make(chan struct{})
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(primaryCanceled)
+		case <-time.After(2 * time.Second):
+			_, _ = io.WriteString(w, "primary")
+		}
+	}))
+	defer primary.Close()
+	// The hedge streams its answer and only finishes once the primary is gone
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "secondary:")
+		w.(http.Flusher).Flush()
+		select {
+		case <-primaryCanceled:
+			_, _ = io.WriteString(w, "primary-cancelled")
+		case <-time.After(time.Second):
+			_, _ = io.WriteString(w, "primary-running")
+		}
+	}))
+	defer secondary.Close()
+	addr, _ := startProxy(t, primary.URL, hedgeTo(secondary))
+
+	resp, err := http.Get("http://" + addr + "/stream")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secondary:primary-cancelled" {
+		t.Errorf("Expected the losing primary cancelled while the hedge streams, got %q", body)
+	}
+}
+
+func TestRetryHedgeAfterConfig(t *testing.T) {
+	cfg := loadConfigFile(t, "retry:\n  hedge_after: \"75ms\"\n")
+	if cfg.Retry.HedgeAfter != "75ms" {
+		t.Errorf("Expected retry.hedge_after loaded, got %q", cfg.Retry.HedgeAfter)
+	}
+	for _, bad := range []string{
+		"retry:\n  hedge_after: \"soon\"\n",
+		"retry:\n  hedge_after: \"0s\"\n",
+		"retry:\n  hedge_after: \"75ms\"\nhedging:\n  enabled: true\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+}
+
+func TestHedgingSkipsUpgrades(t *testing.T) {
+	// The primary accepts the upgrade only after the hedge delay has passed
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		upgradeEcho(w, r)
+	}))
+	defer primary.Close()
+	var secondaryHits atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits.Add(1)
+		upgradeEcho(w, r)
+	}))
+	defer secondary.Close()
+	addr, _ := startProxy(t, primary.URL, hedgeTo(secondary))
+
+	conn, br := dialUpgrade(t, addr, "")
+	expectEcho(t, conn, br, "ping\n")
+	if n := secondaryHits.Load(); n != 0 {
+		t.Errorf("Expected no hedge for an upgrade request, got %d", n)
+	}
+}
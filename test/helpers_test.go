@@ -0,0 +1,117 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+// freeAddr returns a currently unused local TCP address
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+// waitListening waits until addr accepts TCP connections
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			c.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Proxy did not start listening on %s", addr)
+}
+
+// startProxy starts an HTTP proxy on a free local address that forwards every
+// request to target, after applying opts, and stops it when the test ends.
+// It returns the proxy's address.
+func startProxy(t *testing.T, target string, opts ...func(*proxy.HTTPProxy)) (string, *proxy.HTTPProxy) {
+	t.Helper()
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("Invalid backend URL: %v", err)
+	}
+	addr := freeAddr(t)
+	p := proxy.NewHTTPProxyWithResolver(addr, func(r *http.Request) (*url.URL, error) { return u, nil })
+	for _, opt := range opts {
+		opt(p)
+	}
+	go func() { _ = p.Start() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = p.Stop(ctx)
+	})
+	waitListening(t, addr)
+	return addr, p
+}
+
+// withRoutes routes the proxy's requests with rules
+func withRoutes(t *testing.T, rules []config.RouteRule) func(*proxy.HTTPProxy) {
+	t.Helper()
+	router, err := routing.New(rules, "")
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+	return func(p *proxy.HTTPProxy) { p.Router = router }
+}
+
+// metricSeries returns the series of metric name whose labels include every
+// pair in labels. A nil labels matches all series.
+func metricSeries(t *testing.T, name string, labels map[string]string) []*dto.Metric {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	var series []*dto.Metric
+	for _, mf := range families {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.GetMetric() {
+			have := map[string]string{}
+			for _, l := range m.GetLabel() {
+				have[l.GetName()] = l.GetValue()
+			}
+			for k, v := range labels {
+				if have[k] != v {
+					continue next
+				}
+			}
+			series = append(series, m)
+		}
+	}
+	return series
+}
+
+// metricValue sums the counter or gauge values of the matching series of
+// metric name, or returns 0 when none exists yet
+func metricValue(t *testing.T, name string, labels map[string]string) float64 {
+	t.Helper()
+	var total float64
+	for _, m := range metricSeries(t, name, labels) {
+		total += m.GetCounter().GetValue() + m.GetGauge().GetValue() + m.GetUntyped().GetValue()
+	}
+	return total
+}
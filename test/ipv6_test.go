@@ -0,0 +1,184 @@
+package test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/registry"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func writeRegistry(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "registry.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write registry: %v", err)
+	}
+	return path
+}
+
+func TestRegistryIPv6Entries(t *testing.T) {
+	path := writeRegistry(t, `services:
+  v6-backend:
+    - "[::1]:9091"
+    - "[2001:db8::10]:8080"
+  v6-single: "[fe80::1%eth0]:80"
+`)
+	addrs, err := registry.ResolveServiceAddresses(path, "v6-backend")
+	if err != nil {
+		t.Fatalf("Failed to resolve IPv6 service: %v", err)
+	}
+	if len(addrs) != 2 || addrs[0] != "[::1]:9091" || addrs[1] != "[2001:db8::10]:8080" {
+		t.Errorf("Unexpected addresses: %v", addrs)
+	}
+
+	addr, err := registry.ResolveServiceAddress(path, "v6-single")
+	if err != nil {
+		t.Fatalf("Failed to resolve zoned IPv6 service: %v", err)
+	}
+	if addr != "[fe80::1%eth0]:80" {
+		t.Errorf("Unexpected address: %s", addr)
+	}
+}
+
+func TestRegistryRejectsUnbracketedIPv6(t *testing.T) {
+	path := writeRegistry(t, `services:
+  bad: "2001:db8::10:8080"
+`)
+	if _, err := registry.ResolveServiceAddresses(path, "bad"); err == nil {
+		t.Fatal("Expected error for unbracketed IPv6 address")
+	}
+}
+
+func TestUpstreamURLIPv6(t *testing.T) {
+	tests := []struct {
+		addr   string
+		tls    bool
+		expect string
+		host   string
+	}{
+		{"[::1]:9091", false, "http://[::1]:9091", "[::1]:9091"},
+		{"[2001:db8::10]:8443", true, "https://[2001:db8::10]:8443", "[2001:db8::10]:8443"},
+		{"[fe80::1%eth0]:80", false, "http://[fe80::1%25eth0]:80", "[fe80::1%eth0]:80"},
+		{"127.0.0.1:8080", false, "http://127.0.0.1:8080", "127.0.0.1:8080"},
+		{"https://[::1]:8443", false, "https://[::1]:8443", "[::1]:8443"},
+	}
+	for _, tt := range tests {
+		u, err := proxy.UpstreamURL(tt.addr, tt.tls)
+		if err != nil {
+			t.Errorf("UpstreamURL(%q) error: %v", tt.addr, err)
+			continue
+		}
+		if u.String() != tt.expect {
+			t.Errorf("UpstreamURL(%q) = %q, want %q", tt.addr, u.String(), tt.expect)
+		}
+		if u.Host != tt.host {
+			t.Errorf("UpstreamURL(%q).Host = %q, want %q", tt.addr, u.Host, tt.host)
+		}
+	}
+	if _, err := proxy.UpstreamURL("::1:9091", false); err == nil {
+		t.Error("Expected error for unbracketed IPv6 address")
+	}
+}
+
+func TestRouteHostMatchIPv6(t *testing.T) {
+	router, err := routing.New([]config.RouteRule{{Host: "::1", ServiceName: "v6"}}, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	for _, host := range []string{"[::1]:8080", "[::1]"} {
+		req, _ := http.NewRequest("GET", "http://example/", nil)
+		req.Host = host
+		if got := router.Match(req).Service; got != "v6" {
+			t.Errorf("Host %q routed to %q, want v6", host, got)
+		}
+	}
+}
+
+func TestHTTPProxyIPv6Upstream(t *testing.T) {
+	backendLn, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback not available: %v", err)
+	}
+	backend := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "host=%s", r.Host)
+	})}
+	go func() { _ = backend.Serve(backendLn) }()
+	defer backend.Close()
+
+	path := writeRegistry(t, fmt.Sprintf("services:\n  v6: \"%s\"\n", backendLn.Addr().String()))
+	listenAddr, _ := startProxy(t, "", func(p *proxy.HTTPProxy) {
+		p.Resolver = func(r *http.Request) (*url.URL, error) {
+			addr, err := registry.ResolveServiceAddress(path, "v6")
+			if err != nil {
+				return nil, err
+			}
+			return proxy.UpstreamURL(addr, false)
+		}
+	})
+
+	resp, err := http.Get("http://" + listenAddr + "/")
+	if err != nil {
+		t.Fatalf("Request through proxy failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	if want := "host=" + backendLn.Addr().String(); string(body) != want {
+		t.Errorf("Expected %q, got %q", want, body)
+	}
+}
+
+func TestRegistrySkipsInvalidEntries(t *testing.T) {
+	path := writeRegistry(t, `services:
+  mixed:
+    - "10.0.0.1:8080"
+    - "10.0.0.2"
+    - "2001:db8::10:8080"
+    - "[2001:DB8:0::10]:8080"
+    - "10.0.0.3:8080|heavy"
+  other: "10.0.1.1:80"
+`)
+	addrs, err := registry.ResolveServiceAddresses(path, "mixed")
+	if err != nil {
+		t.Fatalf("Expected the valid entries despite bad ones, got %v", err)
+	}
+	if len(addrs) != 2 || addrs[0] != "10.0.0.1:8080" || addrs[1] != "[2001:db8::10]:8080" {
+		t.Errorf("Expected the valid entries in canonical form, got %v", addrs)
+	}
+	if addr, err := registry.ResolveServiceAddress(path, "other"); err != nil || addr != "10.0.1.1:80" {
+		t.Errorf("Expected other services unaffected, got %q (%v)", addr, err)
+	}
+}
+
+func TestDynamicRegistryNormalizesIPv6(t *testing.T) {
+	reg := registry.NewDynamicRegistry()
+	defer reg.Close()
+	inst, err := reg.Register("orders", "[2001:DB8:0::1]:8080", 1, 0)
+	if err != nil || inst.Addr != "[2001:db8::1]:8080" {
+		t.Fatalf("Expected the canonical address, got %q (%v)", inst.Addr, err)
+	}
+	// A heartbeat spelled differently refreshes the same instance
+	if _, err := reg.Register("orders", "[2001:db8::1]:8080", 1, 0); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if got := reg.Instances("orders"); len(got) != 1 {
+		t.Errorf("Expected one instance, got %v", got)
+	}
+	if _, err := reg.Register("orders", "[2001:db8::1]", 1, 0); err == nil {
+		t.Error("Expected an address without a port to be rejected")
+	}
+	if !reg.Deregister("orders", "[2001:0db8::1]:8080") {
+		t.Error("Expected deregistration by another spelling of the address")
+	}
+}
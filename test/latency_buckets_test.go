@@ -0,0 +1,60 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	cfg := loadConfigFile(t, "metrics:\n  latency_buckets: [0.0001, 0.0005, 0.001, 0.01]\n")
+	if got := cfg.Metrics.LatencyBuckets; len(got) != 4 || got[0] != 0.0001 {
+		t.Fatalf("Expected the buckets loaded, got %v", got)
+	}
+	for _, bad := range []string{
+		"metrics:\n  latency_buckets: [0.01, 0.001]\n",
+		"metrics:\n  latency_buckets: [0.01, 0.01]\n",
+		"metrics:\n  latency_buckets: [0, 0.01]\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+
+	if err := proxy.SetLatencyBuckets(cfg.Metrics.LatencyBuckets); err != nil {
+		t.Fatalf("Failed to set the buckets: %v", err)
+	}
+	t.Cleanup(func() { _ = proxy.SetLatencyBuckets(prometheus.DefBuckets) })
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	addr, _ := startProxy(t, backend.URL)
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	series := metricSeries(t, "charon_http_request_latency_seconds", nil)
+	if len(series) == 0 {
+		t.Fatal("Expected a request latency series")
+	}
+	var got []float64
+	for _, b := range series[0].GetHistogram().GetBucket() {
+		got = append(got, b.GetUpperBound())
+	}
+	want := []float64{0.0001, 0.0005, 0.001, 0.01}
+	if len(got) != len(want) {
+		t.Fatalf("Expected buckets %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected buckets %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestLatencyEWMAPrefersFastest(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, LatencyDecay: 0.5, LatencyHalfLife: time.Hour})
+	defer b.Close()
+	addrs := []string{"ewma-a:1", "ewma-b:1", "ewma-c:1"}
+	b.SetServiceAddrs("svc", addrs)
+
+	b.RecordLatency("ewma-a:1", 50*time.Millisecond)
+	b.RecordLatency("ewma-b:1", 5*time.Millisecond)
+	b.RecordLatency("ewma-c:1", 20*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		if got := b.NextLatency("svc", addrs); got != "ewma-b:1" {
+			t.Fatalf("Expected the fastest upstream, got %s", got)
+		}
+	}
+	if got := metricValue(t, "charon_upstream_latency_ewma_seconds", map[string]string{"upstream": "ewma-b:1"}); got != 0.005 {
+		t.Errorf("Expected a 5ms gauge, got %v", got)
+	}
+
+	// b degrades: 5ms -> 102.5ms -> 151.25ms, slower than c now
+	b.RecordLatency("ewma-b:1", 200*time.Millisecond)
+	b.RecordLatency("ewma-b:1", 200*time.Millisecond)
+	if got := b.LatencyEWMA("ewma-b:1"); got != 151250*time.Microsecond {
+		t.Errorf("Expected a 151.25ms average, got %v", got)
+	}
+	if got := b.NextLatency("svc", addrs); got != "ewma-c:1" {
+		t.Errorf("Expected traffic to move off the degraded upstream, got %s", got)
+	}
+
+	// unhealthy upstreams are skipped however fast
+	b.MarkFailure("ewma-c:1")
+	if got := b.NextLatency("svc", addrs); got != "ewma-a:1" {
+		t.Errorf("Expected the unhealthy upstream skipped, got %s", got)
+	}
+}
+
+func TestLatencyEWMAIdleDecay(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, LatencyHalfLife: 50 * time.Millisecond})
+	defer b.Close()
+	addrs := []string{"slow:1", "fast:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.RecordLatency("slow:1", 100*time.Millisecond)
+	b.RecordLatency("fast:1", 10*time.Millisecond)
+	if got := b.NextLatency("svc", addrs); got != "fast:1" {
+		t.Fatalf("Expected the fast upstream, got %s", got)
+	}
+
+	// fast keeps serving while slow sits idle; after about 6 half-lives slow's
+	// average has decayed below fast's and it is tried again
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		addr := b.NextLatency("svc", addrs)
+		if addr == "slow:1" {
+			return
+		}
+		b.RecordLatency(addr, 10*time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Expected the idle upstream to become eligible again")
+}
+
+func TestLatencyEWMASeedsNewUpstreams(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, LatencyHalfLife: time.Hour})
+	defer b.Close()
+	addrs := []string{"seed-a:1", "seed-b:1", "seed-new:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.RecordLatency("seed-a:1", 10*time.Millisecond)
+	b.RecordLatency("seed-b:1", 30*time.Millisecond)
+
+	// The new upstream scores the 20ms pool average: not preferred over a 10ms one
+	for i := 0; i < 6; i++ {
+		if got := b.NextLatency("svc", addrs); got != "seed-a:1" {
+			t.Fatalf("Expected the fastest measured upstream over the new one, got %s", got)
+		}
+	}
+	// With the fast one out it ties with the remaining average and takes turns
+	b.MarkFailure("seed-a:1")
+	seen := map[string]int{}
+	for i := 0; i < 4; i++ {
+		seen[b.NextLatency("svc", addrs)]++
+	}
+	if seen["seed-b:1"] != 2 || seen["seed-new:1"] != 2 {
+		t.Errorf("Expected the new upstream to share traffic with seed-b, got %v", seen)
+	}
+
+	// Without any measurement every upstream ties and they take turns
+	fresh := []string{"fresh-a:1", "fresh-b:1"}
+	b.SetServiceAddrs("fresh", fresh)
+	seen = map[string]int{}
+	for i := 0; i < 4; i++ {
+		seen[b.NextLatency("fresh", fresh)]++
+	}
+	if seen["fresh-a:1"] != 2 || seen["fresh-b:1"] != 2 {
+		t.Errorf("Expected unmeasured upstreams picked in turn, got %v", seen)
+	}
+}
+
+func TestLatencyEWMAPenalizesFailures(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, LatencyDecay: 0.5, LatencyHalfLife: time.Hour})
+	defer b.Close()
+	addrs := []string{"pen-ok:1", "pen-err:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.RecordLatency("pen-ok:1", 20*time.Millisecond)
+	b.RecordLatency("pen-err:1", 10*time.Millisecond)
+
+	// A 1ms failure counts as 4x the upstream's 10ms average: 10ms -> 25ms
+	b.RecordFailureLatency("pen-err:1", time.Millisecond)
+	if got := b.LatencyEWMA("pen-err:1"); got != 25*time.Millisecond {
+		t.Errorf("Expected a 25ms average after the failure, got %v", got)
+	}
+	if got := b.NextLatency("svc", addrs); got != "pen-ok:1" {
+		t.Errorf("Expected traffic to move off the failing upstream, got %s", got)
+	}
+
+	// An upstream without an average is penalized from the pool's
+	b.RecordFailureLatency("pen-new:1", time.Millisecond)
+	if got := b.LatencyEWMA("pen-new:1"); got < 4*20*time.Millisecond {
+		t.Errorf("Expected a new failing upstream penalized from the pool average, got %v", got)
+	}
+}
+
+func TestUpstreamFailureCallback(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	completed, failed := make(chan string, 4), make(chan string, 4)
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.OnUpstreamComplete = func(host string, latency time.Duration) { completed <- host }
+		p.OnUpstreamFailure = func(host string, latency time.Duration) { failed <- host }
+	})
+
+	for _, path := range []string{"/fail", "/ok"} {
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+	}
+	if len(failed) != 1 || <-failed != u.Host {
+		t.Errorf("Expected the 503 reported as a failure")
+	}
+	if len(completed) != 1 || <-completed != u.Host {
+		t.Errorf("Expected only the 200 reported as completed")
+	}
+}
+
+func TestUpstreamCompleteCallback(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	latencies := make(chan time.Duration, 1)
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.OnUpstreamComplete = func(host string, latency time.Duration) {
+			if host == u.Host {
+				latencies <- latency
+			}
+		}
+	})
+
+	resp, err := http.Post("http://"+addr+"/", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	select {
+	case d := <-latencies:
+		if d < 20*time.Millisecond {
+			t.Errorf("Expected the latency to include the upstream's 20ms, got %v", d)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected OnUpstreamComplete to be called")
+	}
+}
+
+func TestLatencyHalfLifeValidation(t *testing.T) {
+	_, err := config.LoadConfig(writeConfig(t, "load_balancing:\n  latency_half_life: \"soon\"\n"))
+	if err == nil {
+		t.Errorf("Expected an invalid latency_half_life rejected at load")
+	}
+}
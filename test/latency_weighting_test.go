@@ -0,0 +1,100 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+)
+
+// delayedCheck is a health check that takes delays[addr] and always succeeds
+func delayedCheck(delays map[string]time.Duration) func(string) error {
+	return func(addr string) error {
+		time.Sleep(delays[addr])
+		return nil
+	}
+}
+
+// latencyWeighted starts a balancer probing addrs with delayedCheck and waits
+// until each has a health-check latency
+func latencyWeighted(t *testing.T, opts balancer.Options, service string, delays map[string]time.Duration) *balancer.Balancer {
+	t.Helper()
+	opts.HealthInterval = 20 * time.Millisecond
+	opts.HealthLatencyWeighting = true
+	opts.HealthCheck = delayedCheck(delays)
+	b := balancer.New(opts)
+	t.Cleanup(b.Close)
+	var addrs []string
+	for addr := range delays {
+		addrs = append(addrs, addr)
+	}
+	b.SetServiceAddrs(service, addrs)
+	deadline := time.Now().Add(3 * time.Second)
+	for _, addr := range addrs {
+		for b.HealthLatency(addr) == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("No health-check latency recorded for %s", addr)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return b
+}
+
+func pickCounts(b *balancer.Balancer, service string, addrs []string, n int) map[string]int {
+	counts := map[string]int{}
+	for i := 0; i < n; i++ {
+		counts[b.Next(service, addrs)]++
+	}
+	return counts
+}
+
+func TestHealthLatencyWeighting(t *testing.T) {
+	addrs := []string{"lw-fast:80", "lw-slow:80"}
+	b := latencyWeighted(t, balancer.Options{}, "lw", map[string]time.Duration{
+		"lw-fast:80": 10 * time.Millisecond,
+		"lw-slow:80": 30 * time.Millisecond,
+	})
+
+	// The slow upstream gets about fast/slow of the fast one's share
+	counts := pickCounts(b, "lw", addrs, 1000)
+	if counts["lw-fast:80"] <= 2*counts["lw-slow:80"] || counts["lw-slow:80"] < 100 {
+		t.Errorf("Expected roughly a 3:1 split toward the fast upstream, got %v", counts)
+	}
+}
+
+func TestHealthLatencyWeightingFloor(t *testing.T) {
+	addrs := []string{"lf-fast:80", "lf-slow:80"}
+	b := latencyWeighted(t, balancer.Options{MinLatencyFactor: 0.25}, "lf", map[string]time.Duration{
+		"lf-fast:80": time.Millisecond,
+		"lf-slow:80": 100 * time.Millisecond,
+	})
+
+	// However slow, an upstream keeps MinLatencyFactor of the fastest one's weight
+	counts := pickCounts(b, "lf", addrs, 500)
+	if counts["lf-fast:80"] != 400 || counts["lf-slow:80"] != 100 {
+		t.Errorf("Expected a 4:1 split at the latency floor, got %v", counts)
+	}
+}
+
+func TestHealthLatencyWeightingDisabled(t *testing.T) {
+	addrs := []string{"ld-fast:80", "ld-slow:80"}
+	b := balancer.New(balancer.Options{
+		HealthInterval: 20 * time.Millisecond,
+		HealthCheck: delayedCheck(map[string]time.Duration{
+			"ld-slow:80": 30 * time.Millisecond,
+		}),
+	})
+	defer b.Close()
+	b.SetServiceAddrs("ld", addrs)
+	deadline := time.Now().Add(3 * time.Second)
+	for b.HealthLatency("ld-slow:80") == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Without the option latency doesn't change the round-robin split
+	counts := pickCounts(b, "ld", addrs, 100)
+	if counts["ld-fast:80"] != 50 || counts["ld-slow:80"] != 50 {
+		t.Errorf("Expected an even split, got %v", counts)
+	}
+}
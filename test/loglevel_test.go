@@ -0,0 +1,63 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+func TestAdminLogLevel(t *testing.T) {
+	mux := http.NewServeMux()
+	(&admin.Server{}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	if err := logging.SetLevel("info"); err != nil {
+		t.Fatalf("SetLevel failed: %v", err)
+	}
+	t.Cleanup(func() { _ = logging.SetLevel("info") })
+
+	do := func(method, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+"/admin/loglevel", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s /admin/loglevel failed: %v", method, err)
+		}
+		defer resp.Body.Close()
+		var state struct {
+			Level string `json:"level"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&state)
+		return resp.StatusCode, state.Level
+	}
+
+	if status, level := do(http.MethodGet, ""); status != http.StatusOK || level != "info" {
+		t.Errorf("Expected 200 info, got %d %q", status, level)
+	}
+	if logging.GetLogger().Core().Enabled(zap.DebugLevel) {
+		t.Fatal("Expected debug logs to be disabled at info")
+	}
+
+	if status, level := do(http.MethodPut, `{"level":"debug"}`); status != http.StatusOK || level != "debug" {
+		t.Errorf("Expected 200 debug, got %d %q", status, level)
+	}
+	if !logging.GetLogger().Core().Enabled(zap.DebugLevel) {
+		t.Error("Expected debug logs to be enabled right after the change")
+	}
+
+	for _, body := range []string{`{"level":"verbose"}`, `{}`, `not json`} {
+		if status, _ := do(http.MethodPut, body); status != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, status)
+		}
+	}
+	if _, level := do(http.MethodGet, ""); level != "debug" {
+		t.Errorf("Expected a rejected change to keep debug, got %q", level)
+	}
+}
@@ -0,0 +1,40 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestRequestMetricsServiceAndRouteLabels(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	for _, tc := range []struct {
+		routeLabels bool
+		wantRoute   string
+	}{
+		{false, ""},
+		{true, "labels-api"},
+	} {
+		rules := []config.RouteRule{
+			{Name: "labels-api", PathPrefix: "/labels", ServiceName: "labels-svc"},
+		}
+		addr, _ := startProxy(t, backend.URL, withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+			p.RouteLabels = tc.routeLabels
+		})
+
+		before := metricValue(t, "charon_http_requests_total", map[string]string{"service": "labels-svc", "route_name": tc.wantRoute})
+		resp, err := http.Get("http://" + addr + "/labels/x")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if got := metricValue(t, "charon_http_requests_total", map[string]string{"service": "labels-svc", "route_name": tc.wantRoute}) - before; got != 1 {
+			t.Errorf("route_labels=%v: expected 1 request with service=labels-svc route_name=%q, got %v", tc.routeLabels, tc.wantRoute, got)
+		}
+	}
+}
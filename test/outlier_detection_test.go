@@ -0,0 +1,119 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+func TestOutlierDetection(t *testing.T) {
+	b := balancer.New(balancer.Options{
+		HealthInterval:      time.Hour,
+		FailureThreshold:    100, // keep the breakers out of it
+		OpenDuration:        time.Minute,
+		OutlierDetection:    true,
+		OutlierMinRequests:  10,
+		OutlierErrorMargin:  30,
+		OutlierEjectionTime: 100 * time.Millisecond,
+	})
+	defer b.Close()
+	// with 3 upstreams and the default 50%, only one may be ejected at a time
+	addrs := []string{"good:1", "bad:1", "worse:1"}
+	b.SetServiceAddrs("svc", addrs)
+	// picked counts how often 6 selections land on addr
+	picked := func(addr string) int {
+		n := 0
+		for i := 0; i < 6; i++ {
+			if b.Next("svc", addrs) == addr {
+				n++
+			}
+		}
+		return n
+	}
+	before := metricValue(t, "charon_outlier_ejections_total", nil)
+
+	// 1 of 11 requests failed; every upstream has failed once, so health
+	// doesn't decide the picks
+	b.MarkFailure(addrs[0])
+	for i := 0; i < 10; i++ {
+		b.MarkSuccess(addrs[0])
+	}
+	// 8 of 10 failed
+	b.MarkSuccess(addrs[1])
+	b.MarkSuccess(addrs[1])
+	for i := 0; i < 8; i++ {
+		b.MarkFailure(addrs[1])
+	}
+	if n := picked(addrs[1]); n != 0 {
+		t.Errorf("Expected the outlier to be ejected, picked %d times", n)
+	}
+	if got := metricValue(t, "charon_outlier_ejections_total", nil) - before; got != 1 {
+		t.Errorf("Expected 1 ejection counted, got %v", got)
+	}
+
+	// an outlier as well, but ejecting it would take 2 of 3 upstreams out
+	for i := 0; i < 10; i++ {
+		b.MarkFailure(addrs[2])
+	}
+	if n := picked(addrs[2]); n == 0 {
+		t.Errorf("Expected max_ejection_percent to keep the second outlier in rotation")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if n := picked(addrs[1]); n == 0 {
+		t.Errorf("Expected the outlier back after ejection_time")
+	}
+}
+
+func TestOutlierDetectionNoEjectionBelowMinRequests(t *testing.T) {
+	b := balancer.New(balancer.Options{
+		HealthInterval:     time.Hour,
+		FailureThreshold:   100,
+		OutlierDetection:   true,
+		OutlierMinRequests: 10,
+	})
+	defer b.Close()
+	addrs := []string{"good:1", "bad:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.MarkFailure(addrs[0])
+	for i := 0; i < 10; i++ {
+		b.MarkSuccess(addrs[0])
+	}
+	for i := 0; i < 9; i++ {
+		b.MarkFailure(addrs[1])
+	}
+	seen := false
+	for i := 0; i < 4; i++ {
+		if b.Next("svc", addrs) == addrs[1] {
+			seen = true
+		}
+	}
+	if !seen {
+		t.Errorf("Expected no ejection before min_requests (9 requests)")
+	}
+}
+
+func TestOutlierDetectionValidation(t *testing.T) {
+	cfg := loadConfigFile(t, `
+outlier_detection:
+  enabled: true
+  window: "1m"
+  min_requests: 20
+  error_margin: 25
+  ejection_time: "45s"
+  max_ejection_percent: 30
+`)
+	od := cfg.OutlierDetection
+	if !od.Enabled || od.Window != "1m" || od.MinRequests != 20 || od.ErrorMargin != 25 || od.EjectionTime != "45s" || od.MaxEjectionPercent != 30 {
+		t.Errorf("Unexpected outlier_detection config %+v", od)
+	}
+	for _, bad := range []string{`window: "soon"`, `ejection_time: "-1s"`, "max_ejection_percent: 120"} {
+		_, err := config.LoadConfig(writeConfig(t, "outlier_detection:\n  "+bad+"\n"))
+		if err == nil || !strings.Contains(err.Error(), "outlier_detection.") {
+			t.Errorf("Expected %q rejected at load, got %v", bad, err)
+		}
+	}
+}
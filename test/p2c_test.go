@@ -0,0 +1,157 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func p2cPicks(b *balancer.Balancer, addrs []string, n int) []string {
+	picks := make([]string, n)
+	for i := range picks {
+		picks[i] = b.NextP2C("svc", addrs)
+	}
+	return picks
+}
+
+func TestP2CPrefersFewerInFlight(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, P2CSeed: 1})
+	defer b.Close()
+	addrs := []string{"a:1", "b:1", "c:1", "d:1", "e:1"}
+	b.SetServiceAddrs("svc", addrs)
+	for i := 0; i < 3; i++ {
+		b.Acquire("a:1")
+	}
+
+	picks := p2cPicks(b, addrs, 200)
+	if slices.Contains(picks, "a:1") {
+		t.Errorf("Expected the busiest upstream never to win a sample")
+	}
+	for _, a := range addrs[1:] {
+		if !slices.Contains(picks, a) {
+			t.Errorf("Expected %s to be picked, got %v", a, picks)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		b.Release("a:1")
+	}
+	if !slices.Contains(p2cPicks(b, addrs, 200), "a:1") {
+		t.Errorf("Expected a:1 back once its requests finished")
+	}
+}
+
+func TestP2CSkipsUnhealthy(t *testing.T) {
+	b := balancer.New(balancer.Options{HealthInterval: time.Hour, FailureThreshold: 100})
+	defer b.Close()
+	addrs := []string{"a:1", "b:1", "c:1"}
+	b.SetServiceAddrs("svc", addrs)
+	b.MarkFailure("b:1")
+
+	if slices.Contains(p2cPicks(b, addrs, 100), "b:1") {
+		t.Errorf("Expected an unhealthy upstream never to be picked")
+	}
+}
+
+func TestP2CSeed(t *testing.T) {
+	addrs := []string{"a:1", "b:1", "c:1", "d:1", "e:1", "f:1", "g:1", "h:1"}
+	run := func() []string {
+		b := balancer.New(balancer.Options{HealthInterval: time.Hour, P2CSeed: 42})
+		defer b.Close()
+		b.SetServiceAddrs("svc", addrs)
+		var picks []string
+		for i := 0; i < 50; i++ {
+			addr := b.NextP2C("svc", addrs)
+			b.Acquire(addr) // make the load, and so the picks, depend on the history
+			picks = append(picks, addr)
+		}
+		return picks
+	}
+	if first, second := run(), run(); !slices.Equal(first, second) {
+		t.Errorf("Expected the same seed to give the same picks:\n%v\n%v", first, second)
+	}
+}
+
+func TestUpstreamInFlightCallbacks(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	var mu sync.Mutex
+	inflight := map[string]int{}
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.OnUpstreamStart = func(host string) { mu.Lock(); inflight[host]++; mu.Unlock() }
+		p.OnUpstreamDone = func(host string) { mu.Lock(); inflight[host]--; mu.Unlock() }
+	})
+	current := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return inflight[u.Host]
+	}
+
+	resp, err := http.Post("http://"+addr+"/", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	// the headers arrived but the body is still streaming
+	if n := current(); n != 1 {
+		t.Errorf("Expected 1 request in flight while the body streams, got %d", n)
+	}
+	close(release)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for current() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := current(); n != 0 {
+		t.Errorf("Expected no request in flight after the response, got %d", n)
+	}
+}
+
+func TestUpstreamInFlightUpgrade(t *testing.T) {
+	u := upgradeEchoBackend(t)
+
+	var mu sync.Mutex
+	inflight := 0
+	addr, _ := startProxy(t, u.String(), func(p *proxy.HTTPProxy) {
+		p.OnUpstreamStart = func(host string) { mu.Lock(); inflight++; mu.Unlock() }
+		p.OnUpstreamDone = func(host string) { mu.Lock(); inflight--; mu.Unlock() }
+	})
+	current := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return inflight
+	}
+
+	// The switched connection works both ways and counts as in flight while open
+	conn, br := dialUpgrade(t, addr, "")
+	expectEcho(t, conn, br, "ping\n")
+	if n := current(); n != 1 {
+		t.Errorf("Expected the open upgraded connection in flight, got %d", n)
+	}
+
+	conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for current() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := current(); n != 0 {
+		t.Errorf("Expected the upgraded connection released once closed, got %d", n)
+	}
+}
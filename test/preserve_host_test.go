@@ -0,0 +1,62 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestPreserveHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	keep, rewrite := true, false
+	start := func(preserve bool) string {
+		rules := []config.RouteRule{
+			{PathPrefix: "/keep", ServiceName: "app", PreserveHost: &keep},
+			{PathPrefix: "/rewrite", ServiceName: "app", PreserveHost: &rewrite},
+			{PathPrefix: "/", ServiceName: "app"},
+		}
+		addr, _ := startProxy(t, backend.URL, withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+			p.PreserveHost = preserve
+		})
+		return "http://" + addr
+	}
+	hostSeen := func(base, path string) string {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, base+path, nil)
+		req.Host = "shop.example.com"
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	rewriting, preserving := start(false), start(true)
+	cases := []struct {
+		base, path, want string
+	}{
+		{rewriting, "/", u.Host}, // default: rewritten to the upstream
+		{rewriting, "/keep", "shop.example.com"},
+		{rewriting, "/rewrite", u.Host},
+		{preserving, "/", "shop.example.com"},
+		{preserving, "/keep", "shop.example.com"},
+		{preserving, "/rewrite", u.Host}, // the route overrides the global setting
+	}
+	for _, tc := range cases {
+		if got := hostSeen(tc.base, tc.path); got != tc.want {
+			t.Errorf("preserve_host=%v %s: expected Host %q, got %q", tc.base == preserving, tc.path, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/proxyproto"
+)
+
+// proxyV2Header builds a PROXY protocol v2 header for a TCP over IPv4 connection
+func proxyV2Header(src, dst net.IP, srcPort, dstPort uint16) []byte {
+	h := []byte("\r\n\r\n\x00\r\nQUIT\n")
+	h = append(h, 0x21, 0x11) // v2 PROXY, AF_INET STREAM
+	h = binary.BigEndian.AppendUint16(h, 12)
+	h = append(h, src.To4()...)
+	h = append(h, dst.To4()...)
+	h = binary.BigEndian.AppendUint16(h, srcPort)
+	return binary.BigEndian.AppendUint16(h, dstPort)
+}
+
+// rawHTTPGet sends prefix followed by a GET / over a fresh connection and
+// returns the response, or nil if the connection was closed without one.
+func rawHTTPGet(t *testing.T, addr string, prefix []byte) *http.Response {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
+	_, _ = conn.Write(append(prefix, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"...))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+func TestHTTPProxyProtocol(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Forwarded-For"))
+	}))
+	defer backend.Close()
+
+	start := func(require bool) string {
+		addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+			p.ProxyProtocol = &proxyproto.Options{Require: require}
+		})
+		return addr
+	}
+	forwardedFor := func(resp *http.Response) string {
+		t.Helper()
+		if resp == nil {
+			t.Fatal("Expected a response")
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	optional := start(false)
+	if got := forwardedFor(rawHTTPGet(t, optional, []byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 80\r\n"))); got != "203.0.113.7" {
+		t.Errorf("v1: expected X-Forwarded-For 203.0.113.7, got %q", got)
+	}
+	v2 := proxyV2Header(net.ParseIP("198.51.100.9"), net.ParseIP("10.0.0.1"), 40000, 80)
+	if got := forwardedFor(rawHTTPGet(t, optional, v2)); got != "198.51.100.9" {
+		t.Errorf("v2: expected X-Forwarded-For 198.51.100.9, got %q", got)
+	}
+	if got := forwardedFor(rawHTTPGet(t, optional, nil)); got != "127.0.0.1" {
+		t.Errorf("Expected connections without a header to keep their address, got %q", got)
+	}
+
+	required := start(true)
+	if resp := rawHTTPGet(t, required, nil); resp != nil {
+		resp.Body.Close()
+		t.Errorf("Expected the connection without a header to be rejected, got %d", resp.StatusCode)
+	}
+	if got := forwardedFor(rawHTTPGet(t, required, v2)); got != "198.51.100.9" {
+		t.Errorf("Expected X-Forwarded-For 198.51.100.9 in require mode, got %q", got)
+	}
+	if resp := rawHTTPGet(t, required, []byte("PROXY TCP4 not-an-ip 10.0.0.1 1 80\r\n")); resp != nil {
+		resp.Body.Close()
+		t.Errorf("Expected a malformed header to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestTCPProxyProtocol(t *testing.T) {
+	upstream := startTagServer(t, "up")
+
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, upstream)
+	p.ProxyProtocol = &proxyproto.Options{Require: true}
+	go func() { _ = p.Start() }()
+	waitListening(t, listenAddr)
+
+	send := func(payload []byte) string {
+		t.Helper()
+		conn, err := net.Dial("tcp", listenAddr)
+		if err != nil {
+			t.Fatalf("Failed to dial proxy: %v", err)
+		}
+		defer conn.Close()
+		_, _ = conn.Write(payload)
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		reply, _ := io.ReadAll(conn)
+		return string(reply)
+	}
+
+	// The header is consumed by the proxy; only the payload reaches the upstream
+	v2 := proxyV2Header(net.ParseIP("198.51.100.9"), net.ParseIP("10.0.0.1"), 40000, 9000)
+	if reply := send(append(v2, "ping"...)); reply != "up:ping" {
+		t.Errorf("Expected the payload without the header upstream, got %q", reply)
+	}
+	if reply := send([]byte("PROXY UNKNOWN\r\nping")); reply != "up:ping" {
+		t.Errorf("Expected an UNKNOWN v1 header to be accepted, got %q", reply)
+	}
+	if reply := send([]byte("ping")); strings.Contains(reply, "ping") {
+		t.Errorf("Expected a connection without a header to be rejected, got %q", reply)
+	}
+}
@@ -0,0 +1,143 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+)
+
+// newDimension builds a dimension whose buckets hold burst tokens and refill slowly
+func newDimension(t *testing.T, name, key string, burst int, routes ...string) *ratelimit.Dimension {
+	t.Helper()
+	fn, err := ratelimit.ParseKey(key)
+	if err != nil {
+		t.Fatalf("ParseKey(%q): %v", key, err)
+	}
+	return &ratelimit.Dimension{Name: name, Key: fn, Routes: routes, Limiter: ratelimit.NewRateLimiter(1, burst)}
+}
+
+func requestFrom(remote, path string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = remote
+	return r
+}
+
+func TestRateLimitPolicyAllDimensions(t *testing.T) {
+	policy := ratelimit.NewPolicy(
+		newDimension(t, "per-ip", "ip", 2),
+		newDimension(t, "per-route", "route", 3),
+	)
+
+	// Client A exhausts its own per-IP allowance
+	for i := 0; i < 2; i++ {
+		if dim, ok := policy.Allow(requestFrom("10.0.0.1:1000", "/api")); !ok {
+			t.Fatalf("Request %d from A rejected by %q", i+1, dim)
+		}
+	}
+	if dim, ok := policy.Allow(requestFrom("10.0.0.1:1000", "/api")); ok || dim != "per-ip" {
+		t.Fatalf("Expected per-ip rejection for A, got ok=%v dim=%q", ok, dim)
+	}
+
+	// Client B passes its per-IP limit but the route's shared budget is spent
+	if _, ok := policy.Allow(requestFrom("10.0.0.2:1000", "/api")); !ok {
+		t.Fatal("First request from B should consume the last route token")
+	}
+	if dim, ok := policy.Allow(requestFrom("10.0.0.2:1000", "/api")); ok || dim != "per-route" {
+		t.Fatalf("Expected per-route rejection for B, got ok=%v dim=%q", ok, dim)
+	}
+
+	// Other routes have their own route bucket
+	if dim, ok := policy.Allow(requestFrom("10.0.0.3:1000", "/other")); !ok {
+		t.Fatalf("Request to another route rejected by %q", dim)
+	}
+}
+
+func TestRateLimitPolicyRefundsRejected(t *testing.T) {
+	policy := ratelimit.NewPolicy(
+		newDimension(t, "per-route", "route", 3),
+		newDimension(t, "per-ip", "ip", 1),
+	)
+
+	// Client A spends its per-IP token; its rejected retries don't drain the route
+	if _, ok := policy.Allow(requestFrom("10.0.0.1:1000", "/api")); !ok {
+		t.Fatal("First request from A should pass")
+	}
+	for i := 0; i < 5; i++ {
+		if dim, ok := policy.Allow(requestFrom("10.0.0.1:1000", "/api")); ok || dim != "per-ip" {
+			t.Fatalf("Expected per-ip rejection for A, got ok=%v dim=%q", ok, dim)
+		}
+	}
+	for _, client := range []string{"10.0.0.2:1000", "10.0.0.3:1000"} {
+		if dim, ok := policy.Allow(requestFrom(client, "/api")); !ok {
+			t.Fatalf("Request from %s rejected by %q", client, dim)
+		}
+	}
+	if dim, ok := policy.Allow(requestFrom("10.0.0.4:1000", "/api")); ok || dim != "per-route" {
+		t.Fatalf("Expected the route budget spent, got ok=%v dim=%q", ok, dim)
+	}
+}
+
+func TestRateLimitPolicyScopedAndHeaderKeys(t *testing.T) {
+	policy := ratelimit.NewPolicy(
+		newDimension(t, "api-key", "header:X-Api-Key", 1, "/api"),
+	)
+
+	r := requestFrom("10.0.0.1:1000", "/api/items")
+	r.Header.Set("X-Api-Key", "k1")
+	if _, ok := policy.Allow(r); !ok {
+		t.Fatal("First keyed request should pass")
+	}
+	if dim, ok := policy.Allow(r); ok || dim != "api-key" {
+		t.Fatalf("Expected api-key rejection, got ok=%v dim=%q", ok, dim)
+	}
+
+	// Outside the rule's routes, or without the header, the dimension does not apply
+	out := requestFrom("10.0.0.1:1000", "/public")
+	out.Header.Set("X-Api-Key", "k1")
+	if _, ok := policy.Allow(out); !ok {
+		t.Error("Rule scoped to /api applied to /public")
+	}
+	if _, ok := policy.Allow(requestFrom("10.0.0.1:1000", "/api/items")); !ok {
+		t.Error("Request without the header should not be limited by the header dimension")
+	}
+
+	if _, err := ratelimit.ParseKey("cookie:session"); err == nil {
+		t.Error("Expected error for unknown key scheme")
+	}
+}
+
+func TestHTTPProxyReportsExceededDimension(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	listenAddr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.RateLimits = ratelimit.NewPolicy(
+			newDimension(t, "per-ip", "ip", 5),
+			newDimension(t, "global", "global", 1),
+		)
+	})
+
+	resp, err := http.Get("http://" + listenAddr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + listenAddr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-RateLimit-Dimension"); got != "global" {
+		t.Errorf("Expected exceeded dimension %q, got %q", "global", got)
+	}
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+)
+
+func TestRateLimiterEvictsOnlyIdleFullBuckets(t *testing.T) {
+	// 1 token per second, burst 2: a drained bucket needs ~2s to be full again
+	rl := ratelimit.NewRateLimiter(1, 2)
+	defer rl.Close()
+	before := metricValue(t, "charon_ratelimit_buckets", nil)
+
+	for i := 0; i < 10; i++ {
+		rl.Allow(fmt.Sprintf("10.0.0.%d", i)) // one request each, stays nearly full
+	}
+	rl.Allow("busy")
+	rl.Allow("busy") // drained
+	if got := metricValue(t, "charon_ratelimit_buckets", nil) - before; got != 11 {
+		t.Fatalf("Expected 11 live buckets in the gauge, got %v", got)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if n := rl.EvictIdle(time.Second); n != 10 {
+		t.Errorf("Expected the 10 refilled buckets to be evicted, got %d", n)
+	}
+	if rl.Len() != 1 {
+		t.Errorf("Expected the drained bucket to survive, %d buckets left", rl.Len())
+	}
+	if got := metricValue(t, "charon_ratelimit_buckets", nil) - before; got != 1 {
+		t.Errorf("Expected the gauge to drop to 1 live bucket, got %v", got)
+	}
+	// The surviving bucket still limits
+	if rl.Allow("busy") && rl.Allow("busy") {
+		t.Error("Eviction must not reset an in-progress limit")
+	}
+}
+
+func TestRateLimiterSweeperAndClose(t *testing.T) {
+	rl := ratelimit.NewRateLimiter(100, 100)
+	rl.StartEviction(100 * time.Millisecond) // sweeps every second
+	rl.Allow("idle-client")
+
+	deadline := time.Now().Add(3 * time.Second)
+	for rl.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if rl.Len() != 0 {
+		t.Fatal("Expected the sweeper to evict the idle bucket")
+	}
+
+	rl.Close()
+	rl.Close() // idempotent
+	rl.Allow("after-close")
+	time.Sleep(1500 * time.Millisecond)
+	if rl.Len() != 1 {
+		t.Errorf("Expected no sweeping after Close, %d buckets left", rl.Len())
+	}
+	if !rl.Allow("after-close") {
+		t.Error("Limiting should keep working after Close")
+	}
+}
+
+func TestRateLimitDimensionsBucketIdleTTL(t *testing.T) {
+	build := func(ttl string) *ratelimit.RateLimiter {
+		t.Helper()
+		dims, err := ratelimit.Dimensions(config.RateLimitConfig{RequestsPerSecond: 100, BurstSize: 100, BucketIdleTTL: ttl})
+		if err != nil {
+			t.Fatalf("Dimensions(%q) failed: %v", ttl, err)
+		}
+		t.Cleanup(dims[0].Limiter.Close)
+		dims[0].Limiter.Allow("/idle")
+		return dims[0].Limiter
+	}
+	evicting, keeping := build("100ms"), build("0")
+
+	// The sweeper runs at least every second
+	deadline := time.Now().Add(3 * time.Second)
+	for evicting.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if evicting.Len() != 0 {
+		t.Error("Expected bucket_idle_ttl to evict the idle bucket")
+	}
+	if keeping.Len() != 1 {
+		t.Errorf("Expected bucket_idle_ttl 0 to keep the bucket, %d left", keeping.Len())
+	}
+
+	if _, err := ratelimit.Dimensions(config.RateLimitConfig{RequestsPerSecond: 1, BucketIdleTTL: "-1m"}); err == nil {
+		t.Error("Expected a negative bucket_idle_ttl rejected")
+	}
+	if _, err := config.LoadConfig(writeConfig(t, "rate_limit:\n  bucket_idle_ttl: \"later\"\n")); err == nil {
+		t.Error("Expected an invalid bucket_idle_ttl rejected by the config")
+	}
+}
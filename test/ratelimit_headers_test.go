@@ -0,0 +1,74 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+)
+
+func TestTokenBucketStateDoesNotConsume(t *testing.T) {
+	tb := ratelimit.NewTokenBucket(3, 1)
+	for i := 0; i < 5; i++ {
+		if st := tb.State(); st.Limit != 3 || st.Remaining != 3 || st.Reset != 0 {
+			t.Fatalf("Unexpected state of a full bucket: %+v", st)
+		}
+	}
+	ok, st := tb.AllowState()
+	if !ok || st.Remaining != 2 {
+		t.Fatalf("Expected allowed with 2 remaining, got ok=%v %+v", ok, st)
+	}
+	if st.Reset <= 0 || st.Reset > time.Second {
+		t.Errorf("Expected next token within a second, got %v", st.Reset)
+	}
+}
+
+func TestHTTPProxyRateLimitHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+
+	listenAddr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.RateLimits = ratelimit.NewPolicy(
+			newDimension(t, "per-ip", "ip", 5),
+			newDimension(t, "global", "global", 2),
+		)
+	})
+
+	get := func() *http.Response {
+		t.Helper()
+		resp, err := http.Get("http://" + listenAddr + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// The most constrained dimension (global) is reported
+	resp := get()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	if l, r := resp.Header.Get("X-RateLimit-Limit"), resp.Header.Get("X-RateLimit-Remaining"); l != "2" || r != "1" {
+		t.Errorf("Expected limit 2 remaining 1, got %q %q", l, r)
+	}
+	if resp.Header.Get("X-RateLimit-Reset") == "" || resp.Header.Get("Retry-After") != "" {
+		t.Errorf("Unexpected reset headers on allowed response: %v", resp.Header)
+	}
+
+	get()
+	resp = get()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", resp.StatusCode)
+	}
+	if r := resp.Header.Get("X-RateLimit-Remaining"); r != "0" {
+		t.Errorf("Expected 0 remaining, got %q", r)
+	}
+	if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || n < 1 {
+		t.Errorf("Expected Retry-After of at least 1 second, got %q", resp.Header.Get("Retry-After"))
+	}
+}
@@ -0,0 +1,39 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+)
+
+func TestTokenBucketKeepsFractionalTokens(t *testing.T) {
+	const rate, burst = 20, 5
+	exact := ratelimit.NewTokenBucket(burst, rate)  // called at the configured rate
+	double := ratelimit.NewTokenBucket(burst, rate) // called at twice the rate
+
+	// Each call to double accrues half a token, which used to be truncated away
+	ticker := time.NewTicker(time.Second / (2 * rate))
+	defer ticker.Stop()
+	start := time.Now()
+	var exactDenied, doubleAllowed int
+	for i := 0; i < 6*rate; i++ { // 3 seconds
+		<-ticker.C
+		if i%2 == 0 && !exact.Allow() {
+			exactDenied++
+		}
+		if double.Allow() {
+			doubleAllowed++
+		}
+	}
+	elapsed := time.Since(start).Seconds()
+
+	if exactDenied != 0 {
+		t.Errorf("Expected every request at the configured rate to pass, %d were denied", exactDenied)
+	}
+	// burst plus what accrued over the run, give or take the token in progress
+	want := burst + int(elapsed*rate)
+	if doubleAllowed < want-1 || doubleAllowed > want+1 {
+		t.Errorf("Expected about %d requests allowed at twice the rate over %.2fs, got %d", want, elapsed, doubleAllowed)
+	}
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/ratelimit"
+)
+
+func TestRateLimitPerRouteLimits(t *testing.T) {
+	cfg := loadConfigFile(t, `
+rate_limit:
+  requests_per_second: 1
+  burst_size: 2
+  routes:
+    - path: "/search"
+      requests_per_second: 1
+      burst_size: 5
+    - path: "/export"
+      requests_per_second: 1
+      burst_size: 1
+`)
+	want := []config.RateLimitRoute{
+		{Path: "/search", RequestsPerSecond: 1, BurstSize: 5},
+		{Path: "/export", RequestsPerSecond: 1, BurstSize: 1},
+	}
+	if len(cfg.RateLimit.Routes) != 2 || cfg.RateLimit.Routes[0] != want[0] || cfg.RateLimit.Routes[1] != want[1] {
+		t.Fatalf("Expected per-route limits loaded, got %+v", cfg.RateLimit.Routes)
+	}
+
+	dimensions, err := ratelimit.Dimensions(cfg.RateLimit)
+	if err != nil {
+		t.Fatalf("Dimensions failed: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, d := range dimensions {
+			d.Limiter.Close()
+		}
+	})
+	policy := ratelimit.NewPolicy(dimensions...)
+	allowed := func(path string, n int) int {
+		got := 0
+		for i := 0; i < n; i++ {
+			if _, ok := policy.Allow(requestFrom("10.0.0.1:1000", path)); ok {
+				got++
+			}
+		}
+		return got
+	}
+	if got := allowed("/search", 3) + allowed("/search/books", 3) + allowed("/search?q=x", 4); got != 5 {
+		t.Errorf("Expected every path under /search to share its burst of 5, got %d", got)
+	}
+	if got := allowed("/export", 10); got != 1 {
+		t.Errorf("Expected /export to allow its burst of 1, got %d", got)
+	}
+	if got := allowed("/other", 10); got != 2 {
+		t.Errorf("Expected unlisted routes to use the global burst of 2, got %d", got)
+	}
+	if got := allowed("/another", 10); got != 2 {
+		t.Errorf("Expected each unlisted path to keep its own bucket, got %d", got)
+	}
+	d := policy.Check(requestFrom("10.0.0.1:1000", "/search"))
+	if d.Allowed || d.State.Limit != 5 {
+		t.Errorf("Expected the /search bucket to report its own limit, got %+v", d)
+	}
+
+	// Without a global limit, unlisted routes are not limited
+	unlimited := ratelimit.NewRouteRateLimiter(0, 0, []ratelimit.RouteLimit{{Prefix: "/search", RPS: 1, Burst: 5}})
+	for i := 0; i < 10; i++ {
+		if !unlimited.Allow("/other") {
+			t.Fatalf("Expected unlisted routes unlimited without a global limit, rejected request %d", i+1)
+		}
+	}
+	if unlimited.Len() != 0 {
+		t.Errorf("Expected no buckets for unlimited routes, got %d", unlimited.Len())
+	}
+}
+
+func TestRateLimitRoutesPlainPrefixes(t *testing.T) {
+	cfg := loadConfigFile(t, `
+rate_limit:
+  requests_per_second: 10
+  burst_size: 20
+  routes: ["/api", {path: "/export", requests_per_second: 2}]
+`)
+	want := []config.RateLimitRoute{{Path: "/api"}, {Path: "/export", RequestsPerSecond: 2}}
+	if len(cfg.RateLimit.Routes) != 2 || cfg.RateLimit.Routes[0] != want[0] || cfg.RateLimit.Routes[1] != want[1] {
+		t.Errorf("Expected plain prefixes and limits mixed, got %+v", cfg.RateLimit.Routes)
+	}
+
+	dimensions, err := ratelimit.Dimensions(cfg.RateLimit)
+	if err != nil || len(dimensions) != 1 {
+		t.Fatalf("Expected the route dimension, got %v (%v)", dimensions, err)
+	}
+	defer dimensions[0].Limiter.Close()
+	policy := ratelimit.NewPolicy(dimensions...)
+	allowed := func(path string, n int) int {
+		got := 0
+		for i := 0; i < n; i++ {
+			if _, ok := policy.Allow(requestFrom("10.0.0.1:1000", path)); ok {
+				got++
+			}
+		}
+		return got
+	}
+	// The global limit applies per path under a plain prefix, and only there
+	if got := allowed("/api/a", 25) + allowed("/api/b", 25); got != 40 {
+		t.Errorf("Expected the global burst of 20 for each path under /api, got %d", got)
+	}
+	if got := allowed("/export/a", 2) + allowed("/export/b", 2); got != 2 {
+		t.Errorf("Expected /export to share its burst of 2, got %d", got)
+	}
+	if got := allowed("/other", 25); got != 25 {
+		t.Errorf("Expected unlisted paths unlimited while prefixes gate the limit, got %d", got)
+	}
+
+	for _, bad := range []string{
+		"rate_limit:\n  routes:\n    - requests_per_second: 5\n",
+		"rate_limit:\n  routes:\n    - path: /x\n      burst_size: -1\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func TestRouteRedirect(t *testing.T) {
+	var resolves atomic.Int32
+	cfg := loadConfigFile(t, `
+strict_config: true
+routes:
+  - host: "www.example.com"
+    redirect:
+      to: "https://example.com{{path}}"
+      status: 301
+  - path_regex: "^/blog/(?P<slug>[^/]+)$"
+    redirect:
+      to: "/articles/{{slug}}"
+      status: 308
+  - path_regex: "^/old/([^/]+)/(\\d+)$"
+    redirect:
+      to: "/new/{{2}}?kind={{1}}"
+  - path_prefix: "/"
+    service: "app"
+registry_file: "registry.yaml"
+`)
+	if w := cfg.RoutingWarnings(); len(w) != 0 {
+		t.Errorf("Expected redirect routes without a service to need no warning, got %v", w)
+	}
+	addr, _ := startProxy(t, "", withRoutes(t, cfg.Routes), func(p *proxy.HTTPProxy) {
+		p.Resolver = func(r *http.Request) (*url.URL, error) {
+			resolves.Add(1)
+			return nil, http.ErrAbortHandler
+		}
+	})
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	cases := []struct {
+		host, path string
+		status     int
+		location   string
+	}{
+		{"www.example.com", "/shop/cart?ref=mail", http.StatusMovedPermanently, "https://example.com/shop/cart?ref=mail"},
+		{"", "/blog/hello-world", http.StatusPermanentRedirect, "/articles/hello-world"},
+		{"", "/old/shoes/42?utm=x", http.StatusFound, "/new/42?kind=shoes"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+c.path, nil)
+		if c.host != "" {
+			req.Host = c.host
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", c.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status || resp.Header.Get("Location") != c.location {
+			t.Errorf("%s%s: expected %d to %q, got %d to %q", c.host, c.path, c.status, c.location, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	if resolves.Load() != 0 {
+		t.Errorf("Expected redirects answered without resolving an upstream, got %d resolutions", resolves.Load())
+	}
+
+	for _, status := range []int{200, 303, 999} {
+		rules := []config.RouteRule{{PathPrefix: "/", Redirect: &config.RouteRedirectConfig{To: "/x", Status: status}}}
+		if _, err := routing.New(rules, ""); err == nil {
+			t.Errorf("Expected redirect status %d rejected", status)
+		}
+	}
+	if _, err := routing.New([]config.RouteRule{{PathPrefix: "/", Redirect: &config.RouteRedirectConfig{}}}, ""); err == nil {
+		t.Errorf("Expected a redirect without a target rejected")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	cases := []struct {
+		port, target, location string
+	}{
+		{"8443", "http://shop.example.com:8080/a/b?c=1", "https://shop.example.com:8443/a/b?c=1"},
+		{"443", "http://shop.example.com/a", "https://shop.example.com/a"},
+		{"8443", "http://[::1]:8080/", "https://[::1]:8443/"},
+	}
+	for _, c := range cases {
+		rr := httptest.NewRecorder()
+		proxy.HTTPSRedirect(c.port).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, c.target, nil))
+		if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != c.location {
+			t.Errorf("%s: expected 301 to %q, got %d to %q", c.target, c.location, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+
+	cfg := loadConfigFile(t, `
+listen_port: "8080"
+force_https: true
+tls:
+  enabled: true
+  server_port: "8443"
+`)
+	if !cfg.ForceHTTPS {
+		t.Errorf("Expected force_https loaded")
+	}
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/registry"
+)
+
+// fakeDNS answers lookups from a table that tests can change
+type fakeDNS struct {
+	mu      sync.Mutex
+	answers map[string][]string
+	fail    bool
+	block   chan struct{} // when set, lookups wait on it
+	calls   atomic.Int32
+}
+
+func (f *fakeDNS) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	f.calls.Add(1)
+	f.mu.Lock()
+	block := f.block
+	f.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return nil, errors.New("SERVFAIL")
+	}
+	var out []net.IPAddr
+	for _, ip := range f.answers[host] {
+		out = append(out, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return out, nil
+}
+
+func (f *fakeDNS) set(host string, ips ...string) {
+	f.mu.Lock()
+	f.answers[host] = ips
+	f.mu.Unlock()
+}
+
+func TestDNSExpanderCachesLookups(t *testing.T) {
+	dns := &fakeDNS{answers: map[string][]string{"api.internal": {"10.0.0.2", "10.0.0.1"}}}
+	e := registry.NewDNSExpander(time.Hour)
+	e.Lookup = dns.lookup
+	defer e.Close()
+
+	want := []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.9.9:80", "https://10.0.0.1:8443", "https://10.0.0.2:8443"}
+	for i := 0; i < 3; i++ {
+		got := e.Expand([]string{"api.internal:8080", "10.0.9.9:80", "https://api.internal:8443"})
+		if !slices.Equal(got, want) {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+	if n := dns.calls.Load(); n != 1 {
+		t.Errorf("Expected one lookup for repeated requests, got %d", n)
+	}
+
+	// Concurrent first requests for a new host share one lookup
+	dns.set("new.internal", "10.0.1.1")
+	gate := make(chan struct{})
+	dns.mu.Lock()
+	dns.block = gate
+	dns.mu.Unlock()
+	var wg sync.WaitGroup
+	results := make([][]string, 8)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = e.Expand([]string{"new.internal:80"})
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+	for _, got := range results {
+		if !slices.Equal(got, []string{"10.0.1.1:80"}) {
+			t.Errorf("Expected the shared answer, got %v", got)
+		}
+	}
+	if n := dns.calls.Load(); n != 2 {
+		t.Errorf("Expected a single lookup for the concurrent requests, got %d", n-1)
+	}
+}
+
+func TestDNSExpanderRefreshesInBackground(t *testing.T) {
+	dns := &fakeDNS{answers: map[string][]string{"api.internal": {"10.0.0.1"}}}
+	e := registry.NewDNSExpander(50 * time.Millisecond)
+	e.Lookup = dns.lookup
+	e.Start()
+	defer e.Close()
+
+	if got := e.Expand([]string{"api.internal:80"}); !slices.Equal(got, []string{"10.0.0.1:80"}) {
+		t.Fatalf("Unexpected first answer %v", got)
+	}
+
+	// A slow resolver no longer delays requests: they get the cached answer
+	gate := make(chan struct{})
+	dns.mu.Lock()
+	dns.block = gate
+	dns.mu.Unlock()
+	time.Sleep(120 * time.Millisecond) // a refresh is now stuck on the resolver
+	start := time.Now()
+	if got := e.Expand([]string{"api.internal:80"}); !slices.Equal(got, []string{"10.0.0.1:80"}) {
+		t.Errorf("Expected the cached answer, got %v", got)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("Expected the request served from cache, took %v", elapsed)
+	}
+
+	// A changed record is picked up by the refresh
+	dns.set("api.internal", "10.0.0.3", "10.0.0.4")
+	dns.mu.Lock()
+	dns.block = nil
+	dns.mu.Unlock()
+	close(gate)
+	deadline := time.Now().Add(2 * time.Second)
+	for !slices.Equal(e.Expand([]string{"api.internal:80"}), []string{"10.0.0.3:80", "10.0.0.4:80"}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the new records after a refresh, got %v", e.Expand([]string{"api.internal:80"}))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Failed refreshes keep the last good answer
+	dns.mu.Lock()
+	dns.fail = true
+	dns.mu.Unlock()
+	time.Sleep(120 * time.Millisecond)
+	if got := e.Expand([]string{"api.internal:80"}); !slices.Equal(got, []string{"10.0.0.3:80", "10.0.0.4:80"}) {
+		t.Errorf("Expected the last good answer while lookups fail, got %v", got)
+	}
+	// Unresolvable hosts pass through unchanged
+	if got := e.Expand([]string{"missing.internal:80"}); !slices.Equal(got, []string{"missing.internal:80"}) {
+		t.Errorf("Expected an unresolvable host kept, got %v", got)
+	}
+}
@@ -0,0 +1,153 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/admin"
+	"github.com/0xReLogic/Charon/internal/auth"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/registry"
+)
+
+func TestDynamicRegistryExpiry(t *testing.T) {
+	reg := registry.NewDynamicRegistry()
+	defer reg.Close()
+
+	if _, err := reg.Register("orders", "not-an-address", 1, time.Minute); err == nil {
+		t.Error("Expected invalid address to be rejected")
+	}
+	if _, err := reg.Register("orders", "10.0.0.1:8080", 1, 200*time.Millisecond); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, err := reg.Register("orders", "10.0.0.2:8080", 3, time.Minute); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	endpoints, err := reg.ResolveServiceEndpoints("orders")
+	if err != nil || len(endpoints) != 2 || !endpoints[0].Weighted || endpoints[1].Weight != 3 {
+		t.Fatalf("Expected two weighted endpoints, got %v (%v)", endpoints, err)
+	}
+
+	// Heartbeats extend the TTL; the instance that is not refreshed expires
+	time.Sleep(120 * time.Millisecond)
+	if _, err := reg.Register("orders", "10.0.0.2:8080", 3, time.Minute); err != nil {
+		t.Fatalf("Heartbeat failed: %v", err)
+	}
+	time.Sleep(120 * time.Millisecond)
+	endpoints, err = reg.ResolveServiceEndpoints("orders")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Addr != "10.0.0.2:8080" {
+		t.Fatalf("Expected only the refreshed instance, got %v (%v)", endpoints, err)
+	}
+
+	if !reg.Deregister("orders", "10.0.0.2:8080") || reg.Deregister("orders", "10.0.0.2:8080") {
+		t.Error("Expected deregistration to succeed exactly once")
+	}
+	if _, err := reg.ResolveServiceEndpoints("orders"); err == nil {
+		t.Error("Expected an error for a service without instances")
+	}
+}
+
+func TestAdminRegistryAPI(t *testing.T) {
+	reg := registry.NewDynamicRegistry()
+	defer reg.Close()
+	mux := http.NewServeMux()
+	(&admin.Server{Registry: reg}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := do("POST", "/admin/registry/orders", `{"address": "127.0.0.1:9001"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 on register, got %d", resp.StatusCode)
+	}
+	if resp := do("POST", "/admin/registry/orders", `{"address": "127.0.0.1:9002", "weight": 2, "ttl": "1m"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 on register, got %d", resp.StatusCode)
+	}
+	for _, body := range []string{`{"address": "127.0.0.1:9003", "ttl": "soon"}`, `{"weight": 1}`, `{"address": "127.0.0.1:9003", "weight": -1}`} {
+		if resp := do("POST", "/admin/registry/orders", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/admin/registry/orders")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var list struct {
+		Instances []registry.Instance `json:"instances"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Instances) != 2 || list.Instances[0].Weight != 1 || list.Instances[1].Weight != 2 {
+		t.Fatalf("Unexpected instances %+v", list.Instances)
+	}
+
+	if resp := do("DELETE", "/admin/registry/orders/127.0.0.1:9001", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 on deregister, got %d", resp.StatusCode)
+	}
+	if resp := do("DELETE", "/admin/registry/orders/127.0.0.1:9001", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown instance, got %d", resp.StatusCode)
+	}
+	endpoints, err := reg.ResolveServiceEndpoints("orders")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Addr != "127.0.0.1:9002" {
+		t.Errorf("Expected the remaining instance, got %v (%v)", endpoints, err)
+	}
+}
+
+func TestAdminRegistryRequiresAuth(t *testing.T) {
+	reg := registry.NewDynamicRegistry()
+	defer reg.Close()
+	keys, err := auth.NewAPIKeyAuth("", "", nil, []auth.Key{{Name: "ops", Key: "secret", Tier: "admin"}}, "")
+	if err != nil {
+		t.Fatalf("NewAPIKeyAuth failed: %v", err)
+	}
+	mux := http.NewServeMux()
+	(&admin.Server{Registry: reg, APIKeys: keys}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/admin/registry/orders", "application/json", strings.NewReader(`{"address": "127.0.0.1:9001"}`))
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unauthenticated registration, got %d", resp.StatusCode)
+	}
+	if got := reg.Instances("orders"); len(got) != 0 {
+		t.Errorf("Expected nothing registered, got %v", got)
+	}
+}
+
+func TestRegistryAPIConfigValidation(t *testing.T) {
+	for _, bad := range []string{
+		"registry:\n  type: api\n",
+		"registry:\n  type: api\nadmin:\n  enabled: true\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+	for _, good := range []string{
+		"registry:\n  type: api\nadmin:\n  enabled: true\n  listen_addr: \"127.0.0.1:9090\"\n",
+		"registry:\n  type: api\nadmin:\n  enabled: true\nauth:\n  api_key:\n    enabled: true\n    keys:\n      - name: ops\n        key: secret\n        tier: admin\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, good)); err != nil {
+			t.Errorf("Expected config accepted, got %v:\n%s", err, good)
+		}
+	}
+}
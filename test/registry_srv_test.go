@@ -0,0 +1,138 @@
+package test
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/registry"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeSRVServer answers SRV queries from records, keyed by query name
+type fakeSRVServer struct {
+	mu      sync.Mutex
+	records map[string][]dnsmessage.SRVResource
+	ttl     uint32
+	queries atomic.Int32
+}
+
+func (s *fakeSRVServer) set(name string, records ...dnsmessage.SRVResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[name] = records
+}
+
+func startFakeSRVServer(t *testing.T, ttl uint32) (*fakeSRVServer, string) {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	s := &fakeSRVServer{records: map[string][]dnsmessage.SRVResource{}, ttl: ttl}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if query.Unpack(buf[:n]) != nil || len(query.Questions) != 1 {
+				continue
+			}
+			s.queries.Add(1)
+			q := query.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true, RCode: dnsmessage.RCodeNameError},
+				Questions: query.Questions,
+			}
+			s.mu.Lock()
+			for _, rec := range s.records[q.Name.String()] {
+				resp.RCode = dnsmessage.RCodeSuccess
+				rec := rec
+				resp.Answers = append(resp.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: s.ttl},
+					Body:   &rec,
+				})
+			}
+			s.mu.Unlock()
+			out, err := resp.Pack()
+			if err == nil {
+				_, _ = pc.WriteTo(out, addr)
+			}
+		}
+	}()
+	return s, pc.LocalAddr().String()
+}
+
+func srvRecord(target string, port, priority, weight uint16) dnsmessage.SRVResource {
+	return dnsmessage.SRVResource{Target: dnsmessage.MustNewName(target), Port: port, Priority: priority, Weight: weight}
+}
+
+func TestSRVResolver(t *testing.T) {
+	server, addr := startFakeSRVServer(t, 1)
+	server.set("_orders._tcp.shop.svc.cluster.local.",
+		srvRecord("orders-0.orders.shop.svc.cluster.local.", 8080, 10, 30),
+		srvRecord("orders-1.orders.shop.svc.cluster.local.", 8080, 10, 10),
+		srvRecord("orders-backup.example.com.", 9090, 20, 100), // backup priority, not used while priority 10 has records
+	)
+
+	r, err := registry.NewSRVResolver("shop", "", addr)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	if got := r.Name("orders"); got != "_orders._tcp.shop.svc.cluster.local." {
+		t.Errorf("Unexpected SRV name %q", got)
+	}
+
+	endpoints, err := r.ResolveServiceEndpoints("orders")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	want := []registry.Endpoint{
+		{Addr: "orders-0.orders.shop.svc.cluster.local:8080", Weight: 30, Weighted: true},
+		{Addr: "orders-1.orders.shop.svc.cluster.local:8080", Weight: 10, Weighted: true},
+	}
+	if len(endpoints) != len(want) || endpoints[0] != want[0] || endpoints[1] != want[1] {
+		t.Fatalf("Expected %v, got %v", want, endpoints)
+	}
+
+	// Cached until the TTL expires
+	for i := 0; i < 5; i++ {
+		_, _ = r.ResolveServiceEndpoints("orders")
+	}
+	if n := server.queries.Load(); n != 1 {
+		t.Errorf("Expected a single lookup within the TTL, got %d", n)
+	}
+
+	// After expiry the records are looked up again
+	server.set("_orders._tcp.shop.svc.cluster.local.", srvRecord("orders-2.orders.shop.svc.cluster.local.", 8080, 0, 0))
+	time.Sleep(1100 * time.Millisecond)
+	endpoints, err = r.ResolveServiceEndpoints("orders")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Addr != "orders-2.orders.shop.svc.cluster.local:8080" || endpoints[0].Weighted {
+		t.Fatalf("Expected re-resolved endpoint, got %v (%v)", endpoints, err)
+	}
+
+	// An empty answer keeps the last good endpoints
+	server.set("_orders._tcp.shop.svc.cluster.local.")
+	time.Sleep(1100 * time.Millisecond)
+	endpoints, err = r.ResolveServiceEndpoints("orders")
+	if err != nil || len(endpoints) != 1 || endpoints[0].Addr != "orders-2.orders.shop.svc.cluster.local:8080" {
+		t.Errorf("Expected previous endpoints to be kept, got %v (%v)", endpoints, err)
+	}
+
+	// Unknown services fail, and the failure is cached briefly
+	before := server.queries.Load()
+	for i := 0; i < 3; i++ {
+		if _, err := r.ResolveServiceEndpoints("missing"); err == nil {
+			t.Fatal("Expected an error for a service without records")
+		}
+	}
+	if n := server.queries.Load() - before; n != 1 {
+		t.Errorf("Expected one lookup for the missing service, got %d", n)
+	}
+}
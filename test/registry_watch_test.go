@@ -0,0 +1,53 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/registry"
+)
+
+func TestRegistryWatchSurvivesAtomicReplace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "registry.yaml")
+	// Every version gets the same mtime, so only the watcher can notice the change
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	write := func(name, addr string) string {
+		t.Helper()
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("services:\n  svc: \""+addr+"\"\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write registry: %v", err)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+		return p
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(3 * time.Second)
+		for {
+			addrs, err := registry.ResolveServiceAddresses(path, "svc")
+			if err == nil && len(addrs) == 1 && addrs[0] == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected svc -> %s, got %v (%v)", want, addrs, err)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	write("registry.yaml", "10.0.0.1:80")
+	waitFor("10.0.0.1:80")
+	// Replace the file twice the way editors do; the second replace is only
+	// seen if the watch followed the first one
+	for i, addr := range []string{"10.0.0.2:80", "10.0.0.3:80"} {
+		if err := os.Rename(write("registry.yaml.tmp", addr), path); err != nil {
+			t.Fatalf("Replace %d failed: %v", i+1, err)
+		}
+		waitFor(addr)
+	}
+}
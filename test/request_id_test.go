@@ -0,0 +1,61 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	seen := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Get("X-Request-ID")
+		// An upstream echoing the ID must not duplicate it in the response
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.RequestIDHeader = proxy.DefaultRequestIDHeader
+	})
+
+	get := func(id string) (response []string, upstream string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+		if id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.Header.Values("X-Request-ID"), <-seen
+	}
+
+	// Without an ID one is generated and used on both sides
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	resp, up := get("")
+	if len(resp) != 1 || !generated.MatchString(resp[0]) || up != resp[0] {
+		t.Errorf("Expected one generated ID sent upstream and returned, got response %v upstream %q", resp, up)
+	}
+	second, _ := get("")
+	if len(second) == 1 && second[0] == resp[0] {
+		t.Errorf("Expected a new ID per request, got %q twice", resp[0])
+	}
+
+	// A client ID is reused as-is
+	if resp, up := get("client-abc-123"); len(resp) != 1 || resp[0] != "client-abc-123" || up != "client-abc-123" {
+		t.Errorf("Expected the client ID reused, got response %v upstream %q", resp, up)
+	}
+
+	// Unusable client IDs are replaced
+	if resp, up := get("has spaces"); len(resp) != 1 || !generated.MatchString(resp[0]) || up != resp[0] {
+		t.Errorf("Expected an invalid client ID replaced, got response %v upstream %q", resp, up)
+	}
+}
@@ -0,0 +1,52 @@
+package test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestHTTPProxyResolvesOncePerRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	var calls atomic.Int32
+	var fail atomic.Bool
+	addr, _ := startProxy(t, "", func(p *proxy.HTTPProxy) {
+		p.Resolver = func(r *http.Request) (*url.URL, error) {
+			calls.Add(1)
+			if fail.Load() {
+				return nil, errors.New("no upstream")
+			}
+			return u, nil
+		}
+	})
+
+	for _, failing := range []bool{false, true} {
+		fail.Store(failing)
+		calls.Store(0)
+		for i := 0; i < 5; i++ {
+			// POST is not retried, which would only slow the failing case down
+			resp, err := http.Post("http://"+addr+"/", "text/plain", nil)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			if want := map[bool]int{false: http.StatusOK, true: http.StatusBadGateway}[failing]; resp.StatusCode != want {
+				t.Errorf("Expected %d (resolver failing: %v), got %d", want, failing, resp.StatusCode)
+			}
+		}
+		if n := calls.Load(); n != 5 {
+			t.Errorf("Expected 5 resolutions for 5 requests (resolver failing: %v), got %d", failing, n)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func TestRouteRespond(t *testing.T) {
+	var hits, resolves atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = io.WriteString(w, "upstream")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	cfg := loadConfigFile(t, `
+strict_config: true
+routes:
+  - path_prefix: "/shop"
+    respond:
+      status: 503
+      body: "<h1>Back soon</h1>"
+      headers:
+        Content-Type: "text/html"
+        Retry-After: "600"
+  - path_exact: "/robots.txt"
+    respond:
+      body: "User-agent: *\nDisallow: /\n"
+  - path_prefix: "/"
+    service: "app"
+registry_file: "registry.yaml"
+`)
+	if w := cfg.RoutingWarnings(); len(w) != 0 {
+		t.Errorf("Expected respond routes without a service to need no warning, got %v", w)
+	}
+	addr, _ := startProxy(t, "", withRoutes(t, cfg.Routes), func(p *proxy.HTTPProxy) {
+		p.Resolver = func(r *http.Request) (*url.URL, error) {
+			resolves.Add(1)
+			return u, nil
+		}
+	})
+
+	do := func(method, path string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, "http://"+addr+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := do(http.MethodGet, "/shop/cart")
+	if resp.StatusCode != http.StatusServiceUnavailable || body != "<h1>Back soon</h1>" {
+		t.Errorf("Expected the maintenance page, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Type") != "text/html" || resp.Header.Get("Retry-After") != "600" {
+		t.Errorf("Expected the configured headers, got %v", resp.Header)
+	}
+	resp, body = do(http.MethodGet, "/robots.txt")
+	if resp.StatusCode != http.StatusOK || body != "User-agent: *\nDisallow: /\n" || resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Errorf("Expected robots.txt from the edge, got %d %q %q", resp.StatusCode, body, resp.Header.Get("Content-Type"))
+	}
+	if resp, body = do(http.MethodHead, "/robots.txt"); resp.StatusCode != http.StatusOK || body != "" {
+		t.Errorf("Expected HEAD without a body, got %d %q", resp.StatusCode, body)
+	}
+	if hits.Load() != 0 || resolves.Load() != 0 {
+		t.Errorf("Expected no upstream contacted, got %d resolutions and %d requests", resolves.Load(), hits.Load())
+	}
+
+	if _, body = do(http.MethodGet, "/other"); body != "upstream" || hits.Load() != 1 {
+		t.Errorf("Expected other routes proxied, got %q", body)
+	}
+
+	if _, err := routing.New([]config.RouteRule{{PathPrefix: "/", Respond: &config.RouteRespondConfig{Status: 999}}}, ""); err == nil {
+		t.Errorf("Expected an invalid respond status rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestResponseFingerprintHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "gunicorn/20.1.0")
+		w.Header().Set("X-Powered-By", "PHP/8.1")
+		w.Header().Set("X-AspNet-Version", "4.0.30319")
+		w.Header().Set("X-App", "kept")
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+
+	cfg := loadConfigFile(t, `
+response:
+  remove_headers: ["X-Powered-By", "X-AspNet-Version"]
+  set_headers:
+    Server: "Charon"
+routes:
+  - path_prefix: "/custom"
+    response_headers:
+      set:
+        Server: "edge-01"
+`)
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, cfg.Routes), func(p *proxy.HTTPProxy) {
+		p.ResponseHeaders = &config.HeaderRulesConfig{Remove: cfg.Response.RemoveHeaders, Set: cfg.Response.SetHeaders}
+	})
+
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Server"); got != "Charon" {
+		t.Errorf("Expected the upstream Server header replaced, got %q", got)
+	}
+	if resp.Header.Get("X-Powered-By") != "" || resp.Header.Get("X-AspNet-Version") != "" {
+		t.Errorf("Expected fingerprinting headers removed, got %v", resp.Header)
+	}
+	if resp.Header.Get("X-App") != "kept" {
+		t.Errorf("Expected other headers kept, got %v", resp.Header)
+	}
+
+	// A route's response_headers apply after the global rules
+	resp, err = http.Get("http://" + addr + "/custom")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Server"); got != "edge-01" {
+		t.Errorf("Expected the route to override the global Server, got %q", got)
+	}
+
+	// Unset keeps the X-Powered-By default; an explicit empty list keeps every header
+	if cfg := loadConfigFile(t, "listen_port: \"8080\"\n"); cfg.Response.RemoveHeaders != nil {
+		t.Errorf("Expected remove_headers unset, got %v", cfg.Response.RemoveHeaders)
+	}
+	if cfg := loadConfigFile(t, "response:\n  remove_headers: []\n"); cfg.Response.RemoveHeaders == nil {
+		t.Error("Expected an explicit empty remove_headers to be distinguishable from unset")
+	}
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func startRetryProxy(t *testing.T, policy *proxy.RetryPolicy, handler http.HandlerFunc) string {
+	t.Helper()
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+	listenAddr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.Retry = policy
+	})
+	return listenAddr
+}
+
+// unavailableOnce answers 503 with Retry-After: 1 to the first request, then 200
+func unavailableOnce() http.HandlerFunc {
+	var hits atomic.Int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	addr := startRetryProxy(t, &proxy.RetryPolicy{Backoff: time.Millisecond, Statuses: []int{503}}, unavailableOnce())
+	start := time.Now()
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the retry to succeed, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("Retry ignored Retry-After: answered after %v", elapsed)
+	}
+}
+
+func TestRetryAfterCappedByBackoffMax(t *testing.T) {
+	addr := startRetryProxy(t, &proxy.RetryPolicy{Backoff: time.Millisecond, BackoffMax: 50 * time.Millisecond, Statuses: []int{503}}, unavailableOnce())
+	start := time.Now()
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the retry to succeed, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Retry-After not capped by backoff_max: answered after %v", elapsed)
+	}
+}
+
+func TestRetryBudgetExhaustion(t *testing.T) {
+	var hits atomic.Int32
+	addr := startRetryProxy(t, &proxy.RetryPolicy{MaxRetries: 1, Backoff: time.Millisecond, BudgetPercent: 1, Statuses: []int{503}},
+		func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+	before := metricValue(t, "charon_http_retry_budget_exhausted_total", nil)
+	const requests = 20
+	for i := 0; i < requests; i++ {
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		// The original response is served when no retry is left
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("Expected 503, got %d", resp.StatusCode)
+		}
+	}
+	// 10 tokens of initial burst, plus 1% of each request
+	if n := hits.Load(); n > requests+11 {
+		t.Errorf("Retry budget exceeded: %d upstream attempts for %d requests", n, requests)
+	}
+	if got := metricValue(t, "charon_http_retry_budget_exhausted_total", nil) - before; got < requests-11 {
+		t.Errorf("Expected budget exhaustion to be counted, got %v", got)
+	}
+}
+
+func TestRetryStatusesOptIn(t *testing.T) {
+	var hits atomic.Int32
+	addr := startRetryProxy(t, &proxy.RetryPolicy{Backoff: time.Millisecond},
+		func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+	// Without statuses a 503 is served as is, not retried
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || hits.Load() != 1 {
+		t.Errorf("Expected one attempt answered 503, got %d after %d attempts", resp.StatusCode, hits.Load())
+	}
+}
+
+func TestRetryDurationValidation(t *testing.T) {
+	cfg := loadConfigFile(t, "retry:\n  backoff: \"10ms\"\n  backoff_max: \"1s\"\nshutdown_timeout: \"5s\"\n")
+	if cfg.Retry.Backoff != "10ms" || cfg.ShutdownTimeout != "5s" {
+		t.Errorf("Expected the durations loaded, got %+v", cfg.Retry)
+	}
+	for _, bad := range []string{
+		"retry:\n  backoff: \"fast\"\n",
+		"retry:\n  backoff_max: \"-1s\"\n",
+		"hedging:\n  enabled: true\n  delay: \"soon\"\n",
+		"shutdown_timeout: \"30\"\n",
+		"default_timeout: \"0s\"\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func TestRouteRewrite(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.RequestURI())
+	}))
+	defer backend.Close()
+	rules := []config.RouteRule{
+		{PathRegex: "/users/(?P<id>[0-9]+)/orders/([a-z]+)", Rewrite: "/v2/customers/{{id}}/orders/{{2}}"},
+		{PathExact: "/legacy", Rewrite: "/modern"},
+		{PathPrefix: "/api", Rewrite: "/internal{{path}}"},
+	}
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, rules))
+	base := "http://" + addr
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"named and positional captures", "/users/42/orders/open", "/v2/customers/42/orders/open"},
+		{"query string kept", "/legacy?page=2", "/modern?page=2"},
+		{"whole path", "/api/items", "/internal/api/items"},
+		{"no rewrite without a matching rule", "/other", "/other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(base + tt.path)
+			if err != nil {
+				t.Fatalf("GET %s failed: %v", tt.path, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != tt.want {
+				t.Errorf("Expected the upstream to receive %q, got %q", tt.want, body)
+			}
+		})
+	}
+
+	if _, err := routing.New([]config.RouteRule{{PathPrefix: "/a", Rewrite: "b/{{path}}"}}, ""); err == nil {
+		t.Error("Expected a rewrite without a leading / rejected")
+	}
+}
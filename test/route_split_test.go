@@ -0,0 +1,81 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func TestRouteSplit(t *testing.T) {
+	cfg := loadConfigFile(t, `
+routes:
+  - path_prefix: "/checkout"
+    service: "checkout"
+    split:
+      match:
+        headers:
+          X-Canary: "true"
+        service: "checkout-canary"
+      services:
+        - service: "checkout"
+          weight: 80
+        - service: "checkout-canary"
+          weight: 20
+  - path_prefix: "/search"
+    service: "search"
+    split:
+      match:
+        cookies:
+          beta: "~^(yes|1)$"
+        service: "search-beta"
+`)
+	router, err := routing.New(cfg.Routes, "")
+	if err != nil {
+		t.Fatalf("Failed to build router: %v", err)
+	}
+
+	// Requests satisfying the match always go to its service
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/checkout/cart", nil)
+		req.Header.Set("X-Canary", "true")
+		if got := router.Match(req).Service; got != "checkout-canary" {
+			t.Fatalf("Expected a canary header to force checkout-canary, got %s", got)
+		}
+	}
+
+	// Everyone else is split by weight
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/checkout/cart", nil)
+		req.Header.Set("X-Canary", "false")
+		counts[router.Match(req).Service]++
+	}
+	if len(counts) != 2 || counts["checkout-canary"] < 250 || counts["checkout-canary"] > 550 {
+		t.Errorf("Expected about 20%% of 2000 requests on checkout-canary, got %v", counts)
+	}
+
+	// Without weights, requests that don't match stay on the route's service
+	req := httptest.NewRequest(http.MethodGet, "/search", nil)
+	req.AddCookie(&http.Cookie{Name: "beta", Value: "yes"})
+	if got := router.Match(req).Service; got != "search-beta" {
+		t.Errorf("Expected the beta cookie to route to search-beta, got %s", got)
+	}
+	if got := router.Match(httptest.NewRequest(http.MethodGet, "/search", nil)).Service; got != "search" {
+		t.Errorf("Expected other requests to stay on search, got %s", got)
+	}
+
+	for name, split := range map[string]*config.RouteSplitConfig{
+		"empty":                   {},
+		"match without service":   {Match: &config.RouteSplitMatch{Headers: map[string]string{"x-canary": "true"}}},
+		"match without predicate": {Match: &config.RouteSplitMatch{Service: "canary"}},
+		"zero weights":            {Services: []config.RouteSplitService{{Service: "a"}, {Service: "b"}}},
+		"negative weight":         {Services: []config.RouteSplitService{{Service: "a", Weight: -1}, {Service: "b", Weight: 2}}},
+	} {
+		if _, err := routing.New([]config.RouteRule{{PathPrefix: "/", ServiceName: "a", Split: split}}, ""); err == nil {
+			t.Errorf("%s: expected the split rejected", name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func TestRouteTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	failures := make(chan string, 4) // the services of failed requests
+	rules := []config.RouteRule{
+		{PathPrefix: "/report", Timeout: "2s"},
+		{PathPrefix: "/ping", ServiceName: "ping", Timeout: "50ms"},
+	}
+	listenAddr, _ := startProxy(t, backend.URL, withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+		p.DefaultTimeout = 100 * time.Millisecond
+		p.OnUpstreamError = func(service, _ string) { failures <- service }
+	})
+
+	for _, tc := range []struct {
+		path string
+		want int
+	}{
+		{"/report", http.StatusOK},
+		{"/ping", http.StatusGatewayTimeout},
+		{"/other", http.StatusGatewayTimeout}, // default_timeout
+	} {
+		start := time.Now()
+		resp, err := http.Get("http://" + listenAddr + tc.path)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.path, resp.StatusCode, tc.want)
+		}
+		if tc.want == http.StatusGatewayTimeout && time.Since(start) > 250*time.Millisecond {
+			t.Errorf("%s: timeout answered after %v", tc.path, time.Since(start))
+		}
+	}
+	for _, want := range []string{"ping", ""} {
+		select {
+		case svc := <-failures:
+			if svc != want {
+				t.Errorf("Expected an upstream failure reported for service %q, got %q", want, svc)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected an upstream failure reported for service %q", want)
+		}
+	}
+	select {
+	case svc := <-failures:
+		t.Errorf("Expected 2 upstream failures for the timeouts, got another for %q", svc)
+	default:
+	}
+
+	if _, err := routing.New([]config.RouteRule{{PathPrefix: "/", Timeout: "soon"}}, ""); err == nil {
+		t.Error("Expected error for an invalid route timeout")
+	}
+}
@@ -0,0 +1,78 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+)
+
+func TestRoutingWarnings(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want []string // substrings of expected warnings, in order
+		mode string
+	}{
+		{
+			name: "service only",
+			cfg:  config.Config{TargetServiceName: "api", RegistryFile: "registry.yaml"},
+			mode: "service",
+		},
+		{
+			name: "service shadows static addr",
+			cfg:  config.Config{TargetServiceName: "api", TargetServiceAddr: "127.0.0.1:9000", RegistryFile: "registry.yaml"},
+			want: []string{"target_service_addr \"127.0.0.1:9000\" is ignored"},
+			mode: "service",
+		},
+		{
+			name: "route without service hits static addr",
+			cfg: config.Config{
+				TargetServiceAddr: "127.0.0.1:9000",
+				RegistryFile:      "registry.yaml",
+				Routes:            []config.RouteRule{{PathPrefix: "/api", ServiceName: "api"}, {PathPrefix: "/legacy"}},
+			},
+			want: []string{"1 route(s) have no service and send traffic to the static"},
+			mode: "routes",
+		},
+		{
+			name: "route without service falls back to default service",
+			cfg: config.Config{
+				TargetServiceName: "web",
+				RegistryFile:      "registry.yaml",
+				Routes:            []config.RouteRule{{PathPrefix: "/legacy"}},
+			},
+			want: []string{"route 0 has no service and falls back to target_service_name \"web\""},
+			mode: "routes+service",
+		},
+		{
+			name: "service without registry",
+			cfg:  config.Config{Routes: []config.RouteRule{{PathPrefix: "/api", ServiceName: "api"}}},
+			want: []string{"registry_file is empty"},
+			mode: "routes",
+		},
+		{
+			name: "nothing configured",
+			cfg:  config.Config{},
+			want: []string{"no routes, target_service_name or target_service_addr"},
+			mode: "none",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cfg.RoutingWarnings()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d warnings, got %d: %q", len(tt.want), len(got), got)
+			}
+			for i, w := range tt.want {
+				if !strings.Contains(got[i], w) {
+					t.Errorf("Warning %d: expected %q to contain %q", i, got[i], w)
+				}
+			}
+			if mode := tt.cfg.RoutingMode(); mode != tt.mode {
+				t.Errorf("Expected mode %q, got %q", tt.mode, mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/routing"
+)
+
+func TestRouteQueryMatch(t *testing.T) {
+	rules := []config.RouteRule{
+		{PathPrefix: "/api", QueryMatch: map[string]string{"version": "2"}, ServiceName: "api-v2"},
+		{PathPrefix: "/api", QueryMatch: map[string]string{"version": "~^3\\.[0-9]+$"}, ServiceName: "api-v3"},
+		// Keys arrive lowercased from the config file
+		{PathPrefix: "/api", QueryMatch: map[string]string{"apiversion": "5"}, ServiceName: "api-v5"},
+		{PathPrefix: "/api", QueryMatch: map[string]string{"Tenant": "acme"}, ServiceName: "api-acme"},
+		{PathPrefix: "/api", ServiceName: "api-v1"},
+	}
+	router, err := routing.New(rules, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		service string
+	}{
+		{"exact match", "/api/items?version=2", "api-v2"},
+		{"regex match", "/api/items?version=3.1", "api-v3"},
+		{"param absent falls through", "/api/items", "api-v1"},
+		{"param mismatch falls through", "/api/items?version=4", "api-v1"},
+		{"multi-value any match", "/api/items?version=1&version=2", "api-v2"},
+		{"empty value does not match", "/api/items?version=", "api-v1"},
+		{"name case-insensitive", "/api/items?apiVersion=5", "api-v5"},
+		{"mixed-case rule key", "/api/items?TENANT=acme", "api-acme"},
+		{"values across name cases", "/api/items?Version=1&VERSION=2", "api-v2"},
+		{"no rule matches", "/other?version=2", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if got := router.Match(req).Service; got != tt.service {
+				t.Errorf("Expected service %q, got %q", tt.service, got)
+			}
+		})
+	}
+}
+
+func TestRouteQueryMatchInvalidRegex(t *testing.T) {
+	rules := []config.RouteRule{
+		{PathPrefix: "/", QueryMatch: map[string]string{"v": "~(unclosed"}, ServiceName: "svc"},
+	}
+	if _, err := routing.New(rules, ""); err == nil {
+		t.Fatal("Expected error for invalid query_match regex")
+	}
+}
+
+func TestRouteHeaderAndCookieMatch(t *testing.T) {
+	rules := []config.RouteRule{
+		// Keys arrive lowercased from the config file
+		{PathPrefix: "/api", Headers: map[string]string{"x-api-version": "2"}, ServiceName: "api-v2"},
+		{PathPrefix: "/api", Headers: map[string]string{"x-api-version": "~^3(\\.[0-9]+)?$"}, ServiceName: "api-v3"},
+		{PathPrefix: "/api", Cookies: map[string]string{"variant": "b"}, ServiceName: "api-experiment"},
+		{PathPrefix: "/api", ServiceName: "api-v1"},
+	}
+	router, err := routing.New(rules, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		cookie  string
+		service string
+	}{
+		{"exact header", "2", "", "api-v2"},
+		{"regex header", "3.1", "", "api-v3"},
+		{"header mismatch falls through", "4", "", "api-v1"},
+		{"cookie match", "", "Variant=b", "api-experiment"},
+		{"cookie mismatch", "", "Variant=a", "api-v1"},
+		{"earlier header rule wins over cookie", "2", "Variant=b", "api-v2"},
+		{"no predicates", "", "", "api-v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/items", nil)
+			if tt.header != "" {
+				req.Header.Set("X-Api-Version", tt.header)
+			}
+			if tt.cookie != "" {
+				req.Header.Set("Cookie", tt.cookie)
+			}
+			if got := router.Match(req).Service; got != tt.service {
+				t.Errorf("Expected service %q, got %q", tt.service, got)
+			}
+		})
+	}
+
+	if _, err := routing.New([]config.RouteRule{{Headers: map[string]string{"x": "~("}}}, ""); err == nil {
+		t.Error("Expected error for invalid headers regex")
+	}
+}
+
+func TestRoutePathExactAndRegex(t *testing.T) {
+	rules := []config.RouteRule{
+		// Listed first, but prefix rules only apply when no exact or regex rule matches
+		{PathPrefix: "/users", ServiceName: "users-prefix"},
+		{PathRegex: `/users/(?P<id>[0-9]+)/orders`, ServiceName: "orders"},
+		{PathRegex: `/users/[^/]+`, ServiceName: "users-regex"},
+		{PathExact: "/users", ServiceName: "users-exact"},
+		{Host: "admin.local", PathExact: "/users/7/orders", ServiceName: "admin-orders"},
+	}
+	router, err := routing.New(rules, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		path    string
+		service string
+	}{
+		{"exact wins over prefix", "", "/users", "users-exact"},
+		{"regex wins over prefix", "", "/users/42/orders", "orders"},
+		{"first regex in order", "", "/users/alice", "users-regex"},
+		{"regex must match whole path", "", "/users/42/orders/9", "users-prefix"},
+		{"prefix still matches longer paths", "", "/users-admin", "users-prefix"},
+		{"exact with host wins over regex", "admin.local", "/users/7/orders", "admin-orders"},
+		{"exact host does not leak", "other.local", "/users/7/orders", "orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if got := router.Match(req).Service; got != tt.service {
+				t.Errorf("Expected service %q, got %q", tt.service, got)
+			}
+		})
+	}
+
+	m := router.Match(httptest.NewRequest("GET", "/users/42/orders", nil))
+	if m.PathParams["id"] != "42" || m.PathParams["1"] != "42" {
+		t.Errorf("Expected capture id=42, got %v", m.PathParams)
+	}
+}
+
+func TestRouteMethodMatch(t *testing.T) {
+	rules := []config.RouteRule{
+		{PathPrefix: "/orders", Methods: []string{"get", "HEAD"}, ServiceName: "orders-replica"},
+		{PathPrefix: "/orders", Methods: []string{"POST"}, ServiceName: "orders-primary"},
+		{PathPrefix: "/orders", ServiceName: "orders-any"},
+	}
+	router, err := routing.New(rules, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	for method, want := range map[string]string{
+		"GET":    "orders-replica",
+		"HEAD":   "orders-replica",
+		"POST":   "orders-primary",
+		"DELETE": "orders-any", // unlisted methods fall through to the next rule
+	} {
+		if got := router.Match(httptest.NewRequest(method, "/orders/1", nil)).Service; got != want {
+			t.Errorf("%s: expected service %q, got %q", method, want, got)
+		}
+	}
+}
+
+func TestRoutePathMatcherErrors(t *testing.T) {
+	for _, rule := range []config.RouteRule{
+		{PathRegex: "/users/(unclosed"},
+		{PathPrefix: "/a", PathExact: "/a"},
+		{PathExact: "/a", PathRegex: "/a"},
+	} {
+		if _, err := routing.New([]config.RouteRule{rule}, ""); err == nil {
+			t.Errorf("Expected config error for %+v", rule)
+		}
+	}
+}
+
+// linearMatch is the pre-index host/path scan, kept as a reference for the index.
+func linearMatch(rules []config.RouteRule, host, path string) string {
+	for _, rule := range rules {
+		if rule.Host != "" && !strings.EqualFold(rule.Host, host) {
+			continue
+		}
+		if rule.PathPrefix != "" && !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		return rule.ServiceName
+	}
+	return "default"
+}
+
+// largeRouteTable builds n routes spread over 50 hosts plus some host-less rules.
+func largeRouteTable(n int) []config.RouteRule {
+	rules := make([]config.RouteRule, 0, n)
+	for i := 0; i < n; i++ {
+		rule := config.RouteRule{
+			PathPrefix:  fmt.Sprintf("/api/v%d/resource%d", i%7, i),
+			ServiceName: fmt.Sprintf("svc-%d", i),
+		}
+		if i%10 != 0 {
+			rule.Host = fmt.Sprintf("host%d.example.com", i%50)
+		}
+		rules = append(rules, rule)
+	}
+	// Broad catch-alls late in the table must not shadow earlier specific rules
+	rules = append(rules,
+		config.RouteRule{PathPrefix: "/api", ServiceName: "api-catchall"},
+		config.RouteRule{Host: "host1.example.com", ServiceName: "host1-catchall"},
+	)
+	return rules
+}
+
+func TestRouterIndexPreservesOrder(t *testing.T) {
+	rules := largeRouteTable(2000)
+	router, err := routing.New(rules, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	for i := 0; i < 3000; i += 7 {
+		host := fmt.Sprintf("HOST%d.example.com", i%50)
+		path := fmt.Sprintf("/api/v%d/resource%d/items", i%7, i)
+		req := httptest.NewRequest("GET", path, nil)
+		req.Host = host + ":8080"
+		want := linearMatch(rules, host, path)
+		if got := router.Match(req).Service; got != want {
+			t.Fatalf("Host %s path %s: indexed match %q, linear match %q", host, path, got, want)
+		}
+	}
+}
+
+func BenchmarkRouterMatch5k(b *testing.B) {
+	rules := largeRouteTable(5000)
+	router, err := routing.New(rules, "default")
+	if err != nil {
+		b.Fatalf("Failed to create router: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/api/v3/resource4999/items", nil)
+	req.Host = "host49.example.com"
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.Match(req)
+	}
+}
+
+func BenchmarkLinearMatch5k(b *testing.B) {
+	rules := largeRouteTable(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearMatch(rules, "host49.example.com", "/api/v3/resource4999/items")
+	}
+}
+
+func TestRouteHostAsService(t *testing.T) {
+	rules := []config.RouteRule{
+		{Host: "billing.internal", PathPrefix: "/", ServiceName: "payments"},
+		{PathPrefix: "/admin", ServiceName: "admin"},
+	}
+	router, err := routing.New(rules, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	known := map[string]bool{"orders": true, "billing": true}
+	router.EnableHostAsService(".internal", func(service string) bool { return known[service] })
+
+	tests := []struct {
+		name    string
+		host    string
+		path    string
+		service string
+		rule    bool
+	}{
+		{"host names a service", "orders", "/items", "orders", false},
+		{"suffix stripped", "orders.internal", "/items", "orders", false},
+		{"case and port ignored", "Orders.Internal:8080", "/items", "orders", false},
+		{"unknown service falls back", "unknown.internal", "/items", "default", false},
+		{"bare suffix falls back", ".internal", "/items", "default", false},
+		{"host rule takes precedence", "billing.internal", "/items", "payments", true},
+		{"path rule takes precedence", "orders.internal", "/admin/users", "admin", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Host = tt.host
+			m := router.Match(req)
+			if m.Service != tt.service {
+				t.Errorf("Expected service %q, got %q", tt.service, m.Service)
+			}
+			if (m.Rule != nil) != tt.rule {
+				t.Errorf("Expected matched rule %v, got %+v", tt.rule, m.Rule)
+			}
+		})
+	}
+
+	// Without host_as_service the Host header does not pick a service
+	plain, err := routing.New(rules, "default")
+	if err != nil {
+		t.Fatalf("Failed to create router: %v", err)
+	}
+	req := httptest.NewRequest("GET", "/items", nil)
+	req.Host = "orders.internal"
+	if got := plain.Match(req).Service; got != "default" {
+		t.Errorf("Expected the default service when disabled, got %q", got)
+	}
+}
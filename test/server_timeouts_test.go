@@ -0,0 +1,141 @@
+package test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestServerReadHeaderTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.Timeouts = proxy.ServerTimeouts{ReadHeaderTimeout: 200 * time.Millisecond}
+	})
+
+	// A client trickling its headers is disconnected instead of holding the connection
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: charon\r\n"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	start := time.Now()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.Copy(io.Discard, conn)
+	if elapsed := time.Since(start); err != nil || elapsed > time.Second {
+		t.Errorf("Expected the connection closed after the header timeout, got %v after %v", err, elapsed)
+	}
+
+	// Complete requests are unaffected
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+}
+
+// upgradeEcho accepts a protocol upgrade and echoes lines on the switched connection
+func upgradeEcho(w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+	_ = rw.Flush()
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		_, _ = rw.WriteString(line)
+		_ = rw.Flush()
+	}
+}
+
+// upgradeEchoBackend serves upgradeEcho
+func upgradeEchoBackend(t *testing.T) *url.URL {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(upgradeEcho))
+	t.Cleanup(backend.Close)
+	u, _ := url.Parse(backend.URL)
+	return u
+}
+
+// dialUpgrade sends an upgrade request through the proxy at addr, with extra
+// raw header lines, and expects 101 Switching Protocols
+func dialUpgrade(t *testing.T, addr, extraHeaders string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: charon\r\nUpgrade: echo\r\nConnection: Upgrade\r\n"+extraHeaders+"\r\n"); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected 101, got %v %v", resp, err)
+	}
+	return conn, br
+}
+
+// expectEcho writes a line on an upgraded connection and expects it back
+func expectEcho(t *testing.T, conn net.Conn, br *bufio.Reader, line string) {
+	t.Helper()
+	if _, err := io.WriteString(conn, line); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if got, err := br.ReadString('\n'); err != nil || got != line {
+		t.Errorf("Expected the echo %q, got %q %v", line, got, err)
+	}
+}
+
+func TestServerWriteTimeoutSparesUpgrades(t *testing.T) {
+	u := upgradeEchoBackend(t)
+
+	addr, _ := startProxy(t, u.String(), func(p *proxy.HTTPProxy) {
+		p.Timeouts = proxy.ServerTimeouts{WriteTimeout: 200 * time.Millisecond, ReadTimeout: 200 * time.Millisecond}
+	})
+
+	conn, br := dialUpgrade(t, addr, "")
+
+	// Well past both timeouts the upgraded connection still carries data
+	time.Sleep(400 * time.Millisecond)
+	expectEcho(t, conn, br, "ping\n")
+}
+
+func TestServerConfigValidation(t *testing.T) {
+	cfg := loadConfigFile(t, "server:\n  read_header_timeout: \"5s\"\n  write_timeout: \"1m\"\n")
+	if cfg.Server.ReadHeaderTimeout != "5s" || cfg.Server.WriteTimeout != "1m" {
+		t.Errorf("Expected server timeouts loaded, got %+v", cfg.Server)
+	}
+	for _, bad := range []string{
+		"server:\n  read_header_timeout: \"soon\"\n",
+		"server:\n  idle_timeout: \"-1s\"\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// statuses sends n requests to url and returns their statuses
+func statuses(t *testing.T, url string, n int) []int {
+	t.Helper()
+	var got []int
+	for i := 0; i < n; i++ {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		resp.Body.Close()
+		got = append(got, resp.StatusCode)
+	}
+	return got
+}
+
+func TestServiceMaxRPSIgnoresCase(t *testing.T) {
+	// Config keys arrive lowercased while route services keep their case
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	addr, _ := startProxy(t, backend.URL,
+		withRoutes(t, []config.RouteRule{{PathPrefix: "/Payments", ServiceName: "Payments"}}),
+		func(p *proxy.HTTPProxy) { p.Services = map[string]config.ServiceConfig{"payments": {MaxRPS: 1}} })
+	got := statuses(t, "http://"+addr+"/Payments", 2)
+	if got[0] != http.StatusOK || got[1] != http.StatusServiceUnavailable {
+		t.Errorf("Expected the payments limit applied to Payments, got %v", got)
+	}
+}
+
+// paymentsRoute sends /payments to the payments service
+var paymentsRoute = []config.RouteRule{{PathPrefix: "/payments", ServiceName: "payments"}}
+
+func TestServiceMaxRPSCountsRetries(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer backend.Close()
+	addr, _ := startProxy(t, backend.URL, withRoutes(t, paymentsRoute), func(p *proxy.HTTPProxy) {
+		p.Services = map[string]config.ServiceConfig{"payments": {MaxRPS: 2}}
+		p.Retry = &proxy.RetryPolicy{MaxRetries: 3, Backoff: time.Millisecond, Statuses: []int{http.StatusBadGateway}, BudgetPercent: -1}
+	})
+	target := "http://" + addr + "/payments"
+	limited := metricValue(t, "charon_upstream_rate_limited_total", nil)
+	rejected := metricValue(t, "charon_http_requests_total", map[string]string{"status": "503"})
+
+	// The first attempt and one retry use the two tokens; the next retry is held back
+	resp, err := http.Get(target)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if n := hits.Load(); n != 2 {
+		t.Errorf("Expected 2 attempts to reach the upstream, got %d", n)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("Expected 503 with Retry-After: 1 once the cap held a retry back, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if got := metricValue(t, "charon_upstream_rate_limited_total", nil) - limited; got != 1 {
+		t.Errorf("Expected 1 rate-limited attempt counted, got %v", got)
+	}
+	if got := metricValue(t, "charon_http_requests_total", map[string]string{"status": "503"}) - rejected; got != 1 {
+		t.Errorf("Expected the 503 recorded in charon_http_requests_total, got %v", got)
+	}
+}
+
+func TestServiceMaxRPSCountsHedges(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	var hedged atomic.Int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hedged.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+	su, _ := url.Parse(secondary.URL)
+	addr, _ := startProxy(t, primary.URL, withRoutes(t, paymentsRoute), func(p *proxy.HTTPProxy) {
+		p.Services = map[string]config.ServiceConfig{"payments": {MaxRPS: 1}}
+		p.Hedging = &proxy.HedgePolicy{
+			Delay: 20 * time.Millisecond,
+			Pick: func(r *http.Request, exclude []string) (*url.URL, error) {
+				if slices.Contains(exclude, su.Host) {
+					return nil, nil
+				}
+				return su, nil
+			},
+		}
+	})
+	target := "http://" + addr + "/payments"
+
+	// The primary takes the only token, so the hedge to the same service is held back
+	if got := statuses(t, target, 1); got[0] != http.StatusOK {
+		t.Errorf("Expected the primary to answer, got %d", got[0])
+	}
+	if n := hedged.Load(); n != 0 {
+		t.Errorf("Expected the hedge held back by max_rps, %d reached the upstream", n)
+	}
+}
+
+func TestServiceMaxRPSReload(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	addr, p := startProxy(t, backend.URL, withRoutes(t, paymentsRoute), func(p *proxy.HTTPProxy) {
+		p.Services = map[string]config.ServiceConfig{"payments": {MaxRPS: 1}}
+	})
+	target := "http://" + addr + "/payments"
+	ok, limited := http.StatusOK, http.StatusServiceUnavailable
+
+	if got := statuses(t, target, 2); !slices.Equal(got, []int{ok, limited}) {
+		t.Fatalf("Expected max_rps 1 enforced, got %v", got)
+	}
+
+	// A raised cap takes effect with a fresh bucket
+	p.SetServiceLimits(map[string]config.ServiceConfig{"payments": {MaxRPS: 3}})
+	if got := statuses(t, target, 4); !slices.Equal(got, []int{ok, ok, ok, limited}) {
+		t.Errorf("Expected max_rps 3 after the reload, got %v", got)
+	}
+
+	// An unchanged cap keeps its bucket, which is still empty
+	p.SetServiceLimits(map[string]config.ServiceConfig{"payments": {MaxRPS: 3}})
+	if got := statuses(t, target, 1); got[0] != limited {
+		t.Errorf("Expected the unchanged cap to keep its drained bucket, got %v", got)
+	}
+
+	// Removing the cap lifts it
+	p.SetServiceLimits(map[string]config.ServiceConfig{"payments": {}})
+	if got := statuses(t, target, 5); slices.Contains(got, limited) {
+		t.Errorf("Expected no limit once max_rps was removed, got %v", got)
+	}
+}
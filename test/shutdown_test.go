@@ -0,0 +1,85 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestHTTPProxyStopDrainsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	addr := freeAddr(t)
+	p := proxy.NewHTTPProxyWithResolver(addr, func(r *http.Request) (*url.URL, error) {
+		return u, nil
+	})
+	startErr := make(chan error, 1)
+	go func() { startErr <- p.Start() }()
+	select {
+	case <-p.Started():
+	case err := <-startErr:
+		t.Fatalf("Start failed: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Proxy did not signal Started")
+	}
+
+	// One request in flight when shutdown begins
+	type result struct {
+		body string
+		err  error
+	}
+	inflight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			inflight <- result{err: err}
+			return
+		}
+		b, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		inflight <- result{body: string(b), err: err}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		stopped <- p.Stop(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if !p.Draining() {
+		t.Error("Expected the proxy to report draining while stopping")
+	}
+	select {
+	case <-stopped:
+		t.Fatal("Stop returned before the in-flight request finished")
+	default:
+	}
+
+	close(release)
+	if res := <-inflight; res.err != nil || res.body != "done" {
+		t.Fatalf("In-flight request should complete, got body %q err %v", res.body, res.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Stop returned error: %v", err)
+	}
+	if err := <-startErr; err != nil {
+		t.Errorf("Start should return nil after Stop, got %v", err)
+	}
+	if _, err := http.Get("http://" + addr + "/after"); err == nil {
+		t.Error("Expected new connections to be refused after Stop")
+	}
+}
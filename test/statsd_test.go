@@ -0,0 +1,138 @@
+package test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/metrics"
+)
+
+// startStatsDListener listens for StatsD packets on a local UDP port
+func startStatsDListener(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readStatsD returns the packets received until the listener is quiet for wait
+// that contain match. Other tests' proxies may still be reporting to the sink.
+func readStatsD(conn net.PacketConn, wait time.Duration, match string) []string {
+	var lines []string
+	buf := make([]byte, 4096)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(wait))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return lines
+		}
+		if line := string(buf[:n]); strings.Contains(line, match) {
+			lines = append(lines, line)
+		}
+	}
+}
+
+// startStatsDProxy starts a proxy in front of a backend and returns the proxy
+// address and the backend's host:port, as reported in the upstream tag
+func startStatsDProxy(t *testing.T) (string, string) {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(backend.Close)
+	u, _ := url.Parse(backend.URL)
+	addr, _ := startProxy(t, backend.URL)
+	return addr, u.Host
+}
+
+func proxyGet(t *testing.T, url string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	resp.Body.Close()
+}
+
+func TestStatsDSink(t *testing.T) {
+	listener := startStatsDListener(t)
+	addr, upstream := startStatsDProxy(t)
+
+	for _, tc := range []struct {
+		name   string
+		tags   bool
+		suffix string
+	}{
+		{"dogstatsd", true, "|#method:GET,status:200,upstream:" + upstream},
+		{"plain", false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := metrics.NewStatsD(listener.LocalAddr().String(), "charon", tc.tags)
+			if err != nil {
+				t.Fatalf("Failed to create StatsD sink: %v", err)
+			}
+			defer sink.Close()
+			metrics.SetSink(sink)
+			defer metrics.SetSink(nil)
+
+			proxyGet(t, "http://"+addr+"/items")
+			proxyGet(t, "http://"+addr+"/items")
+			lines := readStatsD(listener, 200*time.Millisecond, "charon.http.")
+
+			var requests, timings int
+			for _, line := range lines {
+				if tc.tags && !strings.Contains(line, upstream) {
+					continue
+				}
+				switch {
+				case strings.HasPrefix(line, "charon.http.requests:"):
+					requests++
+					if want := "charon.http.requests:1|c" + tc.suffix; line != want {
+						t.Errorf("Expected %q, got %q", want, line)
+					}
+				case strings.HasPrefix(line, "charon.http.latency:"):
+					timings++
+					value, rest, _ := strings.Cut(strings.TrimPrefix(line, "charon.http.latency:"), "|")
+					if ms, err := strconv.ParseFloat(value, 64); err != nil || ms <= 0 || ms > 5000 {
+						t.Errorf("Expected a latency in milliseconds, got %q", line)
+					}
+					if want := "ms" + tc.suffix; rest != want {
+						t.Errorf("Expected the timer suffix %q, got %q", want, rest)
+					}
+				}
+			}
+			if requests != 2 || timings != 2 {
+				t.Errorf("Expected 2 request counters and 2 timers, got %d and %d in %q", requests, timings, lines)
+			}
+		})
+	}
+}
+
+func TestStatsDSinkUnconfigured(t *testing.T) {
+	listener := startStatsDListener(t)
+	addr, _ := startStatsDProxy(t)
+	sink, err := metrics.NewStatsD(listener.LocalAddr().String(), "charon", true)
+	if err != nil {
+		t.Fatalf("Failed to create StatsD sink: %v", err)
+	}
+	defer sink.Close()
+	metrics.SetSink(sink)
+	metrics.SetSink(nil)
+
+	// Once the sink is removed, mirroring is a no-op and requests are unaffected
+	metrics.Count("test.count", 1, map[string]string{"k": "v"})
+	metrics.Timing("test.timing", time.Millisecond, nil)
+	proxyGet(t, "http://"+addr+"/items")
+	if lines := readStatsD(listener, 200*time.Millisecond, ""); len(lines) != 0 {
+		t.Errorf("Expected nothing sent without a sink, got %q", lines)
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestStickySessionCookie(t *testing.T) {
+	var addrs []string
+	names := map[string]string{}
+	for _, name := range []string{"one", "two", "three"} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name)
+		}))
+		t.Cleanup(srv.Close)
+		addrs = append(addrs, srv.Listener.Addr().String())
+		names[name] = srv.Listener.Addr().String()
+	}
+	bal := balancer.New(balancer.Options{HealthInterval: time.Hour, FailureThreshold: 100})
+	defer bal.Close()
+	bal.SetServiceAddrs("app", addrs)
+
+	sticky := &proxy.StickyPolicy{}
+	// Resolves like cmd/charon: the cookie's upstream while it is usable, round-robin otherwise
+	resolver := func(r *http.Request) (*url.URL, error) {
+		if token := sticky.Token(r, "app"); token != "" {
+			for _, a := range addrs {
+				if sticky.UpstreamToken("app", a) == token && bal.Stick("app", a) {
+					return proxy.UpstreamURL(a, false)
+				}
+			}
+		}
+		return proxy.UpstreamURL(bal.Next("app", addrs), false)
+	}
+	addr, _ := startProxy(t, "", withRoutes(t, []config.RouteRule{{PathPrefix: "/", ServiceName: "app"}}), func(p *proxy.HTTPProxy) {
+		p.Resolver = resolver
+		p.Sticky = sticky
+	})
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	base, _ := url.Parse("http://" + addr + "/")
+	get := func() string {
+		t.Helper()
+		resp, err := client.Get(base.String())
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	first := get()
+	cookies := jar.Cookies(base)
+	if len(cookies) != 1 || cookies[0].Name != proxy.DefaultStickyCookie+"_app" {
+		t.Fatalf("Expected the %s_app cookie, got %v", proxy.DefaultStickyCookie, cookies)
+	}
+	if strings.Contains(cookies[0].Value, "127.0.0.1") || cookies[0].Value != sticky.UpstreamToken("app", names[first]) {
+		t.Errorf("Expected an opaque token, got %q", cookies[0].Value)
+	}
+	for i := 0; i < 3; i++ {
+		if got := get(); got != first {
+			t.Fatalf("Expected request %d with the cookie on %s, got %s", i+2, first, got)
+		}
+	}
+
+	// the pinned upstream fails: the client moves and the cookie follows
+	bal.MarkFailure(names[first])
+	moved := get()
+	if moved == first {
+		t.Fatalf("Expected a re-pick away from the unhealthy upstream")
+	}
+	if got := jar.Cookies(base)[0].Value; got != sticky.UpstreamToken("app", names[moved]) {
+		t.Errorf("Expected the cookie rewritten for %s", moved)
+	}
+	if got := get(); got != moved {
+		t.Errorf("Expected the client to stay on %s, got %s", moved, got)
+	}
+}
+
+func TestStickyTokens(t *testing.T) {
+	a := &proxy.StickyPolicy{Secret: []byte("shared")}
+	b := &proxy.StickyPolicy{Secret: []byte("shared")}
+	other := &proxy.StickyPolicy{Secret: []byte("other")}
+	random := &proxy.StickyPolicy{}
+
+	token := a.UpstreamToken("app", "10.0.0.1:80")
+	if token != b.UpstreamToken("app", "10.0.0.1:80") {
+		t.Error("Expected instances with the same secret to agree on tokens")
+	}
+	for name, got := range map[string]string{
+		"another secret":   other.UpstreamToken("app", "10.0.0.1:80"),
+		"a random secret":  random.UpstreamToken("app", "10.0.0.1:80"),
+		"another service":  a.UpstreamToken("api", "10.0.0.1:80"),
+		"another upstream": a.UpstreamToken("app", "10.0.0.2:80"),
+	} {
+		if got == token {
+			t.Errorf("Expected a different token for %s", name)
+		}
+	}
+	if random.UpstreamToken("app", "10.0.0.1:80") != random.UpstreamToken("app", "10.0.0.1:80") {
+		t.Error("Expected the random secret to stay the same within a process")
+	}
+
+	// Each service keeps its own cookie, so visiting one does not unpin the other
+	if a.CookieName("app") == a.CookieName("api") {
+		t.Errorf("Expected per-service cookie names, got %q", a.CookieName("app"))
+	}
+	if got := a.CookieName("my app/v2"); got != "CHARON_UPSTREAM_my_app_v2" {
+		t.Errorf("Expected a valid cookie name, got %q", got)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: a.CookieName("app"), Value: token})
+	if a.Token(req, "app") != token || a.Token(req, "api") != "" {
+		t.Error("Expected the token read from the service's own cookie only")
+	}
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestUpstreamMidStreamFailure(t *testing.T) {
+	// Backend promises 1000 bytes, sends a few and drops the connection
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 1000\r\n\r\npartial body")
+		_ = buf.Flush()
+		conn.Close()
+	}))
+	defer backend.Close()
+
+	var failures, successes int32
+	listenAddr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.OnUpstreamError = func(string, string) { atomic.AddInt32(&failures, 1) }
+		p.OnUpstreamSuccess = func(host string) { atomic.AddInt32(&successes, 1) }
+	})
+
+	before := metricValue(t, "charon_upstream_stream_errors_total", nil)
+	// Depending on buffering the client sees either a dropped connection or a truncated body,
+	// but never a clean response
+	resp, err := http.Get("http://" + listenAddr + "/stream")
+	if err == nil {
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr == nil {
+			t.Errorf("Expected a truncated response, read %d bytes cleanly", len(body))
+		}
+	}
+
+	if got := metricValue(t, "charon_upstream_stream_errors_total", nil) - before; got != 1 {
+		t.Errorf("Expected 1 stream error, got %v", got)
+	}
+	if n := atomic.LoadInt32(&failures); n != 1 {
+		t.Errorf("Expected mid-stream failure to be reported once, got %d", n)
+	}
+	if n := atomic.LoadInt32(&successes); n != 0 {
+		t.Errorf("Mid-stream failure must not count as success, got %d", n)
+	}
+}
@@ -0,0 +1,201 @@
+package test
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestTCPProxyBalancing(t *testing.T) {
+	a := startTagServer(t, "a")
+	b := startTagServer(t, "b")
+	dead := freeAddr(t) // nothing listens here
+
+	bal := balancer.New(balancer.Options{CoolDown: time.Minute})
+	defer bal.Close()
+	var mu sync.Mutex
+	addrs := []string{dead, a, b}
+	var dialErrors []string
+	dialed := 0
+
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, "")
+	p.Resolver = func(net.Addr) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return bal.Next("pool", addrs), nil
+	}
+	p.OnDialError = func(addr string) {
+		mu.Lock()
+		dialErrors = append(dialErrors, addr)
+		mu.Unlock()
+		bal.MarkFailure(addr)
+	}
+	p.OnDialSuccess = func(addr string) {
+		mu.Lock()
+		dialed++
+		mu.Unlock()
+		bal.MarkSuccess(addr)
+	}
+	go func() { _ = p.Start() }()
+	waitListening(t, listenAddr)
+
+	// The readiness probe of waitListening is proxied too; let it take its pick first
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		done := dialed > 0
+		mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	send := func() string {
+		t.Helper()
+		conn, err := net.Dial("tcp", listenAddr)
+		if err != nil {
+			t.Fatalf("Failed to dial proxy: %v", err)
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("ping"))
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		reply, _ := io.ReadAll(conn)
+		return string(reply)
+	}
+
+	// The dead upstream comes first: its dial fails, it is marked and the next one serves
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		reply := send()
+		tag, _, ok := strings.Cut(reply, ":")
+		if !ok {
+			t.Fatalf("Connection %d was not proxied, got %q", i, reply)
+		}
+		seen[tag]++
+	}
+	if seen["a"] != 3 || seen["b"] != 3 {
+		t.Errorf("Expected connections spread evenly across the live upstreams, got %v", seen)
+	}
+	mu.Lock()
+	if len(dialErrors) != 1 || dialErrors[0] != dead {
+		t.Errorf("Expected a single dial failure for %s (then cooldown), got %v", dead, dialErrors)
+	}
+
+	// With every upstream down the client connection is closed without a reply
+	addrs = []string{dead}
+	mu.Unlock()
+	if reply := send(); reply != "" {
+		t.Errorf("Expected no reply without a reachable upstream, got %q", reply)
+	}
+}
+
+// startHoldServer accepts connections and keeps them open until the client
+// closes, counting the open ones in active
+func startHoldServer(t *testing.T, active *atomic.Int64) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			active.Add(1)
+			go func(c net.Conn) {
+				defer active.Add(-1)
+				defer c.Close()
+				_, _ = io.Copy(io.Discard, c)
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestTCPProxyUpstreamHooks(t *testing.T) {
+	var activeA, activeB atomic.Int64
+	addrs := []string{startHoldServer(t, &activeA), startHoldServer(t, &activeB)}
+	bal := balancer.New(balancer.Options{HealthInterval: time.Hour})
+	defer bal.Close()
+
+	var mu sync.Mutex
+	clients := map[string]bool{}
+	open := map[string]int{}
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, "")
+	p.Resolver = func(client net.Addr) (string, error) {
+		mu.Lock()
+		clients[client.String()] = true
+		mu.Unlock()
+		return bal.NextP2C("held", addrs), nil
+	}
+	p.OnUpstreamStart = func(addr string) {
+		mu.Lock()
+		open[addr]++
+		mu.Unlock()
+		bal.Acquire(addr)
+	}
+	p.OnUpstreamDone = func(addr string) {
+		mu.Lock()
+		open[addr]--
+		mu.Unlock()
+		bal.Release(addr)
+	}
+	go func() { _ = p.Start() }()
+	waitListening(t, listenAddr)
+	// settled reports whether want connections are counted and the upstreams
+	// hold exactly the ones counted against them
+	settled := func(want int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return open[addrs[0]]+open[addrs[1]] == want &&
+			open[addrs[0]] == int(activeA.Load()) && open[addrs[1]] == int(activeB.Load())
+	}
+	waitFor := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !settled(want) && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if !settled(want) {
+			mu.Lock()
+			defer mu.Unlock()
+			t.Fatalf("Expected %d upstream connections counted as held (%d, %d), got %v", want, activeA.Load(), activeB.Load(), open)
+		}
+	}
+	waitFor(0) // the readiness probe of waitListening has come and gone
+
+	// Connections stay counted while they are held open
+	var held []net.Conn
+	for i := 0; i < 4; i++ {
+		conn, err := net.Dial("tcp", listenAddr)
+		if err != nil {
+			t.Fatalf("Failed to dial proxy: %v", err)
+		}
+		held = append(held, conn)
+		waitFor(i + 1)
+		mu.Lock()
+		if _, ok := clients[conn.LocalAddr().String()]; !ok {
+			t.Errorf("Expected the resolver to see client %s, got %v", conn.LocalAddr(), clients)
+		}
+		mu.Unlock()
+	}
+
+	// Closing the clients ends the upstream connections
+	for _, conn := range held {
+		conn.Close()
+	}
+	waitFor(0)
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/proxyproto"
+)
+
+func TestTCPProxyMaxConnections(t *testing.T) {
+	// The upstream holds every connection open until the client goes away
+	upstream, _ := startTCPUpstream(t, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, upstream)
+	p.MaxConnections = 2
+	go func() { _ = p.Start() }()
+	waitActive := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for p.ActiveConnections() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d active connections, got %d", want, p.ActiveConnections())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	// Dial until the proxy listens; a readiness probe would take a slot of its own
+	dial := func() net.Conn {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			conn, err := net.Dial("tcp", listenAddr)
+			if err == nil {
+				t.Cleanup(func() { conn.Close() })
+				return conn
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Failed to dial proxy: %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// closedByProxy reports whether the proxy hung up on conn
+	closedByProxy := func(conn net.Conn) bool {
+		_ = conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		_, err := conn.Read(make([]byte, 1))
+		return err == io.EOF
+	}
+
+	rejectedBefore := metricValue(t, "charon_tcp_connections_rejected_total", nil)
+	first, second := dial(), dial()
+	waitActive(2)
+	if v := metricValue(t, "charon_tcp_active_connections", nil); v < 2 {
+		t.Errorf("Expected charon_tcp_active_connections to count the open connections, got %v", v)
+	}
+
+	third := dial()
+	if !closedByProxy(third) {
+		t.Error("Expected the connection over max_connections to be closed")
+	}
+	if got := metricValue(t, "charon_tcp_connections_rejected_total", nil) - rejectedBefore; got != 1 {
+		t.Errorf("Expected one rejected connection, got %v", got)
+	}
+	if closedByProxy(first) || closedByProxy(second) {
+		t.Error("Expected the connections within the limit to stay open")
+	}
+
+	// A freed slot admits the next connection
+	first.Close()
+	waitActive(1)
+	if closedByProxy(dial()) {
+		t.Error("Expected a connection to be accepted once a slot is free")
+	}
+
+	// Raising the limit at runtime (config reload) admits more
+	p.SetMaxConnections(3)
+	if closedByProxy(dial()) {
+		t.Error("Expected a connection to be accepted after raising the limit")
+	}
+	waitActive(3)
+}
+
+func TestTCPProxyMaxConnectionsProxyProtocol(t *testing.T) {
+	upstream, _ := startTCPUpstream(t, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, upstream)
+	p.MaxConnections = 1
+	p.ProxyProtocol = &proxyproto.Options{Require: true, HeaderTimeout: 2 * time.Second}
+	go func() { _ = p.Start() }()
+
+	// Dial until the proxy listens; a readiness probe would take the only slot
+	deadline := time.Now().Add(2 * time.Second)
+	held, err := net.Dial("tcp", listenAddr)
+	for err != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		held, err = net.Dial("tcp", listenAddr)
+	}
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer held.Close()
+	_, _ = held.Write(proxyV2Header(net.ParseIP("198.51.100.9"), net.ParseIP("10.0.0.1"), 40000, 9000))
+	for p.ActiveConnections() != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// A client over the limit that never sends its header is shed at once,
+	// not after the header timeout
+	silent, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer silent.Close()
+	start := time.Now()
+	_ = silent.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, err = silent.Read(make([]byte, 1))
+	if elapsed := time.Since(start); err != io.EOF || elapsed > time.Second {
+		t.Errorf("Expected the rejected connection closed promptly, got %v after %v", err, elapsed)
+	}
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// startTagServer accepts connections, reads the first chunk and replies with tag + chunk.
+func startTagServer(t *testing.T, tag string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				buf := make([]byte, 1024)
+				n, _ := c.Read(buf)
+				_, _ = c.Write(append([]byte(tag+":"), buf[:n]...))
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestTCPProtocolSniffing(t *testing.T) {
+	tlsBackend := startTagServer(t, "tls")
+	plainBackend := startTagServer(t, "plain")
+
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, plainBackend)
+	p.ProtocolTargets = map[string]string{proxy.ProtocolTLS: tlsBackend}
+	p.SniffTimeout = 500 * time.Millisecond
+	go func() { _ = p.Start() }()
+	waitListening(t, listenAddr)
+
+	send := func(payload []byte) string {
+		conn, err := net.Dial("tcp", listenAddr)
+		if err != nil {
+			t.Fatalf("Failed to dial proxy: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write(payload); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		reply, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("Failed to read reply: %v", err)
+		}
+		return string(reply)
+	}
+
+	// TLS 1.2 handshake record header followed by a ClientHello type byte
+	clientHello := []byte{0x16, 0x03, 0x01, 0x00, 0x2f, 0x01, 0x00, 0x00, 0x2b, 0x03, 0x03}
+	if got := send(clientHello); !strings.HasPrefix(got, "tls:") {
+		t.Errorf("Expected TLS handshake routed to tls backend, got %q", got)
+	} else if got[len("tls:"):] != string(clientHello) {
+		t.Errorf("Expected peeked bytes to be replayed to backend, got %q", got)
+	}
+
+	if got := send([]byte("hello world\n")); got != "plain:hello world\n" {
+		t.Errorf("Expected plaintext line routed to plain backend, got %q", got)
+	}
+}
+
+func TestDetectProtocol(t *testing.T) {
+	tests := map[string]string{
+		"\x16\x03\x01\x02\x00": proxy.ProtocolTLS,
+		"GET / HTTP/1.1\r\n":   proxy.ProtocolHTTP,
+		"POST /x HTTP/1.1\r\n": proxy.ProtocolHTTP,
+		"hello\n":              proxy.ProtocolOther,
+		"SSH-2.0-OpenSSH":      proxy.ProtocolOther,
+	}
+	for in, want := range tests {
+		if got := proxy.DetectProtocol([]byte(in)); got != want {
+			t.Errorf("DetectProtocol(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
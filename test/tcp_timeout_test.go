@@ -0,0 +1,115 @@
+package test
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+// startTCPUpstream accepts connections and hands each to serve. Closed reports
+// when serve returned, i.e. when the upstream saw its side torn down.
+func startTCPUpstream(t *testing.T, serve func(net.Conn)) (addr string, closed chan struct{}) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	closed = make(chan struct{}, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+				closed <- struct{}{}
+			}()
+		}
+	}()
+	return ln.Addr().String(), closed
+}
+
+func TestTCPProxyIdleTimeout(t *testing.T) {
+	// The upstream reads the request and then goes silent
+	silent, closed := startTCPUpstream(t, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, silent)
+	p.IdleTimeout = 200 * time.Millisecond
+	go func() { _ = p.Start() }()
+	waitListening(t, listenAddr)
+
+	conn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("hello"))
+
+	start := time.Now()
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("Expected the proxy to close the idle connection, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Idle connection reaped after %v, expected about 200ms", elapsed)
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the upstream side to be closed as well")
+	}
+}
+
+func TestTCPProxyMaxConnectionDuration(t *testing.T) {
+	// The upstream keeps sending, so the connection never goes idle
+	chatty, closed := startTCPUpstream(t, func(conn net.Conn) {
+		for {
+			if _, err := conn.Write([]byte("tick\n")); err != nil {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	})
+
+	listenAddr := freeAddr(t)
+	p := proxy.NewTCPProxy(listenAddr, chatty)
+	p.IdleTimeout = 200 * time.Millisecond
+	p.MaxConnectionDuration = 600 * time.Millisecond
+	go func() { _ = p.Start() }()
+	waitListening(t, listenAddr)
+
+	conn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	defer conn.Close()
+
+	// The client never writes: traffic from the upstream alone keeps it open past the idle timeout
+	start := time.Now()
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	data, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Expected the proxy to close the connection, got %v", err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 500*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("Connection closed after %v, expected about 600ms", elapsed)
+	}
+	if len(data) == 0 {
+		t.Error("Expected upstream data before the connection was closed")
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the upstream side to be closed as well")
+	}
+}
@@ -2,11 +2,15 @@ package test
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -163,3 +167,166 @@ func TestTLSConfigValidation(t *testing.T) {
 		t.Error("Client CA cert pool is nil")
 	}
 }
+
+func TestACMEManager(t *testing.T) {
+	if _, err := tlsutils.NewACMEManager(nil, "", t.TempDir(), true); err == nil {
+		t.Error("Expected an error without domains")
+	}
+
+	am, err := tlsutils.NewACMEManager([]string{"proxy.example.com"}, "ops@example.com", t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("Failed to create ACME manager: %v", err)
+	}
+	serverConfig := am.GetServerTLSConfig()
+	if serverConfig.GetCertificate == nil || serverConfig.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("Unexpected server TLS config: %+v", serverConfig)
+	}
+
+	// Names outside the configured domains are refused before contacting the CA
+	_, err = serverConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"})
+	if err == nil || !strings.Contains(err.Error(), "tls.acme.domains") {
+		t.Errorf("Expected guidance about tls.acme.domains, got %v", err)
+	}
+
+	// Plain HTTP requests that are not challenges are redirected to HTTPS
+	rec := httptest.NewRecorder()
+	am.HTTPHandler(nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://proxy.example.com/status", nil))
+	if loc := rec.Header().Get("Location"); loc != "https://proxy.example.com/status" {
+		t.Errorf("Expected redirect to HTTPS, got %d %q", rec.Code, loc)
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	for _, tc := range []struct {
+		min, max string
+		suites   []string
+		errPart  string
+	}{
+		{min: "1.4", errPart: "unknown TLS version"},
+		{min: "1.3", max: "1.2", errPart: "lower than min_version"},
+		{suites: []string{"TLS_FAKE_SUITE"}, errPart: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+		{suites: []string{"TLS_AES_128_GCM_SHA256"}, errPart: "TLS 1.3 suite"},
+		{suites: []string{"TLS_RSA_WITH_RC4_128_SHA"}, errPart: "insecure"},
+		{min: "1.3", suites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}, errPart: "min_version is 1.3"},
+	} {
+		if _, err := tlsutils.ParseOptions(tc.min, tc.max, tc.suites); err == nil || !strings.Contains(err.Error(), tc.errPart) {
+			t.Errorf("ParseOptions(%q, %q, %v): expected error containing %q, got %v", tc.min, tc.max, tc.suites, tc.errPart, err)
+		}
+	}
+
+	opts, err := tlsutils.ParseOptions("", "", []string{"tls_ecdhe_rsa_with_aes_256_gcm_sha384"})
+	if err != nil {
+		t.Fatalf("ParseOptions failed: %v", err)
+	}
+	if opts.MinVersion != tls.VersionTLS12 || len(opts.CipherSuites) != 1 || opts.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+
+	// A server pinned to TLS 1.3 refuses clients limited to TLS 1.2
+	certManager, err := tlsutils.NewCertManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create cert manager: %v", err)
+	}
+	pinned, _ := tlsutils.ParseOptions("1.3", "", nil)
+	certManager.SetOptions(pinned)
+	serverConfig := certManager.GetServerTLSConfig()
+	if serverConfig.MinVersion != tls.VersionTLS13 || certManager.GetClientTLSConfig().MinVersion != tls.VersionTLS13 {
+		t.Fatal("Options not applied to server and client configs")
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	clientConfig := certManager.GetClientTLSConfig()
+	clientConfig.ServerName = "localhost"
+	clientConfig.MinVersion, clientConfig.MaxVersion = tls.VersionTLS12, tls.VersionTLS12
+	if conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig); err == nil {
+		conn.Close()
+		t.Error("TLS 1.2 client connected to a TLS 1.3-only server")
+	}
+	clientConfig = certManager.GetClientTLSConfig()
+	clientConfig.ServerName = "localhost"
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("TLS 1.3 handshake failed: %v", err)
+	}
+	if v := conn.ConnectionState().Version; v != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3, got %x", v)
+	}
+	conn.Close()
+}
+
+func TestExternalCertManager(t *testing.T) {
+	// Certificates from "another PKI": generated once, then only read
+	pki := t.TempDir()
+	if _, err := tlsutils.NewCertManager(pki); err != nil {
+		t.Fatalf("Failed to create PKI: %v", err)
+	}
+	path := func(name string) string { return filepath.Join(pki, name) }
+
+	if _, err := tlsutils.NewExternalCertManager("", path("server-key.pem"), ""); err == nil {
+		t.Error("Expected an error without server_cert")
+	}
+	if _, err := tlsutils.NewExternalCertManager(path("server-cert.pem"), path("server-key.pem"), path("missing.pem")); err == nil {
+		t.Error("Expected an error for a missing client CA")
+	}
+
+	certManager, err := tlsutils.NewExternalCertManager(path("server-cert.pem"), path("server-key.pem"), path("ca-cert.pem"))
+	if err != nil {
+		t.Fatalf("Failed to load external certificates: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = certManager.GetServerTLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	caPEM, _ := os.ReadFile(path("ca-cert.pem"))
+	roots.AppendCertsFromPEM(caPEM)
+	clientCert, err := tls.LoadX509KeyPair(path("client-cert.pem"), path("client-key.pem"))
+	if err != nil {
+		t.Fatalf("Failed to load client certificate: %v", err)
+	}
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: roots, ServerName: "localhost", Certificates: certs,
+		}}}
+	}
+
+	resp, err := client(clientCert).Get(server.URL)
+	if err != nil {
+		t.Fatalf("mTLS request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if len(body) == 0 {
+		t.Error("Expected the verified client certificate to reach the handler")
+	}
+	if resp, err := client().Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Request without a client certificate should be rejected")
+	}
+
+	// Without a client CA the server only presents its certificate
+	plain, err := tlsutils.NewExternalCertManager(path("server-cert.pem"), path("server-key.pem"), "")
+	if err != nil {
+		t.Fatalf("Failed to load external certificates: %v", err)
+	}
+	if cfg := plain.GetServerTLSConfig(); cfg.ClientAuth != tls.NoClientCert || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("Unexpected server TLS config without client CA: %+v", cfg)
+	}
+}
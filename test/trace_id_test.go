@@ -0,0 +1,23 @@
+package test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/logging"
+)
+
+func TestGenerateTraceIDUnique(t *testing.T) {
+	traceID := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	seen := make(map[string]bool, 10000)
+	for i := 0; i < 10000; i++ {
+		id := logging.GenerateTraceID()
+		if !traceID.MatchString(id) || id == "00000000000000000000000000000000" {
+			t.Fatalf("Expected a W3C trace ID (32 lowercase hex, not all zeros), got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("Trace ID %q generated twice after %d calls", id, i)
+		}
+		seen[id] = true
+	}
+}
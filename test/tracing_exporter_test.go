@@ -0,0 +1,52 @@
+package test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/tracing"
+)
+
+func TestTracingDownCollectorAddsNoLatency(t *testing.T) {
+	// Collector that accepts connections but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	shutdown, err := tracing.InitTracingWithOptions("charon-test", "http://"+ln.Addr().String(), tracing.ExporterOptions{
+		QueueSize:     16,
+		BatchSize:     4,
+		BatchTimeout:  10 * time.Millisecond,
+		ExportTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to init tracing: %v", err)
+	}
+	defer shutdown()
+
+	before := metricValue(t, "charon_trace_spans_dropped_total", nil)
+	start := time.Now()
+	for i := 0; i < 5000; i++ {
+		_, span := tracing.StartSpan(context.Background(), "request")
+		span.End()
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Ending spans with a down collector took %v", elapsed)
+	}
+	if dropped := metricValue(t, "charon_trace_spans_dropped_total", nil) - before; dropped < 5000-16-4 {
+		t.Errorf("Expected most spans to be dropped, got %v", dropped)
+	}
+}
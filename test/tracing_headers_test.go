@@ -0,0 +1,122 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/0xReLogic/Charon/internal/proxy"
+	"github.com/0xReLogic/Charon/internal/tracing"
+)
+
+// recordSpans installs a global tracer provider that keeps ended spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	sr := tracetest.NewSpanRecorder()
+	tp := tracesdk.NewTracerProvider(tracesdk.WithSampler(tracesdk.AlwaysSample()), tracesdk.WithSpanProcessor(sr))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+		_ = tp.Shutdown(context.Background())
+	})
+	return sr
+}
+
+func TestTracingHeaderAttributes(t *testing.T) {
+	const (
+		traceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID    = "00f067aa0ba902b7"
+		traceparent = "00-" + traceID + "-" + parentID + "-01"
+		tracestate  = "vendor=opaque,other=t61rcWkgMzE"
+	)
+	sr := recordSpans(t)
+	got := make(chan http.Header, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	cfg := loadConfigFile(t, `
+tracing:
+  redact_headers: ["X-Session-Token"]
+auth:
+  api_key:
+    header: X-Partner-Key
+`)
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.TraceHeaders = tracing.NewHeaderRecorder(
+			[]string{"x-tenant-id", "Authorization", "X-Api-Key", "X-Session-Token", "X-Partner-Key", "X-Missing"},
+			cfg.TraceRedactHeaders(),
+		)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/orders", nil)
+	req.Header.Set("Traceparent", traceparent)
+	req.Header.Set("Tracestate", tracestate)
+	req.Header.Add("X-Tenant-Id", "acme")
+	req.Header.Add("X-Tenant-Id", "globex")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "secret")
+	req.Header.Set("X-Session-Token", "secret")
+	req.Header.Set("X-Partner-Key", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	// The upstream continues the same trace with tracestate untouched
+	upstream := <-got
+	if ts := upstream.Get("Tracestate"); ts != tracestate {
+		t.Errorf("Expected tracestate %q forwarded unchanged, got %q", tracestate, ts)
+	}
+	tp := strings.Split(upstream.Get("Traceparent"), "-")
+	if len(tp) != 4 || tp[1] != traceID || tp[2] == parentID {
+		t.Errorf("Expected traceparent continuing trace %s from the proxy's span, got %q", traceID, upstream.Get("Traceparent"))
+	}
+
+	// The span ends after the handler returns, possibly after the client saw the response
+	var span tracesdk.ReadOnlySpan
+	for deadline := time.Now().Add(2 * time.Second); span == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected an http_request span in trace %s", traceID)
+		}
+		for _, s := range sr.Ended() {
+			if s.Name() == "http_request" && s.SpanContext().TraceID().String() == traceID {
+				span = s
+			}
+		}
+	}
+	if span.Parent().SpanID().String() != parentID {
+		t.Errorf("Expected the span parented to %s, got %s", parentID, span.Parent().SpanID())
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if v := attrs["http.request.header.x-tenant-id"].AsStringSlice(); len(v) != 2 || v[0] != "acme" || v[1] != "globex" {
+		t.Errorf("Expected both X-Tenant-Id values recorded, got %v", v)
+	}
+	// Default credential headers, redact_headers and the API key header
+	for _, name := range []string{"authorization", "x-api-key", "x-session-token", "x-partner-key"} {
+		if v := attrs[attribute.Key("http.request.header."+name)]; v.AsString() != "[REDACTED]" {
+			t.Errorf("Expected %s redacted, got %q", name, v.Emit())
+		}
+	}
+	if _, ok := attrs["http.request.header.x-missing"]; ok {
+		t.Error("Expected no attribute for an absent header")
+	}
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/tracing"
+)
+
+func TestTracingSampleRate(t *testing.T) {
+	sampled := func(rate float64, parent context.Context) bool {
+		tp := tracesdk.NewTracerProvider(tracesdk.WithSampler(tracing.NewSampler(rate)))
+		defer func() { _ = tp.Shutdown(context.Background()) }()
+		_, span := tp.Tracer("test").Start(parent, "request")
+		defer span.End()
+		return span.SpanContext().IsSampled()
+	}
+	remoteParent := func(flags trace.TraceFlags) context.Context {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1, 2, 3},
+			SpanID:     trace.SpanID{4, 5, 6},
+			TraceFlags: flags,
+			Remote:     true,
+		})
+		return trace.ContextWithRemoteSpanContext(context.Background(), sc)
+	}
+
+	if !sampled(1, context.Background()) {
+		t.Error("Expected every new trace sampled at rate 1")
+	}
+	if sampled(0, context.Background()) {
+		t.Error("Expected no new trace sampled at rate 0")
+	}
+	if !sampled(0, remoteParent(trace.FlagsSampled)) {
+		t.Error("Expected a sampled incoming parent to be honored at rate 0")
+	}
+	if sampled(1, remoteParent(0)) {
+		t.Error("Expected an unsampled incoming parent to be honored at rate 1")
+	}
+
+	n := 0
+	for i := 0; i < 2000; i++ {
+		if sampled(0.25, context.Background()) {
+			n++
+		}
+	}
+	if n < 350 || n > 650 {
+		t.Errorf("Expected about 500 of 2000 traces sampled at 0.25, got %d", n)
+	}
+}
+
+func TestTracingSampleRateValidation(t *testing.T) {
+	cfg := loadConfigFile(t, "tracing:\n  sample_rate: 0.5\n")
+	if cfg.Tracing.SampleRate == nil || *cfg.Tracing.SampleRate != 0.5 {
+		t.Errorf("Expected sample_rate 0.5, got %v", cfg.Tracing.SampleRate)
+	}
+	if cfg := loadConfigFile(t, "tracing:\n  enabled: true\n"); cfg.Tracing.SampleRate != nil {
+		t.Errorf("Expected sample_rate unset by default, got %v", *cfg.Tracing.SampleRate)
+	}
+	for _, rate := range []string{"1.5", "-0.1"} {
+		_, err := config.LoadConfig(writeConfig(t, "tracing:\n  sample_rate: "+rate+"\n"))
+		if err == nil || !strings.Contains(err.Error(), "sample_rate") {
+			t.Errorf("Expected sample_rate %s rejected at load, got %v", rate, err)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/config"
+	"github.com/0xReLogic/Charon/internal/proxy"
+)
+
+func TestTransportSettings(t *testing.T) {
+	var active, peak atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		} else {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.Transport = proxy.TransportSettings{MaxConnsPerHost: 1, ResponseHeaderTimeout: 150 * time.Millisecond}
+	})
+
+	// max_conns_per_host queues requests instead of opening more connections
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post("http://"+addr+"/fast", "text/plain", bytes.NewReader(nil))
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected queued requests to succeed, got %d", resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got != 1 {
+		t.Errorf("Expected at most 1 concurrent upstream request, got %d", got)
+	}
+
+	// response_header_timeout bounds requests without a route timeout
+	start := time.Now()
+	resp, err := http.Post("http://"+addr+"/slow", "text/plain", bytes.NewReader(nil))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || time.Since(start) > 280*time.Millisecond {
+		t.Errorf("Expected 502 after the response header timeout, got %d after %v", resp.StatusCode, time.Since(start))
+	}
+}
+
+func TestTransportConfigValidation(t *testing.T) {
+	cfg := loadConfigFile(t, `
+transport:
+  max_idle_conns_per_host: 64
+  max_conns_per_host: 128
+  dial_timeout: "2s"
+  idle_conn_timeout: "2m"
+`)
+	if cfg.Transport.MaxIdleConnsPerHost != 64 || cfg.Transport.MaxConnsPerHost != 128 || cfg.Transport.DialTimeout != "2s" {
+		t.Errorf("Expected transport settings loaded, got %+v", cfg.Transport)
+	}
+	for _, bad := range []string{
+		"transport:\n  dial_timeout: \"fast\"\n",
+		"transport:\n  response_header_timeout: \"0s\"\n",
+		"transport:\n  max_idle_conns: -1\n",
+		"transport:\n  buffer_size: -1\n",
+	} {
+		if _, err := config.LoadConfig(writeConfig(t, bad)); err == nil {
+			t.Errorf("Expected config rejected:\n%s", bad)
+		}
+	}
+}
+
+func TestTransportPoolPerUpstream(t *testing.T) {
+	// newConns counts the connections a backend accepted
+	newBackend := func(newConns *atomic.Int32) *httptest.Server {
+		s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				newConns.Add(1)
+			}
+		}
+		s.Start()
+		return s
+	}
+	var connsA, connsB atomic.Int32
+	a, b := newBackend(&connsA), newBackend(&connsB)
+	defer a.Close()
+	defer b.Close()
+	ua, _ := url.Parse(a.URL)
+	ub, _ := url.Parse(b.URL)
+
+	addr, _ := startProxy(t, "", func(p *proxy.HTTPProxy) {
+		p.Resolver = func(r *http.Request) (*url.URL, error) {
+			if strings.HasPrefix(r.URL.Path, "/b") {
+				return ub, nil
+			}
+			return ua, nil
+		}
+		// A single idle slot would be shared, and taken by A, with one pool for every upstream
+		p.Transport = proxy.TransportSettings{MaxIdleConns: 1}
+	})
+
+	get := func(path string) {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	get("/b")
+	for i := 0; i < 5; i++ {
+		get("/a")
+	}
+	get("/b")
+
+	if got := connsB.Load(); got != 1 {
+		t.Errorf("Expected B's idle connection reused despite traffic to A, B accepted %d connections", got)
+	}
+	if got := connsA.Load(); got != 1 {
+		t.Errorf("Expected A to reuse its own idle connection, A accepted %d connections", got)
+	}
+}
+
+func TestTransportForgetsRemovedUpstreams(t *testing.T) {
+	var closed atomic.Int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	addr, p := startProxy(t, backend.URL)
+	bal := balancer.New(balancer.Options{HealthInterval: time.Hour, OnForget: p.ForgetUpstream})
+	defer bal.Close()
+
+	get := func() {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	bal.SetServiceAddrs("orders", []string{u.Host})
+	bal.SetServiceAddrs("billing", []string{u.Host})
+	get() // leaves an idle connection in the upstream's pool
+
+	// Still an upstream of billing: the pool stays
+	bal.SetServiceAddrs("orders", nil)
+	time.Sleep(100 * time.Millisecond)
+	if n := closed.Load(); n != 0 {
+		t.Fatalf("Expected the pool kept while billing lists the upstream, %d connections closed", n)
+	}
+
+	// Gone from every service: its idle connection is closed
+	bal.SetServiceAddrs("billing", nil)
+	deadline := time.Now().Add(2 * time.Second)
+	for closed.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if closed.Load() != 1 {
+		t.Errorf("Expected the removed upstream's idle connection closed, %d closed", closed.Load())
+	}
+	// A later request to the same host starts a new pool
+	get()
+}
+
+func TestTransportBufferPool(t *testing.T) {
+	pool := proxy.NewBufferPool(1024)
+	buf := pool.Get()
+	if len(buf) != 1024 {
+		t.Fatalf("Expected a 1024-byte buffer, got %d", len(buf))
+	}
+	pool.Put(buf)
+	pool.Put(make([]byte, 10)) // foreign sizes are dropped
+	if got := pool.Get(); len(got) != 1024 {
+		t.Errorf("Expected only 1024-byte buffers handed out, got %d", len(got))
+	}
+
+	// Bodies larger than the buffer are copied through it intact, both ways
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+	addr, _ := startProxy(t, backend.URL, func(p *proxy.HTTPProxy) {
+		p.Transport = proxy.TransportSettings{BufferSize: 1024}
+	})
+
+	body := bytes.Repeat([]byte("charon"), 10000)
+	resp, err := http.Post("http://"+addr+"/echo", "application/octet-stream", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(got, body) {
+		t.Errorf("Expected the %d-byte body echoed, got %d bytes", len(body), len(got))
+	}
+}
+
+// staticBody answers every request with the same body, without a network
+type staticBody []byte
+
+func (b staticBody) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{},
+		Body:          io.NopCloser(bytes.NewReader(b)),
+		ContentLength: int64(len(b)),
+		Request:       req,
+	}, nil
+}
+
+// discardWriter drops the response so only the proxy's own allocations count
+type discardWriter struct{ header http.Header }
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkReverseProxyBuffers compares allocations per proxied request with
+// a fresh copy buffer per request and with pooled buffers
+func BenchmarkReverseProxyBuffers(b *testing.B) {
+	upstream, _ := url.Parse("http://upstream.invalid")
+	body := staticBody(bytes.Repeat([]byte("x"), 64*1024))
+	for _, bc := range []struct {
+		name string
+		pool httputil.BufferPool
+	}{
+		{"unpooled", nil},
+		{"pooled", proxy.NewBufferPool(32 * 1024)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			rp := httputil.NewSingleHostReverseProxy(upstream)
+			rp.Transport = body
+			rp.BufferPool = bc.pool
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			b.ReportAllocs()
+			b.ResetTimer()
+			w := &discardWriter{header: http.Header{}}
+			for i := 0; i < b.N; i++ {
+				clear(w.header)
+				rp.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+func TestTransportDisableKeepAlive(t *testing.T) {
+	var newConns atomic.Int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	rules := []config.RouteRule{
+		{PathPrefix: "/route-off", ServiceName: "pooled", DisableKeepAlive: true},
+		{PathPrefix: "/service-off", ServiceName: "fresh"},
+		{PathPrefix: "/on", ServiceName: "pooled"},
+	}
+	addr, p := startProxy(t, backend.URL, withRoutes(t, rules), func(p *proxy.HTTPProxy) {
+		p.Services = map[string]config.ServiceConfig{"fresh": {DisableKeepAlive: true}}
+	})
+
+	for _, tc := range []struct {
+		path  string
+		conns int32
+	}{
+		{"/on", 1},
+		{"/route-off", 2},
+		{"/service-off", 2},
+	} {
+		t.Run(strings.TrimPrefix(tc.path, "/"), func(t *testing.T) {
+			p.ForgetUpstream(u.Host)
+			newConns.Store(0)
+			for i := 0; i < 2; i++ {
+				resp, err := http.Get("http://" + addr + tc.path)
+				if err != nil {
+					t.Fatalf("GET %s failed: %v", tc.path, err)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			if got := newConns.Load(); got != tc.conns {
+				t.Errorf("Expected the backend to accept %d connections over two requests, got %d", tc.conns, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/0xReLogic/Charon/internal/balancer"
+	"github.com/0xReLogic/Charon/internal/registry"
+)
+
+func TestRegistryWeights(t *testing.T) {
+	path := writeRegistry(t, `services:
+  weighted:
+    - "127.0.0.1:9001|3"
+    - addr: "127.0.0.1:9002"
+      weight: 1
+    - addr: "127.0.0.1:9003"
+      weight: 0
+  plain:
+    - "127.0.0.1:9004"
+`)
+	endpoints, err := registry.ResolveServiceEndpoints(path, "weighted")
+	if err != nil {
+		t.Fatalf("Failed to resolve endpoints: %v", err)
+	}
+	want := []registry.Endpoint{
+		{Addr: "127.0.0.1:9001", Weight: 3, Weighted: true},
+		{Addr: "127.0.0.1:9002", Weight: 1, Weighted: true},
+		{Addr: "127.0.0.1:9003", Weight: 0, Weighted: true},
+	}
+	if len(endpoints) != len(want) {
+		t.Fatalf("Expected %d endpoints, got %v", len(want), endpoints)
+	}
+	for i := range want {
+		if endpoints[i] != want[i] {
+			t.Errorf("Endpoint %d: expected %+v, got %+v", i, want[i], endpoints[i])
+		}
+	}
+
+	// Addresses come back without the weight suffix
+	addrs, err := registry.ResolveServiceAddresses(path, "weighted")
+	if err != nil || addrs[0] != "127.0.0.1:9001" {
+		t.Errorf("Expected plain addresses, got %v (err %v)", addrs, err)
+	}
+	plain, err := registry.ResolveServiceEndpoints(path, "plain")
+	if err != nil || plain[0].Weighted || plain[0].Weight != 1 {
+		t.Errorf("Expected an unweighted endpoint of weight 1, got %+v (err %v)", plain, err)
+	}
+}
+
+func TestRegistryInvalidWeight(t *testing.T) {
+	path := writeRegistry(t, `services:
+  bad:
+    - "127.0.0.1:9005|heavy"
+`)
+	if _, err := registry.ResolveServiceEndpoints(path, "bad"); err == nil {
+		t.Error("Expected an error for a non-numeric weight")
+	}
+}
+
+func TestBalancerWeightedRoundRobin(t *testing.T) {
+	b := balancer.New(balancer.Options{})
+	addrs := []string{"a:1", "b:1", "c:1"}
+	b.SetServiceWeights("svc", map[string]int{"a:1": 3, "b:1": 1, "c:1": 0})
+
+	counts := map[string]int{}
+	var seq []string
+	for i := 0; i < 40; i++ {
+		addr := b.Next("svc", addrs)
+		counts[addr]++
+		seq = append(seq, addr)
+	}
+	if counts["a:1"] != 30 || counts["b:1"] != 10 {
+		t.Errorf("Expected a 3:1 split, got %v", counts)
+	}
+	if counts["c:1"] != 0 {
+		t.Errorf("Weight 0 must drain the upstream, got %d picks", counts["c:1"])
+	}
+	// Smooth WRR interleaves rather than sending bursts to the heavy upstream
+	for i := 0; i+4 <= len(seq); i += 4 {
+		n := 0
+		for _, a := range seq[i : i+4] {
+			if a == "b:1" {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("Expected one b:1 in every 4 picks, got %v", seq[i:i+4])
+		}
+	}
+
+	// Everything drained: nothing to pick
+	b.SetServiceWeights("drained", map[string]int{"a:1": 0})
+	if got := b.Next("drained", []string{"a:1"}); got != "" {
+		t.Errorf("Expected no upstream when all are drained, got %q", got)
+	}
+
+	// Without weights, plain round-robin
+	b.SetServiceWeights("svc", nil)
+	counts = map[string]int{}
+	for i := 0; i < 30; i++ {
+		counts[b.Next("svc", addrs)]++
+	}
+	for _, a := range addrs {
+		if counts[a] != 10 {
+			t.Errorf("Expected an even split without weights, got %v", counts)
+			break
+		}
+	}
+}